@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"os"
 	"os/signal"
 	"strings"
@@ -18,9 +17,12 @@ import (
 	kafkaevents "github.com/sakkurohilla/kineticops/backend/internal/messaging/redpanda"
 	"github.com/sakkurohilla/kineticops/backend/internal/middleware"
 	"github.com/sakkurohilla/kineticops/backend/internal/models"
+	"github.com/sakkurohilla/kineticops/backend/internal/notify"
+	"github.com/sakkurohilla/kineticops/backend/internal/otlp"
 	"github.com/sakkurohilla/kineticops/backend/internal/repository/postgres"
 	redisrepo "github.com/sakkurohilla/kineticops/backend/internal/repository/redis"
 	"github.com/sakkurohilla/kineticops/backend/internal/services"
+	"github.com/sakkurohilla/kineticops/backend/internal/syslog"
 	"github.com/sakkurohilla/kineticops/backend/internal/telemetry"
 	ws "github.com/sakkurohilla/kineticops/backend/internal/websocket"
 	"github.com/sakkurohilla/kineticops/backend/internal/workers"
@@ -76,6 +78,7 @@ func initDBs(cfg *config.Config) {
 			return
 		}
 		models.LogCollection = mongoClient.Database("kineticops").Collection("logs")
+		models.LogPatternCollection = mongoClient.Database("kineticops").Collection("log_patterns")
 		logging.Infof("MongoDB (logs) connected.")
 
 		// Ensure indexes for efficient log search and retention
@@ -107,6 +110,22 @@ func initDBs(cfg *config.Config) {
 				logging.Infof("[INFO] created/ensured compound index on logs")
 			}
 
+			// Indexes for log pattern counts and pattern reload
+			patternIdx := mongo.IndexModel{
+				Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "pattern_id", Value: 1}, {Key: "timestamp", Value: -1}},
+				Options: options.Index().SetName("idx_logs_tenant_pattern_time"),
+			}
+			if _, err := models.LogCollection.Indexes().CreateOne(ctxIdx, patternIdx); err != nil {
+				logging.Warnf("[WARN] failed to create pattern index on logs: %v", err)
+			}
+			patternSeenIdx := mongo.IndexModel{
+				Keys:    bson.D{{Key: "last_seen", Value: -1}},
+				Options: options.Index().SetName("idx_log_patterns_last_seen"),
+			}
+			if _, err := models.LogPatternCollection.Indexes().CreateOne(ctxIdx, patternSeenIdx); err != nil {
+				logging.Warnf("[WARN] failed to create last_seen index on log_patterns: %v", err)
+			}
+
 			// Create TTL index to enforce log retention (30 days by default)
 			ttlIdx := mongo.IndexModel{
 				Keys:    bson.D{{Key: "timestamp", Value: 1}},
@@ -165,6 +184,13 @@ func main() {
 	// START METRIC COLLECTOR WORKER - ADD THIS
 	workers.StartMetricCollector()
 
+	// Start the OTLP/gRPC receiver when OTLP_GRPC_ADDR is configured
+	// (OTLP/HTTP is served on the API port)
+	otlpGRPC := otlp.StartGRPCReceiver(cfg.OTLPGRPCAddr)
+
+	// Start the syslog receiver when SYSLOG_*_ADDR is configured
+	syslogServer := syslog.Start(cfg)
+
 	// Start the metric batcher to improve ingestion throughput. Batches up to 500
 	// metrics or flushes every 5 seconds.
 	services.StartMetricBatcher(500, 5*time.Second)
@@ -173,15 +199,30 @@ func main() {
 	retentionService := services.NewRetentionService(30)
 	retentionService.StartRetentionWorker()
 
-	// Start downsampling service for performance optimization
-	downsamplingService := services.NewDownsamplingService()
-	downsamplingService.StartDownsamplingWorker()
+	// Start metric rollups (Timescale continuous aggregates, or rollup tables
+	// on vanilla Postgres) used by long-range time series queries
+	services.RollupSvc.Start(context.Background())
+
+	// Evaluate tenant log metric rules on ingest (log-derived metrics)
+	services.LogMetricSvc.Start(context.Background())
 
-	// Start alert scheduler worker
-	workers.StartAlertScheduler()
+	// Cluster incoming log messages into patterns
+	services.LogPatternSvc.Start(context.Background())
+
+	// Mail server for email alert channels that do not configure their own
+	notify.SetDefaultSMTP(notify.SMTPServer{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.SMTPFrom,
+		TLS:      cfg.SMTPTLS,
+	})
+	// Tenant channels may only reach internal addresses when allowed
+	notify.AllowPrivateDestinations(cfg.NotifyPrivate)
 
-	// Start metric aggregation service for analytics
-	services.MetricAggregationSvc.StartAggregationWorker(context.Background())
+	// Start the alert engine (policies, conditions, incidents)
+	services.EnhancedAlertSvc.StartScheduler(context.Background())
 
 	// Start trend analysis service
 	go services.TrendAnalysisSvc.StartTrendAnalysisWorker(context.Background())
@@ -189,6 +230,10 @@ func main() {
 	// Start agent health monitoring
 	go services.AgentHealthSvc.CheckOfflineAgents(context.Background())
 
+	// Mark hosts without heartbeats offline (heartbeat alert conditions
+	// watch last_seen directly)
+	go workers.StartHeartbeatMonitor()
+
 	// Start token rotation cleanup
 	go services.TokenRotationSvc.CleanupExpiredTokens(context.Background())
 
@@ -237,6 +282,20 @@ func main() {
 		logging.Infof("Redpanda producer initialized")
 	}
 
+	// Kafka-first ingestion: agent handlers publish to a host-partitioned topic
+	// and the ingest writer consumer group persists events. INGEST_WRITER=false
+	// runs an API-only node that publishes but does not write.
+	if cfg.IngestMode == "kafka" {
+		if err := kafkaevents.InitIngestProducer(brokers, cfg.IngestTopic, cfg.IngestPartitions); err != nil {
+			logging.Warnf("[WARN] ingest producer init failed, agent data will be written synchronously: %v", err)
+		} else {
+			logging.Infof("Kafka-first ingestion enabled (topic=%s)", cfg.IngestTopic)
+		}
+		if cfg.IngestWriter {
+			workers.StartIngestWriter(brokers, cfg.IngestTopic, "kineticops-ingest-writer", 500, time.Second, &handlers.IngestWriter{})
+		}
+	}
+
 	// Start a reingest consumer that listens for failed metric batches and retries insertion
 	workers.StartReingestConsumer(brokers, "metrics-failed", "kineticops-reingest")
 
@@ -264,7 +323,7 @@ func main() {
 			`, h.ID).Scan(&metrics).Error
 
 			if err == nil && len(metrics) > 0 {
-				payload := map[string]interface{}{"host_id": h.ID, "seq": telemetry.NextSeq()}
+				payload := map[string]interface{}{"type": "metric", "seq": telemetry.NextSeq()}
 				var latestTimestamp time.Time
 				for _, m := range metrics {
 					payload[m.Name] = m.Value
@@ -273,20 +332,16 @@ func main() {
 					}
 				}
 				payload["timestamp"] = latestTimestamp.Format(time.RFC3339)
-				if b, err := json.Marshal(payload); err == nil {
-					wsHub.RememberMessage(b)
-					wsHub.Broadcast(b)
-				}
+				ws.PublishEvent(h.TenantID, h.ID, payload)
 			}
 		}
 	}
 
-	// Kafka consumer to process agent events and broadcast to WebSocket clients
+	// Kafka consumer to route agent events to the owning tenant's WebSocket clients
 	kafkaevents.StartConsumer(brokers, topic, func(msg []byte) {
-		logging.Infof("[DEBUG] Processing Kafka message: %s", string(msg))
-		// Broadcast as metric update
-		wsHub.RememberMessage(msg)
-		wsHub.Broadcast(msg)
+		if err := wsHub.PublishRaw(msg); err != nil {
+			logging.Warnf("[KAFKA] dropping unroutable websocket event: %v", err)
+		}
 	})
 
 	// Session service available for session management
@@ -394,6 +449,12 @@ func main() {
 	if err := app.Shutdown(); err != nil {
 		logging.Errorf("Error during server shutdown: %v", err)
 	}
+	if otlpGRPC != nil {
+		otlpGRPC.GracefulStop()
+	}
+	if syslogServer != nil {
+		syslogServer.Stop()
+	}
 
 	// Close database connections
 	if mongoClient != nil {
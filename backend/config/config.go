@@ -23,6 +23,24 @@ type Config struct {
 	AppPort          string
 	JWTSecret        string
 	AgentToken       string
+	OTLPGRPCAddr     string
+	SyslogUDPAddr    string
+	SyslogTCPAddr    string
+	SyslogTLSAddr    string
+	SyslogTLSCert    string
+	SyslogTLSKey     string
+	SyslogTenantID   int64
+	IngestMode       string
+	IngestTopic      string
+	IngestPartitions int
+	IngestWriter     bool
+	SMTPHost         string
+	SMTPPort         int
+	SMTPUsername     string
+	SMTPPassword     string
+	SMTPFrom         string
+	SMTPTLS          string
+	NotifyPrivate    bool
 }
 
 func Load() *Config {
@@ -43,6 +61,12 @@ func Load() *Config {
 	viper.SetDefault("APP_PORT", "8080")
 	viper.SetDefault("POSTGRES_PORT", "5432")
 	viper.SetDefault("REDIS_ADDR", "localhost:6379")
+	viper.SetDefault("INGEST_MODE", "sync")
+	viper.SetDefault("INGEST_TOPIC", "agent-events")
+	viper.SetDefault("INGEST_PARTITIONS", 12)
+	viper.SetDefault("INGEST_WRITER", true)
+	viper.SetDefault("SMTP_PORT", 587)
+	viper.SetDefault("SMTP_FROM", "alerts@kineticops.local")
 
 	return &Config{
 		PostgresHost:     viper.GetString("POSTGRES_HOST"),
@@ -57,6 +81,24 @@ func Load() *Config {
 		AppPort:          viper.GetString("APP_PORT"),
 		JWTSecret:        viper.GetString("JWT_SECRET"),
 		AgentToken:       viper.GetString("AGENT_TOKEN"),
+		OTLPGRPCAddr:     viper.GetString("OTLP_GRPC_ADDR"),
+		SyslogUDPAddr:    viper.GetString("SYSLOG_UDP_ADDR"),
+		SyslogTCPAddr:    viper.GetString("SYSLOG_TCP_ADDR"),
+		SyslogTLSAddr:    viper.GetString("SYSLOG_TLS_ADDR"),
+		SyslogTLSCert:    viper.GetString("SYSLOG_TLS_CERT"),
+		SyslogTLSKey:     viper.GetString("SYSLOG_TLS_KEY"),
+		SyslogTenantID:   viper.GetInt64("SYSLOG_TENANT_ID"),
+		IngestMode:       viper.GetString("INGEST_MODE"),
+		IngestTopic:      viper.GetString("INGEST_TOPIC"),
+		IngestPartitions: viper.GetInt("INGEST_PARTITIONS"),
+		IngestWriter:     viper.GetBool("INGEST_WRITER"),
+		SMTPHost:         viper.GetString("SMTP_HOST"),
+		SMTPPort:         viper.GetInt("SMTP_PORT"),
+		SMTPUsername:     viper.GetString("SMTP_USERNAME"),
+		SMTPPassword:     viper.GetString("SMTP_PASSWORD"),
+		SMTPFrom:         viper.GetString("SMTP_FROM"),
+		SMTPTLS:          viper.GetString("SMTP_TLS"),
+		NotifyPrivate:    viper.GetBool("NOTIFY_ALLOW_PRIVATE"),
 	}
 }
 
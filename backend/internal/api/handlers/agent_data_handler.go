@@ -11,11 +11,14 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/messaging/redpanda"
 	"github.com/sakkurohilla/kineticops/backend/internal/models"
 	"github.com/sakkurohilla/kineticops/backend/internal/repository/postgres"
 	"github.com/sakkurohilla/kineticops/backend/internal/services"
 	"github.com/sakkurohilla/kineticops/backend/internal/telemetry"
 	ws "github.com/sakkurohilla/kineticops/backend/internal/websocket"
+	"github.com/sakkurohilla/kineticops/backend/internal/workers"
+	"github.com/segmentio/kafka-go"
 )
 
 type AgentEvent struct {
@@ -49,9 +52,25 @@ func ReceiveAgentData(c *fiber.Ctx) error {
 		return c.Status(401).JSON(fiber.Map{"error": "Invalid tenant authentication"})
 	}
 
+	// Kafka-first mode: publish validated events for the ingest writer and
+	// acknowledge immediately. Falls back to synchronous processing when the
+	// broker is unavailable so agents keep reporting.
+	if redpanda.IngestEnabled() {
+		accepted, err := publishAgentEvents(payload.Events, tenantID)
+		if err == nil {
+			return c.Status(202).JSON(fiber.Map{
+				"message":  "Events accepted",
+				"accepted": accepted,
+				"total":    len(payload.Events),
+			})
+		}
+		logging.Warnf("[INGEST] publish failed, processing synchronously: %v", err)
+	}
+
 	processedCount := 0
+	now := time.Now().UTC()
 	for _, event := range payload.Events {
-		if processEvent(&event, tenantID) {
+		if ok, _ := processEvent(&event, tenantID, now, services.CollectMetricAt); ok {
 			processedCount++
 		}
 	}
@@ -63,16 +82,99 @@ func ReceiveAgentData(c *fiber.Ctx) error {
 	})
 }
 
-func processEvent(event *AgentEvent, tenantID int64) bool {
+// ingestEnvelope is the record published to the ingest topic for each agent
+// event. The receive time travels with the event so replayed events keep
+// their original timestamps.
+type ingestEnvelope struct {
+	TenantID   int64      `json:"tenant_id"`
+	ReceivedAt time.Time  `json:"received_at"`
+	Event      AgentEvent `json:"event"`
+}
+
+// publishAgentEvents validates events and publishes them to the ingest topic
+// keyed by tenant and hostname, so all events of a host land on the same
+// partition and are written in order. Invalid events are dropped here, as
+// processEvent would.
+func publishAgentEvents(events []AgentEvent, tenantID int64) (int, error) {
+	now := time.Now().UTC()
+	msgs := make([]kafka.Message, 0, len(events))
+	for _, event := range events {
+		hostname, _ := event.Host["hostname"].(string)
+		if len(hostname) < 2 {
+			continue
+		}
+		if event.System == nil && event.Log == nil && event.Message == "" {
+			continue
+		}
+		b, err := json.Marshal(ingestEnvelope{TenantID: tenantID, ReceivedAt: now, Event: event})
+		if err != nil {
+			continue
+		}
+		msgs = append(msgs, kafka.Message{
+			Key:   []byte(strconv.FormatInt(tenantID, 10) + "/" + hostname),
+			Value: b,
+		})
+	}
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+	if err := redpanda.PublishIngest(msgs); err != nil {
+		return 0, err
+	}
+	return len(msgs), nil
+}
+
+// metricSink stores one metric sample, like services.CollectMetricAt.
+type metricSink func(hostID, tenantID int64, name string, value float64, labels map[string]string, ts time.Time) error
+
+// IngestWriter is the ingest writer's sink. Events run the same path as
+// synchronous ingestion, except that their metric samples are buffered for
+// the whole batch and written by Flush with multi-row inserts. Storage
+// failures are returned as workers.ErrIngestRetry so the writer replays the
+// event instead of committing it.
+type IngestWriter struct {
+	metrics services.MetricBuffer
+}
+
+// Handle writes one event consumed from the ingest topic.
+func (w *IngestWriter) Handle(value []byte) error {
+	var env ingestEnvelope
+	if err := json.Unmarshal(value, &env); err != nil {
+		return fmt.Errorf("decode ingest envelope: %w", err)
+	}
+	if env.TenantID == 0 {
+		return fmt.Errorf("ingest envelope without tenant")
+	}
+	if env.ReceivedAt.IsZero() {
+		env.ReceivedAt = time.Now().UTC()
+	}
+	mark := w.metrics.Len()
+	if _, err := processEvent(&env.Event, env.TenantID, env.ReceivedAt, w.metrics.Collect); err != nil {
+		// the event is replayed, so drop the samples it already buffered
+		w.metrics.Truncate(mark)
+		return fmt.Errorf("%w: %v", workers.ErrIngestRetry, err)
+	}
+	return nil
+}
+
+// Flush writes the metric samples buffered by Handle.
+func (w *IngestWriter) Flush() error {
+	return w.metrics.Flush()
+}
+
+// processEvent stores one agent event, sending its metrics to collect. It
+// reports whether the event was processed, and returns storage errors of the
+// host lookup, the host/process metric rows and the log write.
+func processEvent(event *AgentEvent, tenantID int64, now time.Time, collect metricSink) (bool, error) {
 	// Validate required fields
 	hostData := event.Host
 	if hostData == nil {
-		return false
+		return false, nil
 	}
 
 	hostname, _ := hostData["hostname"].(string)
 	if hostname == "" || len(hostname) < 2 {
-		return false
+		return false, nil
 	}
 
 	// Extract all host information
@@ -88,11 +190,10 @@ func processEvent(event *AgentEvent, tenantID int64) bool {
 	host := findOrCreateHost(hostname, primaryIP, os, platform, platformFamily,
 		platformVersion, arch, kernelVersion, virtualization, tenantID)
 	if host == nil {
-		return false
+		return false, fmt.Errorf("find or create host %q failed", hostname)
 	}
 
 	// Update host last seen and status
-	now := time.Now().UTC()
 	if res := postgres.DB.Model(&models.Host{}).Where("id = ?", host.ID).Updates(map[string]interface{}{
 		"last_seen":    now,
 		"agent_status": "online",
@@ -102,25 +203,28 @@ func processEvent(event *AgentEvent, tenantID int64) bool {
 
 	// Process system metrics with validation
 	if event.System != nil {
-		processSystemMetrics(host.ID, host.TenantID, event.System, now)
+		if err := processSystemMetrics(host.ID, host.TenantID, event.System, now, collect); err != nil {
+			return true, err
+		}
 		// Also check for embedded log in the same event
 		if event.Log != nil || event.Message != "" {
-			processAgentLog(event, host.ID, tenantID)
+			if err := processAgentLog(event, host.ID, tenantID); err != nil {
+				return true, err
+			}
 		}
-		return true
+		return true, nil
 	}
 
 	// If this event carried a log but no system block, try to process it
 	if event.Log != nil || event.Message != "" {
-		processAgentLog(event, host.ID, tenantID)
-		return true
+		return true, processAgentLog(event, host.ID, tenantID)
 	}
 
-	return false
+	return false, nil
 }
 
 // processAgentLog converts an AgentEvent carrying a log into models.Log and stores it.
-func processAgentLog(event *AgentEvent, hostID, tenantID int64) {
+func processAgentLog(event *AgentEvent, hostID, tenantID int64) error {
 	// Build log model from various possible fields
 	l := &models.Log{
 		TenantID: tenantID,
@@ -180,20 +284,15 @@ func processAgentLog(event *AgentEvent, hostID, tenantID int64) {
 	// the field is consumed reflectively by downstream code (e.g. JSON/Mongo).
 	_ = l.HostID
 	if err := services.CollectLog(context.Background(), l); err != nil {
-		// don't fail the whole pipeline for logging issues; record and continue
+		// synchronous ingestion records and continues; the ingest writer
+		// replays the event
 		logging.Warnf("failed to persist agent log for host=%d: %v", hostID, err)
-		return
+		return err
 	}
 
-	// Broadcast to websocket clients for real-time tailing
-	payload := map[string]interface{}{"type": "log", "log": l}
-	if b, err := json.Marshal(payload); err == nil {
-		if gh := ws.GetGlobalHub(); gh != nil {
-			gh.RememberMessage(b)
-		}
-		ws.BroadcastToClients(b)
-		telemetry.IncWSBroadcast(context.Background(), 1)
-	}
+	// Deliver to live-tail subscribers of the tenant
+	services.BroadcastLog(l)
+	return nil
 }
 
 func findOrCreateHost(hostname, primaryIP, os, platform, platformFamily,
@@ -203,7 +302,7 @@ func findOrCreateHost(hostname, primaryIP, os, platform, platformFamily,
 	var host models.Host
 
 	// Multi-layer host identification
-	host = findHostByMultipleIdentifiers(hostname, primaryIP, tenantID)
+	host = services.FindHostByIdentifiers(hostname, primaryIP, tenantID)
 	if host.ID != 0 {
 		// Update host information if changed
 		updates := make(map[string]interface{})
@@ -274,44 +373,6 @@ func findOrCreateHost(hostname, primaryIP, os, platform, platformFamily,
 	return &host
 }
 
-// findHostByMultipleIdentifiers implements multi-layer host identification
-func findHostByMultipleIdentifiers(hostname, ip string, tenantID int64) models.Host {
-	var host models.Host
-
-	// 1. PRIMARY: Try by reg_token (most reliable)
-	token := fmt.Sprintf("auto-%d-%s", tenantID, hostname)
-	err := postgres.DB.Where("reg_token LIKE ? AND tenant_id = ?", token+"%", tenantID).First(&host).Error
-	if err == nil {
-		return host
-	}
-
-	// 2. SECONDARY: Try by IP + tenant (network stable)
-	if ip != "" {
-		err = postgres.DB.Where("ip = ? AND tenant_id = ?", ip, tenantID).First(&host).Error
-		if err == nil {
-			return host
-		}
-	}
-
-	// 3. FALLBACK: Try by hostname + tenant (legacy support)
-	if hostname != "" {
-		err = postgres.DB.Where("hostname = ? AND tenant_id = ?", hostname, tenantID).First(&host).Error
-		if err == nil {
-			return host
-		}
-	}
-
-	// 4. LAST RESORT: Try by hostname pattern matching (for renamed hosts)
-	if hostname != "" {
-		err = postgres.DB.Where("hostname LIKE ? AND tenant_id = ?", hostname+"%", tenantID).First(&host).Error
-		if err == nil {
-			return host
-		}
-	}
-
-	return models.Host{} // Not found
-}
-
 // extractTenantID extracts tenant ID from request headers or token
 func extractTenantID(c *fiber.Ctx) int64 {
 	// Try to get from X-Tenant-ID header
@@ -335,7 +396,7 @@ func extractTenantID(c *fiber.Ctx) int64 {
 	return 2
 }
 
-func processSystemMetrics(hostID, tenantID int64, system map[string]interface{}, timestamp time.Time) {
+func processSystemMetrics(hostID, tenantID int64, system map[string]interface{}, timestamp time.Time, collect metricSink) error {
 	metric := &models.HostMetric{Timestamp: timestamp}
 
 	// CPU metrics with validation
@@ -344,7 +405,7 @@ func processSystemMetrics(hostID, tenantID int64, system map[string]interface{},
 			if pct, ok := total["pct"].(float64); ok && pct >= 0 && pct <= 100 {
 				metric.CPUUsage = pct
 				logging.Infof("[METRICS] CPU for host=%d: usage=%.2f%%", hostID, metric.CPUUsage)
-				if err := services.CollectMetric(hostID, tenantID, "cpu_usage", metric.CPUUsage, nil); err != nil {
+				if err := collect(hostID, tenantID, "cpu_usage", metric.CPUUsage, nil, timestamp); err != nil {
 					logging.Errorf("CollectMetric(cpu_usage) failed host=%d: %v", hostID, err)
 				}
 			}
@@ -451,22 +512,22 @@ func processSystemMetrics(hostID, tenantID int64, system map[string]interface{},
 		if metric.MemoryUsage >= 0 {
 			logging.Infof("[METRICS] Memory for host=%d: usage=%.2f%%, total=%.2fMB, used=%.2fMB, free=%.2fMB",
 				hostID, metric.MemoryUsage, metric.MemoryTotal, metric.MemoryUsed, metric.MemoryFree)
-			if err := services.CollectMetric(hostID, tenantID, "memory_usage", metric.MemoryUsage, nil); err != nil {
+			if err := collect(hostID, tenantID, "memory_usage", metric.MemoryUsage, nil, timestamp); err != nil {
 				logging.Errorf("CollectMetric(memory_usage) failed host=%d: %v", hostID, err)
 			}
 		}
 		if metric.MemoryTotal > 0 {
-			if err := services.CollectMetric(hostID, tenantID, "memory_total", metric.MemoryTotal, nil); err != nil {
+			if err := collect(hostID, tenantID, "memory_total", metric.MemoryTotal, nil, timestamp); err != nil {
 				logging.Errorf("CollectMetric(memory_total) failed host=%d: %v", hostID, err)
 			}
 		}
 		if metric.MemoryUsed > 0 {
-			if err := services.CollectMetric(hostID, tenantID, "memory_used", metric.MemoryUsed, nil); err != nil {
+			if err := collect(hostID, tenantID, "memory_used", metric.MemoryUsed, nil, timestamp); err != nil {
 				logging.Errorf("CollectMetric(memory_used) failed host=%d: %v", hostID, err)
 			}
 		}
 		if metric.MemoryFree > 0 {
-			if err := services.CollectMetric(hostID, tenantID, "memory_free", metric.MemoryFree, nil); err != nil {
+			if err := collect(hostID, tenantID, "memory_free", metric.MemoryFree, nil, timestamp); err != nil {
 				logging.Errorf("CollectMetric(memory_free) failed host=%d: %v", hostID, err)
 			}
 		}
@@ -481,7 +542,7 @@ func processSystemMetrics(hostID, tenantID int64, system map[string]interface{},
 		// Skip if not root filesystem
 		if mountPoint != "/" {
 			logging.Infof("Skipping filesystem %s mounted at %s", deviceName, mountPoint)
-			return
+			return nil
 		}
 
 		logging.Infof("Processing root filesystem %s mounted at %s", deviceName, mountPoint)
@@ -509,17 +570,17 @@ func processSystemMetrics(hostID, tenantID int64, system map[string]interface{},
 			if usedBytes > 0 && totalBytes > 0 {
 				serverPct := (usedBytes / totalBytes) * 100.0
 				metric.DiskUsage = serverPct
-				if err := services.CollectMetric(hostID, tenantID, "disk_usage", metric.DiskUsage, nil); err != nil {
+				if err := collect(hostID, tenantID, "disk_usage", metric.DiskUsage, nil, timestamp); err != nil {
 					logging.Errorf("CollectMetric(disk_usage) failed host=%d: %v", hostID, err)
 				}
 				// Store disk_total and disk_used in GB
 				if metric.DiskTotal > 0 {
-					if err := services.CollectMetric(hostID, tenantID, "disk_total", metric.DiskTotal, nil); err != nil {
+					if err := collect(hostID, tenantID, "disk_total", metric.DiskTotal, nil, timestamp); err != nil {
 						logging.Errorf("CollectMetric(disk_total) failed host=%d: %v", hostID, err)
 					}
 				}
 				if metric.DiskUsed > 0 {
-					if err := services.CollectMetric(hostID, tenantID, "disk_used", metric.DiskUsed, nil); err != nil {
+					if err := collect(hostID, tenantID, "disk_used", metric.DiskUsed, nil, timestamp); err != nil {
 						logging.Errorf("CollectMetric(disk_used) failed host=%d: %v", hostID, err)
 					}
 				}
@@ -546,7 +607,7 @@ func processSystemMetrics(hostID, tenantID int64, system map[string]interface{},
 						agentPctPercent = agentPctVal
 					}
 					metric.DiskUsage = agentPctPercent
-					if err := services.CollectMetric(hostID, tenantID, "disk_usage", metric.DiskUsage, nil); err != nil {
+					if err := collect(hostID, tenantID, "disk_usage", metric.DiskUsage, nil, timestamp); err != nil {
 						logging.Errorf("CollectMetric(disk_usage) failed host=%d: %v", hostID, err)
 					}
 					logging.Infof("Root disk usage (agent pct) for %s mounted at %s: %.2f%%", deviceName, mountPoint, metric.DiskUsage)
@@ -578,19 +639,19 @@ func processSystemMetrics(hostID, tenantID int64, system map[string]interface{},
 
 		// Store network metrics as time-series for historical analysis
 		if networkInBytes > 0 {
-			if err := services.CollectMetric(hostID, tenantID, "network_in_bytes", networkInBytes, nil); err != nil {
+			if err := collect(hostID, tenantID, "network_in_bytes", networkInBytes, nil, timestamp); err != nil {
 				logging.Errorf("CollectMetric(network_in_bytes) failed host=%d: %v", hostID, err)
 			}
 		}
 		if networkOutBytes > 0 {
-			if err := services.CollectMetric(hostID, tenantID, "network_out_bytes", networkOutBytes, nil); err != nil {
+			if err := collect(hostID, tenantID, "network_out_bytes", networkOutBytes, nil, timestamp); err != nil {
 				logging.Errorf("CollectMetric(network_out_bytes) failed host=%d: %v", hostID, err)
 			}
 		}
 		// Combined network throughput metric
 		totalNetworkBytes := networkInBytes + networkOutBytes
 		if totalNetworkBytes > 0 {
-			if err := services.CollectMetric(hostID, tenantID, "network_bytes", totalNetworkBytes, nil); err != nil {
+			if err := collect(hostID, tenantID, "network_bytes", totalNetworkBytes, nil, timestamp); err != nil {
 				logging.Errorf("CollectMetric(network_bytes) failed host=%d: %v", hostID, err)
 			}
 		}
@@ -602,28 +663,28 @@ func processSystemMetrics(hostID, tenantID int64, system map[string]interface{},
 
 		if readBytes, ok := diskio["read_bytes"].(float64); ok && readBytes >= 0 {
 			metric.DiskReadBytes = readBytes
-			if err := services.CollectMetric(hostID, tenantID, "disk_read_bytes", readBytes, nil); err != nil {
+			if err := collect(hostID, tenantID, "disk_read_bytes", readBytes, nil, timestamp); err != nil {
 				logging.Errorf("CollectMetric(disk_read_bytes) failed host=%d: %v", hostID, err)
 			}
 		}
 
 		if writeBytes, ok := diskio["write_bytes"].(float64); ok && writeBytes >= 0 {
 			metric.DiskWriteBytes = writeBytes
-			if err := services.CollectMetric(hostID, tenantID, "disk_write_bytes", writeBytes, nil); err != nil {
+			if err := collect(hostID, tenantID, "disk_write_bytes", writeBytes, nil, timestamp); err != nil {
 				logging.Errorf("CollectMetric(disk_write_bytes) failed host=%d: %v", hostID, err)
 			}
 		}
 
 		if readSpeed, ok := diskio["read_speed"].(float64); ok && readSpeed >= 0 {
 			metric.DiskReadSpeed = readSpeed
-			if err := services.CollectMetric(hostID, tenantID, "disk_read_speed", readSpeed, nil); err != nil {
+			if err := collect(hostID, tenantID, "disk_read_speed", readSpeed, nil, timestamp); err != nil {
 				logging.Errorf("CollectMetric(disk_read_speed) failed host=%d: %v", hostID, err)
 			}
 		}
 
 		if writeSpeed, ok := diskio["write_speed"].(float64); ok && writeSpeed >= 0 {
 			metric.DiskWriteSpeed = writeSpeed
-			if err := services.CollectMetric(hostID, tenantID, "disk_write_speed", writeSpeed, nil); err != nil {
+			if err := collect(hostID, tenantID, "disk_write_speed", writeSpeed, nil, timestamp); err != nil {
 				logging.Errorf("CollectMetric(disk_write_speed) failed host=%d: %v", hostID, err)
 			}
 		}
@@ -642,13 +703,13 @@ func processSystemMetrics(hostID, tenantID int64, system map[string]interface{},
 					metric.LoadAverage = fmt.Sprintf("%.2f %.2f %.2f", load1, load5, load15)
 
 					// Store load average metrics for time-series analysis
-					if err := services.CollectMetric(hostID, tenantID, "load_1min", load1, nil); err != nil {
+					if err := collect(hostID, tenantID, "load_1min", load1, nil, timestamp); err != nil {
 						logging.Errorf("CollectMetric(load_1min) failed host=%d: %v", hostID, err)
 					}
-					if err := services.CollectMetric(hostID, tenantID, "load_5min", load5, nil); err != nil {
+					if err := collect(hostID, tenantID, "load_5min", load5, nil, timestamp); err != nil {
 						logging.Errorf("CollectMetric(load_5min) failed host=%d: %v", hostID, err)
 					}
-					if err := services.CollectMetric(hostID, tenantID, "load_15min", load15, nil); err != nil {
+					if err := collect(hostID, tenantID, "load_15min", load15, nil, timestamp); err != nil {
 						logging.Errorf("CollectMetric(load_15min) failed host=%d: %v", hostID, err)
 					}
 				}
@@ -684,7 +745,7 @@ func processSystemMetrics(hostID, tenantID int64, system map[string]interface{},
 
 		// Store uptime as a metric for historical tracking
 		if metric.Uptime > 0 {
-			if err := services.CollectMetric(hostID, tenantID, "uptime_seconds", float64(metric.Uptime), nil); err != nil {
+			if err := collect(hostID, tenantID, "uptime_seconds", float64(metric.Uptime), nil, timestamp); err != nil {
 				logging.Errorf("CollectMetric(uptime_seconds) failed host=%d: %v", hostID, err)
 			}
 		}
@@ -735,12 +796,13 @@ func processSystemMetrics(hostID, tenantID int64, system map[string]interface{},
 					err := postgres.DB.Exec(`
 						INSERT INTO process_metrics (host_id, tenant_id, pid, name, username, cpu_percent, 
 							memory_percent, memory_rss, status, num_threads, create_time, timestamp)
-						VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW())
+						VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 					`, hostID, tenantID, pid, name, username, cpuPercent, memoryPercent,
-						int64(memoryRSS), status, int(numThreads), int64(createTime)).Error
+						int64(memoryRSS), status, int(numThreads), int64(createTime), timestamp).Error
 
 					if err != nil {
 						logging.Errorf("[PROCESSES] Failed to insert process metric: %v", err)
+						return fmt.Errorf("insert process metric: %w", err)
 					}
 				}
 			}
@@ -765,11 +827,11 @@ func processSystemMetrics(hostID, tenantID int64, system map[string]interface{},
 			network_in, network_out, uptime, load_average, timestamp FROM host_metrics WHERE host_id = ?`, hostID).Scan(&prev).Error
 		if err != nil {
 			logging.Warnf("[METRICS] Placeholder frame host=%d and no previous metrics found (err=%v) - suppress broadcast", hostID, err)
-			return
+			return nil
 		}
 		if prev.Timestamp.IsZero() {
 			logging.Warnf("[METRICS] Placeholder frame host=%d and previous metrics empty - suppress broadcast", hostID)
-			return
+			return nil
 		}
 		logging.Infof("[METRICS] Placeholder frame host=%d - broadcasting last known metrics instead", hostID)
 		payload := map[string]interface{}{
@@ -795,14 +857,9 @@ func processSystemMetrics(hostID, tenantID int64, system map[string]interface{},
 			"timestamp":        prev.Timestamp.UTC().Format(time.RFC3339),
 			"fallback":         true,
 		}
-		if b, jerr := json.Marshal(payload); jerr == nil {
-			if gh := ws.GetGlobalHub(); gh != nil {
-				gh.RememberMessage(b)
-			}
-			ws.BroadcastToClients(b)
-			telemetry.IncWSBroadcast(context.Background(), 1)
-		}
-		return
+		ws.PublishEvent(tenantID, hostID, payload)
+		telemetry.IncWSBroadcast(context.Background(), 1)
+		return nil
 	} else {
 		// Store in host_metrics table as time-series data (INSERT each collection)
 		if err := services.SaveHostMetrics(&services.HostMetric{
@@ -825,6 +882,7 @@ func processSystemMetrics(hostID, tenantID int64, system map[string]interface{},
 			LoadAverage:    metric.LoadAverage,
 		}); err != nil {
 			logging.Errorf("Failed to store host metrics for host %d: %v", hostID, err)
+			return fmt.Errorf("store host metrics: %w", err)
 		}
 
 		// Broadcast the updated metrics to websocket clients for realtime dashboard updates
@@ -850,13 +908,8 @@ func processSystemMetrics(hostID, tenantID int64, system map[string]interface{},
 			"load_average":     metric.LoadAverage,
 			"timestamp":        metric.Timestamp.UTC().Format(time.RFC3339),
 		}
-		if b, jerr := json.Marshal(payload); jerr == nil {
-			if gh := ws.GetGlobalHub(); gh != nil {
-				gh.RememberMessage(b)
-			}
-			ws.BroadcastToClients(b)
-			telemetry.IncWSBroadcast(context.Background(), 1)
-		}
+		ws.PublishEvent(tenantID, hostID, payload)
+		telemetry.IncWSBroadcast(context.Background(), 1)
 
 	} // end non-placeholder else block
 
@@ -868,13 +921,8 @@ func processSystemMetrics(hostID, tenantID int64, system map[string]interface{},
 			"processes": processesData,
 			"timestamp": time.Now().UTC().Format(time.RFC3339),
 		}
-		if pb, perr := json.Marshal(processPayload); perr == nil {
-			if gh := ws.GetGlobalHub(); gh != nil {
-				gh.RememberMessage(pb)
-			}
-			ws.BroadcastToClients(pb)
-			telemetry.IncWSBroadcast(context.Background(), 1)
-		}
+		ws.PublishEvent(tenantID, hostID, processPayload)
+		telemetry.IncWSBroadcast(context.Background(), 1)
 	}
 
 	// Broadcast service metrics if available
@@ -887,15 +935,9 @@ func processSystemMetrics(hostID, tenantID int64, system map[string]interface{},
 			"seq":       uint64(time.Now().UnixNano()),
 			"timestamp": time.Now().UTC().Format(time.RFC3339),
 		}
-		if sb, serr := json.Marshal(servicePayload); serr == nil {
-			logging.Infof("[SERVICES] Broadcasting services data for host=%d", hostID)
-			if gh := ws.GetGlobalHub(); gh != nil {
-				gh.RememberMessage(sb)
-			}
-			ws.BroadcastToClients(sb)
-			telemetry.IncWSBroadcast(context.Background(), 1)
-		} else {
-			logging.Errorf("[SERVICES] Failed to marshal services payload: %v", serr)
-		}
+		logging.Infof("[SERVICES] Broadcasting services data for host=%d", hostID)
+		ws.PublishEvent(tenantID, hostID, servicePayload)
+		telemetry.IncWSBroadcast(context.Background(), 1)
 	}
+	return nil
 }
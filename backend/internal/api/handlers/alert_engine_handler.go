@@ -0,0 +1,884 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/services"
+)
+
+// Alert engine API: conditions, notification channels, policies (which link
+// conditions to channels) and the incidents they open.
+
+type AlertConditionRequest struct {
+	Name             string  `json:"name"`
+	Description      string  `json:"description"`
+	Type             string  `json:"type"`
+	Query            string  `json:"query"`
+	Threshold        float64 `json:"threshold"`
+	Operator         string  `json:"operator"`
+	Sensitivity      float64 `json:"sensitivity"`
+	Direction        string  `json:"direction"`
+	Seasonality      string  `json:"seasonality"`
+	Horizon          int     `json:"horizon"`
+	ForecastMethod   string  `json:"forecast_method"`
+	HostID           *int64  `json:"host_id"`
+	HostGroup        string  `json:"host_group"`
+	Timeout          int     `json:"timeout"`
+	Expression       string  `json:"expression"`
+	Correlation      string  `json:"correlation"`
+	Duration         int     `json:"duration"`
+	RecoveryDuration int     `json:"recovery_duration"`
+	NoDataTimeout    int     `json:"no_data_timeout"`
+	Severity         string  `json:"severity"`
+	Enabled          *bool   `json:"enabled"`
+}
+
+// apply copies the request onto condition; Enabled defaults to true.
+func (r *AlertConditionRequest) apply(condition *services.AlertCondition) {
+	condition.Name = r.Name
+	condition.Description = r.Description
+	condition.Type = r.Type
+	condition.Query = r.Query
+	condition.Threshold = r.Threshold
+	condition.Operator = r.Operator
+	condition.Sensitivity = r.Sensitivity
+	condition.Direction = r.Direction
+	condition.Seasonality = r.Seasonality
+	condition.Horizon = r.Horizon
+	condition.ForecastMethod = r.ForecastMethod
+	condition.HostID = r.HostID
+	condition.HostGroup = r.HostGroup
+	condition.Timeout = r.Timeout
+	condition.Expression = r.Expression
+	condition.Correlation = r.Correlation
+	condition.Duration = r.Duration
+	condition.RecoveryDuration = r.RecoveryDuration
+	condition.NoDataTimeout = r.NoDataTimeout
+	condition.Severity = r.Severity
+	condition.Enabled = r.Enabled == nil || *r.Enabled
+}
+
+type AlertChannelRequest struct {
+	Name    string          `json:"name"`
+	Type    string          `json:"type"`
+	Config  json.RawMessage `json:"config"`
+	Enabled *bool           `json:"enabled"`
+}
+
+func (r *AlertChannelRequest) apply(channel *services.AlertChannel) {
+	channel.Name = r.Name
+	channel.Type = r.Type
+	channel.Config = string(r.Config)
+	channel.Enabled = r.Enabled == nil || *r.Enabled
+}
+
+// AlertPolicyRequest sets the policy's conditions and channels; omitted id
+// lists leave the current links unchanged on update, as does an omitted
+// escalation_policy_id (0 removes it).
+type AlertPolicyRequest struct {
+	Name               string   `json:"name"`
+	Description        string   `json:"description"`
+	Enabled            *bool    `json:"enabled"`
+	ConditionIDs       *[]int64 `json:"condition_ids"`
+	ChannelIDs         *[]int64 `json:"channel_ids"`
+	EscalationPolicyID *int64   `json:"escalation_policy_id"`
+}
+
+func (r *AlertPolicyRequest) apply(policy *services.AlertPolicy) {
+	policy.Name = r.Name
+	policy.Description = r.Description
+	policy.Enabled = r.Enabled == nil || *r.Enabled
+	if r.ConditionIDs != nil {
+		policy.ConditionIDs = *r.ConditionIDs
+	}
+	if r.ChannelIDs != nil {
+		policy.ChannelIDs = *r.ChannelIDs
+	}
+	if r.EscalationPolicyID != nil {
+		policy.EscalationPolicyID = r.EscalationPolicyID
+		if *r.EscalationPolicyID == 0 {
+			policy.EscalationPolicyID = nil
+		}
+	}
+}
+
+type AlertEscalationPolicyRequest struct {
+	Name           string                         `json:"name"`
+	Description    string                         `json:"description"`
+	Tiers          []services.AlertEscalationTier `json:"tiers"`
+	RepeatInterval int                            `json:"repeat_interval"`
+	MaxRepeats     int                            `json:"max_repeats"`
+}
+
+func (r *AlertEscalationPolicyRequest) apply(policy *services.AlertEscalationPolicy) {
+	policy.Name = r.Name
+	policy.Description = r.Description
+	policy.Tiers = r.Tiers
+	policy.RepeatInterval = r.RepeatInterval
+	policy.MaxRepeats = r.MaxRepeats
+}
+
+func ListAlertConditions(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	conditions, err := services.EnhancedAlertSvc.GetConditions(tid.(int64))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot list alert conditions"})
+	}
+	return c.JSON(conditions)
+}
+
+func GetAlertCondition(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	condition, err := services.EnhancedAlertSvc.GetCondition(id, tid.(int64))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Alert condition not found"})
+	}
+	return c.JSON(condition)
+}
+
+// CreateAlertCondition defines a condition, e.g.
+// {"name":"High CPU","query":"SELECT max(cpu_usage) FROM metrics SINCE 5 minutes ago","operator":"above","threshold":90},
+// or an anomaly condition, e.g. {"name":"Unusual traffic","type":"anomaly",
+// "query":"SELECT avg(network_in) FROM metrics FACET host SINCE 5 minutes ago",
+// "sensitivity":3,"direction":"up","seasonality":"hour_of_day","duration":10}.
+// Conditions are evaluated once they belong to an enabled policy.
+func CreateAlertCondition(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	var req AlertConditionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+	condition := &services.AlertCondition{TenantID: tid.(int64), CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	req.apply(condition)
+	if err := services.ValidateCondition(condition); err != nil {
+		return alertConfigError(c, err, "alert condition")
+	}
+	if err := services.EnhancedAlertSvc.CreateCondition(condition); err != nil {
+		return alertConfigError(c, err, "alert condition")
+	}
+	return c.Status(201).JSON(condition)
+}
+
+func UpdateAlertCondition(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	condition, err := services.EnhancedAlertSvc.GetCondition(id, tid.(int64))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Alert condition not found"})
+	}
+	var req AlertConditionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+	req.apply(condition)
+	if err := services.ValidateCondition(condition); err != nil {
+		return alertConfigError(c, err, "alert condition")
+	}
+	if err := services.EnhancedAlertSvc.UpdateCondition(condition); err != nil {
+		return alertConfigError(c, err, "alert condition")
+	}
+	return c.JSON(condition)
+}
+
+func DeleteAlertCondition(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err := services.EnhancedAlertSvc.DeleteCondition(id, tid.(int64)); err != nil {
+		var ce *services.AlertConfigError
+		if errors.As(err, &ce) {
+			return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot delete alert condition"})
+	}
+	return c.JSON(fiber.Map{"message": "Alert condition deleted"})
+}
+
+// ListAlertConditionStates returns the state of each series of a condition.
+func ListAlertConditionStates(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	states, err := services.EnhancedAlertSvc.GetSeriesStates(id, tid.(int64))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot list alert states"})
+	}
+	return c.JSON(states)
+}
+
+// ListAlertConditionTransitions returns the newest state transitions of a
+// condition (?limit=, default 100, at most 1000).
+func ListAlertConditionTransitions(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	limit := c.QueryInt("limit", 100)
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	transitions, err := services.EnhancedAlertSvc.GetStateTransitions(id, tid.(int64), limit)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot list alert transitions"})
+	}
+	return c.JSON(transitions)
+}
+
+func ListAlertChannels(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	channels, err := services.EnhancedAlertSvc.GetChannels(tid.(int64))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot list alert channels"})
+	}
+	return c.JSON(channels)
+}
+
+func GetAlertChannel(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	channel, err := services.EnhancedAlertSvc.GetChannel(id, tid.(int64))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Alert channel not found"})
+	}
+	return c.JSON(channel)
+}
+
+// CreateAlertChannel defines a notification channel, e.g.
+// {"name":"Ops Slack","type":"slack","config":{"webhook_url":"https://hooks.slack.com/..."}}.
+func CreateAlertChannel(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	var req AlertChannelRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+	channel := &services.AlertChannel{TenantID: tid.(int64), CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	req.apply(channel)
+	if err := services.ValidateChannel(channel); err != nil {
+		return alertConfigError(c, err, "alert channel")
+	}
+	if err := services.EnhancedAlertSvc.CreateChannel(channel); err != nil {
+		return alertConfigError(c, err, "alert channel")
+	}
+	return c.Status(201).JSON(channel)
+}
+
+func UpdateAlertChannel(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	channel, err := services.EnhancedAlertSvc.GetChannel(id, tid.(int64))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Alert channel not found"})
+	}
+	var req AlertChannelRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+	req.apply(channel)
+	if err := services.ValidateChannel(channel); err != nil {
+		return alertConfigError(c, err, "alert channel")
+	}
+	if err := services.EnhancedAlertSvc.UpdateChannel(channel); err != nil {
+		return alertConfigError(c, err, "alert channel")
+	}
+	return c.JSON(channel)
+}
+
+func DeleteAlertChannel(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err := services.EnhancedAlertSvc.DeleteChannel(id, tid.(int64)); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot delete alert channel"})
+	}
+	return c.JSON(fiber.Map{"message": "Alert channel deleted"})
+}
+
+func ListAlertPolicies(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	policies, err := services.EnhancedAlertSvc.GetPolicies(tid.(int64))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot list alert policies"})
+	}
+	return c.JSON(policies)
+}
+
+func GetAlertPolicy(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	policy, err := services.EnhancedAlertSvc.GetPolicy(id, tid.(int64))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Alert policy not found"})
+	}
+	return c.JSON(policy)
+}
+
+// CreateAlertPolicy groups conditions and the channels they notify, e.g.
+// {"name":"Production","condition_ids":[1,2],"channel_ids":[3]}.
+func CreateAlertPolicy(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	var req AlertPolicyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+	policy := &services.AlertPolicy{TenantID: tid.(int64), CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	req.apply(policy)
+	if err := services.ValidatePolicy(policy); err != nil {
+		return alertConfigError(c, err, "alert policy")
+	}
+	if err := services.EnhancedAlertSvc.CreatePolicy(policy); err != nil {
+		return alertConfigError(c, err, "alert policy")
+	}
+	return c.Status(201).JSON(policy)
+}
+
+func UpdateAlertPolicy(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	policy, err := services.EnhancedAlertSvc.GetPolicy(id, tid.(int64))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Alert policy not found"})
+	}
+	var req AlertPolicyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+	req.apply(policy)
+	if err := services.ValidatePolicy(policy); err != nil {
+		return alertConfigError(c, err, "alert policy")
+	}
+	if err := services.EnhancedAlertSvc.UpdatePolicy(policy); err != nil {
+		return alertConfigError(c, err, "alert policy")
+	}
+	return c.JSON(policy)
+}
+
+func DeleteAlertPolicy(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err := services.EnhancedAlertSvc.DeletePolicy(id, tid.(int64)); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot delete alert policy"})
+	}
+	return c.JSON(fiber.Map{"message": "Alert policy deleted"})
+}
+
+func ListAlertEscalationPolicies(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	policies, err := services.EnhancedAlertSvc.GetEscalationPolicies(tid.(int64))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot list escalation policies"})
+	}
+	return c.JSON(policies)
+}
+
+func GetAlertEscalationPolicy(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	policy, err := services.EnhancedAlertSvc.GetEscalationPolicy(id, tid.(int64))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Escalation policy not found"})
+	}
+	return c.JSON(policy)
+}
+
+// CreateAlertEscalationPolicy defines timed notification tiers for
+// unacknowledged incidents, e.g. {"name":"On-call","tiers":[{"delay":0,
+// "channel_ids":[3]},{"delay":15,"user_ids":[1]}],"repeat_interval":30}.
+func CreateAlertEscalationPolicy(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	var req AlertEscalationPolicyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+	policy := &services.AlertEscalationPolicy{TenantID: tid.(int64), CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	req.apply(policy)
+	if err := services.ValidateEscalationPolicy(policy); err != nil {
+		return alertConfigError(c, err, "escalation policy")
+	}
+	if err := services.EnhancedAlertSvc.CreateEscalationPolicy(policy); err != nil {
+		return alertConfigError(c, err, "escalation policy")
+	}
+	return c.Status(201).JSON(policy)
+}
+
+func UpdateAlertEscalationPolicy(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	policy, err := services.EnhancedAlertSvc.GetEscalationPolicy(id, tid.(int64))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Escalation policy not found"})
+	}
+	var req AlertEscalationPolicyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+	req.apply(policy)
+	if err := services.ValidateEscalationPolicy(policy); err != nil {
+		return alertConfigError(c, err, "escalation policy")
+	}
+	if err := services.EnhancedAlertSvc.UpdateEscalationPolicy(policy); err != nil {
+		return alertConfigError(c, err, "escalation policy")
+	}
+	return c.JSON(policy)
+}
+
+func DeleteAlertEscalationPolicy(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err := services.EnhancedAlertSvc.DeleteEscalationPolicy(id, tid.(int64)); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot delete escalation policy"})
+	}
+	return c.JSON(fiber.Map{"message": "Escalation policy deleted"})
+}
+
+type AlertSilenceRequest struct {
+	Matchers []services.AlertMatcher `json:"matchers"`
+	StartsAt time.Time               `json:"starts_at"`
+	EndsAt   time.Time               `json:"ends_at"`
+	Comment  string                  `json:"comment"`
+}
+
+func (r *AlertSilenceRequest) apply(silence *services.AlertSilence) {
+	silence.Matchers = r.Matchers
+	silence.StartsAt = r.StartsAt
+	silence.EndsAt = r.EndsAt
+	silence.Comment = r.Comment
+}
+
+type AlertMaintenanceWindowRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	HostGroup   string `json:"host_group"`
+	Schedule    string `json:"schedule"`
+	Duration    int    `json:"duration"`
+	Timezone    string `json:"timezone"`
+	Enabled     *bool  `json:"enabled"`
+}
+
+func (r *AlertMaintenanceWindowRequest) apply(window *services.AlertMaintenanceWindow) {
+	window.Name = r.Name
+	window.Description = r.Description
+	window.HostGroup = r.HostGroup
+	window.Schedule = r.Schedule
+	window.Duration = r.Duration
+	window.Timezone = r.Timezone
+	window.Enabled = r.Enabled == nil || *r.Enabled
+}
+
+// ListAlertSilences returns the silences, or only the active ones with
+// ?active=true.
+func ListAlertSilences(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	silences, err := services.EnhancedAlertSvc.GetSilences(tid.(int64), c.QueryBool("active"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot list silences"})
+	}
+	return c.JSON(silences)
+}
+
+func GetAlertSilence(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	silence, err := services.EnhancedAlertSvc.GetSilence(id, tid.(int64))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Silence not found"})
+	}
+	return c.JSON(silence)
+}
+
+// CreateAlertSilence mutes matching incidents for a time span, e.g.
+// {"matchers":[{"name":"host","value":"db-1"},{"name":"metric","value":"disk_.*","regex":true}],
+// "ends_at":"2025-01-01T06:00:00Z","comment":"disk replacement"}. starts_at
+// defaults to now.
+func CreateAlertSilence(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	var req AlertSilenceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+	silence := &services.AlertSilence{TenantID: tid.(int64), CreatedAt: time.Now()}
+	if username, ok := c.Locals("username").(string); ok {
+		silence.CreatedBy = username
+	}
+	req.apply(silence)
+	if err := services.ValidateSilence(silence); err != nil {
+		return alertConfigError(c, err, "silence")
+	}
+	if err := services.EnhancedAlertSvc.CreateSilence(silence); err != nil {
+		return alertConfigError(c, err, "silence")
+	}
+	return c.Status(201).JSON(silence)
+}
+
+func UpdateAlertSilence(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	silence, err := services.EnhancedAlertSvc.GetSilence(id, tid.(int64))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Silence not found"})
+	}
+	var req AlertSilenceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+	req.apply(silence)
+	if err := services.ValidateSilence(silence); err != nil {
+		return alertConfigError(c, err, "silence")
+	}
+	if err := services.EnhancedAlertSvc.UpdateSilence(silence); err != nil {
+		return alertConfigError(c, err, "silence")
+	}
+	return c.JSON(silence)
+}
+
+// ExpireAlertSilence ends a silence now, keeping it for the record.
+func ExpireAlertSilence(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err := services.EnhancedAlertSvc.ExpireSilence(id, tid.(int64)); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot expire silence"})
+	}
+	return c.JSON(fiber.Map{"message": "Silence expired"})
+}
+
+func DeleteAlertSilence(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err := services.EnhancedAlertSvc.DeleteSilence(id, tid.(int64)); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot delete silence"})
+	}
+	return c.JSON(fiber.Map{"message": "Silence deleted"})
+}
+
+func ListAlertMaintenanceWindows(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	windows, err := services.EnhancedAlertSvc.GetMaintenanceWindows(tid.(int64))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot list maintenance windows"})
+	}
+	return c.JSON(windows)
+}
+
+func GetAlertMaintenanceWindow(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	window, err := services.EnhancedAlertSvc.GetMaintenanceWindow(id, tid.(int64))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Maintenance window not found"})
+	}
+	return c.JSON(window)
+}
+
+// CreateAlertMaintenanceWindow defines a recurring window muting a host
+// group, e.g. {"name":"Sunday patching","host_group":"web",
+// "schedule":"0 2 * * sun","duration":120,"timezone":"Europe/Berlin"}.
+func CreateAlertMaintenanceWindow(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	var req AlertMaintenanceWindowRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+	window := &services.AlertMaintenanceWindow{TenantID: tid.(int64), CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	req.apply(window)
+	if err := services.ValidateMaintenanceWindow(window); err != nil {
+		return alertConfigError(c, err, "maintenance window")
+	}
+	if err := services.EnhancedAlertSvc.CreateMaintenanceWindow(window); err != nil {
+		return alertConfigError(c, err, "maintenance window")
+	}
+	return c.Status(201).JSON(window)
+}
+
+func UpdateAlertMaintenanceWindow(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	window, err := services.EnhancedAlertSvc.GetMaintenanceWindow(id, tid.(int64))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Maintenance window not found"})
+	}
+	var req AlertMaintenanceWindowRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+	req.apply(window)
+	if err := services.ValidateMaintenanceWindow(window); err != nil {
+		return alertConfigError(c, err, "maintenance window")
+	}
+	if err := services.EnhancedAlertSvc.UpdateMaintenanceWindow(window); err != nil {
+		return alertConfigError(c, err, "maintenance window")
+	}
+	return c.JSON(window)
+}
+
+func DeleteAlertMaintenanceWindow(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err := services.EnhancedAlertSvc.DeleteMaintenanceWindow(id, tid.(int64)); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot delete maintenance window"})
+	}
+	return c.JSON(fiber.Map{"message": "Maintenance window deleted"})
+}
+
+// GetAlertRoutingTree returns the tenant's routing tree, or null when
+// incidents notify their policy's channels.
+func GetAlertRoutingTree(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	tree, err := services.EnhancedAlertSvc.GetRoutingTree(tid.(int64))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot load routing tree"})
+	}
+	return c.JSON(tree)
+}
+
+// PutAlertRoutingTree replaces the tenant's routing tree, e.g.
+// {"root":{"channel_ids":[1],"group_by":["condition","group"],"group_wait":30,
+// "routes":[{"matchers":[{"name":"severity","value":"critical"}],"channel_ids":[2]}]}}.
+func PutAlertRoutingTree(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	var tree services.AlertRoutingTree
+	if err := c.BodyParser(&tree); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+	tree.TenantID = tid.(int64)
+	if err := services.ValidateRoutingTree(&tree); err != nil {
+		return alertConfigError(c, err, "routing tree")
+	}
+	if err := services.EnhancedAlertSvc.SaveRoutingTree(&tree); err != nil {
+		return alertConfigError(c, err, "routing tree")
+	}
+	return c.JSON(tree)
+}
+
+func DeleteAlertRoutingTree(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	if err := services.EnhancedAlertSvc.DeleteRoutingTree(tid.(int64)); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot delete routing tree"})
+	}
+	return c.JSON(fiber.Map{"message": "Routing tree deleted"})
+}
+
+// ListAlertNotificationGroups returns the pending notification groups and
+// their incidents.
+func ListAlertNotificationGroups(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	groups, err := services.EnhancedAlertSvc.GetNotificationGroups(tid.(int64))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot list notification groups"})
+	}
+	return c.JSON(groups)
+}
+
+// ListAlertIncidents returns the newest incidents, optionally filtered by
+// ?status=open|acknowledged|closed and ?suppressed=true|false.
+func ListAlertIncidents(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	var suppressed *bool
+	if v, err := strconv.ParseBool(c.Query("suppressed")); err == nil {
+		suppressed = &v
+	}
+	incidents, err := services.EnhancedAlertSvc.GetIncidents(tid.(int64), c.Query("status"), suppressed)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot list alert incidents"})
+	}
+	return c.JSON(incidents)
+}
+
+func GetAlertIncident(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	incident, err := services.EnhancedAlertSvc.GetIncident(id, tid.(int64))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Alert incident not found"})
+	}
+	return c.JSON(incident)
+}
+
+func AcknowledgeAlertIncident(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := services.EnhancedAlertSvc.GetIncident(id, tid.(int64)); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Alert incident not found"})
+	}
+	ackedBy, _ := c.Locals("username").(string)
+	if err := services.EnhancedAlertSvc.AcknowledgeIncident(id, tid.(int64), ackedBy); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot acknowledge alert incident"})
+	}
+	incident, _ := services.EnhancedAlertSvc.GetIncident(id, tid.(int64))
+	return c.JSON(incident)
+}
+
+func CloseAlertIncident(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := services.EnhancedAlertSvc.GetIncident(id, tid.(int64)); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Alert incident not found"})
+	}
+	if err := services.EnhancedAlertSvc.CloseIncident(id, tid.(int64)); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot close alert incident"})
+	}
+	incident, _ := services.EnhancedAlertSvc.GetIncident(id, tid.(int64))
+	return c.JSON(incident)
+}
+
+// ListAlertIncidentDeliveries returns the notification delivery log of an
+// incident.
+func ListAlertIncidentDeliveries(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	deliveries, err := services.EnhancedAlertSvc.GetIncidentDeliveries(id, tid.(int64))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot list notification deliveries"})
+	}
+	return c.JSON(deliveries)
+}
+
+// ListRelatedAlertIncidents returns the child incidents linked to an
+// incident of a composite condition.
+func ListRelatedAlertIncidents(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	incidents, err := services.EnhancedAlertSvc.GetRelatedIncidents(id, tid.(int64))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot list related incidents"})
+	}
+	return c.JSON(incidents)
+}
+
+// alertConfigError maps invalid definitions to 400 and anything else to 500.
+func alertConfigError(c *fiber.Ctx, err error, what string) error {
+	var ce *services.AlertConfigError
+	if errors.As(err, &ce) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	logging.Errorf("[ALERTS] save %s: %v", what, err)
+	return c.Status(500).JSON(fiber.Map{"error": "Cannot save " + what})
+}
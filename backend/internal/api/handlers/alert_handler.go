@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"errors"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/sakkurohilla/kineticops/backend/internal/logquery"
 	"github.com/sakkurohilla/kineticops/backend/internal/models"
-	"github.com/sakkurohilla/kineticops/backend/internal/repository/postgres"
 	"github.com/sakkurohilla/kineticops/backend/internal/services"
 )
 
@@ -40,7 +43,7 @@ func CreateAlertRule(c *fiber.Ctx) error {
 		CreatedAt:           time.Now(),
 	}
 	if err := services.CreateAlertRule(rule); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Cannot create alert rule"})
+		return alertConfigError(c, err, "alert rule")
 	}
 	return c.Status(201).JSON(rule)
 }
@@ -57,106 +60,150 @@ func ListAlertRules(c *fiber.Ctx) error {
 	return c.JSON(rules)
 }
 
+// ListAlerts lists the tenant's alert incidents in the legacy alert shape.
+// Filters: status and severity (comma separated), search and start_time
+// (RFC 3339), limit.
 func ListAlerts(c *fiber.Ctx) error {
 	tid := c.Locals("tenant_id")
 	if tid == nil {
 		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
 	}
-	var alerts []models.Alert
-	err := postgres.DB.Where("tenant_id = ?", tid.(int64)).Order("triggered_at desc").Find(&alerts).Error
+	filter := services.LegacyAlertFilter{
+		Statuses:   splitList(c.Query("status")),
+		Severities: splitList(c.Query("severity")),
+		Search:     strings.TrimSpace(c.Query("search")),
+		Limit:      c.QueryInt("limit"),
+	}
+	if v := c.Query("start_time"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid start_time"})
+		}
+		filter.Since = since
+	}
+	alerts, err := services.ListLegacyAlerts(tid.(int64), filter)
 	if err != nil {
+		var ce *services.AlertConfigError
+		if errors.As(err, &ce) {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(500).JSON(fiber.Map{"error": "Cannot list alerts"})
 	}
 	return c.JSON(alerts)
 }
 
-// UpdateAlert updates an alert's fields (used for silencing/ack)
+// UpdateAlert changes the status of an alert incident: {"status":
+// "acknowledged"} acknowledges it, {"status": "silenced", "duration": "1h"}
+// silences it and {"status": "resolved"} closes it.
 func UpdateAlert(c *fiber.Ctx) error {
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+	switch strings.ToLower(req.Status) {
+	case "acknowledged":
+		return AcknowledgeAlert(c)
+	case "silenced":
+		return SilenceAlert(c)
+	case "resolved", "closed":
+		return ResolveAlert(c)
+	}
+	return c.Status(400).JSON(fiber.Map{"error": "Unsupported alert status"})
+}
+
+// AcknowledgeAlert acknowledges an alert incident, which stops its
+// escalation.
+func AcknowledgeAlert(c *fiber.Ctx) error {
 	tid := c.Locals("tenant_id")
 	if tid == nil {
 		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
 	}
-
-	idParam := c.Params("id")
-	if idParam == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "Missing id"})
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := services.EnhancedAlertSvc.GetIncident(id, tid.(int64)); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
 	}
-
-	var fields map[string]interface{}
-	if err := c.BodyParser(&fields); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	ackedBy, _ := c.Locals("username").(string)
+	if err := services.EnhancedAlertSvc.AcknowledgeIncident(id, tid.(int64), ackedBy); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot acknowledge alert"})
 	}
+	alert, _ := services.GetLegacyAlert(id, tid.(int64))
+	return c.JSON(alert)
+}
 
-	// Ensure tenant+ownership: load alert first
-	var alert models.Alert
-	if err := postgres.DB.Where("id = ? AND tenant_id = ?", idParam, tid.(int64)).First(&alert).Error; err != nil {
+// SilenceAlert silences the series of an alert incident for the body's
+// duration (default 1h).
+func SilenceAlert(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	var req struct {
+		Duration string `json:"duration"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+		}
+	}
+	if req.Duration == "" {
+		req.Duration = "1h"
+	}
+	d, err := logquery.ParseDuration(req.Duration)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid duration: " + err.Error()})
+	}
+	if _, err := services.EnhancedAlertSvc.GetIncident(id, tid.(int64)); err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
 	}
-
-	if err := postgres.DB.Model(&models.Alert{}).Where("id = ?", alert.ID).Updates(fields).Error; err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Cannot update alert"})
+	createdBy, _ := c.Locals("username").(string)
+	silence, err := services.EnhancedAlertSvc.SilenceIncident(id, tid.(int64), d, createdBy)
+	if err != nil {
+		return alertConfigError(c, err, "silence")
 	}
-
-	return c.JSON(fiber.Map{"msg": "alert updated"})
+	alert, _ := services.GetLegacyAlert(id, tid.(int64))
+	return c.JSON(fiber.Map{"alert": alert, "silence": silence})
 }
 
-// You can add other handlers: trigger alert manually, list alerts, ack/close alerts, etc.
+// ResolveAlert closes an alert incident.
+func ResolveAlert(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := services.EnhancedAlertSvc.GetIncident(id, tid.(int64)); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
+	}
+	if err := services.EnhancedAlertSvc.CloseIncident(id, tid.(int64)); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot resolve alert"})
+	}
+	alert, _ := services.GetLegacyAlert(id, tid.(int64))
+	return c.JSON(alert)
+}
 
 // GetAlertStats returns alert statistics for dashboard
 func GetAlertStats(c *fiber.Ctx) error {
 	tid := c.Locals("tenant_id")
 	if tid == nil {
-		// For now, return public stats when no auth
-		var stats = struct {
-			Total        int64 `json:"total"`
-			Open         int64 `json:"open"`
-			Acknowledged int64 `json:"acknowledged"`
-			Silenced     int64 `json:"silenced"`
-			Resolved     int64 `json:"resolved"`
-			Critical     int64 `json:"critical"`
-			High         int64 `json:"high"`
-			Medium       int64 `json:"medium"`
-			Low          int64 `json:"low"`
-		}{
-			Total:        0,
-			Open:         0,
-			Acknowledged: 0,
-			Silenced:     0,
-			Resolved:     0,
-			Critical:     0,
-			High:         0,
-			Medium:       0,
-			Low:          0,
-		}
-		return c.JSON(stats)
+		// No tenant, nothing to count
+		return c.JSON(services.LegacyAlertStats{})
 	}
-
-	tenantID := tid.(int64)
-
-	var stats struct {
-		Total        int64 `json:"total"`
-		Open         int64 `json:"open"`
-		Acknowledged int64 `json:"acknowledged"`
-		Silenced     int64 `json:"silenced"`
-		Resolved     int64 `json:"resolved"`
-		Critical     int64 `json:"critical"`
-		High         int64 `json:"high"`
-		Medium       int64 `json:"medium"`
-		Low          int64 `json:"low"`
+	stats, err := services.GetLegacyAlertStats(tid.(int64))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot load alert stats"})
 	}
-
-	// Count from existing alerts table
-	postgres.DB.Model(&models.Alert{}).Where("tenant_id = ?", tenantID).Count(&stats.Total)
-	postgres.DB.Model(&models.Alert{}).Where("tenant_id = ? AND is_resolved = false", tenantID).Count(&stats.Open)
-
-	// For now, return basic stats - enhance later when you have more alert data
-	stats.Resolved = stats.Total - stats.Open
-	stats.Acknowledged = 0
-	stats.Silenced = 0
-	stats.Critical = 0
-	stats.High = 0
-	stats.Medium = 0
-	stats.Low = 0
-
 	return c.JSON(stats)
 }
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
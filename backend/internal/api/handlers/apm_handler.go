@@ -0,0 +1,490 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/models"
+	"github.com/sakkurohilla/kineticops/backend/internal/services"
+)
+
+var apmService *services.APMService
+
+func InitAPMService() {
+	apmService = services.NewAPMService()
+}
+
+// apmTimeRange reads start/end (RFC3339) query params, defaulting to the
+// last hour.
+func apmTimeRange(c *fiber.Ctx) (time.Time, time.Time) {
+	start, _ := time.Parse(time.RFC3339, c.Query("start", time.Now().Add(-1*time.Hour).Format(time.RFC3339)))
+	end, _ := time.Parse(time.RFC3339, c.Query("end", time.Now().Format(time.RFC3339)))
+	return start, end
+}
+
+// parseAPMBatch accepts either a single JSON object or an array of objects so
+// agents can batch ingest calls.
+func parseAPMBatch[T any](c *fiber.Ctx) ([]T, error) {
+	body := strings.TrimSpace(string(c.Body()))
+	var items []T
+	if strings.HasPrefix(body, "[") {
+		err := json.Unmarshal([]byte(body), &items)
+		return items, err
+	}
+	var item T
+	if err := json.Unmarshal([]byte(body), &item); err != nil {
+		return nil, err
+	}
+	return []T{item}, nil
+}
+
+// apmOwnsApplications verifies every referenced application belongs to the
+// tenant so an ingest token cannot write into another tenant's data.
+func apmOwnsApplications(tenantID int64, appIDs []int64) bool {
+	seen := make(map[int64]bool)
+	for _, id := range appIDs {
+		if seen[id] {
+			continue
+		}
+		if _, err := apmService.GetApplication(id, tenantID); err != nil {
+			return false
+		}
+		seen[id] = true
+	}
+	return true
+}
+
+// Ingest (agent-token auth)
+
+func IngestAPMApplication(c *fiber.Ctx) error {
+	identity, ok := c.Locals("ingest_identity").(*services.IngestIdentity)
+	if !ok || identity == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+
+	var app models.Application
+	if err := c.BodyParser(&app); err != nil || app.Name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+	app.ID = 0
+	app.TenantID = identity.TenantID
+	if app.HostID == 0 {
+		app.HostID = identity.HostID
+	}
+	if host, err := services.GetHostByID(app.HostID, identity.TenantID); err != nil || host == nil || host.TenantID != identity.TenantID {
+		return c.Status(400).JSON(fiber.Map{"error": "Unknown host_id"})
+	}
+	if app.Status == "" {
+		app.Status = "active"
+	}
+
+	if err := apmService.EnsureApplication(&app); err != nil {
+		logging.Errorf("[APM] ensure application %s tenant=%d: %v", app.Name, identity.TenantID, err)
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot register application"})
+	}
+	return c.Status(201).JSON(app)
+}
+
+func IngestAPMTransactions(c *fiber.Ctx) error {
+	tenantID, ok := c.Locals("tenant_id").(int64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	items, err := parseAPMBatch[models.Transaction](c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+
+	appIDs := make([]int64, 0, len(items))
+	for _, it := range items {
+		appIDs = append(appIDs, it.ApplicationID)
+	}
+	if !apmOwnsApplications(tenantID, appIDs) {
+		return c.Status(403).JSON(fiber.Map{"error": "Unknown application"})
+	}
+
+	for i := range items {
+		items[i].ID = 0
+		items[i].TenantID = tenantID
+		if items[i].Timestamp.IsZero() {
+			items[i].Timestamp = time.Now()
+		}
+		if err := apmService.RecordTransaction(&items[i]); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Cannot record transaction"})
+		}
+	}
+	return c.Status(201).JSON(fiber.Map{"ingested": len(items)})
+}
+
+func IngestAPMSpans(c *fiber.Ctx) error {
+	tenantID, ok := c.Locals("tenant_id").(int64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	items, err := parseAPMBatch[models.Span](c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+
+	appIDs := make([]int64, 0, len(items))
+	traceIDs := make(map[string]struct{})
+	for i := range items {
+		if items[i].TraceID == "" || items[i].SpanID == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "trace_id and span_id are required"})
+		}
+		items[i].ID = 0
+		items[i].TenantID = tenantID
+		if items[i].Duration == 0 && !items[i].EndTime.IsZero() {
+			items[i].Duration = float64(items[i].EndTime.Sub(items[i].StartTime).Microseconds()) / 1000
+		}
+		appIDs = append(appIDs, items[i].ApplicationID)
+		traceIDs[items[i].TraceID] = struct{}{}
+	}
+	if !apmOwnsApplications(tenantID, appIDs) {
+		return c.Status(403).JSON(fiber.Map{"error": "Unknown application"})
+	}
+
+	if err := apmService.AddSpans(items); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot record spans"})
+	}
+	for traceID := range traceIDs {
+		if err := apmService.RefreshTrace(tenantID, traceID); err != nil {
+			logging.Warnf("[APM] failed to refresh trace %s tenant=%d: %v", traceID, tenantID, err)
+		}
+	}
+	return c.Status(201).JSON(fiber.Map{"ingested": len(items)})
+}
+
+func IngestAPMErrors(c *fiber.Ctx) error {
+	tenantID, ok := c.Locals("tenant_id").(int64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	items, err := parseAPMBatch[models.ErrorEvent](c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+
+	appIDs := make([]int64, 0, len(items))
+	for _, it := range items {
+		appIDs = append(appIDs, it.ApplicationID)
+	}
+	if !apmOwnsApplications(tenantID, appIDs) {
+		return c.Status(403).JSON(fiber.Map{"error": "Unknown application"})
+	}
+
+	for i := range items {
+		items[i].ID = 0
+		items[i].TenantID = tenantID
+		items[i].Count = 1
+		items[i].Resolved = false
+		if items[i].Timestamp.IsZero() {
+			items[i].Timestamp = time.Now()
+		}
+		if items[i].Fingerprint == "" {
+			items[i].Fingerprint = services.GenerateErrorFingerprint(items[i].ErrorClass, items[i].ErrorMessage)
+		}
+		if err := apmService.RecordError(&items[i]); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Cannot record error"})
+		}
+	}
+	return c.Status(201).JSON(fiber.Map{"ingested": len(items)})
+}
+
+func IngestAPMDatabaseQueries(c *fiber.Ctx) error {
+	tenantID, ok := c.Locals("tenant_id").(int64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	items, err := parseAPMBatch[models.DatabaseQuery](c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+
+	appIDs := make([]int64, 0, len(items))
+	for _, it := range items {
+		appIDs = append(appIDs, it.ApplicationID)
+	}
+	if !apmOwnsApplications(tenantID, appIDs) {
+		return c.Status(403).JSON(fiber.Map{"error": "Unknown application"})
+	}
+
+	for i := range items {
+		items[i].ID = 0
+		items[i].TenantID = tenantID
+		if items[i].Timestamp.IsZero() {
+			items[i].Timestamp = time.Now()
+		}
+		if err := apmService.RecordDatabaseQuery(&items[i]); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Cannot record query"})
+		}
+	}
+	return c.Status(201).JSON(fiber.Map{"ingested": len(items)})
+}
+
+func IngestAPMExternalServices(c *fiber.Ctx) error {
+	tenantID, ok := c.Locals("tenant_id").(int64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	items, err := parseAPMBatch[models.ExternalService](c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+
+	appIDs := make([]int64, 0, len(items))
+	for _, it := range items {
+		appIDs = append(appIDs, it.ApplicationID)
+	}
+	if !apmOwnsApplications(tenantID, appIDs) {
+		return c.Status(403).JSON(fiber.Map{"error": "Unknown application"})
+	}
+
+	for i := range items {
+		items[i].ID = 0
+		items[i].TenantID = tenantID
+		if items[i].Timestamp.IsZero() {
+			items[i].Timestamp = time.Now()
+		}
+		if err := apmService.RecordExternalService(&items[i]); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Cannot record external call"})
+		}
+	}
+	return c.Status(201).JSON(fiber.Map{"ingested": len(items)})
+}
+
+func IngestAPMCustomEvents(c *fiber.Ctx) error {
+	tenantID, ok := c.Locals("tenant_id").(int64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	items, err := parseAPMBatch[models.CustomEvent](c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+
+	appIDs := make([]int64, 0, len(items))
+	for _, it := range items {
+		appIDs = append(appIDs, it.ApplicationID)
+	}
+	if !apmOwnsApplications(tenantID, appIDs) {
+		return c.Status(403).JSON(fiber.Map{"error": "Unknown application"})
+	}
+
+	for i := range items {
+		items[i].ID = 0
+		items[i].TenantID = tenantID
+		if items[i].Timestamp.IsZero() {
+			items[i].Timestamp = time.Now()
+		}
+		if err := apmService.RecordCustomEvent(&items[i]); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Cannot record event"})
+		}
+	}
+	return c.Status(201).JSON(fiber.Map{"ingested": len(items)})
+}
+
+// Queries (JWT auth, tenant-scoped)
+
+func GetAPMApplications(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+
+	apps, err := apmService.GetApplications(tid.(int64))
+	if err != nil {
+		return c.JSON([]models.Application{})
+	}
+	return c.JSON(apps)
+}
+
+func GetAPMApplicationOverview(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	app, err := apmService.GetApplication(id, tid.(int64))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Application not found"})
+	}
+
+	start, end := apmTimeRange(c)
+	overview, err := apmService.GetApplicationOverview(id, tid.(int64), start, end)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch overview"})
+	}
+	overview["application"] = app
+	return c.JSON(overview)
+}
+
+func GetAPMTransactions(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	limit, _ := strconv.Atoi(c.Query("limit", "100"))
+	start, end := apmTimeRange(c)
+
+	transactions, err := apmService.GetTransactions(id, tid.(int64), start, end, limit)
+	if err != nil {
+		return c.JSON([]models.Transaction{})
+	}
+	return c.JSON(transactions)
+}
+
+func GetAPMTransactionStats(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	start, end := apmTimeRange(c)
+
+	stats, err := apmService.GetTransactionStats(id, tid.(int64), start, end)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch stats"})
+	}
+	return c.JSON(stats)
+}
+
+func GetAPMTraces(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	limit, _ := strconv.Atoi(c.Query("limit", "100"))
+	start, end := apmTimeRange(c)
+
+	traces, err := apmService.GetTraces(id, tid.(int64), start, end, limit)
+	if err != nil {
+		return c.JSON([]models.Trace{})
+	}
+	return c.JSON(traces)
+}
+
+// GetAPMTrace returns a trace with its spans nested into a tree.
+func GetAPMTrace(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+
+	trace, spans, err := apmService.GetTrace(c.Params("traceId"), tid.(int64))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Trace not found"})
+	}
+
+	return c.JSON(fiber.Map{
+		"trace": trace,
+		"spans": services.BuildSpanTree(spans),
+	})
+}
+
+func GetAPMErrors(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	limit, _ := strconv.Atoi(c.Query("limit", "100"))
+	start, end := apmTimeRange(c)
+
+	errs, err := apmService.GetErrors(id, tid.(int64), start, end, limit)
+	if err != nil {
+		return c.JSON([]models.ErrorEvent{})
+	}
+	return c.JSON(errs)
+}
+
+func GetAPMErrorStats(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	start, end := apmTimeRange(c)
+
+	stats, err := apmService.GetErrorStats(id, tid.(int64), start, end)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch stats"})
+	}
+	return c.JSON(stats)
+}
+
+func ResolveAPMError(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err := apmService.ResolveError(id, tid.(int64)); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Error group not found"})
+	}
+	return c.JSON(fiber.Map{"message": "Error resolved"})
+}
+
+func GetAPMSlowQueries(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	threshold, _ := strconv.ParseFloat(c.Query("threshold", "100"), 64)
+	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+	start, end := apmTimeRange(c)
+
+	queries, err := apmService.GetSlowQueries(id, tid.(int64), threshold, start, end, limit)
+	if err != nil {
+		return c.JSON([]models.DatabaseQuery{})
+	}
+	return c.JSON(queries)
+}
+
+func GetAPMExternalServices(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	start, end := apmTimeRange(c)
+
+	breakdown, err := apmService.GetExternalServiceBreakdown(id, tid.(int64), start, end)
+	if err != nil {
+		return c.JSON([]services.ExternalServiceBreakdown{})
+	}
+	return c.JSON(breakdown)
+}
+
+func GetAPMCustomEvents(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	limit, _ := strconv.Atoi(c.Query("limit", "100"))
+	start, end := apmTimeRange(c)
+
+	events, err := apmService.GetCustomEvents(id, tid.(int64), c.Query("type"), start, end, limit)
+	if err != nil {
+		return c.JSON([]models.CustomEvent{})
+	}
+	return c.JSON(events)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/services"
+)
+
+// InfluxWriteV1 accepts InfluxDB 1.x /write requests (line protocol). The db
+// and rp parameters are accepted but ignored; ?precision= selects the
+// timestamp unit (n, u, ms, s, m, h).
+func InfluxWriteV1(c *fiber.Ctx) error {
+	return influxWrite(c, c.Query("precision"), func(status int, msg string) error {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	})
+}
+
+// InfluxWriteV2 accepts InfluxDB 2.x /api/v2/write requests (line protocol).
+// org and bucket are accepted but ignored; ?precision= is ns, us, ms or s.
+func InfluxWriteV2(c *fiber.Ctx) error {
+	return influxWrite(c, c.Query("precision"), func(status int, msg string) error {
+		code := "invalid"
+		switch status {
+		case fiber.StatusUnauthorized:
+			code = "unauthorized"
+		case fiber.StatusTooManyRequests:
+			code = "too many requests"
+		case fiber.StatusInternalServerError:
+			code = "internal error"
+		}
+		return c.Status(status).JSON(fiber.Map{"code": code, "message": msg})
+	})
+}
+
+// influxWrite parses and stores a line protocol body. Like InfluxDB, valid
+// lines of a partially bad batch are written and the first error is reported
+// with 400 so clients do not retry the whole batch.
+func influxWrite(c *fiber.Ctx, precision string, fail func(int, string) error) error {
+	identity, ok := c.Locals("ingest_identity").(*services.IngestIdentity)
+	if !ok || identity == nil {
+		return fail(fiber.StatusUnauthorized, "Unauthenticated")
+	}
+
+	if services.MetricBatcherSaturated() {
+		c.Set(fiber.HeaderRetryAfter, "1")
+		return fail(fiber.StatusTooManyRequests, "ingestion overloaded")
+	}
+
+	body := c.Body()
+	if strings.EqualFold(c.Get(fiber.HeaderContentEncoding), "gzip") {
+		unzipped, err := c.Request().BodyGunzip()
+		if err != nil {
+			return fail(fiber.StatusBadRequest, "invalid gzip body")
+		}
+		body = unzipped
+	}
+
+	points, lineErrs, err := services.ParseLineProtocol(body, precision)
+	if err != nil {
+		return fail(fiber.StatusBadRequest, err.Error())
+	}
+
+	stored, dropped, err := services.IngestInfluxPoints(identity, points)
+	if err != nil {
+		logging.Errorf("[INFLUX] write tenant=%d: %v", identity.TenantID, err)
+		return fail(fiber.StatusInternalServerError, "ingest failed")
+	}
+	if dropped > 0 || len(lineErrs) > 0 {
+		logging.Warnf("[INFLUX] write tenant=%d stored=%d dropped=%d bad_lines=%d", identity.TenantID, stored, dropped, len(lineErrs))
+	}
+	if len(lineErrs) > 0 {
+		return fail(fiber.StatusBadRequest, "partial write: "+lineErrs[0].Error())
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
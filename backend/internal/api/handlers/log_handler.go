@@ -2,15 +2,16 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/sakkurohilla/kineticops/backend/internal/logquery"
 	"github.com/sakkurohilla/kineticops/backend/internal/models"
+	"github.com/sakkurohilla/kineticops/backend/internal/repository/mongodb"
 	"github.com/sakkurohilla/kineticops/backend/internal/services"
-	"github.com/sakkurohilla/kineticops/backend/internal/telemetry"
-	ws "github.com/sakkurohilla/kineticops/backend/internal/websocket"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 type CollectLogRequest struct {
@@ -47,20 +48,8 @@ func CollectLog(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": "Cannot store log"})
 	}
 
-	// Broadcast new log to connected websocket clients (realtime tail)
-	// Wrap with a small envelope so frontend can easily filter by type
-	payload := map[string]interface{}{
-		"type": "log",
-		"log":  log,
-	}
-	if b, err := json.Marshal(payload); err == nil {
-		// Best-effort: remember message for new clients and broadcast
-		if gh := ws.GetGlobalHub(); gh != nil {
-			gh.RememberMessage(b)
-		}
-		ws.BroadcastToClients(b)
-		telemetry.IncWSBroadcast(context.Background(), 1)
-	}
+	// Deliver to live-tail subscribers of the tenant
+	services.BroadcastLog(log)
 	return c.Status(201).JSON(fiber.Map{"msg": "Log stored"})
 }
 
@@ -94,6 +83,14 @@ func SearchLogs(c *fiber.Ctx) error {
 			"$lte": end,
 		}
 	}
+	// q is a Lucene-style log query (see package logquery)
+	if q := c.Query("q"); q != "" {
+		compiled, err := logquery.CompileString(q, time.Now())
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		filters["$and"] = []interface{}{compiled}
+	}
 	text := c.Query("search")
 	limit, _ := strconv.Atoi(c.Query("limit"))
 	skip, _ := strconv.Atoi(c.Query("skip"))
@@ -152,3 +149,192 @@ func TriggerLogRetention(c *fiber.Ctx) error {
 	}
 	return c.JSON(fiber.Map{"msg": "Retention started", "days": days})
 }
+
+// logAggregationInput reads the parameters shared by the log aggregation
+// endpoints: q (log query), and either start/end (RFC 3339) or range
+// (e.g. 15m, 24h, 7d; default 1h).
+func logAggregationInput(c *fiber.Ctx) (bson.M, time.Time, time.Time, error) {
+	end := time.Now()
+	start := end.Add(-time.Hour)
+	if s, e := c.Query("start"), c.Query("end"); s != "" || e != "" {
+		var err1, err2 error
+		start, err1 = time.Parse(time.RFC3339, s)
+		end, err2 = time.Parse(time.RFC3339, e)
+		if err1 != nil || err2 != nil || !start.Before(end) {
+			return nil, start, end, fmt.Errorf("start and end must be RFC 3339 times with start before end")
+		}
+	} else if r := c.Query("range"); r != "" {
+		d, err := logquery.ParseDuration(r)
+		if err != nil {
+			return nil, start, end, err
+		}
+		start = end.Add(-d)
+	}
+
+	filter, err := logquery.CompileString(c.Query("q"), end)
+	if err != nil {
+		return nil, start, end, err
+	}
+	return filter, start, end, nil
+}
+
+// LogHistogram counts matching logs over time, per level.
+// GET /api/v1/logs/histogram?q=service:api&range=24h&interval=1h
+func LogHistogram(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	filter, start, end, err := logAggregationInput(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	interval := services.LogHistogramInterval(start, end)
+	if iv := c.Query("interval"); iv != "" && iv != "auto" {
+		if interval, err = logquery.ParseDuration(iv); err != nil || interval < time.Second {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid interval"})
+		}
+		if end.Sub(start)/interval > services.MaxLogHistogramBuckets {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("too many buckets (max %d); use a larger interval", services.MaxLogHistogramBuckets)})
+		}
+	}
+
+	buckets, err := services.LogHistogram(context.Background(), tid.(int64), filter, start, end, interval)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot aggregate logs"})
+	}
+	if buckets == nil {
+		buckets = []mongodb.LogHistogramBucket{}
+	}
+	return c.JSON(fiber.Map{"start": start, "end": end, "interval_seconds": int64(interval / time.Second), "buckets": buckets})
+}
+
+// TopLogValues returns the most frequent values of a field among matching
+// logs. GET /api/v1/logs/top?field=service&q=level:error&limit=10
+func TopLogValues(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	field, err := logquery.ResolveField(c.Query("field"))
+	if err != nil || field == "timestamp" {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid field"})
+	}
+	filter, start, end, err := logAggregationInput(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	values, err := services.TopLogValues(context.Background(), tid.(int64), filter, field, start, end, logAggregationLimit(c))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot aggregate logs"})
+	}
+	return c.JSON(fiber.Map{"field": field, "start": start, "end": end, "values": values})
+}
+
+// LogErrorRates returns the share of error-level logs per service (or per
+// value of field). GET /api/v1/logs/error-rate?range=1h
+func LogErrorRates(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	field, err := logquery.ResolveField(c.Query("field", "service"))
+	if err != nil || field == "timestamp" {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid field"})
+	}
+	filter, start, end, err := logAggregationInput(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	rates, err := services.LogErrorRates(context.Background(), tid.(int64), filter, field, start, end, logAggregationLimit(c))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot aggregate logs"})
+	}
+	return c.JSON(fiber.Map{"field": field, "start": start, "end": end, "rates": rates})
+}
+
+func logAggregationLimit(c *fiber.Ctx) int {
+	limit := c.QueryInt("limit", 10)
+	if limit <= 0 || limit > 100 {
+		limit = 10
+	}
+	return limit
+}
+
+// ListLogPatterns returns the message patterns of matching logs in the last
+// window, flagged as new or spiking against the baseline before it.
+// GET /api/v1/logs/patterns?q=service:api&window=15m&baseline=24h&flagged=true
+func ListLogPatterns(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	window, err := logquery.ParseDuration(c.Query("window", "15m"))
+	if err != nil || window < time.Minute {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid window"})
+	}
+	baseline, err := logquery.ParseDuration(c.Query("baseline", "24h"))
+	if err != nil || baseline < window || baseline > 30*24*time.Hour {
+		return c.Status(400).JSON(fiber.Map{"error": "baseline must be between window and 30d"})
+	}
+	filter, err := logquery.CompileString(c.Query("q"), time.Now())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	flagged := c.QueryBool("flagged")
+	candidates := limit
+	if flagged {
+		candidates = 1000
+	}
+
+	signals, err := services.LogPatternSvc.Signals(context.Background(), tid.(int64), filter, window, baseline, candidates)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot aggregate log patterns"})
+	}
+	out := make([]services.LogPatternSignal, 0, len(signals))
+	for _, s := range signals {
+		if flagged && !s.New && !s.Spiking {
+			continue
+		}
+		if len(out) < limit {
+			out = append(out, s)
+		}
+	}
+	return c.JSON(fiber.Map{"window": window.String(), "baseline": baseline.String(), "patterns": out})
+}
+
+// LogPatternHistogram returns the counts over time of the most frequent
+// patterns of matching logs. GET /api/v1/logs/patterns/histogram?range=24h&limit=10
+func LogPatternHistogram(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	filter, start, end, err := logAggregationInput(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	interval := services.LogHistogramInterval(start, end)
+	if iv := c.Query("interval"); iv != "" && iv != "auto" {
+		if interval, err = logquery.ParseDuration(iv); err != nil || interval < time.Second {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid interval"})
+		}
+		if end.Sub(start)/interval > services.MaxLogHistogramBuckets {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("too many buckets (max %d); use a larger interval", services.MaxLogHistogramBuckets)})
+		}
+	}
+
+	series, err := services.LogPatternSvc.PatternHistogram(context.Background(), tid.(int64), filter, start, end, interval, logAggregationLimit(c))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot aggregate log patterns"})
+	}
+	return c.JSON(fiber.Map{"start": start, "end": end, "interval_seconds": int64(interval / time.Second), "patterns": series})
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/models"
+	"github.com/sakkurohilla/kineticops/backend/internal/services"
+)
+
+type LogMetricRuleRequest struct {
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Query        string `json:"query"`
+	Type         string `json:"type"`
+	ValueField   string `json:"value_field"`
+	ValuePattern string `json:"value_pattern"`
+	GroupBy      string `json:"group_by"`
+	Enabled      *bool  `json:"enabled"`
+}
+
+// apply copies the request onto rule; Enabled defaults to true.
+func (r *LogMetricRuleRequest) apply(rule *models.LogMetricRule) {
+	rule.Name = r.Name
+	rule.Description = r.Description
+	rule.Query = r.Query
+	rule.Type = r.Type
+	rule.ValueField = r.ValueField
+	rule.ValuePattern = r.ValuePattern
+	rule.GroupBy = r.GroupBy
+	rule.Enabled = r.Enabled == nil || *r.Enabled
+}
+
+func ListLogMetricRules(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	rules, err := services.ListLogMetricRules(tid.(int64))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot list log metric rules"})
+	}
+	return c.JSON(rules)
+}
+
+func GetLogMetricRule(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	rule, err := services.GetLogMetricRule(id, tid.(int64))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Log metric rule not found"})
+	}
+	return c.JSON(rule)
+}
+
+// CreateLogMetricRule defines a metric derived from ingested logs, e.g.
+// {"name":"nginx_5xx","query":"service:nginx AND status:[500 TO 599]","group_by":"status"}.
+func CreateLogMetricRule(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	var req LogMetricRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+	rule := &models.LogMetricRule{TenantID: tid.(int64)}
+	req.apply(rule)
+	if err := services.ValidateLogMetricRule(rule); err != nil {
+		return logMetricRuleError(c, err)
+	}
+	if err := services.CreateLogMetricRule(rule); err != nil {
+		return logMetricRuleError(c, err)
+	}
+	return c.Status(201).JSON(rule)
+}
+
+func UpdateLogMetricRule(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	rule, err := services.GetLogMetricRule(id, tid.(int64))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Log metric rule not found"})
+	}
+	var req LogMetricRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Bad request"})
+	}
+	req.apply(rule)
+	if err := services.ValidateLogMetricRule(rule); err != nil {
+		return logMetricRuleError(c, err)
+	}
+	if err := services.UpdateLogMetricRule(rule); err != nil {
+		return logMetricRuleError(c, err)
+	}
+	return c.JSON(rule)
+}
+
+func DeleteLogMetricRule(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err := services.DeleteLogMetricRule(id, tid.(int64)); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot delete log metric rule"})
+	}
+	return c.JSON(fiber.Map{"message": "Log metric rule deleted"})
+}
+
+// logMetricRuleError maps invalid definitions to 400, name clashes to 409
+// and anything else to 500.
+func logMetricRuleError(c *fiber.Ctx, err error) error {
+	var re *services.LogMetricRuleError
+	switch {
+	case errors.As(err, &re):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrLogMetricRuleExists):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	}
+	logging.Errorf("[LOG METRICS] rule failed: %v", err)
+	return c.Status(500).JSON(fiber.Map{"error": "Cannot save log metric rule"})
+}
@@ -3,9 +3,12 @@ package handlers
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/logquery"
 	"github.com/sakkurohilla/kineticops/backend/internal/models"
 	"github.com/sakkurohilla/kineticops/backend/internal/services"
 )
@@ -92,15 +95,55 @@ func LatestMetric(c *fiber.Ctx) error {
 	return c.JSON(data)
 }
 
-// PrometheusExport provides Prometheus-compatible metrics exposition endpoint.
+// PrometheusExport renders the tenant's latest metric values in Prometheus text
+// exposition format so an existing Prometheus can scrape KineticOps as a
+// federation source. Supports repeated match[] selectors and ?window=15m
+// (how far back a series' last sample may be).
 func PrometheusExport(c *fiber.Ctx) error {
+	return prometheusExport(c, 0)
+}
+
+// PrometheusExportHost is PrometheusExport restricted to a single host.
+func PrometheusExportHost(c *fiber.Ctx) error {
 	tid := c.Locals("tenant_id")
 	if tid == nil {
 		return c.Status(401).SendString("Unauthorized")
 	}
+	hostID, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if host, err := services.GetHostByID(hostID, tid.(int64)); err != nil || host == nil || host.TenantID != tid.(int64) {
+		return c.Status(404).SendString("Host not found")
+	}
+	return prometheusExport(c, hostID)
+}
+
+func prometheusExport(c *fiber.Ctx, hostID int64) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).SendString("Unauthorized")
+	}
+
+	var selectors [][]services.PromMatcher
+	for _, raw := range c.Context().QueryArgs().PeekMulti("match[]") {
+		sel, err := services.ParsePromSelector(string(raw))
+		if err != nil {
+			return c.Status(400).SendString(err.Error())
+		}
+		selectors = append(selectors, sel)
+	}
+
+	window, err := time.ParseDuration(c.Query("window", "15m"))
+	if err != nil || window <= 0 {
+		return c.Status(400).SendString("invalid window")
+	}
+
+	body, err := services.RenderPrometheusExposition(tid.(int64), hostID, selectors, window)
+	if err != nil {
+		logging.Errorf("[PROM] exposition failed: %v", err)
+		return c.Status(500).SendString("exposition failed")
+	}
 
-	// Return empty Prometheus format when no metrics exist
-	return c.SendString("# No metrics available\n")
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	return c.SendString(body)
 }
 
 // GetMetricsRange handles dashboard metrics retrieval within a specified time range.
@@ -113,15 +156,9 @@ func GetMetricsRange(c *fiber.Ctx) error {
 	rangeParam := c.Query("range", "24h")
 	hostID, _ := strconv.ParseInt(c.Query("host_id"), 10, 64)
 
-	// If no host_id provided, return aggregated data for all hosts
+	// If no host_id provided, return aggregated data across the fleet
 	if hostID == 0 {
-		// Return empty structure for dashboard overview
-		return c.JSON(map[string][]interface{}{
-			"cpu_usage":     {},
-			"memory_usage":  {},
-			"disk_usage":    {},
-			"network_bytes": {},
-		})
+		return fleetMetricsRange(c, tid.(int64), rangeParam)
 	}
 
 	// Use aggregation service for proper time-series data
@@ -146,3 +183,107 @@ func GetMetricsRange(c *fiber.Ctx) error {
 
 	return c.JSON(result)
 }
+
+// fleetMetricsRange serves GetMetricsRange without host_id: one series per
+// metric aggregated over all hosts, or over those matching group/tag/os and
+// label.<name> filters. group_by splits each series by group, tag, os, host
+// or label.<name>; agg selects avg (default), min, max, sum, count, latest,
+// p50, p90, p95 or p99.
+func fleetMetricsRange(c *fiber.Ctx, tenantID int64, rangeParam string) error {
+	metricNames := []string{"cpu_usage", "memory_usage", "disk_usage", "network_bytes"}
+	if names := c.Query("names"); names != "" {
+		metricNames = strings.Split(names, ",")
+	}
+
+	fq := services.FleetQuery{
+		Metrics: metricNames,
+		Func:    c.Query("agg", "avg"),
+		Range:   rangeParam,
+		GroupBy: c.Query("group_by"),
+		Filter:  fleetFilterFromQuery(c),
+		Limit:   c.QueryInt("limit", 10),
+	}
+	result, err := services.QuerySvc.FleetSeries(tenantID, fq)
+	if err != nil {
+		return queryError(c, err)
+	}
+	return c.JSON(result)
+}
+
+// GetTopHosts ranks hosts by a metric over a time range.
+// GET /api/v1/metrics/top?metric=cpu_usage&agg=p95&range=24h&limit=10&group=web
+func GetTopHosts(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+
+	metric := c.Query("metric")
+	if metric == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "metric is required"})
+	}
+
+	hosts, err := services.QuerySvc.TopHosts(tid.(int64), metric, c.Query("agg", "avg"), c.Query("range", "1h"),
+		fleetFilterFromQuery(c), c.QueryInt("limit", 10))
+	if err != nil {
+		return queryError(c, err)
+	}
+	return c.JSON(fiber.Map{"metric": metric, "hosts": hosts})
+}
+
+// GetCapacityForecasts forecasts per-host metrics from their history, e.g.
+// ?metrics=disk_usage,memory_usage&history=7d&horizon=24h&method=holt. With
+// limit, every metric is forecast against it; otherwise percentage metrics
+// are forecast against 100.
+func GetCapacityForecasts(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+
+	var metrics []string
+	for _, m := range strings.Split(c.Query("metrics", "disk_usage,memory_usage"), ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			metrics = append(metrics, m)
+		}
+	}
+	if len(metrics) == 0 || len(metrics) > 10 {
+		return c.Status(400).JSON(fiber.Map{"error": "metrics must list 1 to 10 metrics"})
+	}
+	history, err := logquery.ParseDuration(c.Query("history", "7d"))
+	if err != nil || history < time.Hour || history > 90*24*time.Hour {
+		return c.Status(400).JSON(fiber.Map{"error": "history must be a duration between 1h and 90d"})
+	}
+	horizon, err := logquery.ParseDuration(c.Query("horizon", "24h"))
+	if err != nil || horizon <= 0 || horizon > 365*24*time.Hour {
+		return c.Status(400).JSON(fiber.Map{"error": "horizon must be a duration up to 365d"})
+	}
+	var limit *float64
+	if l := c.Query("limit"); l != "" {
+		v, err := strconv.ParseFloat(l, 64)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "limit must be a number"})
+		}
+		limit = &v
+	}
+
+	method := c.Query("method", services.ForecastLinear)
+	forecasts, err := services.QuerySvc.CapacityForecasts(tid.(int64), metrics, history, horizon, method, limit)
+	if err != nil {
+		return queryError(c, err)
+	}
+	return c.JSON(fiber.Map{"method": method, "history": history.String(), "horizon": horizon.String(), "forecasts": forecasts})
+}
+
+func fleetFilterFromQuery(c *fiber.Ctx) services.FleetFilter {
+	f := services.FleetFilter{Group: c.Query("group"), Tag: c.Query("tag"), OS: c.Query("os")}
+	c.Context().QueryArgs().VisitAll(func(key, value []byte) {
+		if k := string(key); strings.HasPrefix(k, "label.") && len(k) > len("label.") {
+			if f.Labels == nil {
+				f.Labels = make(map[string]string)
+			}
+			f.Labels[strings.TrimPrefix(k, "label.")] = string(value)
+		}
+	})
+	return f
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/services"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	otlpContentProtobuf = "application/x-protobuf"
+	otlpContentJSON     = "application/json"
+)
+
+// OTLPTraces handles OTLP/HTTP trace exports (POST .../v1/traces).
+func OTLPTraces(c *fiber.Ctx) error {
+	req := &coltracepb.ExportTraceServiceRequest{}
+	return handleOTLP(c, req, func(identity *services.IngestIdentity) (proto.Message, error) {
+		return services.OTLPSvc.ExportTraces(c.UserContext(), identity, req)
+	})
+}
+
+// OTLPMetrics handles OTLP/HTTP metric exports (POST .../v1/metrics).
+func OTLPMetrics(c *fiber.Ctx) error {
+	req := &colmetricspb.ExportMetricsServiceRequest{}
+	return handleOTLP(c, req, func(identity *services.IngestIdentity) (proto.Message, error) {
+		return services.OTLPSvc.ExportMetrics(c.UserContext(), identity, req)
+	})
+}
+
+// OTLPLogs handles OTLP/HTTP log exports (POST .../v1/logs).
+func OTLPLogs(c *fiber.Ctx) error {
+	req := &collogspb.ExportLogsServiceRequest{}
+	return handleOTLP(c, req, func(identity *services.IngestIdentity) (proto.Message, error) {
+		return services.OTLPSvc.ExportLogs(c.UserContext(), identity, req)
+	})
+}
+
+// handleOTLP decodes an OTLP/HTTP request (binary protobuf or JSON, optionally
+// gzip-compressed), runs the export and replies in the request's encoding as
+// required by the OTLP/HTTP specification.
+func handleOTLP(c *fiber.Ctx, req proto.Message, export func(*services.IngestIdentity) (proto.Message, error)) error {
+	identity, ok := c.Locals("ingest_identity").(*services.IngestIdentity)
+	if !ok || identity == nil {
+		return otlpError(c, fiber.StatusUnauthorized, codes.Unauthenticated, "missing ingest identity")
+	}
+
+	body := c.Body()
+	if strings.EqualFold(c.Get(fiber.HeaderContentEncoding), "gzip") {
+		unzipped, err := c.Request().BodyGunzip()
+		if err != nil {
+			return otlpError(c, fiber.StatusBadRequest, codes.InvalidArgument, "invalid gzip body")
+		}
+		body = unzipped
+	}
+
+	if isOTLPJSON(c) {
+		fixed, err := otlpJSONHexIDs(body)
+		if err != nil {
+			return otlpError(c, fiber.StatusBadRequest, codes.InvalidArgument, "invalid JSON body")
+		}
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(fixed, req); err != nil {
+			return otlpError(c, fiber.StatusBadRequest, codes.InvalidArgument, err.Error())
+		}
+	} else if err := proto.Unmarshal(body, req); err != nil {
+		return otlpError(c, fiber.StatusBadRequest, codes.InvalidArgument, "invalid protobuf body")
+	}
+
+	resp, err := export(identity)
+	if err != nil {
+		logging.Errorf("[OTLP] export failed tenant=%d path=%s: %v", identity.TenantID, c.Path(), err)
+		// 503 tells exporters the failure is retryable
+		return otlpError(c, fiber.StatusServiceUnavailable, codes.Unavailable, "export failed")
+	}
+	return otlpReply(c, fiber.StatusOK, resp)
+}
+
+func isOTLPJSON(c *fiber.Ctx) bool {
+	return strings.HasPrefix(strings.ToLower(c.Get(fiber.HeaderContentType)), otlpContentJSON)
+}
+
+func otlpReply(c *fiber.Ctx, status int, msg proto.Message) error {
+	var (
+		b   []byte
+		err error
+	)
+	if isOTLPJSON(c) {
+		c.Set(fiber.HeaderContentType, otlpContentJSON)
+		b, err = protojson.Marshal(msg)
+	} else {
+		c.Set(fiber.HeaderContentType, otlpContentProtobuf)
+		b, err = proto.Marshal(msg)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("encode response failed")
+	}
+	return c.Status(status).Send(b)
+}
+
+func otlpError(c *fiber.Ctx, status int, code codes.Code, message string) error {
+	return otlpReply(c, status, &spb.Status{Code: int32(code), Message: message})
+}
+
+// otlpJSONHexIDs rewrites trace/span ids from the hex strings mandated by
+// OTLP/JSON to the base64 encoding protojson expects for bytes fields.
+func otlpJSONHexIDs(body []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	rewriteOTLPIDs(doc)
+	return json.Marshal(doc)
+}
+
+func rewriteOTLPIDs(v interface{}) {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for k, child := range node {
+			switch k {
+			case "traceId", "spanId", "parentSpanId", "trace_id", "span_id", "parent_span_id":
+				if s, ok := child.(string); ok && s != "" {
+					if raw, err := hex.DecodeString(s); err == nil {
+						node[k] = base64.StdEncoding.EncodeToString(raw)
+					}
+				}
+			default:
+				rewriteOTLPIDs(child)
+			}
+		}
+	case []interface{}:
+		for _, child := range node {
+			rewriteOTLPIDs(child)
+		}
+	}
+}
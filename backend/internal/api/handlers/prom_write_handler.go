@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang/snappy"
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/services"
+)
+
+// maxRemoteWriteSize caps the decompressed size of a remote_write request.
+// Prometheus sends batches of a few MB at most, so anything larger is either
+// misconfigured or a decompression bomb.
+const maxRemoteWriteSize = 32 << 20
+
+// PromRemoteWrite accepts Prometheus remote_write requests (snappy-compressed
+// protobuf WriteRequest) so existing Prometheus servers can forward series to
+// KineticOps. Configure remote_write with the ingest token as bearer token.
+func PromRemoteWrite(c *fiber.Ctx) error {
+	identity, ok := c.Locals("ingest_identity").(*services.IngestIdentity)
+	if !ok || identity == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+
+	// Backpressure: Prometheus retries 429 (retry_on_http_429) and 5xx
+	if services.MetricBatcherSaturated() {
+		c.Set(fiber.HeaderRetryAfter, "1")
+		return c.Status(429).JSON(fiber.Map{"error": "ingestion overloaded"})
+	}
+
+	n, err := snappy.DecodedLen(c.Body())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid snappy payload"})
+	}
+	if n > maxRemoteWriteSize {
+		return c.Status(413).JSON(fiber.Map{"error": "WriteRequest too large"})
+	}
+	raw, err := snappy.Decode(nil, c.Body())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid snappy payload"})
+	}
+	series, err := services.DecodeRemoteWrite(raw)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid WriteRequest"})
+	}
+
+	stored, dropped, err := services.IngestPromSeries(identity, series)
+	if err != nil {
+		logging.Errorf("[PROM] remote_write tenant=%d stored=%d: %v", identity.TenantID, stored, err)
+		// Prometheus retries 5xx with the whole request; only ask for that
+		// when nothing was written, otherwise the stored samples would be
+		// duplicated. A partial write is reported as a non-retryable 400.
+		if stored == 0 {
+			return c.Status(500).JSON(fiber.Map{"error": "ingest failed"})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": "partially stored", "stored": stored, "dropped": dropped})
+	}
+	if dropped > 0 {
+		logging.Warnf("[PROM] remote_write tenant=%d stored=%d dropped=%d", identity.TenantID, stored, dropped)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
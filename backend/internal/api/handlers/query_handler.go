@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/query"
+	"github.com/sakkurohilla/kineticops/backend/internal/services"
+)
+
+type RunQueryRequest struct {
+	Query string `json:"query"`
+}
+
+// RunQuery executes a KQL statement for the caller's tenant, e.g.
+// {"query": "SELECT avg(cpu_usage) FROM metrics FACET host SINCE 1 hour ago TIMESERIES 5m"}.
+func RunQuery(c *fiber.Ctx) error {
+	tid := c.Locals("tenant_id")
+	if tid == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthenticated"})
+	}
+
+	var req RunQueryRequest
+	if err := c.BodyParser(&req); err != nil || req.Query == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "query is required"})
+	}
+
+	res, err := services.QuerySvc.Run(tid.(int64), req.Query)
+	if err != nil {
+		return queryError(c, err)
+	}
+	return c.JSON(res)
+}
+
+// queryError maps query engine errors to 400 for bad queries and 500
+// otherwise.
+func queryError(c *fiber.Ctx, err error) error {
+	var pe *query.ParseError
+	var qe *services.QueryPlanError
+	if errors.As(err, &pe) || errors.As(err, &qe) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	logging.Errorf("[QUERY] query failed: %v", err)
+	return c.Status(500).JSON(fiber.Map{"error": "query failed"})
+}
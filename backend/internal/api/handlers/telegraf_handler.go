@@ -10,7 +10,8 @@ import (
 
 // IngestTelegraf accepts Telegraf JSON payloads (single object or array) and
 // maps them to internal metrics. This supports installing a Telegraf agent on
-// hosts and sending system metrics to KineticOps.
+// hosts and sending system metrics to KineticOps. Payloads that are not JSON
+// are parsed as Influx line protocol.
 func IngestTelegraf(c *fiber.Ctx) error {
 	tidLoc := c.Locals("tenant_id")
 	agentTokenUsed := false
@@ -23,9 +24,27 @@ func IngestTelegraf(c *fiber.Ctx) error {
 	// Try to decode into a generic interface to support arrays or objects
 	var raw interface{}
 	if err := json.Unmarshal(body, &raw); err != nil {
-		// If the payload isn't JSON array/object, try to parse as single line
-		logging.Warnf("[TELEGRAF] invalid json payload: %v", err)
-		return c.Status(400).JSON(fiber.Map{"error": "invalid json"})
+		// If the payload isn't JSON array/object, treat it as Influx line protocol
+		if tidLoc == nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid json"})
+		}
+		identity := &services.IngestIdentity{TenantID: tidLoc.(int64)}
+		if id, ok := c.Locals("ingest_identity").(*services.IngestIdentity); ok && id != nil {
+			identity = id
+		}
+		points, lineErrs, perr := services.ParseLineProtocol(body, c.Query("precision"))
+		if perr != nil || len(points) == 0 {
+			logging.Warnf("[TELEGRAF] payload is neither json nor line protocol: %v", perr)
+			return c.Status(400).JSON(fiber.Map{"error": "invalid payload"})
+		}
+		if _, _, ierr := services.IngestInfluxPoints(identity, points); ierr != nil {
+			logging.Errorf("[TELEGRAF] failed to ingest line protocol: %v", ierr)
+			return c.Status(500).JSON(fiber.Map{"error": "ingest failed"})
+		}
+		if len(lineErrs) > 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "partial write: " + lineErrs[0].Error()})
+		}
+		return c.Status(201).JSON(fiber.Map{"msg": "ingested"})
 	}
 
 	processPoint := func(obj map[string]interface{}) {
@@ -9,16 +9,80 @@ import (
 func RegisterAlertRoutes(app *fiber.App) {
 	api := app.Group("/api/v1/alerts")
 
-	// Public endpoint for stats (no auth required for dashboard)
-	api.Get("/stats", handlers.GetAlertStats)
+	// Public endpoint for stats (no auth required for dashboard); a token,
+	// when sent, scopes the counts to its tenant
+	api.Get("/stats", middleware.AuthOptional(), handlers.GetAlertStats)
 
 	// Protected endpoints
 	apiAuth := app.Group("/api/v1/alerts", middleware.AuthRequired())
+
+	// Alert engine: conditions, channels, policies, escalation policies,
+	// silences, maintenance windows, routing and incidents
+	conditions := apiAuth.Group("/conditions")
+	conditions.Get("/", handlers.ListAlertConditions)
+	conditions.Post("/", handlers.CreateAlertCondition)
+	conditions.Get("/:id", handlers.GetAlertCondition)
+	conditions.Put("/:id", handlers.UpdateAlertCondition)
+	conditions.Delete("/:id", handlers.DeleteAlertCondition)
+	conditions.Get("/:id/states", handlers.ListAlertConditionStates)
+	conditions.Get("/:id/transitions", handlers.ListAlertConditionTransitions)
+
+	channels := apiAuth.Group("/channels")
+	channels.Get("/", handlers.ListAlertChannels)
+	channels.Post("/", handlers.CreateAlertChannel)
+	channels.Get("/:id", handlers.GetAlertChannel)
+	channels.Put("/:id", handlers.UpdateAlertChannel)
+	channels.Delete("/:id", handlers.DeleteAlertChannel)
+
+	policies := apiAuth.Group("/policies")
+	policies.Get("/", handlers.ListAlertPolicies)
+	policies.Post("/", handlers.CreateAlertPolicy)
+	policies.Get("/:id", handlers.GetAlertPolicy)
+	policies.Put("/:id", handlers.UpdateAlertPolicy)
+	policies.Delete("/:id", handlers.DeleteAlertPolicy)
+
+	escalations := apiAuth.Group("/escalation-policies")
+	escalations.Get("/", handlers.ListAlertEscalationPolicies)
+	escalations.Post("/", handlers.CreateAlertEscalationPolicy)
+	escalations.Get("/:id", handlers.GetAlertEscalationPolicy)
+	escalations.Put("/:id", handlers.UpdateAlertEscalationPolicy)
+	escalations.Delete("/:id", handlers.DeleteAlertEscalationPolicy)
+
+	silences := apiAuth.Group("/silences")
+	silences.Get("/", handlers.ListAlertSilences)
+	silences.Post("/", handlers.CreateAlertSilence)
+	silences.Get("/:id", handlers.GetAlertSilence)
+	silences.Put("/:id", handlers.UpdateAlertSilence)
+	silences.Post("/:id/expire", handlers.ExpireAlertSilence)
+	silences.Delete("/:id", handlers.DeleteAlertSilence)
+
+	maintenance := apiAuth.Group("/maintenance-windows")
+	maintenance.Get("/", handlers.ListAlertMaintenanceWindows)
+	maintenance.Post("/", handlers.CreateAlertMaintenanceWindow)
+	maintenance.Get("/:id", handlers.GetAlertMaintenanceWindow)
+	maintenance.Put("/:id", handlers.UpdateAlertMaintenanceWindow)
+	maintenance.Delete("/:id", handlers.DeleteAlertMaintenanceWindow)
+
+	apiAuth.Get("/routing", handlers.GetAlertRoutingTree)
+	apiAuth.Put("/routing", handlers.PutAlertRoutingTree)
+	apiAuth.Delete("/routing", handlers.DeleteAlertRoutingTree)
+	apiAuth.Get("/groups", handlers.ListAlertNotificationGroups)
+
+	incidents := apiAuth.Group("/incidents")
+	incidents.Get("/", handlers.ListAlertIncidents)
+	incidents.Get("/:id", handlers.GetAlertIncident)
+	incidents.Get("/:id/deliveries", handlers.ListAlertIncidentDeliveries)
+	incidents.Get("/:id/related", handlers.ListRelatedAlertIncidents)
+	incidents.Post("/:id/acknowledge", handlers.AcknowledgeAlertIncident)
+	incidents.Post("/:id/close", handlers.CloseAlertIncident)
+
+	// Legacy alert rules (converted to conditions on creation) and alerts
+	// (served from incidents)
 	apiAuth.Post("/rules", handlers.CreateAlertRule)
 	apiAuth.Get("/rules", handlers.ListAlertRules)
 	apiAuth.Get("/", handlers.ListAlerts)
 	apiAuth.Patch("/:id", handlers.UpdateAlert)
-	apiAuth.Post("/:id/acknowledge", handlers.UpdateAlert)
-	apiAuth.Post("/:id/silence", handlers.UpdateAlert)
-	apiAuth.Post("/:id/resolve", handlers.UpdateAlert)
+	apiAuth.Post("/:id/acknowledge", handlers.AcknowledgeAlert)
+	apiAuth.Post("/:id/silence", handlers.SilenceAlert)
+	apiAuth.Post("/:id/resolve", handlers.ResolveAlert)
 }
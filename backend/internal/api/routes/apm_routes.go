@@ -0,0 +1,43 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sakkurohilla/kineticops/backend/internal/api/handlers"
+	"github.com/sakkurohilla/kineticops/backend/internal/middleware"
+)
+
+// RegisterAPMRoutes registers the APM API under /api/v1/apm. Ingest endpoints
+// authenticate by agent/ingest token; query endpoints require a user JWT and
+// are tenant-scoped. Auth is attached per route (not on the /api/v1/apm group)
+// so the two schemes never stack on the same path.
+func RegisterAPMRoutes(app *fiber.App) {
+	// Initialize APM service
+	handlers.InitAPMService()
+
+	apm := app.Group("/api/v1/apm")
+
+	// Ingest (agents / SDKs)
+	ingest := apm.Group("/ingest", middleware.IngestTokenAuth(), middleware.AgentRateLimit())
+	ingest.Post("/applications", handlers.IngestAPMApplication)
+	ingest.Post("/transactions", handlers.IngestAPMTransactions)
+	ingest.Post("/spans", handlers.IngestAPMSpans)
+	ingest.Post("/errors", handlers.IngestAPMErrors)
+	ingest.Post("/queries", handlers.IngestAPMDatabaseQueries)
+	ingest.Post("/external", handlers.IngestAPMExternalServices)
+	ingest.Post("/events", handlers.IngestAPMCustomEvents)
+
+	// Queries (UI)
+	auth := middleware.AuthRequired()
+	apm.Get("/applications", auth, handlers.GetAPMApplications)
+	apm.Get("/applications/:id", auth, handlers.GetAPMApplicationOverview)
+	apm.Get("/applications/:id/transactions", auth, handlers.GetAPMTransactions)
+	apm.Get("/applications/:id/transactions/stats", auth, handlers.GetAPMTransactionStats)
+	apm.Get("/applications/:id/traces", auth, handlers.GetAPMTraces)
+	apm.Get("/applications/:id/errors", auth, handlers.GetAPMErrors)
+	apm.Get("/applications/:id/errors/stats", auth, handlers.GetAPMErrorStats)
+	apm.Get("/applications/:id/queries/slow", auth, handlers.GetAPMSlowQueries)
+	apm.Get("/applications/:id/external", auth, handlers.GetAPMExternalServices)
+	apm.Get("/applications/:id/events", auth, handlers.GetAPMCustomEvents)
+	apm.Get("/traces/:traceId", auth, handlers.GetAPMTrace)
+	apm.Post("/errors/:id/resolve", auth, handlers.ResolveAPMError)
+}
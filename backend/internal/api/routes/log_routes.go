@@ -12,5 +12,18 @@ func RegisterLogRoutes(app *fiber.App) { // ← Was RegisterAlertRoutes
 	api.Post("/", handlers.CollectLog)
 	api.Get("/", handlers.SearchLogs)
 	api.Get("/sources", handlers.GetLogSources)
+	api.Get("/histogram", handlers.LogHistogram)
+	api.Get("/top", handlers.TopLogValues)
+	api.Get("/error-rate", handlers.LogErrorRates)
+	api.Get("/patterns", handlers.ListLogPatterns)
+	api.Get("/patterns/histogram", handlers.LogPatternHistogram)
 	api.Post("/retention", handlers.TriggerLogRetention)
+
+	// Log-derived metric rules (managed by users only)
+	rules := app.Group("/api/v1/log-metrics", middleware.AuthRequired())
+	rules.Get("/", handlers.ListLogMetricRules)
+	rules.Post("/", handlers.CreateLogMetricRule)
+	rules.Get("/:id", handlers.GetLogMetricRule)
+	rules.Put("/:id", handlers.UpdateLogMetricRule)
+	rules.Delete("/:id", handlers.DeleteLogMetricRule)
 }
@@ -11,10 +11,28 @@ func RegisterMetricRoutes(app *fiber.App) {
 	// Public agent endpoints (no auth required)
 	app.Post("/api/v1/metrics/collect", handlers.ReceiveAgentData) // Agent data collection
 
+	// Prometheus remote_write receiver (ingest token auth)
+	app.Post("/api/v1/prom/write", middleware.IngestTokenAuth(), middleware.AgentRateLimit(), handlers.PromRemoteWrite)
+
+	// InfluxDB line protocol write endpoints (v1 and v2 compatible)
+	app.Post("/api/v1/write", middleware.IngestTokenAuth(), middleware.AgentRateLimit(), handlers.InfluxWriteV1)
+	app.Post("/api/v2/write", middleware.IngestTokenAuth(), middleware.AgentRateLimit(), handlers.InfluxWriteV2)
+
+	// Federation scrape endpoints for Prometheus servers (ingest token auth,
+	// since scrape configs cannot refresh short-lived user JWTs)
+	app.Get("/api/v1/prom/federate", middleware.IngestTokenAuth(), handlers.PrometheusExport)
+	app.Get("/api/v1/prom/federate/hosts/:id", middleware.IngestTokenAuth(), handlers.PrometheusExportHost)
+
+	// KQL query API (see package query)
+	app.Post("/api/v1/query", middleware.AuthRequired(), handlers.RunQuery)
+
 	// Protected user endpoints
 	metrics := app.Group("/api/v1/metrics", middleware.AuthRequired())
 
-	metrics.Get("/range", handlers.GetMetricsRange)       // GET /api/v1/metrics/range?range=24h
-	metrics.Post("/telegraf", handlers.IngestTelegraf)    // POST /api/v1/metrics/telegraf
-	metrics.Get("/prometheus", handlers.PrometheusExport) // GET /api/v1/metrics/prometheus
+	metrics.Get("/range", handlers.GetMetricsRange)                     // GET /api/v1/metrics/range?range=24h
+	metrics.Get("/top", handlers.GetTopHosts)                           // GET /api/v1/metrics/top?metric=cpu_usage
+	metrics.Get("/forecast", handlers.GetCapacityForecasts)             // GET /api/v1/metrics/forecast?metrics=disk_usage&horizon=24h
+	metrics.Post("/telegraf", handlers.IngestTelegraf)                  // POST /api/v1/metrics/telegraf
+	metrics.Get("/prometheus", handlers.PrometheusExport)               // GET /api/v1/metrics/prometheus
+	metrics.Get("/prometheus/hosts/:id", handlers.PrometheusExportHost) // GET /api/v1/metrics/prometheus/hosts/1
 }
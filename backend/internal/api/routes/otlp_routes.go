@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sakkurohilla/kineticops/backend/internal/api/handlers"
+	"github.com/sakkurohilla/kineticops/backend/internal/middleware"
+)
+
+// RegisterOTLPRoutes registers the OTLP/HTTP receiver. Exporters should be
+// configured with the base endpoint /api/v1/otlp; the standard /v1/traces,
+// /v1/metrics and /v1/logs signal paths are appended by the SDKs.
+func RegisterOTLPRoutes(app *fiber.App) {
+	otlp := app.Group("/api/v1/otlp", middleware.IngestTokenAuth(), middleware.AgentRateLimit())
+
+	otlp.Post("/v1/traces", handlers.OTLPTraces)
+	otlp.Post("/v1/metrics", handlers.OTLPMetrics)
+	otlp.Post("/v1/logs", handlers.OTLPLogs)
+}
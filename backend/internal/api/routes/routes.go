@@ -15,8 +15,10 @@ func RegisterAllRoutes(app *fiber.App) {
 	// matched by the dedicated agent endpoints and not intercepted by the
 	// UI auth middleware attached to the log routes.
 	RegisterAgentRoutes(app)
+	RegisterOTLPRoutes(app)
 	RegisterLogRoutes(app)
 	RegisterAlertRoutes(app)
+	RegisterAPMRoutes(app)
 	RegisterWorkflowRoutes(app)
 	// RegisterProcessRoutes removed - using host process endpoints instead
 	RegisterSyntheticsRoutes(app)
@@ -0,0 +1,188 @@
+// Package cron parses standard five-field cron expressions, used by alert
+// maintenance windows to describe when a recurring window starts:
+//
+//	minute hour day-of-month month day-of-week
+//	0 2 * * sun        02:00 every Sunday
+//	*/30 9-17 * * 1-5  every half hour during office hours
+//
+// Fields accept *, values, ranges (a-b), steps (*/n, a-b/n) and comma
+// separated lists; months and weekdays also accept three-letter names and
+// Sunday may be 0 or 7. The @hourly, @daily, @weekly, @monthly and @yearly
+// shortcuts are supported. As in cron, when both day-of-month and
+// day-of-week are restricted a day matching either one matches.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64 // bit n set: value n matches
+	domAny, dowAny                bool
+}
+
+// ParseError reports an invalid cron expression.
+type ParseError struct {
+	Msg string
+}
+
+func (e *ParseError) Error() string { return "invalid cron expression: " + e.Msg }
+
+var shortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var dayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// Parse parses a five-field cron expression or shortcut.
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if s, ok := shortcuts[spec]; ok {
+		spec = s
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, &ParseError{Msg: fmt.Sprintf("expected 5 fields, got %d", len(fields))}
+	}
+
+	var s Schedule
+	var err error
+	if s.minute, err = parseField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseField(fields[2], 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 // 7 is Sunday too
+	}
+	// Like vixie cron, a field starting with * (e.g. */2) is unrestricted
+	// for the day-of-month/day-of-week rule.
+	s.domAny = strings.HasPrefix(fields[2], "*") || fields[2] == "?"
+	s.dowAny = strings.HasPrefix(fields[4], "*") || fields[4] == "?"
+	return &s, nil
+}
+
+// parseField parses one comma separated field into a bit set.
+func parseField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, &ParseError{Msg: fmt.Sprintf("invalid step in %q", part)}
+			}
+			rng, step = part[:i], n
+		}
+
+		lo, hi := min, max
+		switch {
+		case rng == "*" || rng == "?":
+		case strings.Contains(rng, "-"):
+			i := strings.IndexByte(rng, '-')
+			var err error
+			if lo, err = parseValue(rng[:i], min, max, names); err != nil {
+				return 0, err
+			}
+			if hi, err = parseValue(rng[i+1:], min, max, names); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, &ParseError{Msg: fmt.Sprintf("range %q is reversed", rng)}
+			}
+		default:
+			v, err := parseValue(rng, min, max, names)
+			if err != nil {
+				return 0, err
+			}
+			lo, hi = v, v
+			if step > 1 {
+				hi = max // "5/15" means from 5 every 15
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(s string, min, max int, names map[string]int) (int, error) {
+	if v, ok := names[s]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, &ParseError{Msg: fmt.Sprintf("invalid value %q", s)}
+	}
+	if v < min || v > max {
+		return 0, &ParseError{Msg: fmt.Sprintf("value %d out of range %d-%d", v, min, max)}
+	}
+	return v, nil
+}
+
+// Matches reports whether the schedule fires in the minute of t, in t's
+// location.
+func (s *Schedule) Matches(t time.Time) bool {
+	if s.minute&(1<<uint(t.Minute())) == 0 || s.hour&(1<<uint(t.Hour())) == 0 ||
+		s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	domOK := s.dom&(1<<uint(t.Day())) != 0
+	dowOK := s.dow&(1<<uint(t.Weekday())) != 0
+	if !s.domAny && !s.dowAny {
+		return domOK || dowOK
+	}
+	return domOK && dowOK
+}
+
+// LastWithin returns the latest time in (t-d, t], truncated to the minute,
+// at which the schedule fired, or false if it did not fire in that span.
+func (s *Schedule) LastWithin(t time.Time, d time.Duration) (time.Time, bool) {
+	t = t.Truncate(time.Minute)
+	for m := time.Duration(0); m < d; m += time.Minute {
+		if at := t.Add(-m); s.Matches(at) {
+			return at, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Next returns the first time after t at which the schedule fires, looking
+// at most limit ahead.
+func (s *Schedule) Next(t time.Time, limit time.Duration) (time.Time, bool) {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for end := t.Add(limit); !t.After(end); t = t.Add(time.Minute) {
+		if s.Matches(t) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
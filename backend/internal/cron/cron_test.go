@@ -0,0 +1,218 @@
+package cron
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // DST tests need zone data on minimal images
+)
+
+// fires lists the first n times after from at which spec fires.
+func fires(t *testing.T, spec string, from time.Time, n int) []time.Time {
+	t.Helper()
+	s, err := Parse(spec)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", spec, err)
+	}
+	var out []time.Time
+	for len(out) < n {
+		next, ok := s.Next(from, 400*24*time.Hour)
+		if !ok {
+			break
+		}
+		out = append(out, next)
+		from = next
+	}
+	return out
+}
+
+func utc(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		spec string
+		from string
+		want []string
+	}{
+		// values, lists and ranges
+		{"0 2 * * *", "2024-05-01 00:00", []string{"2024-05-01 02:00", "2024-05-02 02:00"}},
+		{"15,45 9 * * *", "2024-05-01 00:00", []string{"2024-05-01 09:15", "2024-05-01 09:45", "2024-05-02 09:15"}},
+		{"58-59,1 0 * * *", "2024-05-01 00:00", []string{"2024-05-01 00:01", "2024-05-01 00:58", "2024-05-01 00:59", "2024-05-02 00:01"}},
+		// steps
+		{"*/20 * * * *", "2024-05-01 10:05", []string{"2024-05-01 10:20", "2024-05-01 10:40", "2024-05-01 11:00"}},
+		{"10-40/15 3 * * *", "2024-05-01 00:00", []string{"2024-05-01 03:10", "2024-05-01 03:25", "2024-05-01 03:40", "2024-05-02 03:10"}},
+		{"50/5 3 * * *", "2024-05-01 00:00", []string{"2024-05-01 03:50", "2024-05-01 03:55", "2024-05-02 03:50"}},
+		{"0 */8 * * *", "2024-05-01 00:00", []string{"2024-05-01 08:00", "2024-05-01 16:00", "2024-05-02 00:00"}},
+		// names, Sunday as 0 or 7
+		{"0 0 1 jan,JUL *", "2024-05-01 00:00", []string{"2024-07-01 00:00", "2025-01-01 00:00"}},
+		{"0 12 * * mon-wed", "2024-05-03 00:00", []string{"2024-05-06 12:00", "2024-05-07 12:00", "2024-05-08 12:00", "2024-05-13 12:00"}},
+		{"0 0 * * 7", "2024-05-01 00:00", []string{"2024-05-05 00:00", "2024-05-12 00:00"}},
+		{"0 0 * * 0", "2024-05-01 00:00", []string{"2024-05-05 00:00", "2024-05-12 00:00"}},
+		// shortcuts
+		{"@hourly", "2024-05-01 10:30", []string{"2024-05-01 11:00", "2024-05-01 12:00"}},
+		{"@weekly", "2024-05-01 00:00", []string{"2024-05-05 00:00"}},
+		{"@monthly", "2024-05-15 00:00", []string{"2024-06-01 00:00"}},
+		{"@yearly", "2024-05-01 00:00", []string{"2025-01-01 00:00"}},
+	}
+	for _, tt := range tests {
+		got := fires(t, tt.spec, utc(tt.from), len(tt.want))
+		if len(got) != len(tt.want) {
+			t.Errorf("%q from %s: got %v, want %v", tt.spec, tt.from, got, tt.want)
+			continue
+		}
+		for i, w := range tt.want {
+			if !got[i].Equal(utc(w)) {
+				t.Errorf("%q from %s: fire %d = %s, want %s", tt.spec, tt.from, i, got[i].Format("2006-01-02 15:04"), w)
+			}
+		}
+	}
+}
+
+func TestDayOfMonthOrDayOfWeek(t *testing.T) {
+	tests := []struct {
+		spec string
+		from string
+		want []string
+	}{
+		// both restricted: either matches (the 13th, or any Friday)
+		{"0 0 13 * fri", "2024-09-01 00:00", []string{"2024-09-06 00:00", "2024-09-13 00:00", "2024-09-20 00:00", "2024-09-27 00:00", "2024-10-04 00:00", "2024-10-11 00:00", "2024-10-13 00:00"}},
+		// a * or */n day field is unrestricted: both must match
+		{"0 0 */2 * fri", "2024-09-01 00:00", []string{"2024-09-13 00:00", "2024-09-27 00:00", "2024-10-11 00:00"}},
+		{"0 0 13 * *", "2024-09-01 00:00", []string{"2024-09-13 00:00", "2024-10-13 00:00"}},
+		{"0 0 * * fri", "2024-09-01 00:00", []string{"2024-09-06 00:00", "2024-09-13 00:00"}},
+	}
+	for _, tt := range tests {
+		got := fires(t, tt.spec, utc(tt.from), len(tt.want))
+		for i, w := range tt.want {
+			if i >= len(got) || !got[i].Equal(utc(w)) {
+				t.Errorf("%q from %s: got %v, want %v", tt.spec, tt.from, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestNextAcrossMonths(t *testing.T) {
+	tests := []struct {
+		spec string
+		from string
+		want string // empty: no fire within the lookahead
+	}{
+		{"0 0 31 * *", "2024-04-01 00:00", "2024-05-31 00:00"}, // April has no 31st
+		{"0 0 29 2 *", "2023-03-01 00:00", "2024-02-29 00:00"},
+		{"0 0 29 2 *", "2025-03-01 00:00", ""}, // next is 2028
+		{"0 0 30 2 *", "2024-01-01 00:00", ""},
+		{"59 23 31 12 *", "2024-12-31 23:59", "2025-12-31 23:59"},
+		{"0 0 1 * *", "2024-01-31 23:59", "2024-02-01 00:00"},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := s.Next(utc(tt.from), 400*24*time.Hour)
+		if tt.want == "" {
+			if ok {
+				t.Errorf("%q from %s: got %s, want none within the lookahead", tt.spec, tt.from, got)
+			}
+			continue
+		}
+		if !ok || !got.Equal(utc(tt.want)) {
+			t.Errorf("%q from %s = %s, %v, want %s", tt.spec, tt.from, got, ok, tt.want)
+		}
+	}
+}
+
+func TestNextAcrossDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	at := func(day, hour, min int) time.Time { return time.Date(2024, 3, day, hour, min, 0, 0, ny) }
+
+	// 2024-03-10: clocks jump from 02:00 to 03:00, so 02:30 does not exist
+	// that day and the schedule fires the next day
+	got := fires(t, "30 2 * * *", at(9, 12, 0), 2)
+	if len(got) != 2 || !got[0].Equal(at(11, 2, 30)) {
+		t.Errorf("30 2 * * * across spring forward: got %v, want 2024-03-11 02:30 EDT", got)
+	}
+
+	// local wall-clock hours are kept across the change
+	got = fires(t, "0 9 * * *", at(9, 12, 0), 2)
+	if len(got) != 2 || got[0].Hour() != 9 || got[1].Hour() != 9 || got[1].Sub(got[0]) != 24*time.Hour {
+		t.Errorf("0 9 * * * across spring forward: got %v, want 09:00 on the 10th and 11th", got)
+	}
+	if got[0].Sub(at(9, 12, 0)) != 20*time.Hour {
+		t.Errorf("0 9 * * * from 03-09 12:00 EST: first fire after %s, want 20h", got[0].Sub(at(9, 12, 0)))
+	}
+
+	// 2024-11-03: 01:00-02:00 happens twice; the first 01:30 (EDT) comes first
+	fall := time.Date(2024, 11, 2, 12, 0, 0, 0, ny)
+	got = fires(t, "30 1 * * *", fall, 2)
+	if len(got) < 1 || got[0].Day() != 3 || got[0].Hour() != 1 {
+		t.Fatalf("30 1 * * * across fall back: got %v", got)
+	}
+	if _, offset := got[0].Zone(); offset != -4*3600 {
+		t.Errorf("first 01:30 on 11-03 has offset %d, want EDT (-4h)", offset)
+	}
+}
+
+func TestLastWithin(t *testing.T) {
+	s, err := Parse("0 2 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		now  string
+		d    time.Duration
+		want string // empty: did not fire
+	}{
+		{"2024-05-01 02:00", time.Minute, "2024-05-01 02:00"},
+		{"2024-05-01 03:59", 2 * time.Hour, "2024-05-01 02:00"},
+		{"2024-05-01 04:00", 2 * time.Hour, ""},
+		{"2024-05-01 01:59", 24 * time.Hour, "2024-04-30 02:00"},
+	}
+	for _, tt := range tests {
+		got, ok := s.LastWithin(utc(tt.now).Add(30*time.Second), tt.d)
+		if tt.want == "" {
+			if ok {
+				t.Errorf("LastWithin(%s, %s) = %s, want none", tt.now, tt.d, got)
+			}
+			continue
+		}
+		if !ok || !got.Equal(utc(tt.want)) {
+			t.Errorf("LastWithin(%s, %s) = %s, %v, want %s", tt.now, tt.d, got, ok, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"@every 5m",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"* * * foo *",
+		"1,,2 * * * *",
+		"1- * * * *",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q): expected an error", spec)
+		}
+	}
+}
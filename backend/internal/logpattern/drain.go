@@ -0,0 +1,184 @@
+// Package logpattern clusters log messages into templates with the Drain
+// algorithm (He et al., ICWS 2017). A message is routed through a fixed-depth
+// tree by its token count and leading tokens and joined to the most similar
+// template in the leaf; tokens that differ become wildcards. Tokens holding
+// digits (ids, durations, addresses) are treated as wildcards up front.
+package logpattern
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Wildcard stands for a variable token in a template.
+const Wildcard = "<*>"
+
+// Config tunes the clustering.
+type Config struct {
+	// Depth is the tree depth counting the root, token count and leaf
+	// layers; messages are routed by their first Depth-3 tokens.
+	Depth int
+	// Similarity is the minimum share of equal tokens for a message to
+	// join a template.
+	Similarity float64
+	// MaxChildren bounds the children of a tree node; further tokens share
+	// a wildcard child.
+	MaxChildren int
+	// MaxClusters bounds the templates of a Drain; once reached, messages
+	// only join existing templates.
+	MaxClusters int
+	// MaxTokens truncates long messages before clustering.
+	MaxTokens int
+}
+
+// DefaultConfig follows the parameters of the Drain paper.
+var DefaultConfig = Config{Depth: 4, Similarity: 0.4, MaxChildren: 100, MaxClusters: 1000, MaxTokens: 64}
+
+// Cluster is a template and the stable id it was created with.
+type Cluster struct {
+	ID       string
+	Template []string
+}
+
+// String returns the template text.
+func (c *Cluster) String() string {
+	return strings.Join(c.Template, " ")
+}
+
+type node struct {
+	children map[string]*node
+	clusters []*Cluster
+}
+
+// Drain holds the templates of one message stream. It is not safe for
+// concurrent use.
+type Drain struct {
+	cfg   Config
+	root  map[int]*node
+	count int
+	newID func(template []string) string
+}
+
+// New returns an empty Drain; newID names clusters on creation.
+func New(cfg Config, newID func(template []string) string) *Drain {
+	return &Drain{cfg: cfg, root: map[int]*node{}, newID: newID}
+}
+
+// Len returns the number of templates.
+func (d *Drain) Len() int {
+	return d.count
+}
+
+// Tokenize splits a message on whitespace, masking tokens that hold digits.
+func Tokenize(msg string, max int) []string {
+	fields := strings.Fields(msg)
+	if max > 0 && len(fields) > max {
+		fields = fields[:max]
+	}
+	for i, f := range fields {
+		if strings.IndexFunc(f, unicode.IsDigit) >= 0 {
+			fields[i] = Wildcard
+		}
+	}
+	return fields
+}
+
+// Add clusters a message. It returns the cluster and whether it was created
+// or its template changed. Once MaxClusters is reached a message joins the
+// closest template of its leaf; the cluster is nil for blank messages and
+// when there is none.
+func (d *Drain) Add(msg string) (c *Cluster, created, changed bool) {
+	tokens := Tokenize(msg, d.cfg.MaxTokens)
+	if len(tokens) == 0 {
+		return nil, false, false
+	}
+	leaf := d.leaf(tokens)
+
+	best, bestSim, bestWild := (*Cluster)(nil), -1.0, -1
+	for _, cl := range leaf.clusters {
+		sim, wild := similarity(cl.Template, tokens)
+		if sim > bestSim || (sim == bestSim && wild > bestWild) {
+			best, bestSim, bestWild = cl, sim, wild
+		}
+	}
+
+	if best != nil && (bestSim >= d.cfg.Similarity || d.full()) {
+		for i, t := range tokens {
+			if best.Template[i] != Wildcard && best.Template[i] != t {
+				best.Template[i] = Wildcard
+				changed = true
+			}
+		}
+		return best, false, changed
+	}
+	if d.full() {
+		return nil, false, false
+	}
+
+	c = &Cluster{Template: tokens}
+	c.ID = d.newID(c.Template)
+	leaf.clusters = append(leaf.clusters, c)
+	d.count++
+	return c, true, true
+}
+
+// Load restores a known template, e.g. after a restart, so its id is kept.
+func (d *Drain) Load(id, template string) {
+	tokens := strings.Fields(template)
+	if len(tokens) == 0 {
+		return
+	}
+	leaf := d.leaf(tokens)
+	for _, cl := range leaf.clusters {
+		if cl.ID == id {
+			return
+		}
+	}
+	leaf.clusters = append(leaf.clusters, &Cluster{ID: id, Template: tokens})
+	d.count++
+}
+
+func (d *Drain) full() bool {
+	return d.cfg.MaxClusters > 0 && d.count >= d.cfg.MaxClusters
+}
+
+// leaf walks (and grows) the tree to the leaf for tokens.
+func (d *Drain) leaf(tokens []string) *node {
+	n := d.root[len(tokens)]
+	if n == nil {
+		n = &node{children: map[string]*node{}}
+		d.root[len(tokens)] = n
+	}
+	for i := 0; i < d.cfg.Depth-3 && i < len(tokens); i++ {
+		key := tokens[i]
+		child := n.children[key]
+		if child == nil {
+			// keep one slot for the shared wildcard child
+			if key != Wildcard && len(n.children) >= d.cfg.MaxChildren-1 {
+				key = Wildcard
+				child = n.children[key]
+			}
+			if child == nil {
+				child = &node{children: map[string]*node{}}
+				n.children[key] = child
+			}
+		}
+		n = child
+	}
+	return n
+}
+
+// similarity returns the share of tokens equal to the template and the
+// number of template wildcards. A masked token matches a wildcard.
+func similarity(template, tokens []string) (float64, int) {
+	same, wild := 0, 0
+	for i, t := range template {
+		if t == tokens[i] {
+			same++
+		}
+		if t == Wildcard {
+			wild++
+		}
+	}
+	return float64(same) / float64(len(template)), wild
+}
@@ -0,0 +1,170 @@
+package logpattern
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// seqIDs names clusters c1, c2, ... in creation order.
+func seqIDs() func([]string) string {
+	n := 0
+	return func([]string) string {
+		n++
+		return "c" + strconv.Itoa(n)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		msg  string
+		max  int
+		want []string
+	}{
+		{"user alice logged in", 0, []string{"user", "alice", "logged", "in"}},
+		{"  took 15ms  from 10.0.0.1 ", 0, []string{"took", Wildcard, "from", Wildcard}},
+		{"request id=abc42 done", 0, []string{"request", Wildcard, "done"}},
+		{"a b c d e", 3, []string{"a", "b", "c"}},
+		{"", 0, []string{}},
+	}
+	for _, tt := range tests {
+		if got := Tokenize(tt.msg, tt.max); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q, %d) = %q, want %q", tt.msg, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestAddMergesSimilarMessages(t *testing.T) {
+	d := New(DefaultConfig, seqIDs())
+
+	c, created, changed := d.Add("user alice logged in")
+	if c == nil || !created || !changed || c.String() != "user alice logged in" {
+		t.Fatalf("first Add = %v, %v, %v", c, created, changed)
+	}
+	first := c.ID
+
+	// one differing token becomes a wildcard
+	c, created, changed = d.Add("user bob logged in")
+	if c.ID != first || created || !changed {
+		t.Errorf("second Add = %s, %v, %v, want %s, false, true", c.ID, created, changed, first)
+	}
+	if got, want := c.String(), "user <*> logged in"; got != want {
+		t.Errorf("template = %q, want %q", got, want)
+	}
+
+	// further matches leave the template alone
+	c, created, changed = d.Add("user carol logged in")
+	if c.ID != first || created || changed {
+		t.Errorf("third Add = %s, %v, %v, want %s, false, false", c.ID, created, changed, first)
+	}
+	if d.Len() != 1 {
+		t.Errorf("Len = %d, want 1", d.Len())
+	}
+}
+
+func TestAddSeparatesDissimilarMessages(t *testing.T) {
+	d := New(DefaultConfig, seqIDs())
+	msgs := []struct {
+		msg, id, template string
+	}{
+		{"user alice logged in", "c1", "user alice logged in"},
+		{"user failed password check", "c2", "user failed password check"}, // similarity 1/4
+		{"user alice logged out now", "c3", "user alice logged out now"},   // other length
+		{"disk sda1 is full", "c4", "disk <*> is full"},                    // other first token
+		{"disk sdb2 is full", "c4", "disk <*> is full"},                    // masked token matches
+		{"user bob logged in", "c1", "user <*> logged in"},
+	}
+	for _, m := range msgs {
+		c, _, _ := d.Add(m.msg)
+		if c == nil || c.ID != m.id || c.String() != m.template {
+			t.Errorf("Add(%q) = %v, want %s %q", m.msg, c, m.id, m.template)
+		}
+	}
+	if d.Len() != 4 {
+		t.Errorf("Len = %d, want 4", d.Len())
+	}
+}
+
+func TestAddPrefersTemplateWithMoreWildcards(t *testing.T) {
+	d := New(DefaultConfig, seqIDs())
+	d.Load("exact", "job a finished ok")
+	d.Load("general", "job <*> finished ok")
+	// both templates match 3 of 4 tokens
+	c, _, _ := d.Add("job b finished ok")
+	if c == nil || c.ID != "general" {
+		t.Errorf("Add matched %v, want general", c)
+	}
+}
+
+func TestAddBlank(t *testing.T) {
+	d := New(DefaultConfig, seqIDs())
+	if c, created, changed := d.Add("  \t "); c != nil || created || changed {
+		t.Errorf("Add(blank) = %v, %v, %v", c, created, changed)
+	}
+}
+
+func TestMaxClusters(t *testing.T) {
+	d := New(Config{Depth: 4, Similarity: 0.4, MaxChildren: 100, MaxClusters: 1, MaxTokens: 64}, seqIDs())
+	d.Add("user alice logged in")
+
+	// once full, a message joins the closest template of its leaf
+	c, created, changed := d.Add("user failed password check")
+	if c == nil || c.ID != "c1" || created || !changed {
+		t.Errorf("Add when full = %v, %v, %v, want c1 joined", c, created, changed)
+	}
+	if got, want := c.String(), "user <*> <*> <*>"; got != want {
+		t.Errorf("template = %q, want %q", got, want)
+	}
+	// and is dropped when its leaf is empty
+	if c, _, _ := d.Add("disk is full"); c != nil {
+		t.Errorf("Add to empty leaf when full = %v, want nil", c)
+	}
+	if d.Len() != 1 {
+		t.Errorf("Len = %d, want 1", d.Len())
+	}
+}
+
+func TestMaxChildren(t *testing.T) {
+	d := New(Config{Depth: 4, Similarity: 0.4, MaxChildren: 2, MaxTokens: 64}, seqIDs())
+	d.Add("alpha started")
+	// the only other slot is the shared wildcard child
+	d.Add("beta started")
+	d.Add("gamma started")
+	c, _, _ := d.Add("delta started")
+	if c == nil || c.ID != "c2" || c.String() != "<*> started" {
+		t.Errorf("Add under a full node = %v, want c2 \"<*> started\"", c)
+	}
+	if d.Len() != 2 {
+		t.Errorf("Len = %d, want 2", d.Len())
+	}
+}
+
+func TestLoadKeepsID(t *testing.T) {
+	d := New(DefaultConfig, func([]string) string {
+		t.Error("newID called for a loaded template")
+		return ""
+	})
+	d.Load("p-42", "user <*> logged in")
+	d.Load("p-42", "user <*> logged in") // reloading is a no-op
+	d.Load("p-blank", "   ")
+	if d.Len() != 1 {
+		t.Fatalf("Len = %d, want 1", d.Len())
+	}
+
+	c, created, changed := d.Add("user dave logged in")
+	if c == nil || c.ID != "p-42" || created || changed {
+		t.Errorf("Add after Load = %v, %v, %v, want p-42 unchanged", c, created, changed)
+	}
+}
+
+func TestLoadThenGeneralize(t *testing.T) {
+	d := New(DefaultConfig, seqIDs())
+	d.Load("p-1", "GET /health 200 ok")
+	c, created, changed := d.Add("GET /ready 200 ok")
+	if c == nil || c.ID != "p-1" || created || !changed {
+		t.Fatalf("Add after Load = %v, %v, %v", c, created, changed)
+	}
+	if got, want := c.String(), "GET <*> <*> ok"; got != want {
+		t.Errorf("template = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,414 @@
+package logquery
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Node
+	}{
+		{"", nil},
+		{"timeout", Term{Value: "timeout"}},
+		{`"connection refused"`, Term{Value: "connection refused", Phrase: true}},
+		{"level:error service:api*", And{Nodes: []Node{
+			Term{Field: "level", Value: "error"},
+			Term{Field: "service", Value: "api*"},
+		}}},
+		{"a OR b AND c", Or{Nodes: []Node{
+			Term{Value: "a"},
+			And{Nodes: []Node{Term{Value: "b"}, Term{Value: "c"}}},
+		}}},
+		{"-host_id:3", Not{Node: Term{Field: "host_id", Value: "3"}}},
+		{"NOT meta.env:staging", Not{Node: Term{Field: "meta.env", Value: "staging"}}},
+		{"region:(eu-west OR eu-central)", Or{Nodes: []Node{
+			Term{Field: "region", Value: "eu-west"},
+			Term{Field: "region", Value: "eu-central"},
+		}}},
+		{"status:[500 TO 599}", Range{Field: "status", Lower: "500", Upper: "599", IncludeLower: true}},
+		{"status:{* TO 400]", Range{Field: "status", Upper: "400", IncludeUpper: true}},
+		{"status:>=500", Range{Field: "status", Lower: "500", IncludeLower: true}},
+		{"status:<400", Range{Field: "status", Upper: "400"}},
+		{`path:a\:b`, Term{Field: "path", Value: "a:b"}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %#v, want %#v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, in := range []string{
+		`"unterminated`,
+		"(level:error",
+		"level:error)",
+		"status:[1 2]",
+		"status:[1 TO 2",
+		"level:",
+		"a:(b:c)",
+		strings.Repeat("(", maxDepth+1) + "a" + strings.Repeat(")", maxDepth+1),
+		strings.Repeat("a ", maxClauses+1),
+		strings.Repeat("a", maxQueryLength+1),
+	} {
+		if _, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want bson.M
+	}{
+		{"", bson.M{}},
+		{"host_id:7", bson.M{"host_id": int64(7)}},
+		{"service:api", bson.M{"meta.service": "api"}},
+		{"meta.service:api*", bson.M{"meta.service": primitive.Regex{Pattern: "^api.*$"}}},
+		{"level:error", bson.M{"level": primitive.Regex{Pattern: "^error$", Options: "i"}}},
+		{`"a.b"`, bson.M{"message": primitive.Regex{Pattern: `a\.b`, Options: "i"}}},
+		{"service:*", bson.M{"meta.service": bson.M{"$exists": true, "$nin": bson.A{"", nil}}}},
+		{"timestamp:[now-1h TO now]", bson.M{"timestamp": bson.M{"$gte": now.Add(-time.Hour), "$lte": now}}},
+		{"host_id:{1 TO *]", bson.M{"host_id": bson.M{"$gt": int64(1)}}},
+		{"version:[v1 TO v2]", bson.M{"meta.version": bson.M{"$gte": "v1", "$lte": "v2"}}},
+		{"-level:debug", bson.M{"$nor": bson.A{bson.M{"level": primitive.Regex{Pattern: "^debug$", Options: "i"}}}}},
+	}
+	for _, tt := range tests {
+		got, err := CompileString(tt.in, now)
+		if err != nil {
+			t.Errorf("CompileString(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("CompileString(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, in := range []string{
+		"host_id:abc",
+		"host_id:[1 TO x]",
+		"timestamp:now",
+		"timestamp:[yesterday TO now]",
+		"timestamp:[now-99999w TO now]",
+		"$where:1",
+		"meta.a..b:1",
+	} {
+		if _, err := CompileString(in, time.Now()); err == nil {
+			t.Errorf("CompileString(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"90s", 90 * time.Second, true},
+		{"1h30m", 90 * time.Minute, true},
+		{"2d", 48 * time.Hour, true},
+		{"1w", 7 * 24 * time.Hour, true},
+		{"520w", 520 * 7 * 24 * time.Hour, true},
+		{"0s", 0, false},
+		{"-5m", 0, false},
+		{"0d", 0, false},
+		{"xd", 0, false},
+		{"3651d", 0, false},
+		{"999999999999w", 0, false},
+		{"100000h", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseDuration(%q) = %v, %v; want %v, ok=%v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+// TestMatcherParity checks that Matcher and the MongoDB filter from Compile
+// agree on every query and log. The filter is evaluated by evalFilter, which
+// implements the operators Compile emits.
+func TestMatcherParity(t *testing.T) {
+	now := time.Now()
+	logs := []*models.Log{
+		{HostID: 3, Timestamp: now.Add(-10 * time.Minute), Level: "ERROR", Message: "Connection refused by db.internal",
+			Meta: map[string]string{"service": "api-gateway", "status": "503", "env": "prod"}},
+		{HostID: 7, Timestamp: now.Add(-2 * time.Hour), Level: "info", Message: "request served",
+			Meta: map[string]string{"service": "web", "status": "1000", "env": "staging"}, CorrelID: "abc"},
+		{HostID: 9, Timestamp: now.Add(-30 * time.Second), Level: "warn", Message: "slow query",
+			Meta: map[string]string{"service": "", "status": "n/a"}, PatternID: "p1"},
+		{HostID: 12, Timestamp: now.Add(-5 * time.Minute), Level: "debug", Message: "cache miss 42",
+			Meta: map[string]string{"status": "99.5"}},
+	}
+	queries := []string{
+		"",
+		"refused",
+		`"request served"`,
+		"level:error",
+		"level:ERR*",
+		"service:api*",
+		"service:*",
+		"service:web",
+		"-service:web",
+		"NOT env:staging",
+		"host_id:7",
+		"host_id:[4 TO 10]",
+		"host_id:>9",
+		"status:[500 TO 599]",
+		"status:>=100",
+		"status:<500",
+		"status:{99.5 TO 1000]",
+		"status:[a TO z]",
+		"status:[* TO *]",
+		"timestamp:[now-15m TO now]",
+		"timestamp:<now-1h",
+		"trace_id:abc",
+		"pattern:*",
+		"(level:error OR level:warn) AND NOT host_id:9",
+		"cache 42",
+	}
+	for _, q := range queries {
+		n, err := Parse(q)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", q, err)
+		}
+		filter, err := Compile(n, now)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", q, err)
+		}
+		m, err := NewMatcher(n)
+		if err != nil {
+			t.Fatalf("NewMatcher(%q): %v", q, err)
+		}
+		m.now = func() time.Time { return now }
+		for i, l := range logs {
+			if got, want := m.Match(l), evalFilter(filter, logDocument(l)); got != want {
+				t.Errorf("query %q, log %d: Matcher = %v, filter = %v", q, i, got, want)
+			}
+		}
+	}
+}
+
+func TestMatcherNumericRange(t *testing.T) {
+	l := &models.Log{Meta: map[string]string{"status": "1000"}}
+	for q, want := range map[string]bool{
+		"status:[500 TO 599]": false,
+		"status:>=500":        true,
+		"status:[a TO z]":     false,
+		"status:>10a":         false,
+	} {
+		n, err := Parse(q)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", q, err)
+		}
+		m, err := NewMatcher(n)
+		if err != nil {
+			t.Fatalf("NewMatcher(%q): %v", q, err)
+		}
+		if got := m.Match(l); got != want {
+			t.Errorf("%q matches status=1000: %v, want %v", q, got, want)
+		}
+	}
+}
+
+// logDocument is l as stored in MongoDB.
+func logDocument(l *models.Log) map[string]interface{} {
+	meta := map[string]interface{}{}
+	for k, v := range l.Meta {
+		meta[k] = v
+	}
+	doc := map[string]interface{}{
+		"host_id": l.HostID, "timestamp": l.Timestamp, "level": l.Level, "message": l.Message, "meta": meta,
+	}
+	if l.CorrelID != "" {
+		doc["correlation_id"] = l.CorrelID
+	}
+	if l.PatternID != "" {
+		doc["pattern_id"] = l.PatternID
+	}
+	return doc
+}
+
+func lookup(doc map[string]interface{}, path string) (interface{}, bool) {
+	var cur interface{} = doc
+	for _, part := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func evalFilter(f bson.M, doc map[string]interface{}) bool {
+	for key, cond := range f {
+		var ok bool
+		switch key {
+		case "$and", "$or", "$nor":
+			anyOK := false
+			allOK := true
+			for _, c := range cond.(bson.A) {
+				r := evalFilter(c.(bson.M), doc)
+				anyOK = anyOK || r
+				allOK = allOK && r
+			}
+			ok = map[string]bool{"$and": allOK, "$or": anyOK, "$nor": !anyOK}[key]
+		case "$expr":
+			ok = evalExpr(cond, doc) == true
+		default:
+			ok = evalField(cond, doc, key)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func evalField(cond interface{}, doc map[string]interface{}, path string) bool {
+	v, present := lookup(doc, path)
+	switch c := cond.(type) {
+	case primitive.Regex:
+		s, isString := v.(string)
+		pattern := c.Pattern
+		if strings.Contains(c.Options, "i") {
+			pattern = "(?i)" + pattern
+		}
+		return isString && regexp.MustCompile(pattern).MatchString(s)
+	case bson.M:
+		for op, arg := range c {
+			switch op {
+			case "$exists":
+				if present != arg.(bool) {
+					return false
+				}
+			case "$nin":
+				for _, x := range arg.(bson.A) {
+					if x == v || (x == nil && !present) {
+						return false
+					}
+				}
+			default:
+				if !present {
+					return false
+				}
+				cmp, comparable := compareValues(v, arg)
+				if !comparable {
+					return false
+				}
+				if !map[string]bool{"$gt": cmp > 0, "$gte": cmp >= 0, "$lt": cmp < 0, "$lte": cmp <= 0}[op] {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return present && v == cond
+}
+
+func compareValues(a, b interface{}) (int, bool) {
+	switch a := a.(type) {
+	case int64:
+		b, ok := b.(int64)
+		if !ok {
+			return 0, false
+		}
+		return int(a - b), true
+	case time.Time:
+		b, ok := b.(time.Time)
+		if !ok {
+			return 0, false
+		}
+		return a.Compare(b), true
+	case string:
+		b, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(a, b), true
+	case float64:
+		b, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case a < b:
+			return -1, true
+		case a > b:
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// evalExpr evaluates the aggregation expressions used by numeric ranges.
+func evalExpr(e interface{}, doc map[string]interface{}) interface{} {
+	switch e := e.(type) {
+	case string:
+		if strings.HasPrefix(e, "$") {
+			v, _ := lookup(doc, e[1:])
+			return v
+		}
+		return e
+	case bson.M:
+		for op, arg := range e {
+			switch op {
+			case "$convert":
+				spec := arg.(bson.M)
+				s, ok := evalExpr(spec["input"], doc).(string)
+				if !ok {
+					return nil
+				}
+				f, err := strconv.ParseFloat(s, 64)
+				if err != nil {
+					return nil
+				}
+				return f
+			case "$and":
+				for _, c := range arg.(bson.A) {
+					if evalExpr(c, doc) != true {
+						return false
+					}
+				}
+				return true
+			case "$ne":
+				args := arg.(bson.A)
+				return evalExpr(args[0], doc) != evalExpr(args[1], doc)
+			default:
+				args := arg.(bson.A)
+				a, b := evalExpr(args[0], doc), evalExpr(args[1], doc)
+				cmp, ok := compareValues(a, b)
+				if !ok {
+					// MongoDB orders null before numbers
+					cmp = -1
+				}
+				return map[string]bool{"$gt": cmp > 0, "$gte": cmp >= 0, "$lt": cmp < 0, "$lte": cmp <= 0}[op]
+			}
+		}
+	}
+	return e
+}
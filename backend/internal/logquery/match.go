@@ -0,0 +1,218 @@
+package logquery
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/models"
+)
+
+// Matcher evaluates a query against logs in memory with the same semantics
+// as the MongoDB filter produced by Compile. It is used where logs are
+// filtered before they are stored, such as live tails.
+type Matcher struct {
+	node  Node
+	regex map[*Term]*regexp.Regexp
+	now   func() time.Time
+}
+
+// NewMatcher validates n and prepares it for matching. A nil node matches
+// every log.
+func NewMatcher(n Node) (*Matcher, error) {
+	// Compile performs all field and value validation
+	if _, err := Compile(n, time.Now()); err != nil {
+		return nil, err
+	}
+	m := &Matcher{regex: map[*Term]*regexp.Regexp{}, now: time.Now}
+	m.node = m.prepare(n)
+	return m, nil
+}
+
+// prepare copies terms to stable pointers and precompiles their patterns.
+func (m *Matcher) prepare(n Node) Node {
+	switch n := n.(type) {
+	case And:
+		out := And{Nodes: make([]Node, len(n.Nodes))}
+		for i, c := range n.Nodes {
+			out.Nodes[i] = m.prepare(c)
+		}
+		return out
+	case Or:
+		out := Or{Nodes: make([]Node, len(n.Nodes))}
+		for i, c := range n.Nodes {
+			out.Nodes[i] = m.prepare(c)
+		}
+		return out
+	case Not:
+		return Not{Node: m.prepare(n.Node)}
+	case Term:
+		t := n
+		path := "message"
+		if t.Field != "" {
+			path, _ = ResolveField(t.Field)
+		}
+		switch {
+		case path == "message":
+			m.regex[&t] = regexp.MustCompile("(?i)" + valuePattern(t, false))
+		case path == "level":
+			m.regex[&t] = regexp.MustCompile("(?i)" + valuePattern(t, true))
+		case !t.Phrase && t.Value != "*" && strings.ContainsAny(t.Value, "*?"):
+			m.regex[&t] = regexp.MustCompile(valuePattern(t, true))
+		}
+		return &t
+	}
+	return n
+}
+
+// Match reports whether l satisfies the query.
+func (m *Matcher) Match(l *models.Log) bool {
+	if m == nil || m.node == nil {
+		return true
+	}
+	return m.match(m.node, l)
+}
+
+func (m *Matcher) match(n Node, l *models.Log) bool {
+	switch n := n.(type) {
+	case And:
+		for _, c := range n.Nodes {
+			if !m.match(c, l) {
+				return false
+			}
+		}
+		return true
+	case Or:
+		for _, c := range n.Nodes {
+			if m.match(c, l) {
+				return true
+			}
+		}
+		return false
+	case Not:
+		return !m.match(n.Node, l)
+	case *Term:
+		return m.matchTerm(n, l)
+	case Range:
+		return m.matchRange(n, l)
+	}
+	return false
+}
+
+// FieldValue returns the value of a query field (message, level, service,
+// meta.status, ...) in l and whether it is present.
+func FieldValue(field string, l *models.Log) (string, bool) {
+	path, err := ResolveField(field)
+	if err != nil || path == "timestamp" {
+		return "", false
+	}
+	return fieldValue(path, l)
+}
+
+// fieldValue returns the string value of a document path and whether it is
+// present.
+func fieldValue(path string, l *models.Log) (string, bool) {
+	switch path {
+	case "message":
+		return l.Message, true
+	case "level":
+		return l.Level, true
+	case "host_id":
+		return strconv.FormatInt(l.HostID, 10), true
+	case "correlation_id":
+		return l.CorrelID, l.CorrelID != ""
+	case "pattern_id":
+		return l.PatternID, l.PatternID != ""
+	}
+	v, ok := l.Meta[strings.TrimPrefix(path, "meta.")]
+	return v, ok
+}
+
+func (m *Matcher) matchTerm(t *Term, l *models.Log) bool {
+	path := "message"
+	if t.Field != "" {
+		path, _ = ResolveField(t.Field)
+	}
+	if path == "timestamp" {
+		return false
+	}
+	v, ok := fieldValue(path, l)
+	if !t.Phrase && t.Value == "*" {
+		return ok && v != ""
+	}
+	if !ok {
+		return false
+	}
+	if re := m.regex[t]; re != nil {
+		return re.MatchString(v)
+	}
+	return v == t.Value
+}
+
+func (m *Matcher) matchRange(r Range, l *models.Log) bool {
+	path, _ := ResolveField(r.Field)
+
+	var cmp func(bound string) (int, bool)
+	switch path {
+	case "timestamp":
+		cmp = func(bound string) (int, bool) {
+			b, err := ParseTime(bound, m.now())
+			if err != nil {
+				return 0, false
+			}
+			return l.Timestamp.Compare(b), true
+		}
+	case "host_id":
+		cmp = func(bound string) (int, bool) {
+			b, err := strconv.ParseInt(bound, 10, 64)
+			if err != nil {
+				return 0, false
+			}
+			switch {
+			case l.HostID < b:
+				return -1, true
+			case l.HostID > b:
+				return 1, true
+			}
+			return 0, true
+		}
+	default:
+		v, ok := fieldValue(path, l)
+		if !ok {
+			return false
+		}
+		if numericRange(path, r) {
+			x, ok := parseNumber(v)
+			if !ok {
+				return false
+			}
+			cmp = func(bound string) (int, bool) {
+				b, _ := parseNumber(bound)
+				switch {
+				case x < b:
+					return -1, true
+				case x > b:
+					return 1, true
+				}
+				return 0, true
+			}
+			break
+		}
+		cmp = func(bound string) (int, bool) { return strings.Compare(v, bound), true }
+	}
+
+	if r.Lower != "" {
+		c, ok := cmp(r.Lower)
+		if !ok || c < 0 || (c == 0 && !r.IncludeLower) {
+			return false
+		}
+	}
+	if r.Upper != "" {
+		c, ok := cmp(r.Upper)
+		if !ok || c > 0 || (c == 0 && !r.IncludeUpper) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,313 @@
+package logquery
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var fieldPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_\-]*(\.[A-Za-z0-9_\-]+)*$`)
+
+// ResolveField maps a query field to its document path: message, level,
+// host_id, timestamp, correlation_id and pattern_id are top-level, everything
+// else is a meta key. Field names are restricted to letters, digits, _, - and
+// dots so they cannot smuggle operators into a filter.
+func ResolveField(field string) (string, error) {
+	if len(field) > 128 || !fieldPattern.MatchString(field) {
+		return "", fmt.Errorf("invalid field %q", field)
+	}
+	switch strings.ToLower(field) {
+	case "message", "msg":
+		return "message", nil
+	case "level", "severity":
+		return "level", nil
+	case "host_id":
+		return "host_id", nil
+	case "timestamp", "@timestamp", "time":
+		return "timestamp", nil
+	case "correlation_id", "trace_id":
+		return "correlation_id", nil
+	case "pattern_id", "pattern":
+		return "pattern_id", nil
+	}
+	if strings.HasPrefix(field, "meta.") {
+		return field, nil
+	}
+	return "meta." + field, nil
+}
+
+// Compile translates a parsed query into a MongoDB filter. A nil node yields
+// an empty filter. now anchors relative times such as now-15m.
+func Compile(n Node, now time.Time) (bson.M, error) {
+	if n == nil {
+		return bson.M{}, nil
+	}
+	return compile(n, now)
+}
+
+// CompileString parses and compiles a query in one step.
+func CompileString(q string, now time.Time) (bson.M, error) {
+	n, err := Parse(q)
+	if err != nil {
+		return nil, err
+	}
+	return Compile(n, now)
+}
+
+func compile(n Node, now time.Time) (bson.M, error) {
+	switch n := n.(type) {
+	case And:
+		parts, err := compileAll(n.Nodes, now)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{"$and": parts}, nil
+	case Or:
+		parts, err := compileAll(n.Nodes, now)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{"$or": parts}, nil
+	case Not:
+		inner, err := compile(n.Node, now)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{"$nor": bson.A{inner}}, nil
+	case Term:
+		return compileTerm(n, now)
+	case Range:
+		return compileRange(n, now)
+	}
+	return nil, fmt.Errorf("unsupported query node %T", n)
+}
+
+func compileAll(nodes []Node, now time.Time) (bson.A, error) {
+	out := make(bson.A, 0, len(nodes))
+	for _, n := range nodes {
+		f, err := compile(n, now)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+func compileTerm(t Term, now time.Time) (bson.M, error) {
+	path := "message"
+	if t.Field != "" {
+		var err error
+		if path, err = ResolveField(t.Field); err != nil {
+			return nil, err
+		}
+	}
+
+	if !t.Phrase && t.Value == "*" {
+		if path == "host_id" || path == "timestamp" {
+			return bson.M{path: bson.M{"$exists": true}}, nil
+		}
+		return bson.M{path: bson.M{"$exists": true, "$nin": bson.A{"", nil}}}, nil
+	}
+
+	switch path {
+	case "host_id":
+		id, err := strconv.ParseInt(t.Value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("host_id expects a number, got %q", t.Value)
+		}
+		return bson.M{"host_id": id}, nil
+	case "timestamp":
+		return nil, fmt.Errorf("timestamp needs a range, e.g. timestamp:[now-1h TO now]")
+	case "message":
+		// message is free text: match a case-insensitive substring
+		return bson.M{path: primitive.Regex{Pattern: valuePattern(t, false), Options: "i"}}, nil
+	case "level":
+		return bson.M{path: primitive.Regex{Pattern: valuePattern(t, true), Options: "i"}}, nil
+	}
+
+	if !t.Phrase && strings.ContainsAny(t.Value, "*?") {
+		return bson.M{path: primitive.Regex{Pattern: valuePattern(t, true)}}, nil
+	}
+	return bson.M{path: t.Value}, nil
+}
+
+// valuePattern builds a regex for a term, treating * and ? as wildcards
+// unless the term is a phrase and quoting everything else.
+func valuePattern(t Term, anchored bool) string {
+	var b strings.Builder
+	if anchored {
+		b.WriteByte('^')
+	}
+	if t.Phrase {
+		b.WriteString(regexp.QuoteMeta(t.Value))
+	} else {
+		for _, r := range t.Value {
+			switch r {
+			case '*':
+				b.WriteString(".*")
+			case '?':
+				b.WriteByte('.')
+			default:
+				b.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+	}
+	if anchored {
+		b.WriteByte('$')
+	}
+	return b.String()
+}
+
+func compileRange(r Range, now time.Time) (bson.M, error) {
+	path, err := ResolveField(r.Field)
+	if err != nil {
+		return nil, err
+	}
+	if r.Lower == "" && r.Upper == "" {
+		return bson.M{path: bson.M{"$exists": true}}, nil
+	}
+
+	if numericRange(path, r) {
+		return compileNumericRange(path, r), nil
+	}
+
+	bound := func(v string) (interface{}, error) {
+		switch path {
+		case "host_id":
+			return strconv.ParseInt(v, 10, 64)
+		case "timestamp":
+			return ParseTime(v, now)
+		}
+		return v, nil
+	}
+
+	cond := bson.M{}
+	if r.Lower != "" {
+		v, err := bound(r.Lower)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s bound %q", r.Field, r.Lower)
+		}
+		if r.IncludeLower {
+			cond["$gte"] = v
+		} else {
+			cond["$gt"] = v
+		}
+	}
+	if r.Upper != "" {
+		v, err := bound(r.Upper)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s bound %q", r.Field, r.Upper)
+		}
+		if r.IncludeUpper {
+			cond["$lte"] = v
+		} else {
+			cond["$lt"] = v
+		}
+	}
+	return bson.M{path: cond}, nil
+}
+
+// numericRange reports whether a range over a text field compares numbers:
+// all its bounds parse as numbers.
+func numericRange(path string, r Range) bool {
+	if path == "host_id" || path == "timestamp" || (r.Lower == "" && r.Upper == "") {
+		return false
+	}
+	for _, b := range []string{r.Lower, r.Upper} {
+		if _, ok := parseNumber(b); b != "" && !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// compileNumericRange converts the stored string to a number on the server.
+// Values that are not numbers never match.
+func compileNumericRange(path string, r Range) bson.M {
+	value := bson.M{"$convert": bson.M{"input": "$" + path, "to": "double", "onError": nil, "onNull": nil}}
+	cond := bson.A{bson.M{"$ne": bson.A{value, nil}}}
+	if v, ok := parseNumber(r.Lower); ok {
+		op := "$gt"
+		if r.IncludeLower {
+			op = "$gte"
+		}
+		cond = append(cond, bson.M{op: bson.A{value, v}})
+	}
+	if v, ok := parseNumber(r.Upper); ok {
+		op := "$lt"
+		if r.IncludeUpper {
+			op = "$lte"
+		}
+		cond = append(cond, bson.M{op: bson.A{value, v}})
+	}
+	return bson.M{"$expr": bson.M{"$and": cond}}
+}
+
+// parseNumber parses plain decimal numbers such as 42, -1.5 or 2e3, the
+// forms both Go and MongoDB's $convert accept.
+func parseNumber(v string) (float64, bool) {
+	if v == "" || strings.Trim(v, "0123456789+-.eE") != "" {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+// ParseTime accepts RFC 3339 times, "now" and "now-<n><unit>" with units
+// s, m, h, d and w.
+func ParseTime(v string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if v == "now" {
+		return now, nil
+	}
+	if !strings.HasPrefix(v, "now-") {
+		return time.Time{}, fmt.Errorf("invalid time %q", v)
+	}
+	d, err := ParseDuration(v[len("now-"):])
+	if err != nil {
+		return time.Time{}, err
+	}
+	return now.Add(-d), nil
+}
+
+// MaxDuration bounds the durations ParseDuration accepts.
+const MaxDuration = 10 * 365 * 24 * time.Hour
+
+// ParseDuration is time.ParseDuration extended with d (days) and w (weeks).
+// Durations must be positive and at most MaxDuration.
+func ParseDuration(v string) (time.Duration, error) {
+	if n := len(v); n > 1 && (v[n-1] == 'd' || v[n-1] == 'w') {
+		k, err := strconv.Atoi(v[:n-1])
+		if err != nil || k <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", v)
+		}
+		unit := 24 * time.Hour
+		if v[n-1] == 'w' {
+			unit *= 7
+		}
+		if k > int(MaxDuration/unit) {
+			return 0, fmt.Errorf("duration %q exceeds %s", v, MaxDuration)
+		}
+		return time.Duration(k) * unit, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", v)
+	}
+	if d > MaxDuration {
+		return 0, fmt.Errorf("duration %q exceeds %s", v, MaxDuration)
+	}
+	return d, nil
+}
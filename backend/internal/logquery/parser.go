@@ -0,0 +1,381 @@
+// Package logquery implements the Lucene-style log search syntax accepted by
+// the log search and aggregation endpoints:
+//
+//	level:error AND service:api* AND NOT meta.env:staging
+//	"connection refused" -host_id:3 timestamp:[now-1h TO now]
+//	status:>=500 (region:eu-west OR region:eu-central)
+//
+// Bare terms and phrases search the message. Fields other than message,
+// level, host_id, timestamp, correlation_id and pattern_id address meta keys,
+// with or without the "meta." prefix. Adjacent clauses are ANDed. Queries
+// compile to MongoDB filters with Compile; values never reach the filter as
+// operators.
+package logquery
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	maxQueryLength = 4096
+	maxClauses     = 64
+	maxDepth       = 16
+)
+
+// Node is a parsed query expression.
+type Node interface{ node() }
+
+// And matches when every child matches.
+type And struct{ Nodes []Node }
+
+// Or matches when any child matches.
+type Or struct{ Nodes []Node }
+
+// Not negates its child.
+type Not struct{ Node Node }
+
+// Term matches one field. Field is empty for bare terms, which search the
+// message. Value may contain * and ? wildcards unless Phrase is set; a lone *
+// matches any non-empty value.
+type Term struct {
+	Field  string
+	Value  string
+	Phrase bool
+}
+
+// Range matches a field between two bounds; an empty bound is open. Text
+// fields compare as numbers when every bound is a number, e.g.
+// meta.status:[500 TO 599], and as strings otherwise.
+type Range struct {
+	Field        string
+	Lower, Upper string
+	IncludeLower bool
+	IncludeUpper bool
+}
+
+func (And) node()   {}
+func (Or) node()    {}
+func (Not) node()   {}
+func (Term) node()  {}
+func (Range) node() {}
+
+// Error reports an invalid query and the byte offset of the problem.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid log query at position %d: %s", e.Pos, e.Msg)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokPunct // ( ) : [ ] { }
+)
+
+type token struct {
+	kind tokenKind
+	val  string
+	pos  int
+}
+
+func lex(input string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(input) {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.IndexByte("():[]{}", c) >= 0:
+			toks = append(toks, token{tokPunct, string(c), i})
+			i++
+		case c == '"':
+			start := i
+			i++
+			var b strings.Builder
+			closed := false
+			for i < len(input) {
+				if input[i] == '\\' && i+1 < len(input) {
+					b.WriteByte(input[i+1])
+					i += 2
+					continue
+				}
+				if input[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				b.WriteByte(input[i])
+				i++
+			}
+			if !closed {
+				return nil, &Error{Pos: start, Msg: "unterminated phrase"}
+			}
+			toks = append(toks, token{tokString, b.String(), start})
+		default:
+			start := i
+			var b strings.Builder
+			for i < len(input) && strings.IndexByte(" \t\n\r():[]{}\"", input[i]) < 0 {
+				// backslash escapes a special character inside a word
+				if input[i] == '\\' && i+1 < len(input) {
+					b.WriteByte(input[i+1])
+					i += 2
+					continue
+				}
+				b.WriteByte(input[i])
+				i++
+			}
+			toks = append(toks, token{tokWord, b.String(), start})
+		}
+	}
+	return append(toks, token{tokEOF, "", len(input)}), nil
+}
+
+type parser struct {
+	toks    []token
+	pos     int
+	depth   int
+	clauses int
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isWord(w string) bool {
+	t := p.peek()
+	return t.kind == tokWord && t.val == w
+}
+
+func (p *parser) isPunct(v string) bool {
+	t := p.peek()
+	return t.kind == tokPunct && t.val == v
+}
+
+// Parse parses a log query. An empty query yields a nil Node, which matches
+// everything.
+func Parse(input string) (Node, error) {
+	if len(input) > maxQueryLength {
+		return nil, &Error{Pos: maxQueryLength, Msg: fmt.Sprintf("query is longer than %d characters", maxQueryLength)}
+	}
+	toks, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	if p.peek().kind == tokEOF {
+		return nil, nil
+	}
+	n, err := p.parseOr("")
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("unexpected %q", t.val)}
+	}
+	return n, nil
+}
+
+// parseOr parses OR-separated clauses. field is the default field inside a
+// field:(...) group and empty at top level.
+func (p *parser) parseOr(field string) (Node, error) {
+	var nodes []Node
+	for {
+		n, err := p.parseAnd(field)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+		if !p.isWord("OR") && !p.isWord("||") {
+			break
+		}
+		p.next()
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return Or{Nodes: nodes}, nil
+}
+
+func (p *parser) parseAnd(field string) (Node, error) {
+	var nodes []Node
+	for {
+		n, err := p.parseUnary(field)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+		if p.isWord("AND") || p.isWord("&&") {
+			p.next()
+			continue
+		}
+		// adjacent clauses are an implicit AND
+		if t := p.peek(); t.kind == tokEOF || p.isPunct(")") || p.isWord("OR") || p.isWord("||") {
+			break
+		}
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return And{Nodes: nodes}, nil
+}
+
+func (p *parser) parseUnary(field string) (Node, error) {
+	t := p.peek()
+	switch {
+	case p.isWord("NOT") || (t.kind == tokWord && (t.val == "-" || t.val == "!")):
+		p.next()
+		n, err := p.parseUnary(field)
+		if err != nil {
+			return nil, err
+		}
+		return Not{Node: n}, nil
+	case t.kind == tokWord && len(t.val) > 1 && (t.val[0] == '-' || t.val[0] == '!'):
+		// "-term" / "-field:value": strip the prefix and negate
+		p.toks[p.pos].val = t.val[1:]
+		p.toks[p.pos].pos++
+		n, err := p.parsePrimary(field)
+		if err != nil {
+			return nil, err
+		}
+		return Not{Node: n}, nil
+	}
+	return p.parsePrimary(field)
+}
+
+func (p *parser) parsePrimary(field string) (Node, error) {
+	t := p.peek()
+	if p.isPunct("(") {
+		p.next()
+		p.depth++
+		if p.depth > maxDepth {
+			return nil, &Error{Pos: t.pos, Msg: "query is nested too deeply"}
+		}
+		n, err := p.parseOr(field)
+		if err != nil {
+			return nil, err
+		}
+		if !p.isPunct(")") {
+			return nil, &Error{Pos: p.peek().pos, Msg: "expected )"}
+		}
+		p.next()
+		p.depth--
+		return n, nil
+	}
+
+	p.clauses++
+	if p.clauses > maxClauses {
+		return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("query has more than %d clauses", maxClauses)}
+	}
+
+	switch t.kind {
+	case tokString:
+		p.next()
+		return Term{Field: field, Value: t.val, Phrase: true}, nil
+	case tokWord:
+		p.next()
+		if !p.isPunct(":") {
+			return termFromWord(field, t.val), nil
+		}
+		if field != "" {
+			return nil, &Error{Pos: t.pos, Msg: "field inside a field group"}
+		}
+		p.next()
+		return p.parseValue(t.val)
+	}
+	return nil, &Error{Pos: t.pos, Msg: "expected a term"}
+}
+
+// parseValue parses what follows "field:".
+func (p *parser) parseValue(field string) (Node, error) {
+	t := p.peek()
+	switch {
+	case p.isPunct("("):
+		// field:(a OR b) applies field to every term of the group
+		p.clauses--
+		return p.parsePrimary(field)
+	case p.isPunct("[") || p.isPunct("{"):
+		return p.parseRange(field)
+	case t.kind == tokString:
+		p.next()
+		return Term{Field: field, Value: t.val, Phrase: true}, nil
+	case t.kind == tokWord:
+		p.next()
+		return termFromWord(field, t.val), nil
+	}
+	return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("expected a value for %s", field)}
+}
+
+// termFromWord turns a word into a Term, or a half-open Range for the
+// comparison forms >x, >=x, <x and <=x.
+func termFromWord(field, w string) Node {
+	if field != "" {
+		for _, op := range []string{">=", "<=", ">", "<"} {
+			if strings.HasPrefix(w, op) && len(w) > len(op) {
+				v := w[len(op):]
+				switch op {
+				case ">=":
+					return Range{Field: field, Lower: v, IncludeLower: true}
+				case ">":
+					return Range{Field: field, Lower: v}
+				case "<=":
+					return Range{Field: field, Upper: v, IncludeUpper: true}
+				default:
+					return Range{Field: field, Upper: v}
+				}
+			}
+		}
+	}
+	return Term{Field: field, Value: w}
+}
+
+// parseRange parses [a TO b], {a TO b} or a mix; * is an open bound.
+func (p *parser) parseRange(field string) (Node, error) {
+	open := p.next()
+	r := Range{Field: field, IncludeLower: open.val == "["}
+
+	bound := func() (string, error) {
+		t := p.next()
+		if t.kind != tokWord && t.kind != tokString {
+			return "", &Error{Pos: t.pos, Msg: "expected a range bound"}
+		}
+		if t.kind == tokWord && t.val == "*" {
+			return "", nil
+		}
+		return t.val, nil
+	}
+
+	var err error
+	if r.Lower, err = bound(); err != nil {
+		return nil, err
+	}
+	if !p.isWord("TO") {
+		return nil, &Error{Pos: p.peek().pos, Msg: "expected TO"}
+	}
+	p.next()
+	if r.Upper, err = bound(); err != nil {
+		return nil, err
+	}
+
+	switch closeTok := p.next(); {
+	case closeTok.kind == tokPunct && closeTok.val == "]":
+		r.IncludeUpper = true
+	case closeTok.kind == tokPunct && closeTok.val == "}":
+	default:
+		return nil, &Error{Pos: closeTok.pos, Msg: "expected ] or }"}
+	}
+	return r, nil
+}
@@ -0,0 +1,83 @@
+package redpanda
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/segmentio/kafka-go"
+)
+
+// IngestWriter publishes raw agent events to the ingest topic when
+// INGEST_MODE=kafka. It is nil in synchronous mode.
+var IngestWriter *kafka.Writer
+
+// InitIngestProducer creates the ingest topic (best effort, with the given
+// number of partitions) and the writer used by ingest handlers. Messages are
+// partitioned by key hash so events of one host stay ordered.
+func InitIngestProducer(brokers []string, topic string, partitions int) error {
+	if len(brokers) == 0 {
+		return fmt.Errorf("no brokers configured")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := kafka.DialContext(ctx, "tcp", brokers[0])
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if partitions > 0 {
+		if err := createTopic(conn, topic, partitions); err != nil {
+			logging.Warnf("[INGEST] could not ensure topic %s (%d partitions): %v", topic, partitions, err)
+		}
+	}
+
+	IngestWriter = &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: 10 * time.Millisecond,
+	}
+	return nil
+}
+
+// createTopic creates topic on the cluster controller; an existing topic is
+// left untouched.
+func createTopic(conn *kafka.Conn, topic string, partitions int) error {
+	controller, err := conn.Controller()
+	if err != nil {
+		return err
+	}
+	cc, err := kafka.Dial("tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)))
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+	return cc.CreateTopics(kafka.TopicConfig{
+		Topic:             topic,
+		NumPartitions:     partitions,
+		ReplicationFactor: 1,
+	})
+}
+
+// IngestEnabled reports whether handlers should publish to the ingest topic
+// instead of writing synchronously.
+func IngestEnabled() bool {
+	return IngestWriter != nil
+}
+
+// PublishIngest writes msgs to the ingest topic, waiting for all in-sync
+// replicas so an acknowledged request is never lost.
+func PublishIngest(msgs []kafka.Message) error {
+	if IngestWriter == nil {
+		return fmt.Errorf("ingest writer not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return IngestWriter.WriteMessages(ctx, msgs...)
+}
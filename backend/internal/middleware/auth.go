@@ -2,12 +2,14 @@ package middleware
 
 //nolint:staticcheck // intentional usage of deprecated package for compatibility; see repository/postgres/connection.go
 import (
+	"encoding/base64"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/sakkurohilla/kineticops/backend/config"
 	"github.com/sakkurohilla/kineticops/backend/internal/auth"
 	"github.com/sakkurohilla/kineticops/backend/internal/repository/postgres"
+	"github.com/sakkurohilla/kineticops/backend/internal/services"
 )
 
 // AuthRequired returns a middleware handler (your existing function - keep it)
@@ -127,3 +129,59 @@ func AgentOrUserAuth() fiber.Handler {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing or invalid credentials"})
 	}
 }
+
+// IngestTokenAuth authenticates third-party telemetry receivers (OTLP,
+// Prometheus remote_write, etc.) by ingest token. The token may be sent in
+// X-Agent-Token or as "Authorization: Bearer <token>" since most exporters
+// only support the latter. The resolved tenant is required: the global
+// AGENT_TOKEN has no tenant and is therefore not accepted here. Influx
+// clients may instead use "Token <token>", basic auth or the ?p= query
+// parameter with the token as password.
+func IngestTokenAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := c.Get("X-Agent-Token")
+		if token == "" {
+			token = ingestTokenFromAuthorization(c.Get("Authorization"))
+		}
+		if token == "" {
+			// InfluxDB v1 clients send credentials as ?u=...&p=...
+			token = c.Query("p")
+		}
+		if token == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing ingest token"})
+		}
+
+		identity, err := services.ResolveIngestToken(token)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		c.Locals("agent_token", true)
+		c.Locals("tenant_id", identity.TenantID)
+		if identity.AgentID != 0 {
+			c.Locals("agent_id", identity.AgentID)
+		}
+		c.Locals("ingest_identity", identity)
+		return c.Next()
+	}
+}
+
+// ingestTokenFromAuthorization extracts an ingest token from a Bearer, Token
+// (InfluxDB v2) or Basic (InfluxDB v1, token as password) Authorization header.
+func ingestTokenFromAuthorization(header string) string {
+	switch {
+	case strings.HasPrefix(header, "Bearer "):
+		return strings.TrimPrefix(header, "Bearer ")
+	case strings.HasPrefix(header, "Token "):
+		return strings.TrimPrefix(header, "Token ")
+	case strings.HasPrefix(header, "Basic "):
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Basic "))
+		if err != nil {
+			return ""
+		}
+		if _, password, ok := strings.Cut(string(raw), ":"); ok {
+			return password
+		}
+	}
+	return ""
+}
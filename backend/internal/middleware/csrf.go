@@ -3,6 +3,7 @@ package middleware
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -35,6 +36,14 @@ func CSRFMiddleware(c *fiber.Ctx) error {
 		return c.Next()
 	}
 
+	// Skip CSRF for telemetry receivers (authenticated by ingest token, not cookies)
+	if c.Method() == "POST" && (strings.HasPrefix(path, "/api/v1/otlp/") ||
+		strings.HasPrefix(path, "/api/v1/apm/ingest/") ||
+		path == "/api/v1/prom/write" ||
+		path == "/api/v1/write" || path == "/api/v2/write") {
+		return c.Next()
+	}
+
 	// Skip CSRF for safe methods
 	if c.Method() == "GET" || c.Method() == "HEAD" || c.Method() == "OPTIONS" {
 		token := c.Cookies(csrfTokenKey)
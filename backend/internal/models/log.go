@@ -18,4 +18,5 @@ type Log struct {
 	Meta      map[string]string `bson:"meta" json:"meta"`
 	FullText  string            `bson:"full_text,omitempty" json:"full_text,omitempty"`
 	CorrelID  string            `bson:"correlation_id,omitempty" json:"correlation_id,omitempty"`
+	PatternID string            `bson:"pattern_id,omitempty" json:"pattern_id,omitempty"`
 }
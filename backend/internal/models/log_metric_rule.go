@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Log metric rule types
+const (
+	LogMetricCounter      = "counter"      // matching lines (or the sum of value_field) per minute
+	LogMetricDistribution = "distribution" // count/sum/min/max/avg/p50/p95/p99 of value_field per minute
+)
+
+// LogMetricRule derives a metric from the tenant's ingested logs. Logs
+// matching Query (log query language) are counted, or their numeric
+// ValueField is measured, per host and per value of the GroupBy fields.
+type LogMetricRule struct {
+	ID           int64     `gorm:"primaryKey" json:"id"`
+	TenantID     int64     `gorm:"index" json:"tenant_id"`
+	Name         string    `gorm:"size:128;not null" json:"name"` // metric name
+	Description  string    `gorm:"type:text" json:"description"`
+	Query        string    `gorm:"type:text" json:"query"`
+	Type         string    `gorm:"size:16;default:'counter'" json:"type"`
+	ValueField   string    `gorm:"size:128" json:"value_field"`
+	ValuePattern string    `gorm:"type:text" json:"value_pattern"` // regexp whose first group is the value
+	GroupBy      string    `gorm:"type:text" json:"group_by"`      // comma separated log fields
+	Enabled      bool      `json:"enabled"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var LogPatternCollection *mongo.Collection
+
+// LogPattern is a message template clustered from a tenant's logs of one
+// service. Logs carry its ID as pattern_id.
+type LogPattern struct {
+	ID        string    `bson:"_id" json:"id"`
+	TenantID  int64     `bson:"tenant_id" json:"tenant_id"`
+	Service   string    `bson:"service" json:"service"`
+	Template  string    `bson:"template" json:"template"`
+	Count     int64     `bson:"count" json:"count"`
+	FirstSeen time.Time `bson:"first_seen" json:"first_seen"`
+	LastSeen  time.Time `bson:"last_seen" json:"last_seen"`
+}
@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateDestination is returned when a channel targets a loopback,
+// private, link-local or otherwise internal address. Channel configs come
+// from tenants, so without this check they could reach services on the
+// backend's network, such as cloud metadata endpoints.
+var ErrPrivateDestination = errors.New("destination is a private or loopback address")
+
+var allowPrivate atomic.Bool
+
+// AllowPrivateDestinations lets channels reach internal addresses, for
+// deployments whose webhooks or mail servers live on the local network. The
+// default SMTP server set with SetDefaultSMTP is always allowed.
+func AllowPrivateDestinations(allow bool) {
+	allowPrivate.Store(allow)
+}
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), which
+// net.IP.IsPrivate does not cover.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func internalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		sharedAddressSpace.Contains(ip) || (ip.To4() != nil && ip.To4()[0] == 0)
+}
+
+// checkHost rejects literal internal addresses and localhost when channels
+// are configured, before any connection is attempted.
+func checkHost(host string) error {
+	if allowPrivate.Load() {
+		return nil
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s", ErrPrivateDestination, host)
+	}
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil && internalIP(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateDestination, host)
+	}
+	return nil
+}
+
+// dialer returns a dialer that refuses internal addresses after name
+// resolution, unless trusted or private destinations are allowed. Checking
+// the resolved address also covers redirects and DNS names pointing inside.
+func dialer(trusted bool) *net.Dialer {
+	d := &net.Dialer{Timeout: 10 * time.Second}
+	if trusted {
+		return d
+	}
+	d.Control = func(network, address string, _ syscall.RawConn) error {
+		if allowPrivate.Load() {
+			return nil
+		}
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip == nil || internalIP(ip) {
+			return fmt.Errorf("%w: %s", ErrPrivateDestination, host)
+		}
+		return nil
+	}
+	return d
+}
+
+// httpClient connects directly, without environment proxies, so the dialer
+// sees the real destination.
+var httpClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext:           dialer(false).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	},
+}
@@ -0,0 +1,303 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// SMTPServer is the mail server used by email channels.
+type SMTPServer struct {
+	Host     string `json:"smtp_host"`
+	Port     int    `json:"smtp_port"`
+	Username string `json:"smtp_username"`
+	Password string `json:"smtp_password"`
+	From     string `json:"from"`
+	// TLS is starttls (default: upgrade, required when authenticating),
+	// tls (implicit TLS, usually port 465) or none.
+	TLS                string `json:"tls"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+// EmailConfig sends multipart text/HTML mail to Recipients. Server fields
+// left empty fall back to the defaults set with SetDefaultSMTP. Subject is
+// a text/template over Event.
+type EmailConfig struct {
+	SMTPServer
+	Recipients []string `json:"recipients"`
+	Subject    string   `json:"subject"`
+}
+
+var (
+	smtpMu       sync.RWMutex
+	smtpDefaults SMTPServer
+)
+
+// SetDefaultSMTP sets the server used by email channels that do not name
+// their own.
+func SetDefaultSMTP(s SMTPServer) {
+	smtpMu.Lock()
+	smtpDefaults = s
+	smtpMu.Unlock()
+}
+
+const defaultSubject = `{{if eq .Action "trigger"}}[{{upper .Severity}}]{{else}}[{{upper (label .Action)}}]{{end}} {{.Title}}`
+
+const textBody = `{{.Title}}
+
+{{.Description}}
+
+{{if .GroupID}}Group:     #{{.GroupID}} ({{len .Alerts}} alerts, {{label .Action}}){{else}}Incident:  #{{.IncidentID}} ({{label .Action}}){{end}}
+Severity:  {{.Severity}}
+Status:    {{.Status}}
+Opened:    {{.OpenedAt.UTC.Format "2006-01-02 15:04:05 MST"}}
+{{- if .AckedBy}}
+Acknowledged by: {{.AckedBy}}
+{{- end}}
+
+--
+KineticOps alerting
+`
+
+const htmlBody = `<!DOCTYPE html>
+<html><body style="font-family:Arial,Helvetica,sans-serif;color:#1f2937">
+<h2 style="margin:0 0 8px">{{.Title}}</h2>
+<p style="margin:0 0 16px">{{.Description}}</p>
+<table cellpadding="4" style="border-collapse:collapse">
+{{- if .GroupID}}
+<tr><td><b>Group</b></td><td>#{{.GroupID}} ({{len .Alerts}} alerts, {{label .Action}})</td></tr>
+{{- else}}
+<tr><td><b>Incident</b></td><td>#{{.IncidentID}} ({{label .Action}})</td></tr>
+{{- end}}
+<tr><td><b>Severity</b></td><td>{{.Severity}}</td></tr>
+<tr><td><b>Status</b></td><td>{{.Status}}</td></tr>
+<tr><td><b>Opened</b></td><td>{{.OpenedAt.UTC.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+{{- if .AckedBy}}
+<tr><td><b>Acknowledged by</b></td><td>{{.AckedBy}}</td></tr>
+{{- end}}
+</table>
+<p style="color:#6b7280;font-size:12px">KineticOps alerting</p>
+</body></html>
+`
+
+var templateFuncs = map[string]interface{}{"upper": strings.ToUpper, "label": actionLabel}
+
+var (
+	textTemplate = template.Must(template.New("text").Funcs(templateFuncs).Parse(textBody))
+	htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(templateFuncs).Parse(htmlBody))
+)
+
+type emailSender struct {
+	cfg     EmailConfig
+	subject *template.Template
+	trusted bool // cfg uses the operator's default server
+}
+
+func newEmailSender(config []byte) (Sender, error) {
+	var cfg EmailConfig
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid email config: %w", err)
+	}
+
+	smtpMu.RLock()
+	def := smtpDefaults
+	smtpMu.RUnlock()
+	trusted := cfg.Host == ""
+	if trusted {
+		cfg.SMTPServer = def
+	} else if cfg.From == "" {
+		cfg.From = def.From
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 587
+		if cfg.TLS == "tls" {
+			cfg.Port = 465
+		}
+	}
+	switch cfg.TLS {
+	case "":
+		cfg.TLS = "starttls"
+	case "starttls", "tls", "none":
+	default:
+		return nil, fmt.Errorf("tls must be starttls, tls or none")
+	}
+
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("no smtp_host configured")
+	}
+	if !trusted {
+		if err := checkHost(cfg.Host); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := mail.ParseAddress(cfg.From); err != nil {
+		return nil, fmt.Errorf("invalid from address %q", cfg.From)
+	}
+	if len(cfg.Recipients) == 0 {
+		return nil, fmt.Errorf("email channel has no recipients")
+	}
+	for _, r := range cfg.Recipients {
+		if _, err := mail.ParseAddress(r); err != nil {
+			return nil, fmt.Errorf("invalid recipient %q", r)
+		}
+	}
+
+	subject := cfg.Subject
+	if subject == "" {
+		subject = defaultSubject
+	}
+	st, err := template.New("subject").Funcs(templateFuncs).Parse(subject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subject template: %w", err)
+	}
+	return &emailSender{cfg: cfg, subject: st, trusted: trusted}, nil
+}
+
+func (s *emailSender) Send(ctx context.Context, e Event) error {
+	msg, err := s.message(e)
+	if err != nil {
+		return Permanent(err)
+	}
+	return s.deliver(ctx, msg)
+}
+
+// message renders the MIME message for e.
+func (s *emailSender) message(e Event) ([]byte, error) {
+	var subject, text, html bytes.Buffer
+	if err := s.subject.Execute(&subject, e); err != nil {
+		return nil, err
+	}
+	if err := textTemplate.Execute(&text, e); err != nil {
+		return nil, err
+	}
+	if err := htmlTemplate.Execute(&html, e); err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=UTF-8", text.Bytes()},
+		{"text/html; charset=UTF-8", html.Bytes()},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(part.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	headers := [][2]string{
+		{"From", s.cfg.From},
+		{"To", strings.Join(s.cfg.Recipients, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String()))},
+		{"Date", e.Time.Format(time.RFC1123Z)},
+		{"Message-ID", fmt.Sprintf("<%s-%s-%d@kineticops>", e.DedupKey(), e.Action, e.Time.UnixNano())},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + mw.Boundary()},
+	}
+	for _, h := range headers {
+		msg.WriteString(h[0] + ": " + h[1] + "\r\n")
+	}
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// deliver runs one SMTP transaction. Reply codes 5xx are permanent.
+func (s *emailSender) deliver(ctx context.Context, msg []byte) error {
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: s.cfg.Host, InsecureSkipVerify: s.cfg.InsecureSkipVerify}
+
+	conn, err := dialer(s.trusted).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		if errors.Is(err, ErrPrivateDestination) {
+			return Permanent(err)
+		}
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if s.cfg.TLS == "tls" {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return smtpError(err)
+	}
+	defer c.Close()
+
+	if s.cfg.TLS == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(tlsConfig); err != nil {
+				return smtpError(err)
+			}
+		} else if s.cfg.Username != "" {
+			return Permanent(fmt.Errorf("%s does not support STARTTLS; refusing to send credentials", addr))
+		}
+	}
+	if s.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+			return smtpError(err)
+		}
+	}
+
+	from, _ := mail.ParseAddress(s.cfg.From)
+	if err := c.Mail(from.Address); err != nil {
+		return smtpError(err)
+	}
+	for _, r := range s.cfg.Recipients {
+		to, _ := mail.ParseAddress(r)
+		if err := c.Rcpt(to.Address); err != nil {
+			return smtpError(err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return smtpError(err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return smtpError(err)
+	}
+	return c.Quit()
+}
+
+func smtpError(err error) error {
+	var te *textproto.Error
+	if errors.As(err, &te) && te.Code >= 500 {
+		return Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,184 @@
+// Package notify delivers alert incident events to notification channels:
+// email over SMTP, Slack incoming webhooks, generic webhooks and the
+// PagerDuty Events API v2. Every endpoint comes from the channel config, so
+// senders can be pointed at local stub servers once private destinations
+// are allowed (see AllowPrivateDestinations).
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Action is the incident lifecycle step being notified.
+type Action string
+
+const (
+	Trigger     Action = "trigger"
+	Acknowledge Action = "acknowledge"
+	Resolve     Action = "resolve"
+)
+
+// Event is an incident lifecycle event.
+type Event struct {
+	Action      Action    `json:"action"`
+	IncidentID  int64     `json:"incident_id"`
+	TenantID    int64     `json:"tenant_id"`
+	ConditionID int64     `json:"condition_id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Severity    string    `json:"severity"`
+	Status      string    `json:"status"`
+	OpenedAt    time.Time `json:"opened_at"`
+	AckedBy     string    `json:"acked_by,omitempty"`
+	Time        time.Time `json:"time"`
+
+	// Grouped notifications carry the notification group and its alerts
+	// instead of a single incident.
+	GroupID int64   `json:"group_id,omitempty"`
+	Alerts  []Alert `json:"alerts,omitempty"`
+}
+
+// Alert is one incident of a grouped notification.
+type Alert struct {
+	IncidentID int64     `json:"incident_id"`
+	Title      string    `json:"title"`
+	Severity   string    `json:"severity"`
+	Status     string    `json:"status"` // firing or resolved
+	OpenedAt   time.Time `json:"opened_at"`
+}
+
+// DedupKey identifies the incident, or the notification group, across its
+// lifecycle events.
+func (e Event) DedupKey() string {
+	if e.GroupID != 0 {
+		return "kineticops-" + strconv.FormatInt(e.TenantID, 10) + "-group-" + strconv.FormatInt(e.GroupID, 10)
+	}
+	return "kineticops-" + strconv.FormatInt(e.TenantID, 10) + "-incident-" + strconv.FormatInt(e.IncidentID, 10)
+}
+
+// Sender delivers one event.
+type Sender interface {
+	Send(ctx context.Context, e Event) error
+}
+
+// New builds the sender of a channel type from its JSON config.
+func New(channelType string, config []byte) (Sender, error) {
+	switch channelType {
+	case "email":
+		return newEmailSender(config)
+	case "slack":
+		return newSlackSender(config)
+	case "webhook":
+		return newWebhookSender(config)
+	case "pagerduty":
+		return newPagerDutySender(config)
+	}
+	return nil, fmt.Errorf("unknown channel type %q", channelType)
+}
+
+// permanentError marks failures that retrying cannot fix.
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
+
+// RetryPolicy bounds delivery attempts.
+type RetryPolicy struct {
+	Attempts int           // total attempts
+	Backoff  time.Duration // wait before the second attempt, doubled after each
+	Timeout  time.Duration // per attempt
+}
+
+// DefaultRetryPolicy tries three times over roughly seven seconds.
+var DefaultRetryPolicy = RetryPolicy{Attempts: 3, Backoff: 2 * time.Second, Timeout: 10 * time.Second}
+
+// Deliver sends e with retries and exponential backoff with jitter. It
+// returns the number of attempts made and the last error. A zero Timeout
+// uses the timeout of DefaultRetryPolicy.
+func Deliver(ctx context.Context, s Sender, e Event, p RetryPolicy) (int, error) {
+	if p.Attempts <= 0 {
+		p.Attempts = 1
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = DefaultRetryPolicy.Timeout
+	}
+	backoff := p.Backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		actx, cancel := context.WithTimeout(ctx, p.Timeout)
+		err = s.Send(actx, e)
+		cancel()
+		if err == nil || IsPermanent(err) || attempt >= p.Attempts {
+			return attempt, err
+		}
+		wait := backoff + time.Duration(rand.Int63n(int64(backoff)/2+1))
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+// postJSON sends body to url. Network errors, 429 and 5xx are retryable;
+// other non-2xx answers are permanent.
+func postJSON(ctx context.Context, method, url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "KineticOps-Notifier/1.0")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrPrivateDestination) {
+			return Permanent(err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("%s returned %d: %s", url, resp.StatusCode, bytes.TrimSpace(snippet))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return err
+	}
+	return Permanent(err)
+}
+
+func marshal(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, Permanent(err)
+	}
+	return b, nil
+}
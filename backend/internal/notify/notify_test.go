@@ -0,0 +1,447 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testEvent(action Action) Event {
+	opened := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	return Event{
+		Action:      action,
+		IncidentID:  42,
+		TenantID:    7,
+		ConditionID: 3,
+		Title:       "CPU above 90%",
+		Description: "cpu_usage is 97.5 on web-1",
+		Severity:    "critical",
+		Status:      "open",
+		OpenedAt:    opened,
+		Time:        opened.Add(time.Minute),
+	}
+}
+
+// allowLocal lets senders reach httptest and SMTP stub servers on loopback.
+func allowLocal(t *testing.T) {
+	t.Helper()
+	AllowPrivateDestinations(true)
+	t.Cleanup(func() { AllowPrivateDestinations(false) })
+}
+
+func newSender(t *testing.T, channelType string, config interface{}) Sender {
+	t.Helper()
+	raw, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(channelType, raw)
+	if err != nil {
+		t.Fatalf("New(%s): %v", channelType, err)
+	}
+	return s
+}
+
+type captured struct {
+	method string
+	header http.Header
+	body   []byte
+}
+
+// captureServer records requests and answers them with the given status
+// codes in turn, then 200.
+func captureServer(t *testing.T, statuses ...int) (*httptest.Server, func() []captured) {
+	t.Helper()
+	var mu sync.Mutex
+	var reqs []captured
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		n := len(reqs)
+		reqs = append(reqs, captured{method: r.Method, header: r.Header.Clone(), body: body})
+		mu.Unlock()
+		if n < len(statuses) {
+			w.WriteHeader(statuses[n])
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []captured {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]captured(nil), reqs...)
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	allowLocal(t)
+	srv, requests := captureServer(t)
+	s := newSender(t, "webhook", WebhookConfig{URL: srv.URL, Method: "put", Secret: "s3cret", Headers: map[string]string{"X-Team": "ops"}})
+
+	e := testEvent(Trigger)
+	if err := s.Send(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	reqs := requests()
+	if len(reqs) != 1 {
+		t.Fatalf("got %d requests, want 1", len(reqs))
+	}
+	r := reqs[0]
+	if r.method != http.MethodPut || r.header.Get("X-Team") != "ops" {
+		t.Errorf("method %s, X-Team %q", r.method, r.header.Get("X-Team"))
+	}
+	ts := r.header.Get("X-KineticOps-Timestamp")
+	if ts != strconv.FormatInt(e.Time.Unix(), 10) {
+		t.Errorf("timestamp header %q", ts)
+	}
+	if got, want := r.header.Get("X-KineticOps-Signature"), "sha256="+Sign("s3cret", ts, r.body); got != want {
+		t.Errorf("signature %q, want %q", got, want)
+	}
+
+	var payload struct {
+		Event    string `json:"event"`
+		DedupKey string `json:"dedup_key"`
+		Incident Event  `json:"incident"`
+	}
+	if err := json.Unmarshal(r.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != "trigger" || payload.DedupKey != "kineticops-7-incident-42" || payload.Incident.Title != e.Title {
+		t.Errorf("unexpected payload %s", r.body)
+	}
+}
+
+func TestWebhookWithoutSecretIsUnsigned(t *testing.T) {
+	allowLocal(t)
+	srv, requests := captureServer(t)
+	s := newSender(t, "webhook", WebhookConfig{URL: srv.URL})
+	if err := s.Send(context.Background(), testEvent(Resolve)); err != nil {
+		t.Fatal(err)
+	}
+	r := requests()[0]
+	if r.method != http.MethodPost || r.header.Get("X-KineticOps-Signature") != "" {
+		t.Errorf("method %s, signature %q", r.method, r.header.Get("X-KineticOps-Signature"))
+	}
+}
+
+func TestSlackMessage(t *testing.T) {
+	allowLocal(t)
+	srv, requests := captureServer(t)
+	s := newSender(t, "slack", SlackConfig{WebhookURL: srv.URL, Channel: "#alerts"})
+
+	e := testEvent(Acknowledge)
+	e.AckedBy = "alice"
+	if err := s.Send(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	var msg struct {
+		Text    string `json:"text"`
+		Channel string `json:"channel"`
+		Blocks  []struct {
+			Type   string `json:"type"`
+			Fields []struct {
+				Text string `json:"text"`
+			} `json:"fields"`
+		} `json:"blocks"`
+	}
+	if err := json.Unmarshal(requests()[0].body, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Text != ":eyes: [ACKNOWLEDGED] CPU above 90%" || msg.Channel != "#alerts" {
+		t.Errorf("text %q, channel %q", msg.Text, msg.Channel)
+	}
+	if len(msg.Blocks) != 4 || msg.Blocks[0].Type != "header" {
+		t.Fatalf("unexpected blocks %+v", msg.Blocks)
+	}
+	fields := msg.Blocks[2].Fields
+	if len(fields) != 5 || fields[2].Text != "*Incident*\n#42" || fields[4].Text != "*Acknowledged by*\nalice" {
+		t.Errorf("unexpected fields %+v", fields)
+	}
+}
+
+func TestPagerDutyEvents(t *testing.T) {
+	allowLocal(t)
+	srv, requests := captureServer(t)
+	s := newSender(t, "pagerduty", PagerDutyConfig{IntegrationKey: "routing-key", EventsURL: srv.URL})
+
+	for _, a := range []Action{Trigger, Resolve} {
+		if err := s.Send(context.Background(), testEvent(a)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reqs := requests()
+	if len(reqs) != 2 {
+		t.Fatalf("got %d requests, want 2", len(reqs))
+	}
+
+	var trigger, resolve map[string]interface{}
+	if err := json.Unmarshal(reqs[0].body, &trigger); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(reqs[1].body, &resolve); err != nil {
+		t.Fatal(err)
+	}
+	if trigger["routing_key"] != "routing-key" || trigger["event_action"] != "trigger" || trigger["dedup_key"] != "kineticops-7-incident-42" {
+		t.Errorf("unexpected trigger %v", trigger)
+	}
+	payload, _ := trigger["payload"].(map[string]interface{})
+	if payload["severity"] != "critical" || payload["source"] != "kineticops" || payload["summary"] != "CPU above 90%" {
+		t.Errorf("unexpected payload %v", payload)
+	}
+	if resolve["event_action"] != "resolve" || resolve["dedup_key"] != trigger["dedup_key"] || resolve["payload"] != nil {
+		t.Errorf("unexpected resolve %v", resolve)
+	}
+}
+
+func TestPagerDutySeverity(t *testing.T) {
+	for in, want := range map[string]string{"critical": "critical", "HIGH": "error", "error": "error", "medium": "warning", "low": "info", "": "warning"} {
+		if got := pagerDutySeverity(in); got != want {
+			t.Errorf("pagerDutySeverity(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	allowLocal(t)
+	policy := RetryPolicy{Attempts: 3, Backoff: time.Millisecond}
+	tests := []struct {
+		name     string
+		statuses []int
+		attempts int
+		ok       bool
+	}{
+		{"retries 429 and 5xx", []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}, 3, true},
+		{"gives up after the last attempt", []int{500, 502, 504}, 3, false},
+		{"does not retry 4xx", []int{http.StatusBadRequest}, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := captureServer(t, tt.statuses...)
+			s := newSender(t, "webhook", WebhookConfig{URL: srv.URL})
+			attempts, err := Deliver(context.Background(), s, testEvent(Trigger), policy)
+			if attempts != tt.attempts || (err == nil) != tt.ok || len(requests()) != tt.attempts {
+				t.Errorf("attempts %d (%d requests), err %v; want %d attempts, ok=%v", attempts, len(requests()), err, tt.attempts, tt.ok)
+			}
+			if !tt.ok && tt.attempts == 1 && !IsPermanent(err) {
+				t.Errorf("error %v is not permanent", err)
+			}
+		})
+	}
+}
+
+type senderFunc func(ctx context.Context, e Event) error
+
+func (f senderFunc) Send(ctx context.Context, e Event) error { return f(ctx, e) }
+
+func TestDeliverDefaultsTimeout(t *testing.T) {
+	var deadline time.Duration
+	s := senderFunc(func(ctx context.Context, e Event) error {
+		d, ok := ctx.Deadline()
+		if !ok {
+			return errors.New("no deadline")
+		}
+		deadline = time.Until(d)
+		return nil
+	})
+	if _, err := Deliver(context.Background(), s, testEvent(Trigger), RetryPolicy{Attempts: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if deadline <= 0 || deadline > DefaultRetryPolicy.Timeout {
+		t.Errorf("attempt deadline %v, want up to %v", deadline, DefaultRetryPolicy.Timeout)
+	}
+}
+
+func TestPrivateDestinations(t *testing.T) {
+	for _, cfg := range []struct {
+		channelType string
+		config      interface{}
+	}{
+		{"webhook", WebhookConfig{URL: "http://127.0.0.1:8080/hook"}},
+		{"webhook", WebhookConfig{URL: "http://localhost/hook"}},
+		{"webhook", WebhookConfig{URL: "http://169.254.169.254/latest/meta-data/"}},
+		{"webhook", WebhookConfig{URL: "http://[::1]/hook"}},
+		{"slack", SlackConfig{WebhookURL: "https://10.0.0.5/services/x"}},
+		{"pagerduty", PagerDutyConfig{IntegrationKey: "k", EventsURL: "http://192.168.1.10/enqueue"}},
+		{"email", EmailConfig{SMTPServer: SMTPServer{Host: "172.16.0.1", From: "a@example.com"}, Recipients: []string{"b@example.com"}}},
+	} {
+		raw, _ := json.Marshal(cfg.config)
+		if _, err := New(cfg.channelType, raw); !errors.Is(err, ErrPrivateDestination) {
+			t.Errorf("New(%s, %s) = %v, want ErrPrivateDestination", cfg.channelType, raw, err)
+		}
+	}
+
+	raw, _ := json.Marshal(WebhookConfig{URL: "https://hooks.example.com/x"})
+	if _, err := New("webhook", raw); err != nil {
+		t.Errorf("public webhook rejected: %v", err)
+	}
+}
+
+func TestPrivateDestinationRefusedOnDial(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hits.Add(1) }))
+	defer srv.Close()
+
+	// bypass the config check, as a DNS name pointing at loopback would
+	s := &webhookSender{cfg: WebhookConfig{URL: srv.URL, Method: http.MethodPost}}
+	attempts, err := Deliver(context.Background(), s, testEvent(Trigger), RetryPolicy{Attempts: 3, Backoff: time.Millisecond})
+	if !errors.Is(err, ErrPrivateDestination) || !IsPermanent(err) || attempts != 1 || hits.Load() != 0 {
+		t.Errorf("attempts %d, hits %d, err %v", attempts, hits.Load(), err)
+	}
+}
+
+// smtpStub is a minimal SMTP server that records one transaction.
+type smtpStub struct {
+	addr     string
+	rcptCode int
+
+	mu   sync.Mutex
+	from string
+	rcpt []string
+	data string
+}
+
+func startSMTPStub(t *testing.T, rcptCode int) *smtpStub {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	stub := &smtpStub{addr: ln.Addr().String(), rcptCode: rcptCode}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go stub.serve(conn)
+		}
+	}()
+	return stub
+}
+
+func (s *smtpStub) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+	reply("220 stub ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 stub")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.mu.Lock()
+			s.from = line[len("MAIL FROM:"):]
+			s.mu.Unlock()
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			if s.rcptCode != 250 {
+				reply(strconv.Itoa(s.rcptCode) + " mailbox unavailable")
+				continue
+			}
+			s.mu.Lock()
+			s.rcpt = append(s.rcpt, line[len("RCPT TO:"):])
+			s.mu.Unlock()
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var b strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				b.WriteString(l)
+			}
+			s.mu.Lock()
+			s.data = b.String()
+			s.mu.Unlock()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func smtpConfig(t *testing.T, addr string) EmailConfig {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(addr)
+	p, _ := strconv.Atoi(port)
+	return EmailConfig{
+		SMTPServer: SMTPServer{Host: host, Port: p, From: "KineticOps <alerts@example.com>", TLS: "none"},
+		Recipients: []string{"ops@example.com", "Bob <bob@example.com>"},
+	}
+}
+
+func TestEmailDelivery(t *testing.T) {
+	allowLocal(t)
+	stub := startSMTPStub(t, 250)
+	s := newSender(t, "email", smtpConfig(t, stub.addr))
+
+	if err := s.Send(context.Background(), testEvent(Trigger)); err != nil {
+		t.Fatal(err)
+	}
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if stub.from != "<alerts@example.com>" || strings.Join(stub.rcpt, ",") != "<ops@example.com>,<bob@example.com>" {
+		t.Errorf("from %q, rcpt %q", stub.from, stub.rcpt)
+	}
+	for _, want := range []string{
+		"Subject: [CRITICAL] CPU above 90%\r\n",
+		"To: ops@example.com, Bob <bob@example.com>\r\n",
+		"Content-Type: multipart/alternative; boundary=",
+		"Content-Type: text/plain; charset=UTF-8",
+		"Content-Type: text/html; charset=UTF-8",
+		"Incident:  #42 (triggered)",
+	} {
+		if !strings.Contains(stub.data, want) {
+			t.Errorf("message lacks %q:\n%s", want, stub.data)
+		}
+	}
+}
+
+func TestEmailRejectedRecipientIsPermanent(t *testing.T) {
+	allowLocal(t)
+	stub := startSMTPStub(t, 550)
+	s := newSender(t, "email", smtpConfig(t, stub.addr))
+
+	attempts, err := Deliver(context.Background(), s, testEvent(Trigger), RetryPolicy{Attempts: 3, Backoff: time.Millisecond})
+	if err == nil || !IsPermanent(err) || attempts != 1 {
+		t.Errorf("attempts %d, err %v; want one permanent failure", attempts, err)
+	}
+}
+
+func TestEmailTemporaryFailureIsRetried(t *testing.T) {
+	allowLocal(t)
+	stub := startSMTPStub(t, 451)
+	s := newSender(t, "email", smtpConfig(t, stub.addr))
+
+	attempts, err := Deliver(context.Background(), s, testEvent(Trigger), RetryPolicy{Attempts: 2, Backoff: time.Millisecond})
+	if err == nil || IsPermanent(err) || attempts != 2 {
+		t.Errorf("attempts %d, err %v; want two temporary failures", attempts, err)
+	}
+}
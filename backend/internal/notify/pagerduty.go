@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultPagerDutyEventsURL is the PagerDuty Events API v2 endpoint.
+const DefaultPagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDutyConfig sends Events API v2 trigger, acknowledge and resolve
+// events keyed by the incident, so PagerDuty follows the incident's
+// lifecycle. Severity overrides the mapping of the incident severity.
+type PagerDutyConfig struct {
+	IntegrationKey string `json:"integration_key"`
+	Severity       string `json:"severity"`
+	Source         string `json:"source"`
+	EventsURL      string `json:"events_url"`
+}
+
+type pagerDutySender struct{ cfg PagerDutyConfig }
+
+func newPagerDutySender(config []byte) (Sender, error) {
+	var cfg PagerDutyConfig
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid pagerduty config: %w", err)
+	}
+	if cfg.IntegrationKey == "" {
+		return nil, fmt.Errorf("pagerduty integration_key is required")
+	}
+	if cfg.EventsURL == "" {
+		cfg.EventsURL = DefaultPagerDutyEventsURL
+	}
+	if err := checkURL(cfg.EventsURL); err != nil {
+		return nil, err
+	}
+	if cfg.Source == "" {
+		cfg.Source = "kineticops"
+	}
+	return &pagerDutySender{cfg: cfg}, nil
+}
+
+func (s *pagerDutySender) Send(ctx context.Context, e Event) error {
+	ev := map[string]interface{}{
+		"routing_key":  s.cfg.IntegrationKey,
+		"event_action": string(e.Action),
+		"dedup_key":    e.DedupKey(),
+	}
+	if e.Action == Trigger {
+		severity := s.cfg.Severity
+		if severity == "" {
+			severity = pagerDutySeverity(e.Severity)
+		}
+		details := map[string]interface{}{
+			"description":  e.Description,
+			"incident_id":  e.IncidentID,
+			"condition_id": e.ConditionID,
+			"tenant_id":    e.TenantID,
+		}
+		if e.GroupID != 0 {
+			details["group_id"] = e.GroupID
+			details["alerts"] = e.Alerts
+		}
+		ev["payload"] = map[string]interface{}{
+			"summary":        truncateText(e.Title, 1024),
+			"source":         s.cfg.Source,
+			"severity":       severity,
+			"timestamp":      e.OpenedAt.UTC().Format(time.RFC3339),
+			"custom_details": details,
+		}
+	}
+	body, err := marshal(ev)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, http.MethodPost, s.cfg.EventsURL, body, nil)
+}
+
+// pagerDutySeverity maps incident severities to critical, error, warning
+// or info.
+func pagerDutySeverity(s string) string {
+	switch strings.ToLower(s) {
+	case "critical":
+		return "critical"
+	case "high", "error":
+		return "error"
+	case "low", "info":
+		return "info"
+	}
+	return "warning"
+}
@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SlackConfig posts Block Kit messages to a Slack incoming webhook.
+type SlackConfig struct {
+	WebhookURL string `json:"webhook_url"`
+	Channel    string `json:"channel"`
+	Username   string `json:"username"`
+}
+
+type slackSender struct{ cfg SlackConfig }
+
+func newSlackSender(config []byte) (Sender, error) {
+	var cfg SlackConfig
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid slack config: %w", err)
+	}
+	if err := checkURL(cfg.WebhookURL); err != nil {
+		return nil, err
+	}
+	return &slackSender{cfg: cfg}, nil
+}
+
+func (s *slackSender) Send(ctx context.Context, e Event) error {
+	heading := fmt.Sprintf("%s %s", actionEmoji(e.Action), e.Title)
+	if e.Action != Trigger {
+		heading = fmt.Sprintf("%s [%s] %s", actionEmoji(e.Action), strings.ToUpper(actionLabel(e.Action)), e.Title)
+	}
+	fields := []map[string]string{
+		{"type": "mrkdwn", "text": "*Severity*\n" + orDash(e.Severity)},
+		{"type": "mrkdwn", "text": "*Status*\n" + orDash(e.Status)},
+		{"type": "mrkdwn", "text": fmt.Sprintf("*Incident*\n#%d", e.IncidentID)},
+		{"type": "mrkdwn", "text": "*Opened*\n" + e.OpenedAt.UTC().Format(time.RFC1123)},
+	}
+	if e.GroupID != 0 {
+		fields[2] = map[string]string{"type": "mrkdwn", "text": fmt.Sprintf("*Group*\n#%d (%d alerts)", e.GroupID, len(e.Alerts))}
+	}
+	if e.AckedBy != "" {
+		fields = append(fields, map[string]string{"type": "mrkdwn", "text": "*Acknowledged by*\n" + e.AckedBy})
+	}
+	blocks := []interface{}{
+		map[string]interface{}{"type": "header", "text": map[string]interface{}{"type": "plain_text", "text": truncateText(heading, 150), "emoji": true}},
+		map[string]interface{}{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": truncateText(orDash(e.Description), 3000)}},
+		map[string]interface{}{"type": "section", "fields": fields},
+		map[string]interface{}{"type": "context", "elements": []map[string]string{
+			{"type": "mrkdwn", "text": fmt.Sprintf("KineticOps · condition %d · %s", e.ConditionID, e.Time.UTC().Format(time.RFC3339))},
+		}},
+	}
+
+	msg := map[string]interface{}{
+		"text":   heading, // fallback for notifications
+		"blocks": blocks,
+	}
+	if s.cfg.Channel != "" {
+		msg["channel"] = s.cfg.Channel
+	}
+	if s.cfg.Username != "" {
+		msg["username"] = s.cfg.Username
+	}
+	body, err := marshal(msg)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, http.MethodPost, s.cfg.WebhookURL, body, nil)
+}
+
+func actionEmoji(a Action) string {
+	switch a {
+	case Acknowledge:
+		return ":eyes:"
+	case Resolve:
+		return ":white_check_mark:"
+	}
+	return ":rotating_light:"
+}
+
+func actionLabel(a Action) string {
+	switch a {
+	case Acknowledge:
+		return "acknowledged"
+	case Resolve:
+		return "resolved"
+	}
+	return "triggered"
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func truncateText(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// WebhookConfig posts the event as JSON to URL. With a Secret, requests
+// carry X-KineticOps-Timestamp and X-KineticOps-Signature: sha256=<hex
+// HMAC-SHA256 of "<timestamp>.<body>">, so receivers can verify the sender
+// and reject replays.
+type WebhookConfig struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+	Secret  string            `json:"secret"`
+}
+
+type webhookSender struct{ cfg WebhookConfig }
+
+func newWebhookSender(config []byte) (Sender, error) {
+	var cfg WebhookConfig
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid webhook config: %w", err)
+	}
+	if err := checkURL(cfg.URL); err != nil {
+		return nil, err
+	}
+	cfg.Method = strings.ToUpper(cfg.Method)
+	switch cfg.Method {
+	case "":
+		cfg.Method = http.MethodPost
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return nil, fmt.Errorf("unsupported webhook method %q", cfg.Method)
+	}
+	return &webhookSender{cfg: cfg}, nil
+}
+
+func (s *webhookSender) Send(ctx context.Context, e Event) error {
+	body, err := marshal(map[string]interface{}{
+		"event":     e.Action,
+		"dedup_key": e.DedupKey(),
+		"incident":  e,
+	})
+	if err != nil {
+		return err
+	}
+	headers := make(map[string]string, len(s.cfg.Headers)+2)
+	for k, v := range s.cfg.Headers {
+		headers[k] = v
+	}
+	if s.cfg.Secret != "" {
+		ts := strconv.FormatInt(e.Time.Unix(), 10)
+		headers["X-KineticOps-Timestamp"] = ts
+		headers["X-KineticOps-Signature"] = "sha256=" + Sign(s.cfg.Secret, ts, body)
+	}
+	return postJSON(ctx, s.cfg.Method, s.cfg.URL, body, headers)
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>" under secret.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func checkURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q", raw)
+	}
+	return checkHost(u.Hostname())
+}
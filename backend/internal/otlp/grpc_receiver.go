@@ -0,0 +1,114 @@
+package otlp
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/services"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/encoding/gzip" // most exporters gzip by default
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// StartGRPCReceiver starts the OTLP/gRPC receiver (traces, metrics and logs)
+// on addr in the background. Callers should GracefulStop the returned server
+// on shutdown. A nil server is returned when addr is empty (the receiver is
+// disabled) or the listener cannot be opened.
+func StartGRPCReceiver(addr string) *grpc.Server {
+	if addr == "" {
+		return nil
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		logging.Errorf("[OTLP] gRPC receiver listen on %s failed: %v", addr, err)
+		return nil
+	}
+
+	srv := grpc.NewServer()
+	coltracepb.RegisterTraceServiceServer(srv, &traceServer{})
+	colmetricspb.RegisterMetricsServiceServer(srv, &metricsServer{})
+	collogspb.RegisterLogsServiceServer(srv, &logsServer{})
+
+	go func() {
+		if err := srv.Serve(lis); err != nil {
+			logging.Errorf("[OTLP] gRPC receiver stopped: %v", err)
+		}
+	}()
+	logging.Infof("[OTLP] gRPC receiver listening on %s", addr)
+	return srv
+}
+
+// ingestIdentity authenticates a gRPC export by the ingest token carried in
+// the x-agent-token or authorization ("Bearer <token>") metadata.
+func ingestIdentity(ctx context.Context) (*services.IngestIdentity, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	if v := md.Get("x-agent-token"); len(v) > 0 {
+		token = v[0]
+	} else if v := md.Get("authorization"); len(v) > 0 && strings.HasPrefix(v[0], "Bearer ") {
+		token = strings.TrimPrefix(v[0], "Bearer ")
+	}
+	identity, err := services.ResolveIngestToken(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return identity, nil
+}
+
+type traceServer struct {
+	coltracepb.UnimplementedTraceServiceServer
+}
+
+func (traceServer) Export(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	identity, err := ingestIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := services.OTLPSvc.ExportTraces(ctx, identity, req)
+	if err != nil {
+		logging.Errorf("[OTLP] gRPC trace export failed tenant=%d: %v", identity.TenantID, err)
+		return nil, status.Error(codes.Unavailable, "export failed")
+	}
+	return resp, nil
+}
+
+type metricsServer struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+}
+
+func (metricsServer) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	identity, err := ingestIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := services.OTLPSvc.ExportMetrics(ctx, identity, req)
+	if err != nil {
+		logging.Errorf("[OTLP] gRPC metric export failed tenant=%d: %v", identity.TenantID, err)
+		return nil, status.Error(codes.Unavailable, "export failed")
+	}
+	return resp, nil
+}
+
+type logsServer struct {
+	collogspb.UnimplementedLogsServiceServer
+}
+
+func (logsServer) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	identity, err := ingestIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := services.OTLPSvc.ExportLogs(ctx, identity, req)
+	if err != nil {
+		logging.Errorf("[OTLP] gRPC log export failed tenant=%d: %v", identity.TenantID, err)
+		return nil, status.Error(codes.Unavailable, "export failed")
+	}
+	return resp, nil
+}
@@ -0,0 +1,67 @@
+// Package query implements KQL, the SQL-like metric query language served by
+// POST /api/v1/query and used by alert conditions:
+//
+//	SELECT avg(cpu_usage), max(memory_usage) FROM metrics
+//	WHERE group = 'web' AND host != 'db-1'
+//	FACET host SINCE 1 hour ago TIMESERIES 5m LIMIT 10
+//
+// The package only parses; planning and execution against the metrics tables
+// live in services.QueryService.
+package query
+
+import "time"
+
+// Aggregate is one SELECT item, e.g. avg(cpu_usage) or percentile(x, 95).
+type Aggregate struct {
+	Func     string  // avg, min, max, sum, count, latest, percentile
+	Metric   string  // metric name
+	Quantile float64 // 0-1, only for percentile
+	Alias    string  // output column name
+}
+
+// Condition is one WHERE predicate on a dimension.
+type Condition struct {
+	Dim    Dimension
+	Op     string   // =, !=, IN, NOT IN, LIKE, NOT LIKE
+	Values []string // one value except for IN/NOT IN
+}
+
+// Dimension is a host attribute or metric label usable in WHERE and FACET.
+type Dimension struct {
+	Name  string // host, host_id, group, os, ip, tag or label
+	Label string // label key when Name is "label"
+}
+
+func (d Dimension) String() string {
+	if d.Name == "label" {
+		return "label." + d.Label
+	}
+	return d.Name
+}
+
+// TimeRef is a SINCE/UNTIL bound: either relative to now or absolute.
+type TimeRef struct {
+	Ago      time.Duration
+	Absolute time.Time
+}
+
+// Resolve returns the bound as an absolute time.
+func (t TimeRef) Resolve(now time.Time) time.Time {
+	if !t.Absolute.IsZero() {
+		return t.Absolute
+	}
+	return now.Add(-t.Ago)
+}
+
+// Query is a parsed KQL statement.
+type Query struct {
+	Select     []Aggregate
+	From       string
+	Where      []Condition
+	Facets     []Dimension
+	Since      TimeRef
+	Until      TimeRef
+	TimeSeries bool
+	Interval   time.Duration // 0 with TimeSeries means AUTO
+	Limit      int
+}
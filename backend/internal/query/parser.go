@@ -0,0 +1,529 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// DefaultSince is the window used when SINCE is omitted.
+	DefaultSince = time.Hour
+	// DefaultLimit and MaxLimit bound the number of FACET groups.
+	DefaultLimit = 10
+	MaxLimit     = 100
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	val  string
+	pos  int
+}
+
+// ParseError reports a syntax error and its byte offset in the query.
+type ParseError struct {
+	Pos int
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("syntax error at position %d: %s", e.Pos, e.Msg)
+}
+
+func lex(input string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(input) {
+		c := rune(input[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'' || c == '"':
+			quote := input[i]
+			start := i
+			i++
+			var b strings.Builder
+			closed := false
+			for i < len(input) {
+				if input[i] == quote {
+					// doubled quote is an escaped quote
+					if i+1 < len(input) && input[i+1] == quote {
+						b.WriteByte(quote)
+						i += 2
+						continue
+					}
+					closed = true
+					i++
+					break
+				}
+				b.WriteByte(input[i])
+				i++
+			}
+			if !closed {
+				return nil, &ParseError{Pos: start, Msg: "unterminated string"}
+			}
+			toks = append(toks, token{tokString, b.String(), start})
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(input) && (input[i] >= '0' && input[i] <= '9' || input[i] == '.') {
+				i++
+			}
+			toks = append(toks, token{tokNumber, input[start:i], start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(input) && (unicode.IsLetter(rune(input[i])) || unicode.IsDigit(rune(input[i])) || strings.ContainsRune("_.-:", rune(input[i]))) {
+				i++
+			}
+			toks = append(toks, token{tokIdent, input[start:i], start})
+		case strings.ContainsRune("(),*", c):
+			toks = append(toks, token{tokPunct, string(c), i})
+			i++
+		case c == '=':
+			toks = append(toks, token{tokPunct, "=", i})
+			i++
+		case c == '!' || c == '<':
+			if i+1 < len(input) && (input[i+1] == '=' || (c == '<' && input[i+1] == '>')) {
+				toks = append(toks, token{tokPunct, "!=", i})
+				i += 2
+				continue
+			}
+			return nil, &ParseError{Pos: i, Msg: fmt.Sprintf("unexpected %q", c)}
+		default:
+			return nil, &ParseError{Pos: i, Msg: fmt.Sprintf("unexpected %q", c)}
+		}
+	}
+	return append(toks, token{tokEOF, "", len(input)}), nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isKeyword(kw string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && strings.EqualFold(t.val, kw)
+}
+
+func (p *parser) acceptKeyword(kw string) bool {
+	if p.isKeyword(kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(kw string) error {
+	if !p.acceptKeyword(kw) {
+		return p.errorf("expected %s", strings.ToUpper(kw))
+	}
+	return nil
+}
+
+func (p *parser) acceptPunct(v string) bool {
+	t := p.peek()
+	if t.kind == tokPunct && t.val == v {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectPunct(v string) error {
+	if !p.acceptPunct(v) {
+		return p.errorf("expected %q", v)
+	}
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	msg := fmt.Sprintf(format, args...)
+	if t.kind == tokEOF {
+		msg += ", got end of query"
+	} else {
+		msg += fmt.Sprintf(", got %q", t.val)
+	}
+	return &ParseError{Pos: t.pos, Msg: msg}
+}
+
+// clause keywords end the current clause
+var clauseKeywords = []string{"from", "where", "facet", "since", "until", "timeseries", "limit"}
+
+func (p *parser) atClause() bool {
+	if p.peek().kind == tokEOF {
+		return true
+	}
+	for _, kw := range clauseKeywords {
+		if p.isKeyword(kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse parses a KQL statement. Clauses after FROM may appear in any order.
+func Parse(input string) (*Query, error) {
+	toks, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	q := &Query{Since: TimeRef{Ago: DefaultSince}, Limit: DefaultLimit}
+
+	if err := p.expectKeyword("select"); err != nil {
+		return nil, err
+	}
+	for {
+		agg, err := p.parseAggregate()
+		if err != nil {
+			return nil, err
+		}
+		q.Select = append(q.Select, agg)
+		if !p.acceptPunct(",") {
+			break
+		}
+	}
+
+	if err := p.expectKeyword("from"); err != nil {
+		return nil, err
+	}
+	from := p.next()
+	if from.kind != tokIdent || !strings.EqualFold(from.val, "metrics") {
+		return nil, &ParseError{Pos: from.pos, Msg: "only FROM metrics is supported"}
+	}
+	q.From = "metrics"
+
+	seen := map[string]bool{}
+	for p.peek().kind != tokEOF {
+		t := p.next()
+		kw := strings.ToLower(t.val)
+		if t.kind != tokIdent || seen[kw] {
+			return nil, &ParseError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %q", t.val)}
+		}
+		seen[kw] = true
+		switch kw {
+		case "where":
+			err = p.parseWhere(q)
+		case "facet":
+			err = p.parseFacet(q)
+		case "since":
+			q.Since, err = p.parseTimeRef()
+		case "until":
+			q.Until, err = p.parseTimeRef()
+		case "timeseries":
+			q.TimeSeries = true
+			q.Interval, err = p.parseInterval()
+		case "limit":
+			n := p.next()
+			q.Limit, err = strconv.Atoi(n.val)
+			if n.kind != tokNumber || err != nil || q.Limit <= 0 {
+				return nil, &ParseError{Pos: n.pos, Msg: "LIMIT expects a positive integer"}
+			}
+			if q.Limit > MaxLimit {
+				q.Limit = MaxLimit
+			}
+		default:
+			return nil, &ParseError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %q", t.val)}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+var aggregateFuncs = map[string]bool{
+	"avg": true, "average": true, "min": true, "max": true, "sum": true,
+	"count": true, "latest": true, "percentile": true,
+	"p50": true, "p90": true, "p95": true, "p99": true,
+}
+
+// NewAggregate builds a SELECT item from a function name as accepted in
+// queries (avg, max, p95, ...) and a metric name, for callers that take the
+// pieces as separate parameters. The alias is the metric name.
+func NewAggregate(fn, metric string) (Aggregate, error) {
+	name := strings.ToLower(fn)
+	if !aggregateFuncs[name] || name == "percentile" || metric == "" {
+		return Aggregate{}, fmt.Errorf("unknown function %q", fn)
+	}
+	agg := Aggregate{Func: name, Metric: metric, Alias: metric}
+	switch name {
+	case "average":
+		agg.Func = "avg"
+	case "p50", "p90", "p95", "p99":
+		agg.Func = "percentile"
+		q, _ := strconv.ParseFloat(name[1:], 64)
+		agg.Quantile = q / 100
+	}
+	return agg, nil
+}
+
+// ParseDimension parses a single dimension such as "group" or "label.mount".
+func ParseDimension(input string) (Dimension, error) {
+	toks, err := lex(input)
+	if err != nil {
+		return Dimension{}, err
+	}
+	p := &parser{toks: toks}
+	dim, err := p.parseDimension()
+	if err != nil {
+		return Dimension{}, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return Dimension{}, &ParseError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %q", t.val)}
+	}
+	return dim, nil
+}
+
+func (p *parser) parseAggregate() (Aggregate, error) {
+	start := p.pos
+	fn := p.next()
+	name := strings.ToLower(fn.val)
+	if fn.kind != tokIdent || !aggregateFuncs[name] {
+		return Aggregate{}, &ParseError{Pos: fn.pos, Msg: fmt.Sprintf("unknown function %q", fn.val)}
+	}
+	if err := p.expectPunct("("); err != nil {
+		return Aggregate{}, err
+	}
+	metric := p.next()
+	if metric.kind != tokIdent && metric.kind != tokString {
+		return Aggregate{}, &ParseError{Pos: metric.pos, Msg: "expected metric name"}
+	}
+	agg := Aggregate{Func: name, Metric: metric.val}
+
+	switch name {
+	case "average":
+		agg.Func = "avg"
+	case "p50", "p90", "p95", "p99":
+		agg.Func = "percentile"
+		q, _ := strconv.ParseFloat(name[1:], 64)
+		agg.Quantile = q / 100
+	case "percentile":
+		if err := p.expectPunct(","); err != nil {
+			return Aggregate{}, err
+		}
+		n := p.next()
+		q, err := strconv.ParseFloat(n.val, 64)
+		if n.kind != tokNumber || err != nil || q <= 0 || q >= 100 {
+			return Aggregate{}, &ParseError{Pos: n.pos, Msg: "percentile expects a value between 0 and 100"}
+		}
+		agg.Quantile = q / 100
+	}
+	if err := p.expectPunct(")"); err != nil {
+		return Aggregate{}, err
+	}
+
+	if p.acceptKeyword("as") {
+		alias := p.next()
+		if alias.kind != tokIdent && alias.kind != tokString {
+			return Aggregate{}, &ParseError{Pos: alias.pos, Msg: "expected alias"}
+		}
+		agg.Alias = alias.val
+	} else {
+		// default column name is the aggregate as written
+		agg.Alias = aggregateText(p.toks[start:p.pos])
+	}
+	return agg, nil
+}
+
+func aggregateText(toks []token) string {
+	var b strings.Builder
+	for i, t := range toks {
+		if t.kind == tokString {
+			b.WriteString("'" + t.val + "'")
+		} else {
+			b.WriteString(t.val)
+		}
+		if t.val == "," && i < len(toks)-1 {
+			b.WriteByte(' ')
+		}
+	}
+	return b.String()
+}
+
+func (p *parser) parseDimension() (Dimension, error) {
+	t := p.next()
+	if t.kind != tokIdent {
+		return Dimension{}, &ParseError{Pos: t.pos, Msg: "expected dimension"}
+	}
+	name := strings.ToLower(t.val)
+	switch {
+	case name == "host" || name == "hostname":
+		return Dimension{Name: "host"}, nil
+	case name == "host_id" || name == "group" || name == "os" || name == "ip" || name == "tag":
+		return Dimension{Name: name}, nil
+	case strings.HasPrefix(name, "label.") || strings.HasPrefix(name, "labels."):
+		key := t.val[strings.IndexByte(t.val, '.')+1:]
+		if key == "" {
+			return Dimension{}, &ParseError{Pos: t.pos, Msg: "empty label name"}
+		}
+		return Dimension{Name: "label", Label: key}, nil
+	}
+	return Dimension{}, &ParseError{Pos: t.pos, Msg: fmt.Sprintf("unknown dimension %q (use host, host_id, group, os, ip, tag or label.<name>)", t.val)}
+}
+
+func (p *parser) parseWhere(q *Query) error {
+	for {
+		dim, err := p.parseDimension()
+		if err != nil {
+			return err
+		}
+		cond := Condition{Dim: dim}
+
+		switch {
+		case p.acceptPunct("="):
+			cond.Op = "="
+		case p.acceptPunct("!="):
+			cond.Op = "!="
+		case p.acceptKeyword("in"):
+			cond.Op = "IN"
+		case p.acceptKeyword("like"):
+			cond.Op = "LIKE"
+		case p.acceptKeyword("not"):
+			switch {
+			case p.acceptKeyword("in"):
+				cond.Op = "NOT IN"
+			case p.acceptKeyword("like"):
+				cond.Op = "NOT LIKE"
+			default:
+				return p.errorf("expected IN or LIKE after NOT")
+			}
+		default:
+			return p.errorf("expected operator")
+		}
+
+		if cond.Op == "IN" || cond.Op == "NOT IN" {
+			if err := p.expectPunct("("); err != nil {
+				return err
+			}
+			for {
+				v, err := p.parseValue()
+				if err != nil {
+					return err
+				}
+				cond.Values = append(cond.Values, v)
+				if !p.acceptPunct(",") {
+					break
+				}
+			}
+			if err := p.expectPunct(")"); err != nil {
+				return err
+			}
+		} else {
+			v, err := p.parseValue()
+			if err != nil {
+				return err
+			}
+			cond.Values = []string{v}
+		}
+		if dim.Name == "tag" && cond.Op != "=" && cond.Op != "!=" && cond.Op != "IN" && cond.Op != "NOT IN" {
+			return &ParseError{Pos: p.peek().pos, Msg: "tag supports =, !=, IN and NOT IN"}
+		}
+		q.Where = append(q.Where, cond)
+
+		if !p.acceptKeyword("and") {
+			if p.isKeyword("or") {
+				return p.errorf("OR is not supported; use IN")
+			}
+			return nil
+		}
+	}
+}
+
+func (p *parser) parseValue() (string, error) {
+	t := p.next()
+	if t.kind != tokString && t.kind != tokNumber {
+		return "", &ParseError{Pos: t.pos, Msg: "expected quoted string or number"}
+	}
+	return t.val, nil
+}
+
+func (p *parser) parseFacet(q *Query) error {
+	for {
+		dim, err := p.parseDimension()
+		if err != nil {
+			return err
+		}
+		q.Facets = append(q.Facets, dim)
+		if !p.acceptPunct(",") {
+			return nil
+		}
+	}
+}
+
+// parseTimeRef parses "<n> <unit> ago", "now" or a quoted RFC 3339 time.
+func (p *parser) parseTimeRef() (TimeRef, error) {
+	if p.acceptKeyword("now") {
+		return TimeRef{}, nil
+	}
+	if t := p.peek(); t.kind == tokString {
+		p.next()
+		ts, err := time.Parse(time.RFC3339, t.val)
+		if err != nil {
+			return TimeRef{}, &ParseError{Pos: t.pos, Msg: "expected RFC 3339 time"}
+		}
+		return TimeRef{Absolute: ts}, nil
+	}
+	d, err := p.parseDuration()
+	if err != nil {
+		return TimeRef{}, err
+	}
+	if err := p.expectKeyword("ago"); err != nil {
+		return TimeRef{}, err
+	}
+	return TimeRef{Ago: d}, nil
+}
+
+// parseInterval parses the optional TIMESERIES bucket ("5m", "1 hour" or
+// AUTO).
+func (p *parser) parseInterval() (time.Duration, error) {
+	if p.acceptKeyword("auto") || p.atClause() {
+		return 0, nil
+	}
+	return p.parseDuration()
+}
+
+var durationUnits = map[string]time.Duration{
+	"s": time.Second, "sec": time.Second, "second": time.Second, "seconds": time.Second,
+	"m": time.Minute, "min": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"h": time.Hour, "hour": time.Hour, "hours": time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour,
+}
+
+func (p *parser) parseDuration() (time.Duration, error) {
+	n := p.next()
+	v, err := strconv.Atoi(n.val)
+	if n.kind != tokNumber || err != nil || v <= 0 {
+		return 0, &ParseError{Pos: n.pos, Msg: "expected a positive whole number"}
+	}
+	u := p.next()
+	unit, ok := durationUnits[strings.ToLower(u.val)]
+	if u.kind != tokIdent || !ok {
+		return 0, &ParseError{Pos: u.pos, Msg: fmt.Sprintf("unknown time unit %q", u.val)}
+	}
+	return time.Duration(v) * unit, nil
+}
@@ -0,0 +1,245 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Query
+	}{
+		{
+			"SELECT avg(cpu_usage) FROM metrics",
+			Query{
+				Select: []Aggregate{{Func: "avg", Metric: "cpu_usage", Alias: "avg(cpu_usage)"}},
+				From:   "metrics", Since: TimeRef{Ago: DefaultSince}, Limit: DefaultLimit,
+			},
+		},
+		{
+			"select average(cpu_usage) as cpu, p95(latency), percentile('disk.io', 99.5) from METRICS",
+			Query{
+				Select: []Aggregate{
+					{Func: "avg", Metric: "cpu_usage", Alias: "cpu"},
+					{Func: "percentile", Metric: "latency", Quantile: 0.95, Alias: "p95(latency)"},
+					{Func: "percentile", Metric: "disk.io", Quantile: 0.995, Alias: "percentile('disk.io', 99.5)"},
+				},
+				From: "metrics", Since: TimeRef{Ago: DefaultSince}, Limit: DefaultLimit,
+			},
+		},
+		{
+			"SELECT max(memory_usage) FROM metrics FACET host, label.mount, group LIMIT 25",
+			Query{
+				Select: []Aggregate{{Func: "max", Metric: "memory_usage", Alias: "max(memory_usage)"}},
+				From:   "metrics",
+				Facets: []Dimension{{Name: "host"}, {Name: "label", Label: "mount"}, {Name: "group"}},
+				Since:  TimeRef{Ago: DefaultSince}, Limit: 25,
+			},
+		},
+		{
+			"SELECT sum(net) FROM metrics TIMESERIES 5m SINCE 3 days ago UNTIL now",
+			Query{
+				Select: []Aggregate{{Func: "sum", Metric: "net", Alias: "sum(net)"}},
+				From:   "metrics", Since: TimeRef{Ago: 72 * time.Hour},
+				TimeSeries: true, Interval: 5 * time.Minute, Limit: DefaultLimit,
+			},
+		},
+		{
+			"SELECT count(x) FROM metrics TIMESERIES 1 hour",
+			Query{
+				Select: []Aggregate{{Func: "count", Metric: "x", Alias: "count(x)"}},
+				From:   "metrics", Since: TimeRef{Ago: DefaultSince},
+				TimeSeries: true, Interval: time.Hour, Limit: DefaultLimit,
+			},
+		},
+		{
+			// AUTO, or no interval before the next clause, picks the bucket at run time
+			"SELECT count(x) FROM metrics TIMESERIES AUTO FACET os",
+			Query{
+				Select: []Aggregate{{Func: "count", Metric: "x", Alias: "count(x)"}},
+				From:   "metrics", Facets: []Dimension{{Name: "os"}}, Since: TimeRef{Ago: DefaultSince},
+				TimeSeries: true, Limit: DefaultLimit,
+			},
+		},
+		{
+			"SELECT count(x) FROM metrics TIMESERIES LIMIT 5",
+			Query{
+				Select: []Aggregate{{Func: "count", Metric: "x", Alias: "count(x)"}},
+				From:   "metrics", Since: TimeRef{Ago: DefaultSince},
+				TimeSeries: true, Limit: 5,
+			},
+		},
+		{
+			"SELECT latest(up) FROM metrics SINCE '2024-05-01T00:00:00Z' UNTIL '2024-05-02T00:00:00Z'",
+			Query{
+				Select: []Aggregate{{Func: "latest", Metric: "up", Alias: "latest(up)"}},
+				From:   "metrics",
+				Since:  TimeRef{Absolute: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+				Until:  TimeRef{Absolute: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)},
+				Limit:  DefaultLimit,
+			},
+		},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("Parse(%q) =\n%+v\nwant\n%+v", tt.in, *got, tt.want)
+		}
+	}
+}
+
+func TestParseWhere(t *testing.T) {
+	tests := []struct {
+		where string
+		want  []Condition
+	}{
+		{
+			"host = 'web-1'",
+			[]Condition{{Dim: Dimension{Name: "host"}, Op: "=", Values: []string{"web-1"}}},
+		},
+		{
+			// AND binds the predicates; the clause ends at the next keyword
+			"hostname != 'db-1' AND group IN ('web', 'api') AND label.path NOT LIKE '/tmp%' FACET host",
+			[]Condition{
+				{Dim: Dimension{Name: "host"}, Op: "!=", Values: []string{"db-1"}},
+				{Dim: Dimension{Name: "group"}, Op: "IN", Values: []string{"web", "api"}},
+				{Dim: Dimension{Name: "label", Label: "path"}, Op: "NOT LIKE", Values: []string{"/tmp%"}},
+			},
+		},
+		{
+			`host_id <> 7 and tag not in ("env=dev") and os like 'linux%'`,
+			[]Condition{
+				{Dim: Dimension{Name: "host_id"}, Op: "!=", Values: []string{"7"}},
+				{Dim: Dimension{Name: "tag"}, Op: "NOT IN", Values: []string{"env=dev"}},
+				{Dim: Dimension{Name: "os"}, Op: "LIKE", Values: []string{"linux%"}},
+			},
+		},
+		{
+			"label.name = 'it''s'",
+			[]Condition{{Dim: Dimension{Name: "label", Label: "name"}, Op: "=", Values: []string{"it's"}}},
+		},
+	}
+	for _, tt := range tests {
+		in := "SELECT avg(x) FROM metrics WHERE " + tt.where
+		q, err := Parse(in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", in, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.Where, tt.want) {
+			t.Errorf("Parse(%q).Where = %+v, want %+v", in, q.Where, tt.want)
+		}
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		limit string
+		want  int
+	}{
+		{"1", 1},
+		{"10", 10},
+		{"100", MaxLimit},
+		{"101", MaxLimit},
+		{"100000", MaxLimit},
+	}
+	for _, tt := range tests {
+		q, err := Parse("SELECT avg(x) FROM metrics FACET host LIMIT " + tt.limit)
+		if err != nil {
+			t.Errorf("LIMIT %s: %v", tt.limit, err)
+			continue
+		}
+		if q.Limit != tt.want {
+			t.Errorf("LIMIT %s = %d, want %d", tt.limit, q.Limit, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"avg(x) FROM metrics",
+		"SELECT FROM metrics",
+		"SELECT avg(x)",
+		"SELECT avg(x) FROM logs",
+		"SELECT median(x) FROM metrics",
+		"SELECT avg(1x) FROM metrics",
+		"SELECT avg(x$) FROM metrics",
+		"SELECT avg(x) AS 5 FROM metrics",
+		"SELECT percentile(x) FROM metrics",
+		"SELECT percentile(x, 100) FROM metrics",
+		"SELECT avg(x FROM metrics",
+		"SELECT avg('unterminated) FROM metrics",
+		// WHERE
+		"SELECT avg(x) FROM metrics WHERE",
+		"SELECT avg(x) FROM metrics WHERE region = 'eu'",
+		"SELECT avg(x) FROM metrics WHERE label. = 'a'",
+		"SELECT avg(x) FROM metrics WHERE host = web",
+		"SELECT avg(x) FROM metrics WHERE host == 'a'",
+		"SELECT avg(x) FROM metrics WHERE host = 'a' OR host = 'b'",
+		"SELECT avg(x) FROM metrics WHERE host = 'a' AND",
+		"SELECT avg(x) FROM metrics WHERE host NOT = 'a'",
+		"SELECT avg(x) FROM metrics WHERE host IN ()",
+		"SELECT avg(x) FROM metrics WHERE tag LIKE 'env%'",
+		// FACET, TIMESERIES, SINCE
+		"SELECT avg(x) FROM metrics FACET",
+		"SELECT avg(x) FROM metrics FACET 'host'",
+		"SELECT avg(x) FROM metrics FACET host,",
+		"SELECT avg(x) FROM metrics FACET host FACET group",
+		"SELECT avg(x) FROM metrics TIMESERIES 5 fortnights",
+		"SELECT avg(x) FROM metrics TIMESERIES 0m",
+		"SELECT avg(x) FROM metrics SINCE 1 hour",
+		"SELECT avg(x) FROM metrics SINCE 'yesterday'",
+		// LIMIT
+		"SELECT avg(x) FROM metrics LIMIT",
+		"SELECT avg(x) FROM metrics LIMIT 0",
+		"SELECT avg(x) FROM metrics LIMIT 2.5",
+		"SELECT avg(x) FROM metrics LIMIT ten",
+		"SELECT avg(x) FROM metrics LIMIT 5 extra",
+	} {
+		if _, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q): expected an error", in)
+		}
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	_, err := Parse("SELECT avg(x) FROM metrics WHERE region = 'eu'")
+	pe, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("error = %v, want *ParseError", err)
+	}
+	if pe.Pos != 33 {
+		t.Errorf("error position = %d, want 33", pe.Pos)
+	}
+}
+
+func TestParseDimension(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Dimension
+	}{
+		{"host", Dimension{Name: "host"}},
+		{"HOSTNAME", Dimension{Name: "host"}},
+		{"group", Dimension{Name: "group"}},
+		{"label.Mount", Dimension{Name: "label", Label: "Mount"}},
+		{"labels.k8s.pod", Dimension{Name: "label", Label: "k8s.pod"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseDimension(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseDimension(%q) = %+v, %v, want %+v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "region", "label.", "host group", "'host'", "host-1!"} {
+		if _, err := ParseDimension(in); err == nil {
+			t.Errorf("ParseDimension(%q): expected an error", in)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/models"
+)
+
+// UpsertLogPatterns stores pattern templates; Count is added to the stored
+// count and FirstSeen only applies to new patterns.
+func UpsertLogPatterns(ctx context.Context, patterns []models.LogPattern) error {
+	if len(patterns) == 0 {
+		return nil
+	}
+	writes := make([]mongo.WriteModel, 0, len(patterns))
+	for _, p := range patterns {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": p.ID}).
+			SetUpdate(bson.M{
+				"$set":         bson.M{"tenant_id": p.TenantID, "service": p.Service, "template": p.Template},
+				"$inc":         bson.M{"count": p.Count},
+				"$max":         bson.M{"last_seen": p.LastSeen},
+				"$setOnInsert": bson.M{"first_seen": p.FirstSeen},
+			}).
+			SetUpsert(true))
+	}
+	_, err := models.LogPatternCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// LoadLogPatterns returns the patterns of all tenants seen since the given
+// time.
+func LoadLogPatterns(ctx context.Context, since time.Time) ([]models.LogPattern, error) {
+	cur, err := models.LogPatternCollection.Find(ctx, bson.M{"last_seen": bson.M{"$gte": since}})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var out []models.LogPattern
+	err = cur.All(ctx, &out)
+	return out, err
+}
+
+// GetLogPatterns returns the tenant's patterns with the given ids, by id.
+func GetLogPatterns(ctx context.Context, tenantID int64, ids []string) (map[string]models.LogPattern, error) {
+	out := make(map[string]models.LogPattern, len(ids))
+	if len(ids) == 0 {
+		return out, nil
+	}
+	cur, err := models.LogPatternCollection.Find(ctx, bson.M{"tenant_id": tenantID, "_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var p models.LogPattern
+		if err := cur.Decode(&p); err != nil {
+			return nil, err
+		}
+		out[p.ID] = p
+	}
+	return out, cur.Err()
+}
+
+// LogPatternCount is how many logs of a pattern fall in the recent window
+// and in the baseline before it.
+type LogPatternCount struct {
+	PatternID string
+	Recent    int64
+	Baseline  int64
+}
+
+// LogPatternCounts counts logs matching filter per pattern in the window
+// [windowStart, end) and the baseline [baselineStart, windowStart), for the
+// patterns present in the window, most frequent first.
+func LogPatternCounts(ctx context.Context, tenantID int64, filter bson.M, baselineStart, windowStart, end time.Time, limit int) ([]LogPatternCount, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: logMatch(tenantID, bson.M{"$and": bson.A{filter, bson.M{"pattern_id": bson.M{"$gt": ""}}}}, baselineStart, end)}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      "$pattern_id",
+			"recent":   bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$gte": bson.A{"$timestamp", windowStart}}, 1, 0}}},
+			"baseline": bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$lt": bson.A{"$timestamp", windowStart}}, 1, 0}}},
+		}}},
+		{{Key: "$match", Value: bson.M{"recent": bson.M{"$gt": 0}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "recent", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+	}
+	cur, err := models.LogCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []LogPatternCount
+	for cur.Next(ctx) {
+		var row struct {
+			ID       string `bson:"_id"`
+			Recent   int64  `bson:"recent"`
+			Baseline int64  `bson:"baseline"`
+		}
+		if err := cur.Decode(&row); err != nil {
+			return nil, err
+		}
+		out = append(out, LogPatternCount{PatternID: row.ID, Recent: row.Recent, Baseline: row.Baseline})
+	}
+	return out, cur.Err()
+}
+
+// LogPatternBucket is the number of logs of one pattern in one time bucket.
+type LogPatternBucket struct {
+	PatternID string    `json:"pattern_id"`
+	Timestamp time.Time `json:"timestamp"`
+	Count     int64     `json:"count"`
+}
+
+// LogPatternHistogram counts logs matching filter of the given patterns in
+// buckets of interval between start and end.
+func LogPatternHistogram(ctx context.Context, tenantID int64, filter bson.M, ids []string, start, end time.Time, interval time.Duration) ([]LogPatternBucket, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: logMatch(tenantID, bson.M{"$and": bson.A{filter, bson.M{"pattern_id": bson.M{"$in": ids}}}}, start, end)}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"t": bson.M{"$dateTrunc": bson.M{"date": "$timestamp", "unit": "second", "binSize": int64(interval / time.Second)}},
+				"p": "$pattern_id",
+			},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id.t", Value: 1}, {Key: "_id.p", Value: 1}}}},
+	}
+	cur, err := models.LogCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []LogPatternBucket
+	for cur.Next(ctx) {
+		var row struct {
+			ID struct {
+				T time.Time `bson:"t"`
+				P string    `bson:"p"`
+			} `bson:"_id"`
+			Count int64 `bson:"count"`
+		}
+		if err := cur.Decode(&row); err != nil {
+			return nil, err
+		}
+		out = append(out, LogPatternBucket{PatternID: row.ID.P, Timestamp: row.ID.T, Count: row.Count})
+	}
+	return out, cur.Err()
+}
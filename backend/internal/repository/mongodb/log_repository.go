@@ -6,6 +6,7 @@ import (
 
 	"github.com/sakkurohilla/kineticops/backend/internal/models"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -99,3 +100,152 @@ func DistinctValues(ctx context.Context, tenantID int64, field string) ([]string
 	}
 	return out, nil
 }
+
+// LogHistogramBucket is the number of logs in one time bucket, in total and
+// per level.
+type LogHistogramBucket struct {
+	Timestamp time.Time        `json:"timestamp"`
+	Count     int64            `json:"count"`
+	Levels    map[string]int64 `json:"levels"`
+}
+
+// LogFieldCount is one value of a field and how many logs carry it.
+type LogFieldCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// LogErrorRate is the share of error-level logs for one value of a field.
+type LogErrorRate struct {
+	Value  string  `json:"value"`
+	Total  int64   `json:"total"`
+	Errors int64   `json:"errors"`
+	Rate   float64 `json:"rate"`
+}
+
+// ErrorLevels are the levels counted as errors, compared lower-cased.
+var ErrorLevels = []string{"error", "err", "fatal", "critical", "crit", "alert", "emerg", "panic"}
+
+func logMatch(tenantID int64, filter bson.M, start, end time.Time) bson.M {
+	return bson.M{"$and": bson.A{
+		bson.M{"tenant_id": tenantID, "timestamp": bson.M{"$gte": start, "$lt": end}},
+		filter,
+	}}
+}
+
+// LogHistogram counts logs matching filter in buckets of interval between
+// start and end.
+func LogHistogram(ctx context.Context, tenantID int64, filter bson.M, start, end time.Time, interval time.Duration) ([]LogHistogramBucket, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: logMatch(tenantID, filter, start, end)}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"t": bson.M{"$dateTrunc": bson.M{"date": "$timestamp", "unit": "second", "binSize": int64(interval / time.Second)}},
+				"l": bson.M{"$toLower": "$level"},
+			},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id.t": 1}}},
+	}
+	cur, err := models.LogCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var buckets []LogHistogramBucket
+	for cur.Next(ctx) {
+		var row struct {
+			ID struct {
+				T time.Time `bson:"t"`
+				L string    `bson:"l"`
+			} `bson:"_id"`
+			Count int64 `bson:"count"`
+		}
+		if err := cur.Decode(&row); err != nil {
+			return nil, err
+		}
+		if n := len(buckets); n == 0 || !buckets[n-1].Timestamp.Equal(row.ID.T) {
+			buckets = append(buckets, LogHistogramBucket{Timestamp: row.ID.T, Levels: map[string]int64{}})
+		}
+		b := &buckets[len(buckets)-1]
+		b.Count += row.Count
+		b.Levels[row.ID.L] += row.Count
+	}
+	return buckets, cur.Err()
+}
+
+// TopLogValues returns the most frequent values of field among logs matching
+// filter. field must be a document path (see logquery.ResolveField).
+func TopLogValues(ctx context.Context, tenantID int64, filter bson.M, field string, start, end time.Time, limit int) ([]LogFieldCount, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: logMatch(tenantID, filter, start, end)}},
+		{{Key: "$group", Value: bson.M{"_id": bson.M{"$toString": "$" + field}, "count": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+	}
+	cur, err := models.LogCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := []LogFieldCount{}
+	for cur.Next(ctx) {
+		var row struct {
+			ID    *string `bson:"_id"`
+			Count int64   `bson:"count"`
+		}
+		if err := cur.Decode(&row); err != nil {
+			return nil, err
+		}
+		v := ""
+		if row.ID != nil {
+			v = *row.ID
+		}
+		out = append(out, LogFieldCount{Value: v, Count: row.Count})
+	}
+	return out, cur.Err()
+}
+
+// LogErrorRates groups logs matching filter by field and reports the share
+// at an error level, highest rate first.
+func LogErrorRates(ctx context.Context, tenantID int64, filter bson.M, field string, start, end time.Time, limit int) ([]LogErrorRate, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: logMatch(tenantID, filter, start, end)}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"$toString": "$" + field},
+			"total": bson.M{"$sum": 1},
+			"errors": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$in": bson.A{bson.M{"$toLower": "$level"}, ErrorLevels}}, 1, 0,
+			}}},
+		}}},
+		{{Key: "$addFields", Value: bson.M{"rate": bson.M{"$divide": bson.A{"$errors", "$total"}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "rate", Value: -1}, {Key: "total", Value: -1}}}},
+		{{Key: "$limit", Value: limit}},
+	}
+	cur, err := models.LogCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := []LogErrorRate{}
+	for cur.Next(ctx) {
+		var row struct {
+			ID     *string `bson:"_id"`
+			Total  int64   `bson:"total"`
+			Errors int64   `bson:"errors"`
+			Rate   float64 `bson:"rate"`
+		}
+		if err := cur.Decode(&row); err != nil {
+			return nil, err
+		}
+		v := ""
+		if row.ID != nil {
+			v = *row.ID
+		}
+		out = append(out, LogErrorRate{Value: v, Total: row.Total, Errors: row.Errors, Rate: row.Rate})
+	}
+	return out, cur.Err()
+}
@@ -3,7 +3,6 @@ package postgres
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"time"
 
@@ -230,14 +229,14 @@ func (r *AgentRepository) UpdateHeartbeat(token string, heartbeat *models.AgentH
 		"uptime":     uptime,
 		"timestamp":  time.Now().UTC().Format(time.RFC3339),
 	}
-	if b, jerr := json.Marshal(payload); jerr == nil {
-		logging.Infof("[WS BROADCAST] host=%d heartbeat (processed in %dms)", hostID, elapsed)
-		if gh := ws.GetGlobalHub(); gh != nil {
-			gh.RememberMessage(b)
-		}
-		ws.BroadcastToClients(b)
-		telemetry.IncWSBroadcast(context.Background(), 1)
+	var tenantID int64
+	if err := r.db.Get(&tenantID, "SELECT tenant_id FROM hosts WHERE id = $1", hostID); err != nil {
+		logging.Warnf("[WS BROADCAST] host=%d heartbeat not broadcast: tenant lookup failed: %v", hostID, err)
+		return nil
 	}
+	logging.Infof("[WS BROADCAST] host=%d heartbeat (processed in %dms)", hostID, elapsed)
+	ws.PublishEvent(tenantID, int64(hostID), payload)
+	telemetry.IncWSBroadcast(context.Background(), 1)
 
 	return nil
 }
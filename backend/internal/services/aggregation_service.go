@@ -23,7 +23,7 @@ type AggregationQuery struct {
 	StartTime  time.Time
 	EndTime    time.Time
 	Interval   string // "1m", "5m", "1h", "1d"
-	Function   string // "avg", "max", "min", "sum"
+	Function   string // "avg", "max", "min", "sum", "count", "p50", "p95", "p99"
 }
 
 func NewAggregationService() *AggregationService {
@@ -90,55 +90,80 @@ func (a *AggregationService) selectOptimalInterval(start, end time.Time) string
 
 // buildTimeSeriesQuery creates optimized SQL for time series aggregation
 func (a *AggregationService) buildTimeSeriesQuery(query AggregationQuery) string {
-	tableName := a.selectOptimalTable(query.StartTime, query.EndTime, query.Interval)
+	tableName := a.selectOptimalTable(query.StartTime, query.EndTime, query.Interval, query.Function)
 	intervalSQL := a.getIntervalSQL(query.Interval)
-	functionSQL := a.getFunctionSQL(query.Function)
 
 	if tableName == "metrics" {
 		// Use raw data with aggregation
 		return fmt.Sprintf(`
 			SELECT 
-				time_bucket('%s', timestamp) as bucket,
-				%s(value) as aggregated_value
-			FROM %s 
+				%s as bucket,
+				%s as aggregated_value
+			FROM metrics 
 			WHERE host_id = $1 
 				AND name = $2 
 				AND timestamp >= $3 
 				AND timestamp <= $4
 			GROUP BY bucket 
 			ORDER BY bucket ASC
-		`, intervalSQL, functionSQL, tableName)
-	} else {
-		// Use TimescaleDB continuous aggregates (metrics_5m, metrics_1h, metrics_1d)
-		// These views have columns: bucket, host_id, tenant_id, name, value
-		return fmt.Sprintf(`
-			SELECT 
-				bucket as bucket,
-				value as aggregated_value
-			FROM %s 
-			WHERE host_id = $1 
-				AND name = $2 
-				AND bucket >= $3 
-				AND bucket <= $4
-			ORDER BY bucket ASC
-		`, tableName)
+		`, RollupSvc.bucketExpr(intervalSQL, "timestamp"), a.getFunctionSQL(query.Function))
 	}
+
+	// Re-bucket the rollup to the requested interval, combining per-bucket
+	// aggregates so results match what the raw query would return
+	_, toolkit, _ := RollupSvc.level(tableName)
+	return fmt.Sprintf(`
+		SELECT 
+			%s as b,
+			%s as aggregated_value
+		FROM %s 
+		WHERE host_id = $1 
+			AND name = $2 
+			AND bucket >= $3 
+			AND bucket <= $4
+		GROUP BY b
+		ORDER BY b ASC
+	`, RollupSvc.bucketExpr(intervalSQL, "bucket"), a.getRollupFunctionSQL(query.Function, toolkit), tableName)
 }
 
-// selectOptimalTable chooses best table for query performance
-func (a *AggregationService) selectOptimalTable(start, end time.Time, interval string) string {
-	duration := end.Sub(start)
+// selectOptimalTable chooses best table for query performance: the coarsest
+// ready rollup whose bucket divides the requested interval, for ranges long
+// enough that scanning raw rows is costly. It is the only reader of the
+// rollups maintained by RollupService.
+func (a *AggregationService) selectOptimalTable(start, end time.Time, interval, function string) string {
+	if end.Sub(start) <= 2*time.Hour {
+		return "metrics"
+	}
+	step := a.intervalDuration(interval)
 
-	// Use TimescaleDB continuous aggregates for longer ranges
-	switch {
-	case duration > 7*24*time.Hour && (interval == "1h" || interval == "1d"):
-		return "metrics_1h"
-	case duration > 30*24*time.Hour && interval == "1d":
-		return "metrics_1d"
-	case duration > 2*time.Hour && (interval == "5m" || interval == "15m"):
-		return "metrics_5m"
+	for i := len(rollupLevels) - 1; i >= 0; i-- {
+		level, toolkit, ok := RollupSvc.level(rollupLevels[i].Table)
+		if !ok || step < level.Step || step%level.Step != 0 {
+			continue
+		}
+		// per-bucket percentiles cannot be merged without toolkit sketches,
+		// and continuous aggregates without toolkit, or rollup tables built
+		// from a finer level, have none at all
+		if isPercentileFunction(function) && !toolkit && (step != level.Step || RollupSvc.Timescale() || level.Source != "") {
+			continue
+		}
+		return level.Table
+	}
+	return "metrics"
+}
+
+func (a *AggregationService) intervalDuration(interval string) time.Duration {
+	switch interval {
+	case "5m":
+		return 5 * time.Minute
+	case "15m":
+		return 15 * time.Minute
+	case "1h":
+		return time.Hour
+	case "1d":
+		return 24 * time.Hour
 	default:
-		return "metrics"
+		return time.Minute
 	}
 }
 
@@ -146,38 +171,71 @@ func (a *AggregationService) selectOptimalTable(start, end time.Time, interval s
 func (a *AggregationService) getIntervalSQL(interval string) string {
 	switch interval {
 	case "1m":
-		return "minute"
+		return "1 minute"
 	case "5m":
 		return "5 minutes"
 	case "15m":
 		return "15 minutes"
 	case "1h":
-		return "hour"
+		return "1 hour"
 	case "1d":
-		return "day"
+		return "1 day"
 	default:
-		return "minute"
+		return "1 minute"
 	}
 }
 
-// getFunctionSQL converts function string to SQL aggregation
+// getFunctionSQL converts function string to SQL aggregation over raw values
 func (a *AggregationService) getFunctionSQL(function string) string {
 	switch function {
 	case "avg":
-		return "AVG"
+		return "AVG(value)"
+	case "max":
+		return "MAX(value)"
+	case "min":
+		return "MIN(value)"
+	case "sum":
+		return "SUM(value)"
+	case "count":
+		return "COUNT(value)"
+	case "p50":
+		return "percentile_cont(0.50) WITHIN GROUP (ORDER BY value)"
+	case "p95":
+		return "percentile_cont(0.95) WITHIN GROUP (ORDER BY value)"
+	case "p99":
+		return "percentile_cont(0.99) WITHIN GROUP (ORDER BY value)"
+	default:
+		return "AVG(value)"
+	}
+}
+
+// getRollupFunctionSQL combines rollup rows into one value per bucket.
+func (a *AggregationService) getRollupFunctionSQL(function string, toolkit bool) string {
+	switch function {
 	case "max":
-		return "MAX"
+		return "MAX(max_value)"
 	case "min":
-		return "MIN"
+		return "MIN(min_value)"
 	case "sum":
-		return "SUM"
+		return "SUM(avg_value * sample_count)"
 	case "count":
-		return "COUNT"
+		return "SUM(sample_count)"
+	case "p50", "p95", "p99":
+		q := map[string]string{"p50": "0.50", "p95": "0.95", "p99": "0.99"}[function]
+		if toolkit {
+			return fmt.Sprintf("approx_percentile(%s, rollup(pct))", q)
+		}
+		// only selected for rollup tables whose bucket equals the interval
+		return fmt.Sprintf("MAX(%s_value)", function)
 	default:
-		return "AVG"
+		return "SUM(avg_value * sample_count) / NULLIF(SUM(sample_count), 0)"
 	}
 }
 
+func isPercentileFunction(function string) bool {
+	return function == "p50" || function == "p95" || function == "p99"
+}
+
 // GetMetricsForDashboard returns optimized metrics for dashboard display
 func (a *AggregationService) GetMetricsForDashboard(hostID int64, timeRange string) (map[string][]TimeSeriesPoint, error) {
 	end := time.Now()
@@ -0,0 +1,309 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/query"
+)
+
+// Anomaly conditions. Instead of a fixed threshold, each series of the
+// condition's KQL query (every FACET group and, with several SELECT items,
+// every metric) is compared with a baseline learned from its own history:
+// the mean and standard deviation of the same query in past buckets of the
+// same season slot, i.e. the same hour of the day (hour_of_day), the same
+// hour of the week (day_of_week) or any time (none). A value more than
+// Sensitivity standard deviations from the mean, in Direction, breaches;
+// Duration then gives how long the anomaly must persist before firing.
+//
+// Baselines are computed with TIMESERIES runs of the query whose bucket is
+// the query's window, so each past sample aggregates as much data as the
+// current value: count() and sum() stay comparable and avg() keeps its
+// spread. They are cached per condition for an hour.
+
+const (
+	AlertConditionThreshold = "threshold"
+	AlertConditionAnomaly   = "anomaly"
+
+	defaultAnomalySensitivity = 3.0
+	maxAnomalySensitivity     = 10.0
+	anomalyBaselineTTL        = time.Hour
+	anomalyMinSamples         = 6
+	anomalyMinWeeklySamples   = 4
+	anomalyMaxBaselineBuckets = 4 * maxQueryBuckets
+)
+
+var anomalyDirections = map[string]bool{"up": true, "down": true, "both": true}
+
+var anomalySeasonalities = map[string]bool{"none": true, "hour_of_day": true, "day_of_week": true}
+
+// anomalyBaseline is the cached baseline of a condition: per series, the
+// statistics of each season slot.
+type anomalyBaseline struct {
+	query       string
+	seasonality string
+	computedAt  time.Time
+	series      map[string]map[int]*baselineStats
+}
+
+type baselineStats struct {
+	n, mean, m2 float64 // Welford's running mean and sum of squared deviations
+}
+
+func (b *baselineStats) add(v float64) {
+	b.n++
+	d := v - b.mean
+	b.mean += d / b.n
+	b.m2 += d * (v - b.mean)
+}
+
+// stddev is the sample standard deviation, floored at 1% of the mean so a
+// flat history does not make every change an anomaly.
+func (b *baselineStats) stddev() float64 {
+	sd := 0.0
+	if b.n > 1 {
+		sd = math.Sqrt(b.m2 / (b.n - 1))
+	}
+	return math.Max(sd, math.Max(math.Abs(b.mean)*0.01, 1e-9))
+}
+
+// validateAnomaly checks the anomaly settings of a condition and fills in
+// their defaults.
+func validateAnomaly(c *AlertCondition) error {
+	if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(c.Query)), "SELECT") {
+		return &AlertConfigError{Msg: "anomaly conditions need a KQL query (SELECT ... FROM metrics)"}
+	}
+	if c.Sensitivity == 0 {
+		c.Sensitivity = defaultAnomalySensitivity
+	}
+	if c.Sensitivity < 0 || c.Sensitivity > maxAnomalySensitivity {
+		return &AlertConfigError{Msg: fmt.Sprintf("sensitivity must be between 0 and %g standard deviations", maxAnomalySensitivity)}
+	}
+	if c.Direction == "" {
+		c.Direction = "both"
+	}
+	if !anomalyDirections[c.Direction] {
+		return &AlertConfigError{Msg: "direction must be up, down or both"}
+	}
+	if c.Seasonality == "" {
+		c.Seasonality = "hour_of_day"
+	}
+	if !anomalySeasonalities[c.Seasonality] {
+		return &AlertConfigError{Msg: "seasonality must be none, hour_of_day or day_of_week"}
+	}
+
+	q, err := query.Parse(strings.TrimSpace(c.Query))
+	if err != nil {
+		return nil // reported with the query
+	}
+	window := q.Since.Ago - q.Until.Ago
+	if !q.Since.Absolute.IsZero() || window < time.Minute || window%time.Minute != 0 {
+		return &AlertConfigError{Msg: "anomaly queries need a window of whole minutes (SINCE n minutes ago)"}
+	}
+	if c.Seasonality != "none" && window > time.Hour {
+		return &AlertConfigError{Msg: "seasonal anomaly queries need a window of at most 1 hour; use seasonality none for longer windows"}
+	}
+	if _, history := baselinePlan(q, c.Seasonality); history < seasonPeriod(c.Seasonality) {
+		return &AlertConfigError{Msg: fmt.Sprintf("a %d-minute window is too short for %s seasonality", window/time.Minute, c.Seasonality)}
+	}
+	return nil
+}
+
+// seasonPeriod is the history a seasonality needs to see every slot once.
+func seasonPeriod(seasonality string) time.Duration {
+	switch seasonality {
+	case "hour_of_day":
+		return 24 * time.Hour
+	case "day_of_week":
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+// seasonSlot is the season slot of t: its hour of the day or of the week.
+func seasonSlot(t time.Time, seasonality string) int {
+	t = t.Local()
+	switch seasonality {
+	case "hour_of_day":
+		return t.Hour()
+	case "day_of_week":
+		return int(t.Weekday())*24 + t.Hour()
+	}
+	return 0
+}
+
+// baselinePlan picks the bucket size and history length of a baseline:
+// buckets as long as the query window, and as much history as
+// anomalyMaxBaselineBuckets allows, up to two weeks (eight for
+// day_of_week, and at least 2*anomalyMinSamples buckets for none). Seasonal
+// history is whole days (weeks for day_of_week).
+func baselinePlan(q *query.Query, seasonality string) (interval, history time.Duration) {
+	interval = q.Since.Ago - q.Until.Ago
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	switch seasonality {
+	case "none":
+		history = max(24*time.Hour, 2*anomalyMinSamples*interval)
+	case "day_of_week":
+		history = 8 * 7 * 24 * time.Hour
+	default:
+		history = 14 * 24 * time.Hour
+	}
+	if max := time.Duration(anomalyMaxBaselineBuckets) * interval; history > max {
+		history = max
+		switch seasonality {
+		case "hour_of_day":
+			history = history.Truncate(24 * time.Hour)
+		case "day_of_week":
+			history = history.Truncate(7 * 24 * time.Hour)
+		}
+	}
+	return interval, history
+}
+
+// anomalySeriesKey is the series key of a facet group and, for queries with
+// several SELECT items, a metric column.
+func anomalySeriesKey(facet map[string]string, column string, columns int) string {
+	if columns < 2 {
+		return alertSeriesKey(facet)
+	}
+	labels := map[string]string{"metric": column}
+	for k, v := range facet {
+		labels[k] = v
+	}
+	return alertSeriesKey(labels)
+}
+
+// baseline returns the condition's cached baseline, recomputing it when it
+// is older than anomalyBaselineTTL or the condition changed.
+func (s *EnhancedAlertService) baseline(condition *AlertCondition, q *query.Query, now time.Time) (*anomalyBaseline, error) {
+	if v, ok := s.baselines.Load(condition.ID); ok {
+		b := v.(*anomalyBaseline)
+		if b.query == condition.Query && b.seasonality == condition.Seasonality && now.Sub(b.computedAt) < anomalyBaselineTTL {
+			return b, nil
+		}
+	}
+
+	b := &anomalyBaseline{
+		query:       condition.Query,
+		seasonality: condition.Seasonality,
+		computedAt:  now,
+		series:      make(map[string]map[int]*baselineStats),
+	}
+
+	// One TIMESERIES run per maxQueryBuckets buckets
+	interval, history := baselinePlan(q, condition.Seasonality)
+	until := now.Truncate(interval)
+	chunk := time.Duration(maxQueryBuckets) * interval
+	for since := until.Add(-history); since.Before(until); since = since.Add(chunk) {
+		bq := *q
+		bq.TimeSeries = true
+		bq.Interval = interval
+		bq.Since = query.TimeRef{Absolute: since}
+		bq.Until = query.TimeRef{Absolute: minTime(since.Add(chunk), until)}
+		bq.Limit = query.MaxLimit
+		res, err := QuerySvc.Execute(condition.TenantID, &bq, now)
+		if err != nil {
+			return nil, err
+		}
+		b.add(res, condition.Seasonality)
+	}
+	s.baselines.Store(condition.ID, b)
+	return b, nil
+}
+
+// add feeds the buckets of a TIMESERIES result into the baseline.
+func (b *anomalyBaseline) add(res *QueryResult, seasonality string) {
+	for _, row := range res.Rows {
+		if row.Timestamp == nil {
+			continue
+		}
+		slot := seasonSlot(*row.Timestamp, seasonality)
+		for _, col := range res.Columns {
+			v := row.Values[col]
+			if v == nil {
+				continue
+			}
+			key := anomalySeriesKey(row.Facet, col, len(res.Columns))
+			slots := b.series[key]
+			if slots == nil {
+				slots = make(map[int]*baselineStats)
+				b.series[key] = slots
+			}
+			if slots[slot] == nil {
+				slots[slot] = &baselineStats{}
+			}
+			slots[slot].add(*v)
+		}
+	}
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// anomalySeries evaluates an anomaly condition: the current value of each
+// series against its baseline. Series without enough history are skipped.
+func (s *EnhancedAlertService) anomalySeries(condition *AlertCondition, now time.Time) ([]alertSeriesValue, error) {
+	q, err := query.Parse(strings.TrimSpace(condition.Query))
+	if err != nil {
+		return nil, err
+	}
+	if q.TimeSeries {
+		return nil, &QueryPlanError{Msg: "TIMESERIES queries do not yield a single value"}
+	}
+	q.Limit = query.MaxLimit
+	res, err := QuerySvc.Execute(condition.TenantID, q, now)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.baseline(condition, q, now)
+	if err != nil {
+		return nil, err
+	}
+
+	minSamples := float64(anomalyMinSamples)
+	if condition.Seasonality == "day_of_week" {
+		minSamples = anomalyMinWeeklySamples
+	}
+	slot := seasonSlot(now, condition.Seasonality)
+	var series []alertSeriesValue
+	for _, row := range res.Rows {
+		for _, col := range res.Columns {
+			v := row.Values[col]
+			if v == nil {
+				continue
+			}
+			key := anomalySeriesKey(row.Facet, col, len(res.Columns))
+			stats := b.series[key][slot]
+			if stats == nil || stats.n < minSamples {
+				continue
+			}
+			sd := stats.stddev()
+			score := (*v - stats.mean) / sd
+			breach := false
+			switch condition.Direction {
+			case "up":
+				breach = score > condition.Sensitivity
+			case "down":
+				breach = score < -condition.Sensitivity
+			default:
+				breach = math.Abs(score) > condition.Sensitivity
+			}
+			series = append(series, alertSeriesValue{
+				key:    key,
+				value:  *v,
+				breach: breach,
+				detail: fmt.Sprintf("Value: %.2f, %.1f standard deviations from the baseline %.2f ± %.2f (%s)",
+					*v, score, stats.mean, sd, condition.Seasonality),
+			})
+		}
+	}
+	return series, nil
+}
@@ -0,0 +1,388 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/models"
+	"github.com/sakkurohilla/kineticops/backend/internal/repository/postgres"
+)
+
+// Composite conditions combine other conditions of the tenant with a
+// boolean expression over their ids, e.g. "12 AND (13 OR NOT 14)". A child
+// is true while a series of it is firing (or recovering). With Correlation
+// host or group, the expression is evaluated per host or host group: child
+// series count for the host or group they carry (directly or through their
+// host), and child series with neither, such as a log count, count for every
+// host or group. Composites are evaluated after their children, which are
+// evaluated even when they are in no policy, and cannot be nested. Child
+// series not evaluated within compositeStateMaxAge, because the child's
+// evaluation is stuck or it stopped being evaluated, count as not firing.
+// Their incidents are linked to the open incidents of the children that
+// made them fire.
+
+const (
+	AlertConditionComposite = "composite"
+
+	maxCompositeRefs     = 10
+	compositeStateMaxAge = 2 * alertEvalInterval
+)
+
+var compositeCorrelations = map[string]bool{"none": true, "host": true, "group": true}
+
+// AlertIncidentLink links an incident of a composite condition to an
+// incident of one of its children.
+type AlertIncidentLink struct {
+	IncidentID        int64 `json:"incident_id" gorm:"primaryKey"`
+	RelatedIncidentID int64 `json:"related_incident_id" gorm:"primaryKey"`
+}
+
+// compositeNode is a parsed composite expression: an AND, OR or NOT of its
+// args, or a reference to a condition.
+type compositeNode struct {
+	op   string // and, or, not or ref
+	id   int64
+	args []*compositeNode
+}
+
+func (n *compositeNode) eval(truth func(id int64) bool) bool {
+	switch n.op {
+	case "and":
+		for _, a := range n.args {
+			if !a.eval(truth) {
+				return false
+			}
+		}
+		return true
+	case "or":
+		for _, a := range n.args {
+			if a.eval(truth) {
+				return true
+			}
+		}
+		return false
+	case "not":
+		return !n.args[0].eval(truth)
+	}
+	return truth(n.id)
+}
+
+// refs appends the condition ids the expression references to ids, once
+// each.
+func (n *compositeNode) refs(ids []int64) []int64 {
+	if n.op == "ref" {
+		for _, id := range ids {
+			if id == n.id {
+				return ids
+			}
+		}
+		return append(ids, n.id)
+	}
+	for _, a := range n.args {
+		ids = a.refs(ids)
+	}
+	return ids
+}
+
+// parseComposite parses a composite expression: condition ids combined with
+// AND, OR (binding looser) and NOT, and grouped with parentheses.
+func parseComposite(expr string) (*compositeNode, error) {
+	var tokens []string
+	for _, field := range strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expr)) {
+		tokens = append(tokens, strings.ToUpper(field))
+	}
+	p := &compositeParser{tokens: tokens}
+	node, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return node, nil
+}
+
+type compositeParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *compositeParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *compositeParser) or() (*compositeNode, error) {
+	return p.binary("OR", "or", p.and)
+}
+
+func (p *compositeParser) and() (*compositeNode, error) {
+	return p.binary("AND", "and", p.unary)
+}
+
+func (p *compositeParser) binary(keyword, op string, operand func() (*compositeNode, error)) (*compositeNode, error) {
+	node, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == keyword {
+		p.pos++
+		next, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if node.op != op {
+			node = &compositeNode{op: op, args: []*compositeNode{node}}
+		}
+		node.args = append(node.args, next)
+	}
+	return node, nil
+}
+
+func (p *compositeParser) unary() (*compositeNode, error) {
+	switch tok := p.peek(); tok {
+	case "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case "NOT":
+		p.pos++
+		arg, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &compositeNode{op: "not", args: []*compositeNode{arg}}, nil
+	case "(":
+		p.pos++
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return node, nil
+	default:
+		id, err := strconv.ParseInt(strings.TrimPrefix(tok, "#"), 10, 64)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("expected a condition id, got %q", tok)
+		}
+		p.pos++
+		return &compositeNode{op: "ref", id: id}, nil
+	}
+}
+
+// validateComposite checks the expression and correlation of a composite
+// condition. Composite conditions have no query, threshold or operator.
+func validateComposite(c *AlertCondition) error {
+	c.Expression = strings.TrimSpace(c.Expression)
+	if c.Expression == "" || len(c.Expression) > 1000 {
+		return &AlertConfigError{Msg: "expression is required (at most 1000 characters)"}
+	}
+	node, err := parseComposite(c.Expression)
+	if err != nil {
+		return &AlertConfigError{Msg: "invalid expression: " + err.Error()}
+	}
+	ids := node.refs(nil)
+	if len(ids) > maxCompositeRefs {
+		return &AlertConfigError{Msg: fmt.Sprintf("expression references more than %d conditions", maxCompositeRefs)}
+	}
+	for _, id := range ids {
+		if id == c.ID {
+			return &AlertConfigError{Msg: "expression references the condition itself"}
+		}
+	}
+	var children []AlertCondition
+	if err := postgres.DB.Where("id IN ? AND tenant_id = ?", ids, c.TenantID).Find(&children).Error; err != nil {
+		return err
+	}
+	if len(children) != len(ids) {
+		return &AlertConfigError{Msg: "expression references unknown conditions"}
+	}
+	for _, child := range children {
+		if child.Type == AlertConditionComposite {
+			return &AlertConfigError{Msg: fmt.Sprintf("condition %d is composite; composite conditions cannot be nested", child.ID)}
+		}
+	}
+	if c.ID != 0 {
+		if names := compositesUsing(c.ID, c.TenantID); len(names) > 0 {
+			return &AlertConfigError{Msg: "conditions used by composite conditions cannot be composite"}
+		}
+	}
+	if c.Correlation == "" {
+		c.Correlation = "none"
+	}
+	if !compositeCorrelations[c.Correlation] {
+		return &AlertConfigError{Msg: "correlation must be none, host or group"}
+	}
+	c.Query = ""
+	c.Operator = "above"
+	return nil
+}
+
+// compositesUsing returns the names of the tenant's composite conditions
+// whose expression references condition id.
+func compositesUsing(id, tenantID int64) []string {
+	var composites []AlertCondition
+	postgres.DB.Where("tenant_id = ? AND type = ?", tenantID, AlertConditionComposite).Find(&composites)
+	var names []string
+	for _, c := range composites {
+		if node, err := parseComposite(c.Expression); err == nil {
+			for _, ref := range node.refs(nil) {
+				if ref == id {
+					names = append(names, fmt.Sprintf("'%s'", c.Name))
+				}
+			}
+		}
+	}
+	return names
+}
+
+// compositeScope returns the scope key of a child series for correlation,
+// or false for series that apply to every scope.
+func compositeScope(correlation, seriesKey string, hostsByID map[string]models.Host, hostsByName map[string]models.Host) (string, bool) {
+	labels := parseSeriesKey(seriesKey)
+	host, ok := hostsByID[labels["host_id"]]
+	if !ok {
+		host, ok = hostsByName[labels["host"]]
+	}
+	switch correlation {
+	case "host":
+		if ok {
+			return host.Hostname, true
+		}
+		return labels["host"], labels["host"] != ""
+	case "group":
+		if g := labels["group"]; g != "" {
+			return g, true
+		}
+		return host.Group, ok && host.Group != ""
+	}
+	return "", false
+}
+
+// compositeSeries evaluates a composite condition from the series states of
+// its children.
+func (s *EnhancedAlertService) compositeSeries(condition *AlertCondition) ([]alertSeriesValue, error) {
+	node, err := parseComposite(condition.Expression)
+	if err != nil {
+		return nil, err
+	}
+	ids := node.refs(nil)
+	var children []AlertCondition
+	if err := postgres.DB.Where("id IN ? AND tenant_id = ?", ids, condition.TenantID).Find(&children).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[int64]string, len(children))
+	for _, c := range children {
+		names[c.ID] = c.Name
+	}
+	var states []AlertSeriesState
+	if err := postgres.DB.Where("condition_id IN ? AND tenant_id = ?", ids, condition.TenantID).
+		Order("series_key").Find(&states).Error; err != nil {
+		return nil, err
+	}
+
+	hostsByID := make(map[string]models.Host)
+	hostsByName := make(map[string]models.Host)
+	if condition.Correlation != "none" {
+		var hosts []models.Host
+		postgres.DB.Select(`id, hostname, "group"`).Where("tenant_id = ?", condition.TenantID).Find(&hosts)
+		for _, h := range hosts {
+			hostsByID[strconv.FormatInt(h.ID, 10)] = h
+			hostsByName[h.Hostname] = h
+		}
+	}
+
+	// Firing child series per scope, and those that apply to every scope
+	firing := make(map[string]map[int64][]string)
+	global := make(map[int64][]string)
+	scopes := []string{}
+	if condition.Correlation == "none" {
+		scopes = append(scopes, "")
+	}
+	stale := time.Now().Add(-compositeStateMaxAge)
+	for _, st := range states {
+		active := (st.State == AlertStateFiring || st.State == AlertStateRecovering) && !st.EvaluatedAt.Before(stale)
+		scope, scoped := compositeScope(condition.Correlation, st.SeriesKey, hostsByID, hostsByName)
+		if !scoped {
+			if active {
+				global[st.ConditionID] = append(global[st.ConditionID], st.SeriesKey)
+			}
+			continue
+		}
+		if firing[scope] == nil {
+			firing[scope] = make(map[int64][]string)
+			scopes = append(scopes, scope)
+		}
+		if active {
+			firing[scope][st.ConditionID] = append(firing[scope][st.ConditionID], st.SeriesKey)
+		}
+	}
+
+	var incidents []AlertIncident
+	postgres.DB.Select("id", "condition_id", "series_key").
+		Where("condition_id IN ? AND status IN ?", ids, []string{"open", "acknowledged"}).Find(&incidents)
+	open := make(map[string][]int64)
+	for _, inc := range incidents {
+		k := fmt.Sprintf("%d/%s", inc.ConditionID, inc.SeriesKey)
+		open[k] = append(open[k], inc.ID)
+	}
+
+	series := make([]alertSeriesValue, 0, len(scopes))
+	for _, scope := range scopes {
+		truth := func(id int64) bool { return len(firing[scope][id]) > 0 || len(global[id]) > 0 }
+		sv := alertSeriesValue{breach: node.eval(truth)}
+		if condition.Correlation != "none" {
+			sv.key = alertSeriesKey(map[string]string{condition.Correlation: scope})
+		}
+		var parts []string
+		for _, id := range ids {
+			if !truth(id) {
+				continue
+			}
+			sv.value++
+			keys := append(append([]string{}, firing[scope][id]...), global[id]...)
+			for _, key := range keys {
+				sv.related = append(sv.related, open[fmt.Sprintf("%d/%s", id, key)]...)
+			}
+			part := fmt.Sprintf("'%s'", names[id])
+			if len(keys) > 0 && keys[0] != "" {
+				part += " (" + strings.Join(keys, "; ") + ")"
+			}
+			parts = append(parts, part)
+		}
+		if sv.breach {
+			sv.detail = fmt.Sprintf("Expression %s is true. Firing: %s", condition.Expression, strings.Join(parts, ", "))
+			if len(parts) == 0 {
+				sv.detail = fmt.Sprintf("Expression %s is true", condition.Expression)
+			}
+		}
+		series = append(series, sv)
+	}
+	return series, nil
+}
+
+// linkIncidents links an incident of a composite condition to the child
+// incidents that made it fire.
+func linkIncidents(incidentID int64, related []int64) {
+	for _, id := range uniqueIDs(related) {
+		if err := postgres.DB.Create(&AlertIncidentLink{IncidentID: incidentID, RelatedIncidentID: id}).Error; err != nil {
+			logging.Warnf("failed to link incident=%d to incident=%d: %v", incidentID, id, err)
+		}
+	}
+}
+
+// GetRelatedIncidents returns the child incidents linked to an incident of
+// a composite condition.
+func (s *EnhancedAlertService) GetRelatedIncidents(incidentID int64, tenantID int64) ([]AlertIncident, error) {
+	incidents := []AlertIncident{}
+	err := postgres.DB.Joins("JOIN alert_incident_links l ON l.related_incident_id = alert_incidents.id").
+		Where("l.incident_id = ? AND alert_incidents.tenant_id = ?", incidentID, tenantID).
+		Order("alert_incidents.opened_at").Find(&incidents).Error
+	return incidents, err
+}
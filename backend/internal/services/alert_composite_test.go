@@ -0,0 +1,133 @@
+package services
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/models"
+)
+
+// compositeString renders a parsed expression fully parenthesized.
+func compositeString(n *compositeNode) string {
+	switch n.op {
+	case "ref":
+		return strconv.FormatInt(n.id, 10)
+	case "not":
+		return "NOT " + compositeString(n.args[0])
+	}
+	parts := make([]string, len(n.args))
+	for i, a := range n.args {
+		parts[i] = compositeString(a)
+	}
+	return "(" + strings.Join(parts, " "+strings.ToUpper(n.op)+" ") + ")"
+}
+
+func TestParseComposite(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"12", "12"},
+		{"#12", "12"},
+		{"12 AND 13", "(12 AND 13)"},
+		{"12 and 13 and 14", "(12 AND 13 AND 14)"},
+		{"12 OR 13 AND 14", "(12 OR (13 AND 14))"},
+		{"12 AND 13 OR 14", "((12 AND 13) OR 14)"},
+		{"12 AND (13 OR NOT 14)", "(12 AND (13 OR NOT 14))"},
+		{"NOT NOT 12", "NOT NOT 12"},
+		{"NOT (12 OR 13)", "NOT (12 OR 13)"},
+		{"(12)AND(13)", "(12 AND 13)"},
+	}
+	for _, tt := range tests {
+		node, err := parseComposite(tt.in)
+		if err != nil {
+			t.Errorf("parseComposite(%q): %v", tt.in, err)
+			continue
+		}
+		if got := compositeString(node); got != tt.want {
+			t.Errorf("parseComposite(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseCompositeErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"AND",
+		"12 AND",
+		"12 13",
+		"(12 OR 13",
+		"12 OR 13)",
+		"NOT",
+		"0",
+		"-1",
+		"cpu",
+		"12 XOR 13",
+	} {
+		if _, err := parseComposite(in); err == nil {
+			t.Errorf("parseComposite(%q): expected an error", in)
+		}
+	}
+}
+
+func TestCompositeEval(t *testing.T) {
+	node, err := parseComposite("1 AND (2 OR NOT 3)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		firing []int64
+		want   bool
+	}{
+		{nil, false},
+		{[]int64{1}, true},
+		{[]int64{1, 3}, false},
+		{[]int64{1, 2, 3}, true},
+		{[]int64{2}, false},
+	}
+	for _, tt := range tests {
+		truth := func(id int64) bool { return containsInt64(tt.firing, id) }
+		if got := node.eval(truth); got != tt.want {
+			t.Errorf("eval with %v firing = %v, want %v", tt.firing, got, tt.want)
+		}
+	}
+}
+
+func TestCompositeRefs(t *testing.T) {
+	node, err := parseComposite("3 AND (1 OR NOT 3) AND 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := node.refs(nil), []int64{3, 1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("refs = %v, want %v", got, want)
+	}
+}
+
+func TestCompositeScope(t *testing.T) {
+	web := models.Host{ID: 7, Hostname: "web-1", Group: "frontend"}
+	byID := map[string]models.Host{"7": web}
+	byName := map[string]models.Host{"web-1": web}
+	tests := []struct {
+		correlation, seriesKey string
+		scope                  string
+		scoped                 bool
+	}{
+		{"host", "host=web-1", "web-1", true},
+		{"host", "host_id=7", "web-1", true},
+		{"host", "host=db-1", "db-1", true},
+		{"host", "", "", false},
+		{"group", "host=web-1", "frontend", true},
+		{"group", "group=backend, host=web-1", "backend", true},
+		{"group", "host=db-1", "", false},
+		{"none", "host=web-1", "", false},
+	}
+	for _, tt := range tests {
+		scope, scoped := compositeScope(tt.correlation, tt.seriesKey, byID, byName)
+		if scope != tt.scope || scoped != tt.scoped {
+			t.Errorf("compositeScope(%q, %q) = %q, %v, want %q, %v",
+				tt.correlation, tt.seriesKey, scope, scoped, tt.scope, tt.scoped)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/models"
+	"github.com/sakkurohilla/kineticops/backend/internal/notify"
+	"github.com/sakkurohilla/kineticops/backend/internal/repository/postgres"
+)
+
+// Escalation. An alert policy may name an escalation policy: ordered tiers of
+// channels and users, each notified Delay minutes after the previous tier
+// (the first tier: after the incident opened) while the incident stays
+// unacknowledged. After the final tier it is notified again every
+// RepeatInterval minutes, at most MaxRepeats times (0: until acknowledged).
+// The progress is kept on the incident (escalation_level,
+// escalation_repeat, next_escalation_at) so escalations survive restarts;
+// acknowledging or closing the incident clears next_escalation_at.
+
+const (
+	maxEscalationTiers   = 10
+	maxEscalationDelay   = 7 * 24 * 60 // minutes
+	escalationBatch      = 100
+	escalationTickPeriod = 15 * time.Second
+)
+
+// AlertEscalationTier is one step of an escalation policy.
+type AlertEscalationTier struct {
+	Delay      int     `json:"delay"` // minutes after the previous tier
+	ChannelIDs []int64 `json:"channel_ids"`
+	UserIDs    []int64 `json:"user_ids"`
+}
+
+type AlertEscalationPolicy struct {
+	ID             int64                 `json:"id"`
+	TenantID       int64                 `json:"tenant_id"`
+	Name           string                `json:"name"`
+	Description    string                `json:"description"`
+	Tiers          []AlertEscalationTier `json:"tiers" gorm:"serializer:json"`
+	RepeatInterval int                   `json:"repeat_interval"` // minutes; 0 disables repeats
+	MaxRepeats     int                   `json:"max_repeats"`     // 0 repeats until acknowledged
+	CreatedAt      time.Time             `json:"created_at"`
+	UpdatedAt      time.Time             `json:"updated_at"`
+}
+
+// ValidateEscalationPolicy checks an escalation policy, including that its
+// channels and users belong to the tenant.
+func ValidateEscalationPolicy(ep *AlertEscalationPolicy) error {
+	ep.Name = strings.TrimSpace(ep.Name)
+	if ep.Name == "" || len(ep.Name) > 255 {
+		return &AlertConfigError{Msg: "name is required (at most 255 characters)"}
+	}
+	if len(ep.Tiers) == 0 || len(ep.Tiers) > maxEscalationTiers {
+		return &AlertConfigError{Msg: fmt.Sprintf("an escalation policy needs 1 to %d tiers", maxEscalationTiers)}
+	}
+	if ep.RepeatInterval < 0 || ep.RepeatInterval > maxEscalationDelay || ep.MaxRepeats < 0 {
+		return &AlertConfigError{Msg: "repeat_interval and max_repeats must not be negative (repeat_interval at most 10080)"}
+	}
+	for i := range ep.Tiers {
+		tier := &ep.Tiers[i]
+		if tier.Delay < 0 || tier.Delay > maxEscalationDelay {
+			return &AlertConfigError{Msg: fmt.Sprintf("tier %d: delay must be between 0 and %d minutes", i+1, maxEscalationDelay)}
+		}
+		tier.ChannelIDs = uniqueIDs(tier.ChannelIDs)
+		tier.UserIDs = uniqueIDs(tier.UserIDs)
+		if len(tier.ChannelIDs) == 0 && len(tier.UserIDs) == 0 {
+			return &AlertConfigError{Msg: fmt.Sprintf("tier %d has no channels or users", i+1)}
+		}
+		if err := checkTenantIDs(postgres.DB, &AlertChannel{}, ep.TenantID, tier.ChannelIDs, "channel"); err != nil {
+			return err
+		}
+		// Tenants are single user accounts: the tenant id is the user id.
+		for _, id := range tier.UserIDs {
+			if id != ep.TenantID {
+				return &AlertConfigError{Msg: fmt.Sprintf("unknown user id %d", id)}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *EnhancedAlertService) GetEscalationPolicies(tenantID int64) ([]AlertEscalationPolicy, error) {
+	var policies []AlertEscalationPolicy
+	err := postgres.DB.Where("tenant_id = ?", tenantID).Order("id").Find(&policies).Error
+	return policies, err
+}
+
+func (s *EnhancedAlertService) GetEscalationPolicy(id int64, tenantID int64) (*AlertEscalationPolicy, error) {
+	var policy AlertEscalationPolicy
+	if err := postgres.DB.Where("id = ? AND tenant_id = ?", id, tenantID).First(&policy).Error; err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (s *EnhancedAlertService) CreateEscalationPolicy(policy *AlertEscalationPolicy) error {
+	return postgres.DB.Create(policy).Error
+}
+
+func (s *EnhancedAlertService) UpdateEscalationPolicy(policy *AlertEscalationPolicy) error {
+	policy.UpdatedAt = time.Now()
+	return postgres.DB.Save(policy).Error
+}
+
+// DeleteEscalationPolicy deletes an escalation policy; alert policies using
+// it stop escalating.
+func (s *EnhancedAlertService) DeleteEscalationPolicy(id int64, tenantID int64) error {
+	return postgres.DB.Where("id = ? AND tenant_id = ?", id, tenantID).
+		Delete(&AlertEscalationPolicy{}).Error
+}
+
+// escalationPolicyFor returns the escalation policy of an incident's alert
+// policy, or nil.
+func escalationPolicyFor(incident *AlertIncident) (*AlertEscalationPolicy, error) {
+	var policies []AlertEscalationPolicy
+	err := postgres.DB.
+		Joins("JOIN alert_policies p ON p.escalation_policy_id = alert_escalation_policies.id").
+		Where("p.id = ? AND alert_escalation_policies.tenant_id = ?", incident.PolicyID, incident.TenantID).
+		Limit(1).Find(&policies).Error
+	if err != nil || len(policies) == 0 || len(policies[0].Tiers) == 0 {
+		return nil, err
+	}
+	return &policies[0], nil
+}
+
+// startEscalation schedules the first tier of a newly opened incident.
+func (s *EnhancedAlertService) startEscalation(incident *AlertIncident) {
+	ep, err := escalationPolicyFor(incident)
+	if err != nil {
+		logging.Errorf("failed to load escalation policy for incident=%d: %v", incident.ID, err)
+		return
+	}
+	if ep == nil {
+		return
+	}
+	next := incident.OpenedAt.Add(time.Duration(ep.Tiers[0].Delay) * time.Minute)
+	if err := postgres.DB.Model(&AlertIncident{}).Where("id = ? AND status = ?", incident.ID, "open").
+		Update("next_escalation_at", next).Error; err != nil {
+		logging.Errorf("failed to schedule escalation of incident=%d: %v", incident.ID, err)
+		return
+	}
+	incident.NextEscalationAt = &next
+}
+
+// runEscalations notifies the next tier of every open incident whose
+// escalation is due.
+func (s *EnhancedAlertService) runEscalations() {
+	now := time.Now()
+	var due []AlertIncident
+	if err := postgres.DB.Where("status = ? AND next_escalation_at <= ?", "open", now).
+		Order("next_escalation_at").Limit(escalationBatch).Find(&due).Error; err != nil {
+		logging.Errorf("failed to load due escalations: %v", err)
+		return
+	}
+	for i := range due {
+		s.escalate(&due[i], now)
+	}
+}
+
+// escalate advances one incident. The update is conditional on the
+// schedule it read, so with several servers only one notifies a tier.
+func (s *EnhancedAlertService) escalate(incident *AlertIncident, now time.Time) {
+	ep, err := escalationPolicyFor(incident)
+	if err != nil {
+		logging.Errorf("failed to load escalation policy for incident=%d: %v", incident.ID, err)
+		return
+	}
+
+	level, repeat := incident.EscalationLevel, incident.EscalationRepeat
+	var tier int
+	var next *time.Time
+	if ep != nil {
+		if level < len(ep.Tiers) {
+			tier = level
+			level++
+		} else {
+			tier = len(ep.Tiers) - 1
+			repeat++
+		}
+		if level < len(ep.Tiers) {
+			t := now.Add(time.Duration(ep.Tiers[level].Delay) * time.Minute)
+			next = &t
+		} else if ep.RepeatInterval > 0 && (ep.MaxRepeats == 0 || repeat < ep.MaxRepeats) {
+			t := now.Add(time.Duration(ep.RepeatInterval) * time.Minute)
+			next = &t
+		}
+	}
+
+	res := postgres.DB.Model(&AlertIncident{}).
+		Where("id = ? AND status = ? AND next_escalation_at = ?", incident.ID, "open", incident.NextEscalationAt).
+		Updates(map[string]interface{}{
+			"escalation_level":   level,
+			"escalation_repeat":  repeat,
+			"next_escalation_at": next,
+		})
+	if res.Error != nil {
+		logging.Errorf("failed to advance escalation of incident=%d: %v", incident.ID, res.Error)
+		return
+	}
+	if res.RowsAffected == 0 || ep == nil {
+		return
+	}
+	incident.EscalationLevel, incident.EscalationRepeat, incident.NextEscalationAt = level, repeat, next
+	s.notifyTier(incident, ep.Tiers[tier], tier+1)
+}
+
+// notifyTier sends the incident to the channels and users of a tier.
+func (s *EnhancedAlertService) notifyTier(incident *AlertIncident, tier AlertEscalationTier, number int) {
+	event := incidentEvent(incident, notify.Trigger)
+	event.Title = fmt.Sprintf("[Escalation %d] %s", number, incident.Title)
+
+	var channels []AlertChannel
+	if len(tier.ChannelIDs) > 0 {
+		if err := postgres.DB.Where("id IN ? AND tenant_id = ? AND enabled = ?", tier.ChannelIDs, incident.TenantID, true).
+			Find(&channels).Error; err != nil {
+			logging.Errorf("failed to load escalation channels for incident=%d: %v", incident.ID, err)
+		}
+	}
+	for _, id := range tier.UserIDs {
+		if ch := userEmailChannel(id, incident.TenantID); ch != nil {
+			channels = append(channels, *ch)
+		}
+	}
+	logging.Infof("escalating incident=%d to tier %d (%d targets)", incident.ID, number, len(channels))
+	for i := range channels {
+		go s.sendNotification(&channels[i], event, number)
+	}
+}
+
+// userEmailChannel is an ad-hoc email channel to a user's alert email
+// (user settings) or account email, using the default mail server.
+func userEmailChannel(userID, tenantID int64) *AlertChannel {
+	var user models.User
+	if err := postgres.DB.Select("id, email").First(&user, userID).Error; err != nil {
+		logging.Warnf("escalation user=%d not found: %v", userID, err)
+		return nil
+	}
+	email := user.Email
+	var settings models.UserSettings
+	if err := postgres.DB.Where("user_id = ?", userID).First(&settings).Error; err == nil && settings.AlertEmail != "" {
+		email = settings.AlertEmail
+	}
+	if email == "" {
+		return nil
+	}
+	config, _ := json.Marshal(map[string][]string{"recipients": {email}})
+	return &AlertChannel{TenantID: tenantID, Name: "user " + user.Email, Type: "email", Config: string(config), Enabled: true}
+}
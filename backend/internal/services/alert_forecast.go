@@ -0,0 +1,93 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/query"
+)
+
+// Forecast conditions predict when each series of the condition's KQL
+// query crosses the threshold: the query window (SINCE) is fitted with
+// ForecastMethod over downsampled buckets, and a series breaches when the
+// fit reaches the threshold within Horizon minutes, rising for the above
+// operators and falling for the below ones. For example
+//
+//	SELECT max(disk_usage) FROM metrics FACET host SINCE 6 hours ago
+//	operator above, threshold 100, horizon 1440
+//
+// fires for hosts whose disks are forecast to fill up within a day.
+
+const (
+	AlertConditionForecast = "forecast"
+
+	maxForecastHorizon = 30 * 24 * 60 // minutes
+)
+
+// validateForecast checks the forecast settings of a condition and fills
+// in the default operator (above) and method.
+func validateForecast(c *AlertCondition) error {
+	text := strings.TrimSpace(c.Query)
+	if !strings.HasPrefix(strings.ToUpper(text), "SELECT") {
+		return &AlertConfigError{Msg: "forecast conditions need a KQL query (SELECT ... FROM metrics)"}
+	}
+	if q, err := query.Parse(text); err == nil && q.Since.Absolute.IsZero() && q.Since.Ago < 30*time.Minute {
+		return &AlertConfigError{Msg: "forecast conditions need a window of at least 30 minutes (e.g. SINCE 6 hours ago)"}
+	}
+	if c.Operator == "" {
+		c.Operator = "above"
+	}
+	switch c.Operator {
+	case "above", "above_or_equals", "below", "below_or_equals":
+	default:
+		return &AlertConfigError{Msg: "forecast conditions need operator above, above_or_equals, below or below_or_equals"}
+	}
+	if c.Horizon < 1 || c.Horizon > maxForecastHorizon {
+		return &AlertConfigError{Msg: fmt.Sprintf("horizon must be between 1 and %d minutes", maxForecastHorizon)}
+	}
+	if c.ForecastMethod == "" {
+		c.ForecastMethod = ForecastLinear
+	}
+	if !forecastMethods[c.ForecastMethod] {
+		return &AlertConfigError{Msg: "forecast_method must be linear or holt"}
+	}
+	return nil
+}
+
+// forecastConditionSeries evaluates a forecast condition. The value of a
+// series is its latest bucket.
+func (s *EnhancedAlertService) forecastConditionSeries(condition *AlertCondition, now time.Time) ([]alertSeriesValue, error) {
+	q, err := query.Parse(strings.TrimSpace(condition.Query))
+	if err != nil {
+		return nil, err
+	}
+	q.Interval = 0 // AUTO bucket size for the window
+	points, err := forecastSeries(condition.TenantID, q, now)
+	if err != nil {
+		return nil, err
+	}
+
+	rising := strings.HasPrefix(condition.Operator, "above")
+	horizon := time.Duration(condition.Horizon) * time.Minute
+	var series []alertSeriesValue
+	for key, pts := range points {
+		fit, ok := fitForecast(pts, condition.ForecastMethod)
+		if !ok {
+			continue
+		}
+		sv := alertSeriesValue{key: key, value: pts[len(pts)-1].v}
+		at, reaches := fit.reachAt(condition.Threshold, rising)
+		if reaches && at.Sub(now) <= horizon {
+			sv.breach = true
+			eta := at.Sub(now)
+			if eta < 0 {
+				eta = 0
+			}
+			sv.detail = fmt.Sprintf("Forecast to reach %.2f in %s (%s). Current: %.2f, trend %+.2f/h (%s)",
+				condition.Threshold, eta.Round(time.Minute), at.Format(time.RFC3339), sv.value, fit.Slope*3600, condition.ForecastMethod)
+		}
+		series = append(series, sv)
+	}
+	return series, nil
+}
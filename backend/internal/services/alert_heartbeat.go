@@ -0,0 +1,115 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/repository/postgres"
+)
+
+// Heartbeat conditions alert on hosts that stopped sending data. Each host
+// in scope (HostID, every host of HostGroup, or every host of the tenant) is
+// a series whose value is the minutes since the host was last seen (by its
+// agent or any other ingest path, see MarkHostSeen); it breaches once that
+// exceeds Timeout minutes and recovers as soon as data arrives again. Hosts
+// that never reported count from their registration.
+// Series carry the host and host_id labels, so maintenance windows of the
+// host's group and silences on host, group or tag apply as for metric
+// conditions. Incidents of hosts that leave the scope, e.g. because they
+// were deleted, are resolved.
+
+const (
+	AlertConditionHeartbeat = "heartbeat"
+
+	defaultHeartbeatTimeout = 5 // minutes
+	maxHeartbeatTimeout     = 7 * 24 * 60
+)
+
+// validateHeartbeat checks the heartbeat settings of a condition and fills
+// in the default timeout. Heartbeat conditions have no query, threshold or
+// operator.
+func validateHeartbeat(c *AlertCondition) error {
+	c.HostGroup = strings.TrimSpace(c.HostGroup)
+	if c.HostID != nil && c.HostGroup != "" {
+		return &AlertConfigError{Msg: "heartbeat conditions take host_id or host_group, not both"}
+	}
+	if c.HostID != nil {
+		var n int64
+		postgres.DB.Table("hosts").Where("id = ? AND tenant_id = ?", *c.HostID, c.TenantID).Count(&n)
+		if n == 0 {
+			return &AlertConfigError{Msg: fmt.Sprintf("host %d not found", *c.HostID)}
+		}
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultHeartbeatTimeout
+	}
+	if c.Timeout < 1 || c.Timeout > maxHeartbeatTimeout {
+		return &AlertConfigError{Msg: fmt.Sprintf("timeout must be between 1 and %d minutes", maxHeartbeatTimeout)}
+	}
+	c.Query = ""
+	c.Threshold = float64(c.Timeout)
+	c.Operator = "above"
+	return nil
+}
+
+type heartbeatHost struct {
+	ID       int64
+	Hostname string
+	LastSeen time.Time
+}
+
+// heartbeatSeries evaluates a heartbeat condition over the hosts in scope.
+func (s *EnhancedAlertService) heartbeatSeries(condition *AlertCondition, now time.Time) ([]alertSeriesValue, error) {
+	db := postgres.DB.Table("hosts").
+		Select("id, hostname, COALESCE(last_seen, created_at) AS last_seen").
+		Where("tenant_id = ?", condition.TenantID)
+	switch {
+	case condition.HostID != nil:
+		db = db.Where("id = ?", *condition.HostID)
+	case condition.HostGroup != "":
+		db = db.Where(`"group" = ?`, condition.HostGroup)
+	}
+	var hosts []heartbeatHost
+	if err := db.Order("id").Scan(&hosts).Error; err != nil {
+		return nil, err
+	}
+
+	timeout := time.Duration(condition.Timeout) * time.Minute
+	series := make([]alertSeriesValue, 0, len(hosts))
+	for _, h := range hosts {
+		silence := now.Sub(h.LastSeen)
+		if silence < 0 {
+			silence = 0
+		}
+		sv := alertSeriesValue{
+			key:   alertSeriesKey(map[string]string{"host": h.Hostname, "host_id": strconv.FormatInt(h.ID, 10)}),
+			value: silence.Minutes(),
+		}
+		if silence > timeout {
+			sv.breach = true
+			sv.detail = fmt.Sprintf("Host %s has sent no data for %s (timeout %s), last seen %s",
+				h.Hostname, silence.Round(time.Second), timeout, h.LastSeen.Format(time.RFC3339))
+		}
+		series = append(series, sv)
+	}
+	s.forgetHeartbeatSeries(condition, series)
+	return series, nil
+}
+
+// forgetHeartbeatSeries resolves the incidents and drops the states of
+// series whose host is no longer in the condition's scope.
+func (s *EnhancedAlertService) forgetHeartbeatSeries(condition *AlertCondition, series []alertSeriesValue) {
+	keys := []string{""}
+	for _, sv := range series {
+		keys = append(keys, sv.key)
+	}
+	var gone []string
+	postgres.DB.Model(&AlertSeriesState{}).Where("condition_id = ? AND series_key NOT IN ?", condition.ID, keys).
+		Pluck("series_key", &gone)
+	for _, key := range gone {
+		s.closeIncidents("condition_id = ? AND series_key = ?", condition.ID, key)
+		postgres.DB.Where("condition_id = ? AND series_key = ?", condition.ID, key).Delete(&AlertSeriesState{})
+	}
+}
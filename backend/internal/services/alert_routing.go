@@ -0,0 +1,536 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/notify"
+	"github.com/sakkurohilla/kineticops/backend/internal/repository/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Routing and grouping. A tenant may define a routing tree; its incidents
+// are then notified through it instead of their policy's channels. An
+// incident's labels (see alertLabels, plus policy) walk the tree as in
+// Alertmanager: a route matches when all its matchers do, the first
+// matching child (and later ones while Continue is set) takes the incident,
+// and a route without matching children takes it itself. Children inherit
+// channels, group_by and timings they do not set.
+//
+// Each route batches its incidents into notification groups keyed by the
+// group_by label values. A new group waits GroupWait for more incidents
+// before the first message; afterwards it is checked every GroupInterval
+// and sends one message listing its firing and newly resolved incidents
+// when they changed, or every RepeatInterval while incidents keep firing.
+// Groups and memberships are persisted, so batching survives restarts.
+// Acknowledgements are sent to the routes' channels right away, and
+// escalation tiers still notify per incident.
+
+const (
+	defaultGroupWait      = 30       // seconds
+	defaultGroupInterval  = 5 * 60   // seconds
+	defaultRepeatInterval = 4 * 3600 // seconds
+	maxRouteDepth         = 10
+	maxRoutes             = 200
+	groupFlushBatch       = 100
+	groupByAll            = "..." // one group per incident
+)
+
+// routeMatcherNames are the labels route matchers and group_by can use.
+var routeMatcherNames = map[string]bool{"host": true, "group": true, "tag": true, "metric": true, "condition": true, "severity": true, "policy": true}
+
+// AlertRoute is a node of a routing tree. Timings are in seconds.
+type AlertRoute struct {
+	Matchers       []AlertMatcher `json:"matchers,omitempty"`
+	ChannelIDs     []int64        `json:"channel_ids,omitempty"`
+	GroupBy        []string       `json:"group_by,omitempty"`
+	GroupWait      *int           `json:"group_wait,omitempty"`
+	GroupInterval  *int           `json:"group_interval,omitempty"`
+	RepeatInterval *int           `json:"repeat_interval,omitempty"`
+	Continue       bool           `json:"continue,omitempty"`
+	Routes         []AlertRoute   `json:"routes,omitempty"`
+}
+
+// AlertRoutingTree is a tenant's routing tree; the root matches every
+// incident and must name channels.
+type AlertRoutingTree struct {
+	TenantID  int64      `json:"tenant_id" gorm:"primaryKey"`
+	Root      AlertRoute `json:"root" gorm:"serializer:json"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// AlertNotificationGroup batches the incidents of a route sharing the
+// route's group_by label values.
+type AlertNotificationGroup struct {
+	ID             int64      `json:"id"`
+	TenantID       int64      `json:"tenant_id"`
+	RoutePath      string     `json:"route_path"` // child indexes from the root, e.g. "0.2"; "" for the root
+	GroupKey       string     `json:"group_key"`  // e.g. "condition=7, group=web"
+	ChannelIDs     []int64    `json:"channel_ids" gorm:"serializer:json"`
+	GroupInterval  int        `json:"group_interval"`
+	RepeatInterval int        `json:"repeat_interval"`
+	NextFlushAt    time.Time  `json:"next_flush_at"`
+	LastFlushAt    *time.Time `json:"last_flush_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	IncidentIDs    []int64    `json:"incident_ids" gorm:"-"`
+}
+
+// AlertNotificationGroupIncident is a member of a group; Notified is the
+// state last sent for it: "" (not yet), firing or resolved.
+type AlertNotificationGroupIncident struct {
+	GroupID    int64 `gorm:"primaryKey"`
+	IncidentID int64 `gorm:"primaryKey"`
+	Notified   string
+}
+
+// resolvedRoute is a matched route with its inherited settings.
+type resolvedRoute struct {
+	path           string
+	channelIDs     []int64
+	groupBy        []string
+	groupWait      time.Duration
+	groupInterval  time.Duration
+	repeatInterval time.Duration
+}
+
+// ValidateRoutingTree checks a routing tree, including that its channels
+// belong to the tenant, and fills in the root's defaults.
+func ValidateRoutingTree(tree *AlertRoutingTree) error {
+	root := &tree.Root
+	if len(root.Matchers) > 0 {
+		return &AlertConfigError{Msg: "the root route matches every incident and takes no matchers"}
+	}
+	if len(root.ChannelIDs) == 0 {
+		return &AlertConfigError{Msg: "the root route needs channel_ids"}
+	}
+	if len(root.GroupBy) == 0 {
+		root.GroupBy = []string{"condition"}
+	}
+	setDefault := func(p **int, v int) {
+		if *p == nil {
+			*p = &v
+		}
+	}
+	setDefault(&root.GroupWait, defaultGroupWait)
+	setDefault(&root.GroupInterval, defaultGroupInterval)
+	setDefault(&root.RepeatInterval, defaultRepeatInterval)
+
+	count := 0
+	var channelIDs []int64
+	var check func(r *AlertRoute, path string, depth int) error
+	check = func(r *AlertRoute, path string, depth int) error {
+		if count++; count > maxRoutes {
+			return &AlertConfigError{Msg: fmt.Sprintf("a routing tree has at most %d routes", maxRoutes)}
+		}
+		if depth > maxRouteDepth {
+			return &AlertConfigError{Msg: fmt.Sprintf("routes nest at most %d levels deep", maxRouteDepth)}
+		}
+		where := "root route"
+		if path != "" {
+			where = "route " + path
+		}
+		if err := validateMatchers(r.Matchers, routeMatcherNames); err != nil {
+			return &AlertConfigError{Msg: where + ": " + err.Error()}
+		}
+		r.ChannelIDs = uniqueIDs(r.ChannelIDs)
+		channelIDs = append(channelIDs, r.ChannelIDs...)
+		for i, name := range r.GroupBy {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "rule" {
+				name = "condition"
+			}
+			if name != groupByAll && !routeMatcherNames[name] && !strings.HasPrefix(name, "label.") {
+				return &AlertConfigError{Msg: fmt.Sprintf("%s: cannot group by %q", where, name)}
+			}
+			r.GroupBy[i] = name
+		}
+		if r.GroupWait != nil && (*r.GroupWait < 0 || *r.GroupWait > 3600) {
+			return &AlertConfigError{Msg: where + ": group_wait must be between 0 and 3600 seconds"}
+		}
+		if r.GroupInterval != nil && (*r.GroupInterval < 10 || *r.GroupInterval > 86400) {
+			return &AlertConfigError{Msg: where + ": group_interval must be between 10 and 86400 seconds"}
+		}
+		if r.RepeatInterval != nil && (*r.RepeatInterval < 60 || *r.RepeatInterval > 7*86400) {
+			return &AlertConfigError{Msg: where + ": repeat_interval must be between 60 and 604800 seconds"}
+		}
+		for i := range r.Routes {
+			if err := check(&r.Routes[i], childPath(path, i), depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := check(root, "", 0); err != nil {
+		return err
+	}
+	return checkTenantIDs(postgres.DB, &AlertChannel{}, tree.TenantID, uniqueIDs(channelIDs), "channel")
+}
+
+func childPath(path string, i int) string {
+	if path == "" {
+		return strconv.Itoa(i)
+	}
+	return path + "." + strconv.Itoa(i)
+}
+
+// match returns the routes taking an incident with the given labels.
+func (tree *AlertRoutingTree) match(labels map[string][]string) []resolvedRoute {
+	root := &tree.Root
+	base := resolvedRoute{
+		channelIDs:     root.ChannelIDs,
+		groupBy:        root.GroupBy,
+		groupWait:      seconds(root.GroupWait, defaultGroupWait),
+		groupInterval:  seconds(root.GroupInterval, defaultGroupInterval),
+		repeatInterval: seconds(root.RepeatInterval, defaultRepeatInterval),
+	}
+	return matchRoute(root, base, labels)
+}
+
+func matchRoute(r *AlertRoute, rr resolvedRoute, labels map[string][]string) []resolvedRoute {
+	var out []resolvedRoute
+	for i := range r.Routes {
+		child := &r.Routes[i]
+		if !matchAll(child.Matchers, labels) {
+			continue
+		}
+		inherited := rr
+		inherited.path = childPath(rr.path, i)
+		if len(child.ChannelIDs) > 0 {
+			inherited.channelIDs = child.ChannelIDs
+		}
+		if len(child.GroupBy) > 0 {
+			inherited.groupBy = child.GroupBy
+		}
+		inherited.groupWait = seconds(child.GroupWait, int(rr.groupWait/time.Second))
+		inherited.groupInterval = seconds(child.GroupInterval, int(rr.groupInterval/time.Second))
+		inherited.repeatInterval = seconds(child.RepeatInterval, int(rr.repeatInterval/time.Second))
+		out = append(out, matchRoute(child, inherited, labels)...)
+		if !child.Continue {
+			break
+		}
+	}
+	if len(out) == 0 {
+		out = []resolvedRoute{rr}
+	}
+	return out
+}
+
+func matchAll(matchers []AlertMatcher, labels map[string][]string) bool {
+	for i := range matchers {
+		if matchers[i].compile() != nil || !matchers[i].matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func seconds(v *int, def int) time.Duration {
+	if v == nil {
+		return time.Duration(def) * time.Second
+	}
+	return time.Duration(*v) * time.Second
+}
+
+// groupKey renders the group_by label values of an incident.
+func groupKey(groupBy []string, labels map[string][]string, incidentID int64) string {
+	parts := make([]string, 0, len(groupBy))
+	for _, name := range groupBy {
+		if name == groupByAll {
+			return "incident=" + strconv.FormatInt(incidentID, 10)
+		}
+		values := append([]string(nil), labels[name]...)
+		sort.Strings(values)
+		parts = append(parts, name+"="+strings.Join(values, ","))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// Routing tree CRUD
+
+// GetRoutingTree returns a tenant's routing tree, or nil when it has none.
+func (s *EnhancedAlertService) GetRoutingTree(tenantID int64) (*AlertRoutingTree, error) {
+	var trees []AlertRoutingTree
+	if err := postgres.DB.Where("tenant_id = ?", tenantID).Limit(1).Find(&trees).Error; err != nil {
+		return nil, err
+	}
+	if len(trees) == 0 {
+		return nil, nil
+	}
+	return &trees[0], nil
+}
+
+func (s *EnhancedAlertService) SaveRoutingTree(tree *AlertRoutingTree) error {
+	tree.UpdatedAt = time.Now()
+	return postgres.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(tree).Error
+}
+
+// DeleteRoutingTree returns the tenant to notifying policy channels per
+// incident. Pending groups are still flushed.
+func (s *EnhancedAlertService) DeleteRoutingTree(tenantID int64) error {
+	return postgres.DB.Where("tenant_id = ?", tenantID).Delete(&AlertRoutingTree{}).Error
+}
+
+// GetNotificationGroups returns a tenant's pending notification groups.
+func (s *EnhancedAlertService) GetNotificationGroups(tenantID int64) ([]AlertNotificationGroup, error) {
+	var groups []AlertNotificationGroup
+	if err := postgres.DB.Where("tenant_id = ?", tenantID).Order("id").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return groups, nil
+	}
+	ids := make([]int64, len(groups))
+	index := make(map[int64]*AlertNotificationGroup, len(groups))
+	for i := range groups {
+		ids[i] = groups[i].ID
+		index[groups[i].ID] = &groups[i]
+		groups[i].IncidentIDs = []int64{}
+	}
+	var members []AlertNotificationGroupIncident
+	if err := postgres.DB.Where("group_id IN ?", ids).Order("incident_id").Find(&members).Error; err != nil {
+		return nil, err
+	}
+	for _, m := range members {
+		g := index[m.GroupID]
+		g.IncidentIDs = append(g.IncidentIDs, m.IncidentID)
+	}
+	return groups, nil
+}
+
+// Routing incidents
+
+// routeIncident notifies an incident lifecycle event through the tenant's
+// routing tree. It reports false when the tenant has none.
+func (s *EnhancedAlertService) routeIncident(incident *AlertIncident, action notify.Action) bool {
+	tree, err := s.GetRoutingTree(incident.TenantID)
+	if err != nil {
+		logging.Errorf("failed to load routing tree for tenant=%d: %v", incident.TenantID, err)
+		return false
+	}
+	if tree == nil {
+		return false
+	}
+	var condition AlertCondition
+	if err := postgres.DB.First(&condition, incident.ConditionID).Error; err != nil {
+		logging.Warnf("failed to load condition=%d of incident=%d: %v", incident.ConditionID, incident.ID, err)
+		condition = AlertCondition{ID: incident.ConditionID, TenantID: incident.TenantID, Severity: incident.Severity}
+	}
+	labels := alertLabels(&condition, incident.SeriesKey, queryHosts(condition.TenantID))
+	labels["policy"] = []string{strconv.FormatInt(incident.PolicyID, 10)}
+
+	for _, route := range tree.match(labels) {
+		switch action {
+		case notify.Trigger:
+			s.addToGroup(incident, route, groupKey(route.groupBy, labels, incident.ID))
+		case notify.Acknowledge:
+			s.notifyChannels(incident.TenantID, route.channelIDs, incidentEvent(incident, action))
+		}
+		// Resolutions are picked up by the groups' next flush.
+	}
+	return true
+}
+
+// addToGroup adds an incident to the group of a route, creating the group
+// with its first flush GroupWait from now.
+func (s *EnhancedAlertService) addToGroup(incident *AlertIncident, route resolvedRoute, key string) {
+	now := time.Now()
+	group := &AlertNotificationGroup{
+		TenantID:       incident.TenantID,
+		RoutePath:      route.path,
+		GroupKey:       key,
+		ChannelIDs:     route.channelIDs,
+		GroupInterval:  int(route.groupInterval / time.Second),
+		RepeatInterval: int(route.repeatInterval / time.Second),
+		NextFlushAt:    now.Add(route.groupWait),
+		CreatedAt:      now,
+	}
+	// A flush may delete the group, empty, between finding and joining
+	// it; the second attempt creates it again.
+	fresh := *group
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		*group = fresh
+		err = postgres.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(group).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("tenant_id = ? AND route_path = ? AND group_key = ?", group.TenantID, group.RoutePath, group.GroupKey).
+				First(group).Error; err != nil {
+				return err
+			}
+			return tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&AlertNotificationGroupIncident{GroupID: group.ID, IncidentID: incident.ID}).Error
+		})
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		logging.Errorf("failed to group incident=%d (route %q, %s): %v", incident.ID, route.path, key, err)
+	}
+}
+
+// flushGroups sends the notification groups that are due.
+func (s *EnhancedAlertService) flushGroups() {
+	now := time.Now()
+	var due []AlertNotificationGroup
+	if err := postgres.DB.Where("next_flush_at <= ?", now).Order("next_flush_at").
+		Limit(groupFlushBatch).Find(&due).Error; err != nil {
+		logging.Errorf("failed to load due notification groups: %v", err)
+		return
+	}
+	for i := range due {
+		s.flushGroup(&due[i], now)
+	}
+}
+
+// flushGroup sends one message for a group when its incidents changed since
+// the last one, or when the repeat interval elapsed. The schedule update is
+// conditional on the one read, so with several servers one sends it.
+func (s *EnhancedAlertService) flushGroup(group *AlertNotificationGroup, now time.Time) {
+	res := postgres.DB.Model(&AlertNotificationGroup{}).
+		Where("id = ? AND next_flush_at = ?", group.ID, group.NextFlushAt).
+		Update("next_flush_at", now.Add(time.Duration(group.GroupInterval)*time.Second))
+	if res.Error != nil || res.RowsAffected == 0 {
+		return
+	}
+
+	var members []AlertNotificationGroupIncident
+	if err := postgres.DB.Where("group_id = ?", group.ID).Find(&members).Error; err != nil {
+		logging.Errorf("failed to load members of notification group=%d: %v", group.ID, err)
+		return
+	}
+	notified := make(map[int64]string, len(members))
+	ids := make([]int64, len(members))
+	for i, m := range members {
+		notified[m.IncidentID] = m.Notified
+		ids[i] = m.IncidentID
+	}
+	var incidents []AlertIncident
+	if len(ids) > 0 {
+		if err := postgres.DB.Where("id IN ?", ids).Order("opened_at, id").Find(&incidents).Error; err != nil {
+			logging.Errorf("failed to load incidents of notification group=%d: %v", group.ID, err)
+			return
+		}
+	}
+
+	var firing, resolved, gone []AlertIncident
+	changed := false
+	for _, inc := range incidents {
+		switch {
+		case inc.Status != "closed" && inc.SuppressedBy == "":
+			firing = append(firing, inc)
+			changed = changed || notified[inc.ID] != "firing"
+		case notified[inc.ID] == "firing":
+			resolved = append(resolved, inc)
+			changed = true
+		case inc.Status == "closed":
+			gone = append(gone, inc)
+		}
+	}
+	repeatDue := len(firing) > 0 && group.LastFlushAt != nil &&
+		!now.Before(group.LastFlushAt.Add(time.Duration(group.RepeatInterval)*time.Second))
+
+	if changed || repeatDue {
+		s.notifyChannels(group.TenantID, group.ChannelIDs, groupEvent(group, firing, resolved, now))
+		postgres.DB.Model(&AlertNotificationGroup{}).Where("id = ?", group.ID).Update("last_flush_at", now)
+		var firingIDs []int64
+		for _, inc := range firing {
+			firingIDs = append(firingIDs, inc.ID)
+		}
+		if len(firingIDs) > 0 {
+			postgres.DB.Model(&AlertNotificationGroupIncident{}).
+				Where("group_id = ? AND incident_id IN ?", group.ID, firingIDs).Update("notified", "firing")
+		}
+	}
+
+	// Drop incidents once their resolution was sent (or never needed), and
+	// the group once it is empty. Suppressed incidents rejoin when notified
+	// again. The emptiness check is part of the delete so an incident added
+	// concurrently keeps the group.
+	var goneIDs []int64
+	for _, inc := range append(gone, resolved...) {
+		goneIDs = append(goneIDs, inc.ID)
+	}
+	if len(goneIDs) > 0 {
+		postgres.DB.Where("group_id = ? AND incident_id IN ?", group.ID, goneIDs).
+			Delete(&AlertNotificationGroupIncident{})
+	}
+	postgres.DB.Where("id = ? AND NOT EXISTS (SELECT 1 FROM alert_notification_group_incidents m WHERE m.group_id = alert_notification_groups.id)", group.ID).
+		Delete(&AlertNotificationGroup{})
+}
+
+// groupEvent builds the grouped message of a flush: a trigger while any
+// incident fires, a resolve once all are resolved.
+func groupEvent(group *AlertNotificationGroup, firing, resolved []AlertIncident, now time.Time) notify.Event {
+	event := notify.Event{
+		Action:   notify.Trigger,
+		TenantID: group.TenantID,
+		GroupID:  group.ID,
+		Status:   "firing",
+		Time:     now,
+	}
+	name := group.GroupKey
+	if name == "" {
+		name = "all incidents"
+	}
+	if len(firing) == 0 {
+		event.Action = notify.Resolve
+		event.Status = "resolved"
+		event.Title = fmt.Sprintf("[RESOLVED] %s", name)
+	} else {
+		event.Title = fmt.Sprintf("[FIRING:%d] %s", len(firing), name)
+	}
+
+	var lines []string
+	add := func(inc AlertIncident, status string) {
+		event.Alerts = append(event.Alerts, notify.Alert{
+			IncidentID: inc.ID, Title: inc.Title, Severity: inc.Severity, Status: status, OpenedAt: inc.OpenedAt,
+		})
+		lines = append(lines, fmt.Sprintf("[%s] #%d %s", status, inc.ID, inc.Title))
+		if event.OpenedAt.IsZero() || inc.OpenedAt.Before(event.OpenedAt) {
+			event.OpenedAt = inc.OpenedAt
+		}
+		if status == "firing" && severityRank[inc.Severity] > severityRank[event.Severity] {
+			event.Severity = inc.Severity
+		}
+	}
+	for _, inc := range firing {
+		add(inc, "firing")
+	}
+	for _, inc := range resolved {
+		add(inc, "resolved")
+		if len(firing) == 0 && severityRank[inc.Severity] > severityRank[event.Severity] {
+			event.Severity = inc.Severity
+		}
+	}
+	if len(event.Alerts) > 0 {
+		event.IncidentID = event.Alerts[0].IncidentID
+	}
+	event.Description = fmt.Sprintf("%d firing, %d resolved\n%s", len(firing), len(resolved), strings.Join(lines, "\n"))
+	return event
+}
+
+var severityRank = map[string]int{"low": 1, "medium": 2, "high": 3, "critical": 4}
+
+// notifyChannels sends an event to the tenant's enabled channels among ids.
+func (s *EnhancedAlertService) notifyChannels(tenantID int64, ids []int64, event notify.Event) {
+	if len(ids) == 0 {
+		return
+	}
+	var channels []AlertChannel
+	if err := postgres.DB.Where("id IN ? AND tenant_id = ? AND enabled = ?", ids, tenantID, true).
+		Find(&channels).Error; err != nil {
+		logging.Errorf("failed to load alert channels %v: %v", ids, err)
+		return
+	}
+	for i := range channels {
+		go s.sendNotification(&channels[i], event, 0)
+	}
+}
@@ -1,91 +1,253 @@
 package services
 
 import (
-	"bytes"
-	"crypto/sha1"
-	"encoding/hex"
-	"encoding/json"
 	"fmt"
-	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/sakkurohilla/kineticops/backend/internal/logging"
 	"github.com/sakkurohilla/kineticops/backend/internal/models"
 	"github.com/sakkurohilla/kineticops/backend/internal/repository/postgres"
+	"gorm.io/gorm"
 )
 
 // ALERT RULE CRUD
+//
+// Alert rules are kept for API compatibility; each rule is converted into a
+// condition of the alert engine (see EnhancedAlertService.ImportAlertRule),
+// which does the evaluation and notification.
 
+// CreateAlertRule stores rule and its condition together; a rule that
+// cannot be converted is not stored.
 func CreateAlertRule(rule *models.AlertRule) error {
-	return postgres.CreateAlertRule(postgres.DB, rule)
+	return postgres.DB.Transaction(func(tx *gorm.DB) error {
+		if err := postgres.CreateAlertRule(tx, rule); err != nil {
+			return err
+		}
+		return EnhancedAlertSvc.ImportAlertRule(tx, rule)
+	})
 }
 
 func ListAlertRules(tenantID int64) ([]models.AlertRule, error) {
 	return postgres.ListAlertRules(postgres.DB, tenantID)
 }
 
-// ALERT TRIGGERING & DEDUPLICATION
+// LEGACY ALERTS
+//
+// The /api/v1/alerts list and stats predate the alert engine; they are
+// served from engine incidents in the shape the dashboard expects.
 
-func hashForDedup(ruleID, hostID int64, metric string) string {
-	h := sha1.New()
-	h.Write([]byte(fmt.Sprintf("%d-%d-%s", ruleID, hostID, metric)))
-	return hex.EncodeToString(h.Sum(nil))
+// LegacyAlert is an incident as listed by GET /api/v1/alerts.
+type LegacyAlert struct {
+	ID             int64      `json:"id"`
+	TenantID       int64      `json:"tenant_id"`
+	PolicyID       int64      `json:"policy_id"`
+	ConditionID    int64      `json:"condition_id"`
+	SeriesKey      string     `json:"series_key"`
+	HostID         int64      `json:"host_id"`             // 0 when the series is not a host
+	HostName       string     `json:"host_name,omitempty"` // from the series key
+	Title          string     `json:"title"`
+	Description    string     `json:"description"`
+	Message        string     `json:"message"`
+	Severity       string     `json:"severity"` // CRITICAL, HIGH, MEDIUM, LOW
+	Status         string     `json:"status"`   // OPEN, ACKNOWLEDGED, SILENCED, RESOLVED
+	TriggeredAt    time.Time  `json:"triggered_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy string     `json:"acknowledged_by,omitempty"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
 }
 
-func CheckAndTriggerAlerts(tenantID int64, metricName string, hostID int64, value float64) error {
-	// Use global postgres.DB
-	rules, err := postgres.GetActiveAlertRulesForMetric(postgres.DB, tenantID, metricName)
-	if err != nil {
-		return err
-	}
-	for _, rule := range rules {
-		if shouldTrigger(rule, value) {
-			hash := hashForDedup(rule.ID, hostID, metricName)
-			existing, _ := postgres.FindActiveAlertByDedup(postgres.DB, hash)
-			if existing != nil {
-				// already open, skip/dedup
-				continue
-			}
-			// trigger
-			alert := &models.Alert{
-				TenantID:         tenantID,
-				RuleID:           rule.ID,
-				MetricName:       metricName,
-				HostID:           hostID,
-				Value:            value,
-				Status:           "OPEN",
-				DedupHash:        hash,
-				EscalatedLevel:   0,
-				TriggeredAt:      time.Now(),
-				NotificationSent: false,
-			}
-			if err := postgres.CreateAlert(postgres.DB, alert); err != nil {
-				logging.Errorf("failed to create alert rule=%d host=%d: %v", rule.ID, hostID, err)
-			}
-			if rule.NotificationWebhook != "" {
-				go sendAlertWebhook(rule.NotificationWebhook, alert)
-				alert.NotificationSent = true
+// LegacyAlertFilter selects incidents for ListLegacyAlerts. Statuses and
+// severities use the legacy upper-case names; empty fields match all.
+type LegacyAlertFilter struct {
+	Statuses   []string
+	Severities []string
+	Search     string
+	Since      time.Time
+	Limit      int
+}
+
+// LegacyAlertStats counts a tenant's incidents by legacy status and by
+// severity.
+type LegacyAlertStats struct {
+	Total        int64 `json:"total"`
+	Open         int64 `json:"open"`
+	Acknowledged int64 `json:"acknowledged"`
+	Silenced     int64 `json:"silenced"`
+	Resolved     int64 `json:"resolved"`
+	Critical     int64 `json:"critical"`
+	High         int64 `json:"high"`
+	Medium       int64 `json:"medium"`
+	Low          int64 `json:"low"`
+}
+
+// legacyStatus maps an incident to its legacy status. A muted incident is
+// SILENCED until it closes.
+func legacyStatus(incident *AlertIncident) string {
+	switch {
+	case incident.Status == "closed":
+		return "RESOLVED"
+	case incident.SuppressedBy != "":
+		return "SILENCED"
+	case incident.Status == "acknowledged":
+		return "ACKNOWLEDGED"
+	}
+	return "OPEN"
+}
+
+func toLegacyAlert(incident *AlertIncident) LegacyAlert {
+	return LegacyAlert{
+		ID:             incident.ID,
+		TenantID:       incident.TenantID,
+		PolicyID:       incident.PolicyID,
+		ConditionID:    incident.ConditionID,
+		SeriesKey:      incident.SeriesKey,
+		Title:          incident.Title,
+		Description:    incident.Description,
+		Message:        incident.Title,
+		Severity:       strings.ToUpper(incident.Severity),
+		Status:         legacyStatus(incident),
+		TriggeredAt:    incident.OpenedAt,
+		CreatedAt:      incident.OpenedAt,
+		AcknowledgedAt: incident.AckedAt,
+		AcknowledgedBy: incident.AckedBy,
+		ResolvedAt:     incident.ClosedAt,
+	}
+}
+
+// legacyStatusScope restricts a query to the incidents in a legacy status.
+func legacyStatusScope(status string) (string, bool) {
+	switch strings.ToUpper(status) {
+	case "OPEN":
+		return "status = 'open' AND suppressed_by = ''", true
+	case "ACKNOWLEDGED":
+		return "status = 'acknowledged' AND suppressed_by = ''", true
+	case "SILENCED":
+		return "status <> 'closed' AND suppressed_by <> ''", true
+	case "RESOLVED", "CLOSED":
+		return "status = 'closed'", true
+	}
+	return "", false
+}
+
+// ListLegacyAlerts returns a tenant's incidents, newest first.
+func ListLegacyAlerts(tenantID int64, filter LegacyAlertFilter) ([]LegacyAlert, error) {
+	query := postgres.DB.Model(&AlertIncident{}).Where("tenant_id = ?", tenantID)
+
+	if len(filter.Statuses) > 0 {
+		var scopes []string
+		for _, status := range filter.Statuses {
+			scope, ok := legacyStatusScope(status)
+			if !ok {
+				return nil, &AlertConfigError{Msg: fmt.Sprintf("unknown alert status %q", status)}
 			}
+			scopes = append(scopes, "("+scope+")")
+		}
+		query = query.Where(strings.Join(scopes, " OR "))
+	}
+	if len(filter.Severities) > 0 {
+		severities := make([]string, len(filter.Severities))
+		for i, severity := range filter.Severities {
+			severities[i] = strings.ToLower(severity)
+		}
+		query = query.Where("severity IN ?", severities)
+	}
+	if filter.Search != "" {
+		pattern := "%" + escapeLike(filter.Search) + "%"
+		query = query.Where("(title ILIKE ? OR description ILIKE ? OR series_key ILIKE ?)", pattern, pattern, pattern)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("opened_at >= ?", filter.Since)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+
+	var incidents []AlertIncident
+	if err := query.Order("opened_at DESC").Limit(limit).Find(&incidents).Error; err != nil {
+		return nil, err
+	}
+	alerts := make([]LegacyAlert, len(incidents))
+	for i := range incidents {
+		alerts[i] = toLegacyAlert(&incidents[i])
+	}
+	legacyAlertHosts(alerts, queryHosts(tenantID))
+	return alerts, nil
+}
+
+// legacyAlertHosts sets the host of each alert from the host_id or host
+// facet of its series key. Alerts of conditions not faceted by host keep
+// host_id 0; a host name that no longer matches a host is kept as is.
+func legacyAlertHosts(alerts []LegacyAlert, findHosts hostFinder) {
+	var names []string
+	var ids []int64
+	facets := make([]map[string]string, len(alerts))
+	for i := range alerts {
+		facets[i] = parseSeriesKey(alerts[i].SeriesKey)
+		if id, err := strconv.ParseInt(facets[i]["host_id"], 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+		if name := facets[i]["host"]; name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 && len(ids) == 0 {
+		return
+	}
+
+	byID := make(map[string]models.Host)
+	byName := make(map[string]models.Host)
+	for _, h := range findHosts(names, ids) {
+		byID[strconv.FormatInt(h.ID, 10)] = h
+		byName[h.Hostname] = h
+	}
+	for i, facet := range facets {
+		h, ok := byID[facet["host_id"]]
+		if !ok {
+			h, ok = byName[facet["host"]]
+		}
+		if ok {
+			alerts[i].HostID, alerts[i].HostName = h.ID, h.Hostname
+		} else {
+			alerts[i].HostName = facet["host"]
 		}
 	}
-	return nil
 }
 
-func shouldTrigger(rule models.AlertRule, value float64) bool {
-	switch rule.Operator {
-	case ">":
-		return value > rule.Threshold
-	case "<":
-		return value < rule.Threshold
-	case "==":
-		return value == rule.Threshold
-	case "!=":
-		return value != rule.Threshold
-	}
-	return false
+// GetLegacyAlertStats counts a tenant's incidents for the alert dashboard.
+func GetLegacyAlertStats(tenantID int64) (*LegacyAlertStats, error) {
+	var stats LegacyAlertStats
+	err := postgres.DB.Model(&AlertIncident{}).
+		Select(`COUNT(*) AS total,
+			COUNT(*) FILTER (WHERE status = 'open' AND suppressed_by = '') AS open,
+			COUNT(*) FILTER (WHERE status = 'acknowledged' AND suppressed_by = '') AS acknowledged,
+			COUNT(*) FILTER (WHERE status <> 'closed' AND suppressed_by <> '') AS silenced,
+			COUNT(*) FILTER (WHERE status = 'closed') AS resolved,
+			COUNT(*) FILTER (WHERE severity = 'critical') AS critical,
+			COUNT(*) FILTER (WHERE severity = 'high') AS high,
+			COUNT(*) FILTER (WHERE severity = 'medium') AS medium,
+			COUNT(*) FILTER (WHERE severity = 'low') AS low`).
+		Where("tenant_id = ?", tenantID).
+		Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
 }
 
-func sendAlertWebhook(url string, alert *models.Alert) {
-	payload, _ := json.Marshal(alert)
-	_, _ = http.Post(url, "application/json", bytes.NewReader(payload))
+// GetLegacyAlert returns one of a tenant's incidents as a legacy alert.
+func GetLegacyAlert(id, tenantID int64) (*LegacyAlert, error) {
+	incident, err := EnhancedAlertSvc.GetIncident(id, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	alerts := []LegacyAlert{toLegacyAlert(incident)}
+	legacyAlertHosts(alerts, queryHosts(tenantID))
+	return &alerts[0], nil
 }
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/models"
+)
+
+func TestLegacyAlertHosts(t *testing.T) {
+	hosts := []models.Host{{ID: 7, Hostname: "web-1"}, {ID: 9, Hostname: "db-1"}}
+	find := func(names []string, ids []int64) []models.Host {
+		var out []models.Host
+		for _, h := range hosts {
+			if containsString(names, h.Hostname) || containsInt64(ids, h.ID) {
+				out = append(out, h)
+			}
+		}
+		return out
+	}
+
+	alerts := []LegacyAlert{
+		{SeriesKey: "host=web-1"},
+		{SeriesKey: "host_id=9"},
+		{SeriesKey: "group=prod, host=db-1"},
+		{SeriesKey: "host=gone-1"},
+		{SeriesKey: "label.mount=/"},
+		{SeriesKey: ""},
+	}
+	legacyAlertHosts(alerts, find)
+
+	want := []struct {
+		id   int64
+		name string
+	}{
+		{7, "web-1"},
+		{9, "db-1"},
+		{9, "db-1"},
+		{0, "gone-1"},
+		{0, ""},
+		{0, ""},
+	}
+	for i, w := range want {
+		if alerts[i].HostID != w.id || alerts[i].HostName != w.name {
+			t.Errorf("series %q: host = %d %q, want %d %q",
+				alerts[i].SeriesKey, alerts[i].HostID, alerts[i].HostName, w.id, w.name)
+		}
+	}
+
+	// no lookup when no alert is about a host
+	legacyAlertHosts([]LegacyAlert{{SeriesKey: "os=linux"}}, func([]string, []int64) []models.Host {
+		t.Error("hosts looked up for series without a host")
+		return nil
+	})
+}
@@ -0,0 +1,739 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/cron"
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/models"
+	"github.com/sakkurohilla/kineticops/backend/internal/query"
+	"github.com/sakkurohilla/kineticops/backend/internal/repository/postgres"
+	"gorm.io/gorm"
+)
+
+// Suppression. Silences (matchers with a start and end time) and recurring
+// maintenance windows (a cron start schedule, a duration and a host group)
+// suppress incidents. A suppressed incident is still opened and listed, with
+// suppressed_by naming the silence or window, but its channels are not
+// notified and it does not escalate; the silence or window counts it.
+// Firing series are checked before their incident opens. Open incidents are
+// re-checked when a silence or window starts, ends or is edited, so an
+// incident notifies once its suppression ends and stops notifying when a
+// new silence matches it.
+//
+// Matchers compare the labels of an alert series: its condition and
+// severity, the metrics and host/group/tag filters of the condition's
+// query, its facets, and the group and tags of its host.
+
+const (
+	maxMaintenanceDuration = 7 * 24 * 60 // minutes
+	maintenanceLookahead   = 366 * 24 * time.Hour
+)
+
+// alertMatcherNames are the labels a silence matcher can compare; "rule"
+// is an alias of condition. host_id, os and ip are only set by query
+// filters and facets.
+var alertMatcherNames = map[string]bool{
+	"host": true, "host_id": true, "group": true, "os": true, "ip": true, "tag": true,
+	"metric": true, "condition": true, "severity": true,
+}
+
+// AlertMatcher matches a series label by value, or by an anchored regular
+// expression when Regex is set.
+type AlertMatcher struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Regex bool   `json:"regex"`
+
+	re *regexp.Regexp
+}
+
+type AlertSilence struct {
+	ID              int64          `json:"id"`
+	TenantID        int64          `json:"tenant_id"`
+	Matchers        []AlertMatcher `json:"matchers" gorm:"serializer:json"`
+	StartsAt        time.Time      `json:"starts_at"`
+	EndsAt          time.Time      `json:"ends_at"`
+	CreatedBy       string         `json:"created_by"`
+	Comment         string         `json:"comment"`
+	SuppressedCount int64          `json:"suppressed_count"`
+	Status          string         `json:"status" gorm:"-"` // pending, active or expired
+	CreatedAt       time.Time      `json:"created_at"`
+}
+
+type AlertMaintenanceWindow struct {
+	ID              int64      `json:"id"`
+	TenantID        int64      `json:"tenant_id"`
+	Name            string     `json:"name"`
+	Description     string     `json:"description"`
+	HostGroup       string     `json:"host_group"`
+	Schedule        string     `json:"schedule"` // cron expression of the start times
+	Duration        int        `json:"duration"` // minutes
+	Timezone        string     `json:"timezone"`
+	Enabled         bool       `json:"enabled"`
+	SuppressedCount int64      `json:"suppressed_count"`
+	Active          bool       `json:"active" gorm:"-"`
+	NextStart       *time.Time `json:"next_start,omitempty" gorm:"-"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+func (m *AlertMatcher) matches(labels map[string][]string) bool {
+	for _, v := range labels[m.Name] {
+		if m.re != nil && m.re.MatchString(v) || m.re == nil && v == m.Value {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *AlertMatcher) compile() error {
+	if !m.Regex {
+		m.re = nil
+		return nil
+	}
+	re, err := regexp.Compile("^(?:" + m.Value + ")$")
+	if err != nil {
+		return err
+	}
+	m.re = re
+	return nil
+}
+
+func (sl *AlertSilence) matches(labels map[string][]string) bool {
+	for i := range sl.Matchers {
+		if !sl.Matchers[i].matches(labels) {
+			return false
+		}
+	}
+	return len(sl.Matchers) > 0
+}
+
+func (sl *AlertSilence) setStatus(now time.Time) {
+	switch {
+	case now.Before(sl.StartsAt):
+		sl.Status = "pending"
+	case now.Before(sl.EndsAt):
+		sl.Status = "active"
+	default:
+		sl.Status = "expired"
+	}
+}
+
+// ValidateSilence checks a silence and fills in its defaults.
+func ValidateSilence(sl *AlertSilence) error {
+	if len(sl.Matchers) == 0 {
+		return &AlertConfigError{Msg: "a silence needs at least one matcher"}
+	}
+	if err := validateMatchers(sl.Matchers, alertMatcherNames); err != nil {
+		return err
+	}
+	if sl.StartsAt.IsZero() {
+		sl.StartsAt = time.Now()
+	}
+	if !sl.EndsAt.After(sl.StartsAt) {
+		return &AlertConfigError{Msg: "ends_at must be after starts_at"}
+	}
+	if len(sl.Comment) > 1000 {
+		return &AlertConfigError{Msg: "comment is too long (at most 1000 characters)"}
+	}
+	return nil
+}
+
+// validateMatchers normalizes and compiles matchers on the given labels;
+// label.<name> facets are accepted too.
+func validateMatchers(matchers []AlertMatcher, names map[string]bool) error {
+	for i := range matchers {
+		m := &matchers[i]
+		m.Name = strings.ToLower(strings.TrimSpace(m.Name))
+		if m.Name == "rule" {
+			m.Name = "condition"
+		}
+		if !names[m.Name] && !(strings.HasPrefix(m.Name, "label.") && len(m.Name) > len("label.")) {
+			return &AlertConfigError{Msg: fmt.Sprintf("unknown matcher %q (use %s or label.<name>)", m.Name, labelNameList(names))}
+		}
+		if m.Value == "" {
+			return &AlertConfigError{Msg: fmt.Sprintf("matcher %q needs a value", m.Name)}
+		}
+		if err := m.compile(); err != nil {
+			return &AlertConfigError{Msg: fmt.Sprintf("matcher %q: invalid regular expression: %v", m.Name, err)}
+		}
+	}
+	return nil
+}
+
+func labelNameList(names map[string]bool) string {
+	list := make([]string, 0, len(names))
+	for n := range names {
+		list = append(list, n)
+	}
+	sort.Strings(list)
+	return strings.Join(list, ", ")
+}
+
+// ValidateMaintenanceWindow checks a maintenance window.
+func ValidateMaintenanceWindow(w *AlertMaintenanceWindow) error {
+	w.Name = strings.TrimSpace(w.Name)
+	if w.Name == "" || len(w.Name) > 255 {
+		return &AlertConfigError{Msg: "name is required (at most 255 characters)"}
+	}
+	w.HostGroup = strings.TrimSpace(w.HostGroup)
+	if w.HostGroup == "" {
+		return &AlertConfigError{Msg: "host_group is required"}
+	}
+	if _, err := cron.Parse(w.Schedule); err != nil {
+		return &AlertConfigError{Msg: err.Error()}
+	}
+	if w.Duration < 1 || w.Duration > maxMaintenanceDuration {
+		return &AlertConfigError{Msg: fmt.Sprintf("duration must be between 1 and %d minutes", maxMaintenanceDuration)}
+	}
+	if w.Timezone == "" {
+		w.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(w.Timezone); err != nil {
+		return &AlertConfigError{Msg: fmt.Sprintf("unknown timezone %q", w.Timezone)}
+	}
+	return nil
+}
+
+// activeAt reports whether the window is open at now: the schedule fired
+// less than Duration minutes ago.
+func (w *AlertMaintenanceWindow) activeAt(now time.Time) bool {
+	sched, loc, err := w.schedule()
+	if err != nil || !w.Enabled {
+		return false
+	}
+	_, ok := sched.LastWithin(now.In(loc), time.Duration(w.Duration)*time.Minute)
+	return ok
+}
+
+func (w *AlertMaintenanceWindow) schedule() (*cron.Schedule, *time.Location, error) {
+	sched, err := cron.Parse(w.Schedule)
+	if err != nil {
+		return nil, nil, err
+	}
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sched, loc, nil
+}
+
+func (w *AlertMaintenanceWindow) setStatus(now time.Time) {
+	w.Active = w.activeAt(now)
+	w.NextStart = nil
+	if sched, loc, err := w.schedule(); err == nil && w.Enabled {
+		if next, ok := sched.Next(now.In(loc), maintenanceLookahead); ok {
+			w.NextStart = &next
+		}
+	}
+}
+
+// Silences
+
+func (s *EnhancedAlertService) GetSilences(tenantID int64, activeOnly bool) ([]AlertSilence, error) {
+	var silences []AlertSilence
+	now := time.Now()
+	q := postgres.DB.Where("tenant_id = ?", tenantID)
+	if activeOnly {
+		q = q.Where("starts_at <= ? AND ends_at > ?", now, now)
+	}
+	if err := q.Order("ends_at DESC").Limit(500).Find(&silences).Error; err != nil {
+		return nil, err
+	}
+	for i := range silences {
+		silences[i].setStatus(now)
+	}
+	return silences, nil
+}
+
+func (s *EnhancedAlertService) GetSilence(id int64, tenantID int64) (*AlertSilence, error) {
+	var silence AlertSilence
+	if err := postgres.DB.Where("id = ? AND tenant_id = ?", id, tenantID).First(&silence).Error; err != nil {
+		return nil, err
+	}
+	silence.setStatus(time.Now())
+	return &silence, nil
+}
+
+func (s *EnhancedAlertService) CreateSilence(silence *AlertSilence) error {
+	if err := postgres.DB.Create(silence).Error; err != nil {
+		return err
+	}
+	silence.setStatus(time.Now())
+	return nil
+}
+
+func (s *EnhancedAlertService) UpdateSilence(silence *AlertSilence) error {
+	if err := postgres.DB.Save(silence).Error; err != nil {
+		return err
+	}
+	silence.setStatus(time.Now())
+	return nil
+}
+
+// ExpireSilence ends a silence now; incidents it suppressed notify on the
+// next evaluation.
+func (s *EnhancedAlertService) ExpireSilence(id int64, tenantID int64) error {
+	now := time.Now()
+	return postgres.DB.Model(&AlertSilence{}).
+		Where("id = ? AND tenant_id = ? AND ends_at > ?", id, tenantID, now).
+		Updates(map[string]interface{}{"ends_at": now, "starts_at": gorm.Expr("LEAST(starts_at, ?)", now)}).Error
+}
+
+// SilenceIncident silences the series of an incident for d: a silence
+// matching its condition and facets. An open incident is suppressed right
+// away.
+func (s *EnhancedAlertService) SilenceIncident(id int64, tenantID int64, d time.Duration, createdBy string) (*AlertSilence, error) {
+	incident, err := s.GetIncident(id, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if d <= 0 {
+		return nil, &AlertConfigError{Msg: "silence duration must be positive"}
+	}
+	matchers := []AlertMatcher{{Name: "condition", Value: strconv.FormatInt(incident.ConditionID, 10)}}
+	facet := parseSeriesKey(incident.SeriesKey)
+	names := make([]string, 0, len(facet))
+	for k := range facet {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		matchers = append(matchers, AlertMatcher{Name: k, Value: facet[k]})
+	}
+
+	now := time.Now()
+	silence := &AlertSilence{
+		TenantID:  tenantID,
+		Matchers:  matchers,
+		StartsAt:  now,
+		EndsAt:    now.Add(d),
+		CreatedBy: createdBy,
+		Comment:   fmt.Sprintf("Silenced from incident %d", incident.ID),
+		CreatedAt: now,
+	}
+	if err := ValidateSilence(silence); err != nil {
+		return nil, err
+	}
+	if err := s.CreateSilence(silence); err != nil {
+		return nil, err
+	}
+	if incident.Status == "open" && incident.SuppressedBy == "" {
+		s.setSuppression(incident, fmt.Sprintf("silence:%d", silence.ID))
+	}
+	return silence, nil
+}
+
+func (s *EnhancedAlertService) DeleteSilence(id int64, tenantID int64) error {
+	return postgres.DB.Where("id = ? AND tenant_id = ?", id, tenantID).Delete(&AlertSilence{}).Error
+}
+
+// Maintenance windows
+
+func (s *EnhancedAlertService) GetMaintenanceWindows(tenantID int64) ([]AlertMaintenanceWindow, error) {
+	var windows []AlertMaintenanceWindow
+	if err := postgres.DB.Where("tenant_id = ?", tenantID).Order("id").Find(&windows).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range windows {
+		windows[i].setStatus(now)
+	}
+	return windows, nil
+}
+
+func (s *EnhancedAlertService) GetMaintenanceWindow(id int64, tenantID int64) (*AlertMaintenanceWindow, error) {
+	var window AlertMaintenanceWindow
+	if err := postgres.DB.Where("id = ? AND tenant_id = ?", id, tenantID).First(&window).Error; err != nil {
+		return nil, err
+	}
+	window.setStatus(time.Now())
+	return &window, nil
+}
+
+func (s *EnhancedAlertService) CreateMaintenanceWindow(window *AlertMaintenanceWindow) error {
+	if err := postgres.DB.Create(window).Error; err != nil {
+		return err
+	}
+	window.setStatus(time.Now())
+	return nil
+}
+
+func (s *EnhancedAlertService) UpdateMaintenanceWindow(window *AlertMaintenanceWindow) error {
+	window.UpdatedAt = time.Now()
+	if err := postgres.DB.Save(window).Error; err != nil {
+		return err
+	}
+	window.setStatus(time.Now())
+	return nil
+}
+
+func (s *EnhancedAlertService) DeleteMaintenanceWindow(id int64, tenantID int64) error {
+	return postgres.DB.Where("id = ? AND tenant_id = ?", id, tenantID).Delete(&AlertMaintenanceWindow{}).Error
+}
+
+// Suppression checks
+
+// suppressionScope holds what suppression checks for a tenant need: its
+// active silences with compiled matchers, its enabled maintenance windows
+// and a way to find its hosts for labels.
+type suppressionScope struct {
+	silences  []AlertSilence
+	windows   []AlertMaintenanceWindow
+	findHosts hostFinder
+}
+
+// hostFinder returns the hosts of a tenant with one of the given names or
+// ids.
+type hostFinder func(names []string, ids []int64) []models.Host
+
+func loadSuppressionScope(tenantID int64, now time.Time, findHosts hostFinder) *suppressionScope {
+	sc := loadSuppressionScopes(now, tenantID)[tenantID]
+	if sc == nil {
+		sc = &suppressionScope{}
+	}
+	sc.findHosts = findHosts
+	return sc
+}
+
+// loadSuppressionScopes loads the active silences and enabled maintenance
+// windows of the given tenants, or of all tenants, by tenant. Tenants with
+// neither have no scope; scopes find hosts with tenantHosts.
+func loadSuppressionScopes(now time.Time, tenantIDs ...int64) map[int64]*suppressionScope {
+	byTenant := func(db *gorm.DB) *gorm.DB {
+		if len(tenantIDs) > 0 {
+			return db.Where("tenant_id IN ?", tenantIDs)
+		}
+		return db
+	}
+	scopes := make(map[int64]*suppressionScope)
+	scope := func(tenantID int64) *suppressionScope {
+		sc := scopes[tenantID]
+		if sc == nil {
+			sc = &suppressionScope{findHosts: tenantHosts(tenantID)}
+			scopes[tenantID] = sc
+		}
+		return sc
+	}
+
+	var silences []AlertSilence
+	if err := postgres.DB.Scopes(byTenant).Where("starts_at <= ? AND ends_at > ?", now, now).
+		Order("id").Find(&silences).Error; err != nil {
+		logging.Errorf("failed to load silences for tenants %v: %v", tenantIDs, err)
+	}
+	for i := range silences {
+		valid := true
+		for j := range silences[i].Matchers {
+			if silences[i].Matchers[j].compile() != nil {
+				valid = false
+			}
+		}
+		if valid {
+			sc := scope(silences[i].TenantID)
+			sc.silences = append(sc.silences, silences[i])
+		}
+	}
+
+	var windows []AlertMaintenanceWindow
+	if err := postgres.DB.Scopes(byTenant).Where("enabled = ?", true).
+		Order("id").Find(&windows).Error; err != nil {
+		logging.Errorf("failed to load maintenance windows for tenants %v: %v", tenantIDs, err)
+	}
+	for i := range windows {
+		sc := scope(windows[i].TenantID)
+		sc.windows = append(sc.windows, windows[i])
+	}
+	return scopes
+}
+
+// active returns the silences and maintenance windows of the scope in
+// effect at now, by the name incidents are suppressed by, with a version
+// that changes when one is edited.
+func (sc *suppressionScope) active(now time.Time) map[string]string {
+	active := make(map[string]string)
+	for i := range sc.silences {
+		sl := &sc.silences[i]
+		var version strings.Builder
+		fmt.Fprintf(&version, "%d-%d", sl.StartsAt.UnixNano(), sl.EndsAt.UnixNano())
+		for _, m := range sl.Matchers {
+			fmt.Fprintf(&version, "|%s=%q,%t", m.Name, m.Value, m.Regex)
+		}
+		active[fmt.Sprintf("silence:%d", sl.ID)] = version.String()
+	}
+	for i := range sc.windows {
+		if w := &sc.windows[i]; w.activeAt(now) {
+			active[fmt.Sprintf("maintenance:%d", w.ID)] = fmt.Sprintf("%s-%d", w.HostGroup, w.UpdatedAt.UnixNano())
+		}
+	}
+	return active
+}
+
+// suppressionChanges compares the active silences and windows of a tenant
+// with those seen before: started holds the new and edited ones, ended
+// the ones gone and edited, both sorted.
+func suppressionChanges(before, after map[string]string) (started, ended []string) {
+	for name, version := range after {
+		if prev, ok := before[name]; !ok || prev != version {
+			started = append(started, name)
+		}
+	}
+	for name, version := range before {
+		if next, ok := after[name]; !ok || next != version {
+			ended = append(ended, name)
+		}
+	}
+	sort.Strings(started)
+	sort.Strings(ended)
+	return started, ended
+}
+
+// match returns what suppresses a series of a condition at now,
+// "silence:<id>" or "maintenance:<id>", or "" when nothing does.
+func (sc *suppressionScope) match(condition *AlertCondition, seriesKey string, now time.Time) string {
+	if len(sc.silences) == 0 && len(sc.windows) == 0 {
+		return ""
+	}
+	labels := alertLabels(condition, seriesKey, sc.findHosts)
+	for i := range sc.silences {
+		if sl := &sc.silences[i]; sl.matches(labels) {
+			return fmt.Sprintf("silence:%d", sl.ID)
+		}
+	}
+	for i := range sc.windows {
+		w := &sc.windows[i]
+		if containsString(labels["group"], w.HostGroup) && w.activeAt(now) {
+			return fmt.Sprintf("maintenance:%d", w.ID)
+		}
+	}
+	return ""
+}
+
+// queryHosts finds hosts of a tenant with a query per lookup.
+func queryHosts(tenantID int64) hostFinder {
+	return func(names []string, ids []int64) []models.Host {
+		var hosts []models.Host
+		postgres.DB.Where("tenant_id = ? AND (hostname IN ? OR id IN ?)", tenantID, append(names, ""), append(ids, 0)).
+			Find(&hosts)
+		return hosts
+	}
+}
+
+// tenantHosts finds hosts of a tenant among all its hosts, loaded on the
+// first lookup.
+func tenantHosts(tenantID int64) hostFinder {
+	var all []models.Host
+	loaded := false
+	return func(names []string, ids []int64) []models.Host {
+		if !loaded {
+			loaded = true
+			if err := postgres.DB.Where("tenant_id = ?", tenantID).Find(&all).Error; err != nil {
+				logging.Errorf("failed to load hosts for tenant=%d: %v", tenantID, err)
+			}
+		}
+		var hosts []models.Host
+		for _, h := range all {
+			if containsString(names, h.Hostname) || containsInt64(ids, h.ID) {
+				hosts = append(hosts, h)
+			}
+		}
+		return hosts
+	}
+}
+
+// countSuppression adds one suppressed incident to the silence or window
+// named by suppressedBy.
+func countSuppression(suppressedBy string) {
+	kind, idText, _ := strings.Cut(suppressedBy, ":")
+	id, _ := strconv.ParseInt(idText, 10, 64)
+	var model interface{}
+	switch kind {
+	case "silence":
+		model = &AlertSilence{}
+	case "maintenance":
+		model = &AlertMaintenanceWindow{}
+	default:
+		return
+	}
+	if err := postgres.DB.Model(model).Where("id = ?", id).
+		UpdateColumn("suppressed_count", gorm.Expr("suppressed_count + 1")).Error; err != nil {
+		logging.Warnf("failed to count suppression by %s: %v", suppressedBy, err)
+	}
+}
+
+// refreshSuppressions re-checks open incidents when the silences and
+// maintenance windows in effect change. Incidents whose suppression ended
+// are notified and start escalating; newly suppressed ones stop escalating.
+// Only a tenant's unsuppressed incidents, when something started, and those
+// suppressed by what ended are loaded; the first pass checks them all.
+func (s *EnhancedAlertService) refreshSuppressions() {
+	now := time.Now()
+	scopes := loadSuppressionScopes(now)
+	active := make(map[int64]map[string]string, len(scopes))
+	for tenantID, sc := range scopes {
+		if a := sc.active(now); len(a) > 0 {
+			active[tenantID] = a
+		}
+	}
+	before := s.suppressors
+	s.suppressors = active
+
+	var open []AlertIncident
+	if before == nil {
+		if err := postgres.DB.Where("status = ?", "open").Find(&open).Error; err != nil {
+			logging.Errorf("failed to load open incidents: %v", err)
+			s.suppressors = nil
+			return
+		}
+	} else {
+		tenants := make(map[int64]bool, len(active)+len(before))
+		for tenantID := range active {
+			tenants[tenantID] = true
+		}
+		for tenantID := range before {
+			tenants[tenantID] = true
+		}
+		for tenantID := range tenants {
+			started, ended := suppressionChanges(before[tenantID], active[tenantID])
+			if len(started) == 0 && len(ended) == 0 {
+				continue
+			}
+			// "" selects the unsuppressed incidents a started one may match
+			by := ended
+			if len(started) > 0 {
+				by = append(by, "")
+			}
+			var incidents []AlertIncident
+			if err := postgres.DB.Where("tenant_id = ? AND status = ? AND suppressed_by IN ?", tenantID, "open", by).
+				Find(&incidents).Error; err != nil {
+				logging.Errorf("failed to load open incidents for tenant=%d: %v", tenantID, err)
+				s.suppressors[tenantID] = before[tenantID] // retry on the next pass
+				continue
+			}
+			open = append(open, incidents...)
+		}
+	}
+
+	conditions := make(map[int64]*AlertCondition)
+	for i := range open {
+		incident := &open[i]
+		condition, ok := conditions[incident.ConditionID]
+		if !ok {
+			var c AlertCondition
+			if err := postgres.DB.First(&c, incident.ConditionID).Error; err == nil {
+				condition = &c
+			}
+			conditions[incident.ConditionID] = condition
+		}
+		if condition == nil {
+			continue
+		}
+
+		scope := scopes[incident.TenantID]
+		if scope == nil {
+			scope = &suppressionScope{}
+		}
+		if by := scope.match(condition, incident.SeriesKey, now); by != incident.SuppressedBy {
+			s.setSuppression(incident, by)
+		}
+	}
+}
+
+// setSuppression moves an open incident to a new suppression state: a
+// newly suppressed incident stops escalating, one whose suppression ended
+// is notified and starts escalating.
+func (s *EnhancedAlertService) setSuppression(incident *AlertIncident, by string) {
+	updates := map[string]interface{}{"suppressed_by": by}
+	if by != "" {
+		updates["next_escalation_at"] = nil
+	}
+	res := postgres.DB.Model(&AlertIncident{}).
+		Where("id = ? AND status = ? AND suppressed_by = ?", incident.ID, "open", incident.SuppressedBy).
+		Updates(updates)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return
+	}
+	was := incident.SuppressedBy
+	incident.SuppressedBy = by
+	switch {
+	case by == "":
+		logging.Infof("incident=%d no longer suppressed by %s", incident.ID, was)
+		s.startEscalation(incident)
+		s.sendNotifications(incident)
+	case was == "":
+		logging.Infof("incident=%d suppressed by %s", incident.ID, by)
+		countSuppression(by)
+	}
+}
+
+// alertLabels collects the labels matchers compare for a series of a
+// condition; findHosts supplies the group and tags of its hosts.
+func alertLabels(condition *AlertCondition, seriesKey string, findHosts hostFinder) map[string][]string {
+	labels := make(map[string][]string)
+	add := func(name, value string) {
+		if value != "" && !containsString(labels[name], value) {
+			labels[name] = append(labels[name], value)
+		}
+	}
+	add("condition", strconv.FormatInt(condition.ID, 10))
+	add("severity", condition.Severity)
+
+	if text := strings.TrimSpace(condition.Query); strings.HasPrefix(strings.ToUpper(text), "SELECT") {
+		if q, err := query.Parse(text); err == nil {
+			for _, a := range q.Select {
+				add("metric", a.Metric)
+			}
+			for _, w := range q.Where {
+				if w.Op == "=" || w.Op == "IN" {
+					for _, v := range w.Values {
+						add(w.Dim.String(), v)
+					}
+				}
+			}
+		}
+	}
+	for k, v := range parseSeriesKey(seriesKey) {
+		add(k, v)
+	}
+
+	// The host's group and tags
+	if len(labels["host"]) > 0 || len(labels["host_id"]) > 0 {
+		var ids []int64
+		for _, v := range labels["host_id"] {
+			if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+				ids = append(ids, id)
+			}
+		}
+		for _, h := range findHosts(labels["host"], ids) {
+			add("host", h.Hostname)
+			add("group", h.Group)
+			for _, tag := range strings.Split(h.Tags, ",") {
+				add("tag", strings.TrimSpace(tag))
+			}
+		}
+	}
+	return labels
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt64(list []int64, n int64) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/models"
+)
+
+func TestSuppressionChanges(t *testing.T) {
+	tests := []struct {
+		before, after  map[string]string
+		started, ended []string
+	}{
+		{nil, nil, nil, nil},
+		{map[string]string{"silence:1": "a"}, map[string]string{"silence:1": "a"}, nil, nil},
+		{nil, map[string]string{"silence:2": "a", "maintenance:1": "b"}, []string{"maintenance:1", "silence:2"}, nil},
+		{map[string]string{"silence:1": "a", "silence:2": "a"}, map[string]string{"silence:2": "a"}, nil, []string{"silence:1"}},
+		// an edited silence ends and starts again
+		{map[string]string{"silence:1": "a"}, map[string]string{"silence:1": "b"}, []string{"silence:1"}, []string{"silence:1"}},
+	}
+	for _, tt := range tests {
+		started, ended := suppressionChanges(tt.before, tt.after)
+		if !reflect.DeepEqual(started, tt.started) || !reflect.DeepEqual(ended, tt.ended) {
+			t.Errorf("suppressionChanges(%v, %v) = %v, %v, want %v, %v",
+				tt.before, tt.after, started, ended, tt.started, tt.ended)
+		}
+	}
+}
+
+func TestSuppressionScopeActive(t *testing.T) {
+	now := time.Date(2024, 5, 1, 2, 30, 0, 0, time.UTC)
+	silence := AlertSilence{ID: 1, Matchers: []AlertMatcher{{Name: "host", Value: "web-1"}},
+		StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour)}
+	open := AlertMaintenanceWindow{ID: 2, HostGroup: "db", Schedule: "0 2 * * *", Duration: 60, Timezone: "UTC", Enabled: true}
+	closed := AlertMaintenanceWindow{ID: 3, HostGroup: "db", Schedule: "0 4 * * *", Duration: 60, Timezone: "UTC", Enabled: true}
+
+	sc := &suppressionScope{silences: []AlertSilence{silence}, windows: []AlertMaintenanceWindow{open, closed}}
+	active := sc.active(now)
+	if len(active) != 2 || active["silence:1"] == "" || active["maintenance:2"] == "" {
+		t.Fatalf("active = %v, want silence:1 and maintenance:2", active)
+	}
+
+	// editing the matchers, the end time or the window changes the version
+	edits := []func(sc *suppressionScope){
+		func(sc *suppressionScope) { sc.silences[0].Matchers[0].Value = "web-2" },
+		func(sc *suppressionScope) { sc.silences[0].Matchers[0].Regex = true },
+		func(sc *suppressionScope) { sc.silences[0].EndsAt = now.Add(2 * time.Hour) },
+		func(sc *suppressionScope) { sc.windows[0].HostGroup = "web" },
+		func(sc *suppressionScope) { sc.windows[0].UpdatedAt = now },
+	}
+	for i, edit := range edits {
+		edited := &suppressionScope{
+			silences: []AlertSilence{silence},
+			windows:  []AlertMaintenanceWindow{open, closed},
+		}
+		edited.silences[0].Matchers = append([]AlertMatcher(nil), silence.Matchers...)
+		edit(edited)
+		started, ended := suppressionChanges(active, edited.active(now))
+		if len(started) != 1 || len(ended) != 1 || started[0] != ended[0] {
+			t.Errorf("edit %d: started %v, ended %v, want one edited suppression", i, started, ended)
+		}
+	}
+}
+
+func TestSuppressionScopeMatch(t *testing.T) {
+	now := time.Date(2024, 5, 1, 2, 30, 0, 0, time.UTC)
+	hosts := []models.Host{{ID: 7, Hostname: "web-1", Group: "web"}, {ID: 9, Hostname: "db-1", Group: "db", Tags: "env=prod"}}
+	sc := &suppressionScope{
+		silences: []AlertSilence{
+			{ID: 1, Matchers: []AlertMatcher{{Name: "host", Value: "web-1"}, {Name: "severity", Value: "critical"}}},
+			{ID: 2, Matchers: []AlertMatcher{{Name: "tag", Value: "env=.*", Regex: true}, {Name: "condition", Value: "5"}}},
+		},
+		windows: []AlertMaintenanceWindow{
+			{ID: 3, HostGroup: "db", Schedule: "0 2 * * *", Duration: 60, Timezone: "UTC", Enabled: true},
+		},
+		findHosts: func(names []string, ids []int64) []models.Host {
+			var out []models.Host
+			for _, h := range hosts {
+				if containsString(names, h.Hostname) || containsInt64(ids, h.ID) {
+					out = append(out, h)
+				}
+			}
+			return out
+		},
+	}
+	for i := range sc.silences {
+		for j := range sc.silences[i].Matchers {
+			if err := sc.silences[i].Matchers[j].compile(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tests := []struct {
+		condition AlertCondition
+		seriesKey string
+		want      string
+	}{
+		{AlertCondition{ID: 4, Severity: "critical"}, "host=web-1", "silence:1"},
+		{AlertCondition{ID: 4, Severity: "warning"}, "host=web-1", ""},
+		{AlertCondition{ID: 5, Severity: "warning"}, "host_id=9", "silence:2"},
+		{AlertCondition{ID: 6, Severity: "warning"}, "host=db-1", "maintenance:3"},
+		{AlertCondition{ID: 6, Severity: "critical"}, "", ""},
+	}
+	for _, tt := range tests {
+		if got := sc.match(&tt.condition, tt.seriesKey, now); got != tt.want {
+			t.Errorf("match(condition %d %s, %q) = %q, want %q",
+				tt.condition.ID, tt.condition.Severity, tt.seriesKey, got, tt.want)
+		}
+	}
+	if got := sc.match(&AlertCondition{ID: 6}, "host=db-1", now.Add(2*time.Hour)); got != "" {
+		t.Errorf("match after the window closed = %q, want none", got)
+	}
+}
@@ -0,0 +1,434 @@
+package services
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/query"
+	"github.com/sakkurohilla/kineticops/backend/internal/repository/postgres"
+	"gorm.io/gorm/clause"
+)
+
+// Alert state machine. Every series of a condition (each FACET group of a
+// KQL query, or the single value of other queries) has a persisted state:
+//
+//	ok -> pending      first breach; firing right away when Duration is 0
+//	pending -> firing  breaching for Duration minutes
+//	pending -> ok      recovered before Duration elapsed
+//	firing -> recovering  first value back within the threshold; resolved
+//	                      right away when RecoveryDuration is 0
+//	recovering -> resolved  within the threshold for RecoveryDuration minutes
+//	recovering -> firing    breached again during recovery
+//	resolved -> pending     breached again
+//	firing, recovering -> resolved  no data for NoDataTimeout minutes
+//	pending -> ok                   no data for NoDataTimeout minutes
+//
+// Entering firing opens an incident per policy, entering resolved closes
+// it. A series whose breach result changed in at least half of the last 20
+// evaluations is flapping: its state keeps moving but incidents are neither
+// opened nor closed until the change rate falls to a quarter, when the
+// incident is brought in line with the state.
+
+const (
+	AlertStateOK         = "ok"
+	AlertStatePending    = "pending"
+	AlertStateFiring     = "firing"
+	AlertStateRecovering = "recovering"
+	AlertStateResolved   = "resolved"
+
+	alertEvalInterval        = time.Minute
+	alertFlapWindow          = 21             // evaluations kept for flap detection (20 changes)
+	alertFlapStart           = 0.5            // change ratio at which a series starts flapping
+	alertFlapStop            = 0.25           // change ratio at which it stops
+	alertStateTTL            = 24 * time.Hour // quiet series without data are forgotten after this
+	alertTransitionRetention = 30 * 24 * time.Hour
+
+	// alertNoDataTimeout is how long an active series may go without data
+	// when its condition sets no NoDataTimeout.
+	alertNoDataTimeout = 15 * time.Minute
+)
+
+// AlertSeriesState is the current state of one series of a condition.
+type AlertSeriesState struct {
+	ConditionID int64     `json:"condition_id" gorm:"primaryKey"`
+	SeriesKey   string    `json:"series_key" gorm:"primaryKey"`
+	TenantID    int64     `json:"tenant_id"`
+	State       string    `json:"state"`
+	Value       float64   `json:"value"`
+	StateSince  time.Time `json:"state_since"`
+	History     int64     `json:"-"` // breach results, newest in bit 0
+	Flapping    bool      `json:"flapping"`
+	EvaluatedAt time.Time `json:"evaluated_at"`
+}
+
+// AlertStateTransition records a state change of a series, or the start or
+// end of flapping (From == To).
+type AlertStateTransition struct {
+	ID          int64     `json:"id"`
+	TenantID    int64     `json:"tenant_id"`
+	ConditionID int64     `json:"condition_id"`
+	SeriesKey   string    `json:"series_key"`
+	FromState   string    `json:"from_state"`
+	ToState     string    `json:"to_state"`
+	Value       float64   `json:"value"`
+	Flapping    bool      `json:"flapping"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// alertSeriesValue is one evaluated series of a condition: its value,
+// whether it breaches and, for other than threshold conditions, how.
+type alertSeriesValue struct {
+	key     string
+	value   float64
+	breach  bool
+	detail  string
+	related []int64 // composite: open child incidents to link
+}
+
+// observe feeds one evaluation into the state machine.
+func (st *AlertSeriesState) observe(breach bool, now time.Time, pending, recovery time.Duration) {
+	st.History = (st.History << 1) & (1<<alertFlapWindow - 1)
+	if breach {
+		st.History |= 1
+	}
+	switch ratio := flapRatio(st.History); {
+	case ratio >= alertFlapStart:
+		st.Flapping = true
+	case ratio <= alertFlapStop:
+		st.Flapping = false
+	}
+
+	// Evaluations run once per interval, so a duration of n minutes is
+	// reached on the n-th evaluation after entering the state.
+	elapsed := func(d time.Duration) bool { return now.Sub(st.StateSince) >= d-alertEvalInterval/2 }
+	enter := func(state string) {
+		st.State = state
+		st.StateSince = now
+	}
+
+	switch st.State {
+	case AlertStatePending:
+		if !breach {
+			enter(AlertStateOK)
+		} else if elapsed(pending) {
+			enter(AlertStateFiring)
+		}
+	case AlertStateFiring:
+		if !breach {
+			if recovery <= 0 {
+				enter(AlertStateResolved)
+			} else {
+				enter(AlertStateRecovering)
+			}
+		}
+	case AlertStateRecovering:
+		if breach {
+			enter(AlertStateFiring)
+		} else if elapsed(recovery) {
+			enter(AlertStateResolved)
+		}
+	default: // ok, resolved or new
+		if st.State == "" {
+			enter(AlertStateOK)
+		}
+		if breach {
+			if pending <= 0 {
+				enter(AlertStateFiring)
+			} else {
+				enter(AlertStatePending)
+			}
+		}
+	}
+}
+
+// flapRatio is the share of the last alertFlapWindow-1 evaluation pairs
+// whose breach result differs.
+func flapRatio(history int64) float64 {
+	changes := bits.OnesCount64(uint64((history ^ history>>1) & (1<<(alertFlapWindow-1) - 1)))
+	return float64(changes) / float64(alertFlapWindow-1)
+}
+
+// alertSeriesKey renders a facet as "k=v, k=v" in key order.
+func alertSeriesKey(facet map[string]string) string {
+	keys := make([]string, 0, len(facet))
+	for k := range facet {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + facet[k]
+	}
+	return strings.Join(parts, ", ")
+}
+
+// parseSeriesKey is the inverse of alertSeriesKey.
+func parseSeriesKey(key string) map[string]string {
+	facet := make(map[string]string)
+	if key == "" {
+		return facet
+	}
+	for _, part := range strings.Split(key, ", ") {
+		if k, v, ok := strings.Cut(part, "="); ok {
+			facet[k] = v
+		}
+	}
+	return facet
+}
+
+// querySeries evaluates a condition into its series. FACET queries yield one
+// series per group, evaluated up to query.MaxLimit groups.
+func (s *EnhancedAlertService) querySeries(condition *AlertCondition) ([]alertSeriesValue, error) {
+	text := strings.TrimSpace(condition.Query)
+	if !strings.HasPrefix(strings.ToUpper(text), "SELECT") {
+		v, err := s.executeQuery(text, condition.TenantID)
+		if err != nil {
+			return nil, err
+		}
+		return []alertSeriesValue{{value: v}}, nil
+	}
+
+	q, err := query.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if q.TimeSeries {
+		return nil, &QueryPlanError{Msg: "TIMESERIES queries do not yield a single value"}
+	}
+	q.Limit = query.MaxLimit
+	res, err := QuerySvc.Execute(condition.TenantID, q, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	var series []alertSeriesValue
+	for _, row := range res.Rows {
+		if v := row.Values[res.Columns[0]]; v != nil {
+			series = append(series, alertSeriesValue{key: alertSeriesKey(row.Facet), value: *v})
+		}
+	}
+	return series, nil
+}
+
+// evaluateSeries evaluates a condition into its series and breach results.
+func (s *EnhancedAlertService) evaluateSeries(condition *AlertCondition) ([]alertSeriesValue, error) {
+	switch condition.Type {
+	case AlertConditionAnomaly:
+		return s.anomalySeries(condition, time.Now())
+	case AlertConditionForecast:
+		return s.forecastConditionSeries(condition, time.Now())
+	case AlertConditionHeartbeat:
+		return s.heartbeatSeries(condition, time.Now())
+	case AlertConditionComposite:
+		return s.compositeSeries(condition)
+	}
+	series, err := s.querySeries(condition)
+	if err != nil {
+		return nil, err
+	}
+	compare := alertOperators[condition.Operator]
+	if compare == nil {
+		return nil, fmt.Errorf("unknown operator %q", condition.Operator)
+	}
+	for i := range series {
+		series[i].breach = compare(series[i].value, condition.Threshold)
+	}
+	return series, nil
+}
+
+// recordEvaluationError logs a failed evaluation and keeps the error on the
+// condition, so a condition that silently stopped evaluating (a broken query,
+// a deleted child) shows why; the next successful evaluation clears it.
+func recordEvaluationError(condition *AlertCondition, err error) {
+	updates := map[string]interface{}{"last_error": "", "last_error_at": nil}
+	if err != nil {
+		logging.Errorf("[ALERT] evaluation failed for condition=%d tenant=%d: %v", condition.ID, condition.TenantID, err)
+		updates["last_error"], updates["last_error_at"] = truncate(err.Error(), 1024), time.Now()
+	} else if condition.LastError == "" {
+		return
+	}
+	if err := postgres.DB.Model(&AlertCondition{}).Where("id = ?", condition.ID).UpdateColumns(updates).Error; err != nil {
+		logging.Errorf("failed to record evaluation error for condition=%d: %v", condition.ID, err)
+	}
+}
+
+// evaluateCondition evaluates a condition and moves each series through the
+// state machine, opening and closing incidents in policyIDs. Series without
+// data keep their state until the condition's no-data timeout.
+func (s *EnhancedAlertService) evaluateCondition(condition *AlertCondition, policyIDs []int64) {
+	if _, busy := s.evaluating.LoadOrStore(condition.ID, true); busy {
+		return
+	}
+	defer s.evaluating.Delete(condition.ID)
+
+	series, err := s.evaluateSeries(condition)
+	recordEvaluationError(condition, err)
+	if err != nil {
+		return
+	}
+
+	var rows []AlertSeriesState
+	if err := postgres.DB.Where("condition_id = ?", condition.ID).Find(&rows).Error; err != nil {
+		logging.Errorf("failed to load alert states for condition=%d: %v", condition.ID, err)
+		return
+	}
+	states := make(map[string]*AlertSeriesState, len(rows))
+	for i := range rows {
+		states[rows[i].SeriesKey] = &rows[i]
+	}
+
+	now := time.Now()
+	pending := time.Duration(condition.Duration) * time.Minute
+	recovery := time.Duration(condition.RecoveryDuration) * time.Minute
+	seen := make(map[string]bool, len(series))
+	var scope *suppressionScope // loaded when a series starts firing
+	for _, sv := range series {
+		seen[sv.key] = true
+		st := states[sv.key]
+		if st == nil {
+			st = &AlertSeriesState{ConditionID: condition.ID, SeriesKey: sv.key, TenantID: condition.TenantID}
+		}
+		from, wasFlapping := st.State, st.Flapping
+		if from == "" {
+			from = AlertStateOK
+		}
+		st.observe(sv.breach, now, pending, recovery)
+		st.Value = sv.value
+		st.EvaluatedAt = now
+
+		if err := postgres.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(st).Error; err != nil {
+			logging.Errorf("failed to save alert state for condition=%d series=%q: %v", condition.ID, sv.key, err)
+			continue
+		}
+		if from != st.State || wasFlapping != st.Flapping {
+			s.recordTransition(st, from, now)
+		}
+		if st.Flapping {
+			continue
+		}
+
+		switch st.State {
+		case AlertStateFiring:
+			// Entering firing, or settling in it after flapping
+			if from != AlertStateFiring && from != AlertStateRecovering || wasFlapping {
+				if scope == nil {
+					scope = loadSuppressionScope(condition.TenantID, now, queryHosts(condition.TenantID))
+				}
+				suppressedBy := scope.match(condition, sv.key, now)
+				for _, policyID := range policyIDs {
+					s.openIncident(condition, policyID, sv, suppressedBy)
+				}
+			}
+		case AlertStateResolved, AlertStateOK:
+			if from == AlertStateFiring || from == AlertStateRecovering || wasFlapping {
+				s.closeIncidents("condition_id = ? AND series_key = ?", condition.ID, sv.key)
+			}
+		}
+	}
+
+	s.expireSeries(condition, states, seen, now)
+
+	// Forget quiet series that stopped reporting
+	postgres.DB.Where("condition_id = ? AND evaluated_at < ? AND state IN ?",
+		condition.ID, now.Add(-alertStateTTL), []string{AlertStateOK, AlertStateResolved}).
+		Delete(&AlertSeriesState{})
+}
+
+// expireSeries settles the active series that had no data for the
+// condition's no-data timeout: a host that stopped reporting would otherwise
+// keep its incident open forever. EvaluatedAt, the last evaluation with
+// data, is kept.
+func (s *EnhancedAlertService) expireSeries(condition *AlertCondition, states map[string]*AlertSeriesState, seen map[string]bool, now time.Time) {
+	timeout := time.Duration(condition.NoDataTimeout) * time.Minute
+	if timeout <= 0 {
+		timeout = alertNoDataTimeout
+	}
+	for key, st := range states {
+		if seen[key] || now.Sub(st.EvaluatedAt) < timeout {
+			continue
+		}
+		from := st.State
+		switch from {
+		case AlertStateFiring, AlertStateRecovering:
+			st.State = AlertStateResolved
+		case AlertStatePending:
+			st.State = AlertStateOK
+		default:
+			continue
+		}
+		st.StateSince = now
+		st.Flapping = false
+		if err := postgres.DB.Model(&AlertSeriesState{}).
+			Where("condition_id = ? AND series_key = ?", st.ConditionID, st.SeriesKey).
+			Updates(map[string]interface{}{"state": st.State, "state_since": now, "flapping": false}).Error; err != nil {
+			logging.Errorf("failed to expire alert state for condition=%d series=%q: %v", condition.ID, key, err)
+			continue
+		}
+		logging.Infof("alert condition=%d series=%q has no data since %s, %s -> %s",
+			condition.ID, key, st.EvaluatedAt.Format(time.RFC3339), from, st.State)
+		s.recordTransition(st, from, now)
+		if st.State == AlertStateResolved {
+			s.closeIncidents("condition_id = ? AND series_key = ?", condition.ID, key)
+		}
+	}
+}
+
+func (s *EnhancedAlertService) recordTransition(st *AlertSeriesState, from string, at time.Time) {
+	t := &AlertStateTransition{
+		TenantID:    st.TenantID,
+		ConditionID: st.ConditionID,
+		SeriesKey:   st.SeriesKey,
+		FromState:   from,
+		ToState:     st.State,
+		Value:       st.Value,
+		Flapping:    st.Flapping,
+		CreatedAt:   at,
+	}
+	if err := postgres.DB.Create(t).Error; err != nil {
+		logging.Errorf("failed to record alert transition for condition=%d: %v", st.ConditionID, err)
+	}
+	if from == st.State {
+		logging.Infof("alert condition=%d series=%q flapping=%v", st.ConditionID, st.SeriesKey, st.Flapping)
+	}
+}
+
+// GetSeriesStates returns the series states of a condition.
+func (s *EnhancedAlertService) GetSeriesStates(conditionID int64, tenantID int64) ([]AlertSeriesState, error) {
+	var states []AlertSeriesState
+	err := postgres.DB.Where("condition_id = ? AND tenant_id = ?", conditionID, tenantID).
+		Order("series_key").Find(&states).Error
+	return states, err
+}
+
+// GetStateTransitions returns the newest state transitions of a condition.
+func (s *EnhancedAlertService) GetStateTransitions(conditionID int64, tenantID int64, limit int) ([]AlertStateTransition, error) {
+	var transitions []AlertStateTransition
+	err := postgres.DB.Where("condition_id = ? AND tenant_id = ?", conditionID, tenantID).
+		Order("created_at DESC, id DESC").Limit(limit).Find(&transitions).Error
+	return transitions, err
+}
+
+// resetSeriesStates forgets a condition's series states, e.g. when it is
+// disabled, so it starts from ok when enabled again.
+func (s *EnhancedAlertService) resetSeriesStates(conditionID int64) {
+	if err := postgres.DB.Where("condition_id = ?", conditionID).Delete(&AlertSeriesState{}).Error; err != nil {
+		logging.Errorf("failed to reset alert states for condition=%d: %v", conditionID, err)
+	}
+}
+
+func incidentDescription(condition *AlertCondition, sv alertSeriesValue) string {
+	if sv.detail != "" {
+		return fmt.Sprintf("Condition '%s' triggered. %s", condition.Name, sv.detail)
+	}
+	return fmt.Sprintf("Condition '%s' triggered. Value: %.2f, Threshold: %.2f", condition.Name, sv.value, condition.Threshold)
+}
+
+func incidentTitle(condition *AlertCondition, seriesKey string) string {
+	if seriesKey == "" {
+		return fmt.Sprintf("Alert: %s", condition.Name)
+	}
+	return fmt.Sprintf("Alert: %s (%s)", condition.Name, seriesKey)
+}
@@ -1,12 +1,15 @@
 package services
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"time"
 
 	"github.com/sakkurohilla/kineticops/backend/internal/models"
 	"github.com/sakkurohilla/kineticops/backend/internal/repository/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type APMService struct {
@@ -36,6 +39,40 @@ func (s *APMService) GetApplication(id int64, tenantID int64) (*models.Applicati
 	return &app, err
 }
 
+// EnsureApplication looks up an application by tenant, host and name and
+// creates it when missing. Existing applications get their last_seen and any
+// non-empty descriptive fields refreshed.
+func (s *APMService) EnsureApplication(app *models.Application) error {
+	var existing models.Application
+	err := postgres.DB.Where("tenant_id = ? AND host_id = ? AND name = ?", app.TenantID, app.HostID, app.Name).
+		First(&existing).Error
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			return err
+		}
+		if app.LastSeen.IsZero() {
+			app.LastSeen = time.Now()
+		}
+		return postgres.DB.Create(app).Error
+	}
+
+	updates := map[string]interface{}{"last_seen": time.Now(), "status": "active"}
+	if app.Language != "" {
+		updates["language"] = app.Language
+	}
+	if app.Framework != "" {
+		updates["framework"] = app.Framework
+	}
+	if app.Version != "" {
+		updates["version"] = app.Version
+	}
+	if err := postgres.DB.Model(&existing).Updates(updates).Error; err != nil {
+		return err
+	}
+	*app = existing
+	return nil
+}
+
 // Transaction Tracking
 func (s *APMService) RecordTransaction(tx *models.Transaction) error {
 	return postgres.DB.Create(tx).Error
@@ -108,6 +145,45 @@ func (s *APMService) AddSpan(span *models.Span) error {
 	return postgres.DB.Create(span).Error
 }
 
+// AddSpans inserts a batch of spans. Spans whose span_id already exists are
+// skipped so exporters can safely retry a batch.
+func (s *APMService) AddSpans(spans []models.Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	return postgres.DB.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(spans, 200).Error
+}
+
+// RefreshTrace recomputes the trace summary row (root span, duration, span
+// and error counts) from the spans stored for it. Recomputing rather than
+// incrementing keeps the summary correct when spans of one trace arrive in
+// several batches or are retried.
+func (s *APMService) RefreshTrace(tenantID int64, traceID string) error {
+	return postgres.DB.Exec(`
+		INSERT INTO traces (tenant_id, trace_id, application_id, root_span_id, duration, span_count, error_count, timestamp)
+		SELECT
+			tenant_id,
+			trace_id,
+			(ARRAY_AGG(application_id ORDER BY (COALESCE(parent_span_id, '') = '') DESC, start_time ASC))[1],
+			COALESCE(MAX(CASE WHEN COALESCE(parent_span_id, '') = '' THEN span_id END), ''),
+			EXTRACT(EPOCH FROM (MAX(end_time) - MIN(start_time))) * 1000,
+			COUNT(*),
+			SUM(CASE WHEN error THEN 1 ELSE 0 END),
+			MIN(start_time)
+		FROM spans
+		WHERE tenant_id = ? AND trace_id = ?
+		GROUP BY tenant_id, trace_id
+		ON CONFLICT (trace_id) DO UPDATE SET
+			application_id = EXCLUDED.application_id,
+			root_span_id = EXCLUDED.root_span_id,
+			duration = EXCLUDED.duration,
+			span_count = EXCLUDED.span_count,
+			error_count = EXCLUDED.error_count,
+			timestamp = EXCLUDED.timestamp
+		WHERE traces.tenant_id = EXCLUDED.tenant_id
+	`, tenantID, traceID).Error
+}
+
 func (s *APMService) GetTrace(traceID string, tenantID int64) (*models.Trace, []models.Span, error) {
 	var trace models.Trace
 	err := postgres.DB.Where("trace_id = ? AND tenant_id = ?", traceID, tenantID).First(&trace).Error
@@ -122,6 +198,33 @@ func (s *APMService) GetTrace(traceID string, tenantID int64) (*models.Trace, []
 	return &trace, spans, err
 }
 
+// SpanNode is a span with its child spans, used to render a trace waterfall.
+type SpanNode struct {
+	models.Span
+	Children []*SpanNode `json:"children"`
+}
+
+// BuildSpanTree nests spans under their parents. Spans whose parent is not in
+// the set (root spans, or children of spans that were never received) are
+// returned as roots. Input order (start time) is preserved among siblings.
+func BuildSpanTree(spans []models.Span) []*SpanNode {
+	nodes := make(map[string]*SpanNode, len(spans))
+	for i := range spans {
+		nodes[spans[i].SpanID] = &SpanNode{Span: spans[i], Children: []*SpanNode{}}
+	}
+
+	roots := []*SpanNode{}
+	for i := range spans {
+		node := nodes[spans[i].SpanID]
+		if parent, ok := nodes[spans[i].ParentSpanID]; ok && spans[i].ParentSpanID != "" && parent != node {
+			parent.Children = append(parent.Children, node)
+			continue
+		}
+		roots = append(roots, node)
+	}
+	return roots
+}
+
 func (s *APMService) GetTraces(appID int64, tenantID int64, start, end time.Time, limit int) ([]models.Trace, error) {
 	var traces []models.Trace
 	query := postgres.DB.Where("application_id = ? AND tenant_id = ?", appID, tenantID)
@@ -142,9 +245,10 @@ func (s *APMService) RecordError(errorEvent *models.ErrorEvent) error {
 		errorEvent.Fingerprint, errorEvent.TenantID).First(&existing).Error
 
 	if err == nil {
-		// Update existing error
+		// Update existing error; a recurrence reopens a resolved group
 		existing.Count++
 		existing.LastSeen = errorEvent.Timestamp
+		existing.Resolved = false
 		return postgres.DB.Save(&existing).Error
 	}
 
@@ -166,6 +270,21 @@ func (s *APMService) GetErrors(appID int64, tenantID int64, start, end time.Time
 	return errors, err
 }
 
+// ResolveError marks an error group as resolved. It reopens automatically if
+// the same fingerprint is recorded again.
+func (s *APMService) ResolveError(id int64, tenantID int64) error {
+	res := postgres.DB.Model(&models.ErrorEvent{}).
+		Where("id = ? AND tenant_id = ?", id, tenantID).
+		Update("resolved", true)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
 func (s *APMService) GetErrorStats(appID int64, tenantID int64, start, end time.Time) (map[string]interface{}, error) {
 	var stats struct {
 		TotalErrors   int64   `json:"total_errors"`
@@ -252,6 +371,38 @@ func (s *APMService) GetExternalServices(appID int64, tenantID int64, start, end
 	return services, err
 }
 
+// ExternalServiceBreakdown summarizes calls to one downstream service
+type ExternalServiceBreakdown struct {
+	ServiceName   string  `json:"service_name"`
+	CallCount     int64   `json:"call_count"`
+	AvgDuration   float64 `json:"avg_duration"`
+	P95Duration   float64 `json:"p95_duration"`
+	MaxDuration   float64 `json:"max_duration"`
+	ErrorCount    int64   `json:"error_count"`
+	TotalDuration float64 `json:"total_duration"`
+}
+
+// GetExternalServiceBreakdown groups external calls by service, slowest
+// (by total time spent) first.
+func (s *APMService) GetExternalServiceBreakdown(appID int64, tenantID int64, start, end time.Time) ([]ExternalServiceBreakdown, error) {
+	var breakdown []ExternalServiceBreakdown
+	err := postgres.DB.Raw(`
+		SELECT
+			service_name,
+			COUNT(*) as call_count,
+			AVG(duration) as avg_duration,
+			PERCENTILE_CONT(0.95) WITHIN GROUP (ORDER BY duration) as p95_duration,
+			MAX(duration) as max_duration,
+			SUM(CASE WHEN status_code >= 400 THEN 1 ELSE 0 END) as error_count,
+			SUM(duration) as total_duration
+		FROM external_services
+		WHERE application_id = ? AND tenant_id = ? AND timestamp BETWEEN ? AND ?
+		GROUP BY service_name
+		ORDER BY total_duration DESC
+	`, appID, tenantID, start, end).Scan(&breakdown).Error
+	return breakdown, err
+}
+
 // Performance Metrics
 func (s *APMService) RecordPerformanceMetric(metric *models.PerformanceMetric) error {
 	return postgres.DB.Create(metric).Error
@@ -329,9 +480,9 @@ func (s *APMService) GetApplicationOverview(appID int64, tenantID int64, start,
 	return overview, nil
 }
 
-// Helper function to generate fingerprint for errors
+// Helper function to generate fingerprint for errors. The SHA-256 hex digest
+// always fits the 64-character fingerprint column.
 func GenerateErrorFingerprint(errorClass, errorMessage string) string {
-	data := fmt.Sprintf("%s:%s", errorClass, errorMessage)
-	// Simple hash - in production use proper hashing
-	return fmt.Sprintf("%x", []byte(data))
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%s", errorClass, errorMessage)))
+	return hex.EncodeToString(sum[:])
 }
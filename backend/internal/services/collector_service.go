@@ -233,6 +233,7 @@ func SaveHostMetrics(metric *HostMetric) error {
 	// add monotonic sequence id for ordering across websocket consumers
 	seq := telemetry.NextSeq()
 	payload := map[string]interface{}{
+		"tenant_id":        tenantID,
 		"host_id":          dbm.HostID,
 		"cpu_usage":        dbm.CPUUsage,
 		"memory_usage":     dbm.MemoryUsage,
@@ -252,16 +253,13 @@ func SaveHostMetrics(metric *HostMetric) error {
 		"timestamp":        dbm.Timestamp.Format(time.RFC3339),
 	}
 	if b, err := json.Marshal(payload); err == nil {
-		// remember the last message for new clients (best-effort)
-		if gh := ws.GetGlobalHub(); gh != nil {
-			gh.RememberMessage(b)
-		}
+		// the Redpanda consumer routes the event to the tenant's clients
 		if err := kafkaevents.PublishEvent(b); err != nil {
 			logging.Warnf("[WARN] Failed to publish metric event: %v", err)
 			// instrumentation
 			telemetry.IncWSSendErrors(context.Background(), 1)
-			// Fallback: broadcast directly to connected websocket clients so UI remains realtime
-			ws.BroadcastToClients(b)
+			// Fallback: publish directly to the hub so UI remains realtime
+			ws.PublishEvent(tenantID, dbm.HostID, payload)
 			telemetry.IncWSBroadcast(context.Background(), 1)
 		} else {
 			telemetry.IncKafkaPublish(context.Background(), 1)
@@ -1,39 +1,71 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/logquery"
+	"github.com/sakkurohilla/kineticops/backend/internal/models"
+	"github.com/sakkurohilla/kineticops/backend/internal/notify"
+	"github.com/sakkurohilla/kineticops/backend/internal/query"
 	"github.com/sakkurohilla/kineticops/backend/internal/repository/postgres"
+	ws "github.com/sakkurohilla/kineticops/backend/internal/websocket"
 	"gorm.io/gorm"
 )
 
+// EnhancedAlertService is the alert engine. Conditions are evaluated every
+// minute; policies own conditions and notification channels, and a breached
+// condition opens one incident in each enabled policy it belongs to, which
+// is delivered to that policy's channels only.
 type EnhancedAlertService struct {
-	db *gorm.DB
+	evaluating  sync.Map                    // condition ids being evaluated
+	baselines   sync.Map                    // condition id -> *anomalyBaseline
+	suppressors map[int64]map[string]string // tenant id -> silences and windows in effect, owned by refreshSuppressions
 }
 
 func NewEnhancedAlertService() *EnhancedAlertService {
-	return &EnhancedAlertService{
-		db: postgres.DB,
-	}
+	return &EnhancedAlertService{}
 }
 
+// EnhancedAlertSvc is the alert engine instance started by the server.
+var EnhancedAlertSvc = NewEnhancedAlertService()
+
 // Advanced Alert Rules with NRQL-like queries
 type AlertCondition struct {
-	ID          int64     `json:"id"`
-	TenantID    int64     `json:"tenant_id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Query       string    `json:"query"` // NRQL-like query
-	Threshold   float64   `json:"threshold"`
-	Operator    string    `json:"operator"` // above, below, equals
-	Duration    int       `json:"duration"` // minutes
-	Severity    string    `json:"severity"` // critical, high, medium, low
-	Enabled     bool      `json:"enabled"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID               int64      `json:"id"`
+	TenantID         int64      `json:"tenant_id"`
+	Name             string     `json:"name"`
+	Description      string     `json:"description"`
+	Type             string     `json:"type"`  // threshold, anomaly, forecast, heartbeat or composite
+	Query            string     `json:"query"` // NRQL-like query
+	Threshold        float64    `json:"threshold"`
+	Operator         string     `json:"operator"`          // above, above_or_equals, below, below_or_equals, equals, not_equals
+	Sensitivity      float64    `json:"sensitivity"`       // anomaly: standard deviations from the baseline
+	Direction        string     `json:"direction"`         // anomaly: up, down or both
+	Seasonality      string     `json:"seasonality"`       // anomaly: none, hour_of_day or day_of_week
+	Horizon          int        `json:"horizon"`           // forecast: minutes ahead to predict the threshold crossing
+	ForecastMethod   string     `json:"forecast_method"`   // forecast: linear or holt
+	HostID           *int64     `json:"host_id,omitempty"` // heartbeat: the host to watch
+	HostGroup        string     `json:"host_group"`        // heartbeat: the host group to watch; all hosts without either
+	Timeout          int        `json:"timeout"`           // heartbeat: minutes without data before breaching
+	Expression       string     `json:"expression"`        // composite: e.g. "12 AND (13 OR NOT 14)" over condition ids
+	Correlation      string     `json:"correlation"`       // composite: none, host or group
+	Duration         int        `json:"duration"`          // minutes breaching before firing
+	RecoveryDuration int        `json:"recovery_duration"` // minutes back within the threshold before resolving
+	NoDataTimeout    int        `json:"no_data_timeout"`   // minutes without data before a firing series resolves; 0 for the default
+	Severity         string     `json:"severity"`          // critical, high, medium, low
+	Enabled          bool       `json:"enabled"`
+	LegacyRuleID     *int64     `json:"legacy_rule_id,omitempty"` // alert rule this condition was converted from
+	LastError        string     `json:"last_error"`               // why the latest evaluation failed; empty once it succeeds
+	LastErrorAt      *time.Time `json:"last_error_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
 }
 
 // Alert Channels (like New Relic notification channels)
@@ -45,16 +77,33 @@ type AlertChannel struct {
 	Config    string    `json:"config"` // JSON configuration
 	Enabled   bool      `json:"enabled"`
 	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 // Alert Policies (grouping conditions and channels)
 type AlertPolicy struct {
-	ID          int64     `json:"id"`
-	TenantID    int64     `json:"tenant_id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Enabled     bool      `json:"enabled"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID                 int64     `json:"id"`
+	TenantID           int64     `json:"tenant_id"`
+	Name               string    `json:"name"`
+	Description        string    `json:"description"`
+	Enabled            bool      `json:"enabled"`
+	EscalationPolicyID *int64    `json:"escalation_policy_id"`
+	ConditionIDs       []int64   `json:"condition_ids" gorm:"-"`
+	ChannelIDs         []int64   `json:"channel_ids" gorm:"-"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// AlertPolicyCondition links a policy to one of its conditions.
+type AlertPolicyCondition struct {
+	PolicyID    int64 `gorm:"primaryKey"`
+	ConditionID int64 `gorm:"primaryKey"`
+}
+
+// AlertPolicyChannel links a policy to one of its notification channels.
+type AlertPolicyChannel struct {
+	PolicyID  int64 `gorm:"primaryKey"`
+	ChannelID int64 `gorm:"primaryKey"`
 }
 
 // Alert Incidents (like New Relic incidents)
@@ -63,6 +112,7 @@ type AlertIncident struct {
 	TenantID    int64      `json:"tenant_id"`
 	PolicyID    int64      `json:"policy_id"`
 	ConditionID int64      `json:"condition_id"`
+	SeriesKey   string     `json:"series_key"` // facet of the series, e.g. "host=web-1"
 	Title       string     `json:"title"`
 	Description string     `json:"description"`
 	Status      string     `json:"status"` // open, acknowledged, closed
@@ -71,6 +121,157 @@ type AlertIncident struct {
 	ClosedAt    *time.Time `json:"closed_at"`
 	AckedAt     *time.Time `json:"acked_at"`
 	AckedBy     string     `json:"acked_by"`
+
+	// Escalation progress: tiers notified, repeats of the final tier and
+	// when the next step is due (nil when not escalating)
+	EscalationLevel  int        `json:"escalation_level"`
+	EscalationRepeat int        `json:"escalation_repeat"`
+	NextEscalationAt *time.Time `json:"next_escalation_at"`
+
+	// SuppressedBy names the silence or maintenance window muting the
+	// incident ("silence:3", "maintenance:1"); empty when it notifies.
+	SuppressedBy string `json:"suppressed_by"`
+}
+
+// AlertConfigError reports an invalid condition, channel or policy.
+type AlertConfigError struct {
+	Msg string
+}
+
+func (e *AlertConfigError) Error() string { return e.Msg }
+
+// alertOperators compare a condition's query result with its threshold.
+var alertOperators = map[string]func(value, threshold float64) bool{
+	"above":           func(v, t float64) bool { return v > t },
+	"above_or_equals": func(v, t float64) bool { return v >= t },
+	"below":           func(v, t float64) bool { return v < t },
+	"below_or_equals": func(v, t float64) bool { return v <= t },
+	"equals":          func(v, t float64) bool { return v == t },
+	"not_equals":      func(v, t float64) bool { return v != t },
+}
+
+var alertSeverities = map[string]bool{"critical": true, "high": true, "medium": true, "low": true}
+
+// legacyPolicyName is the policy holding conditions converted from alert
+// rules (see migration 027).
+const legacyPolicyName = "Legacy alert rules"
+
+// ValidateCondition checks a condition definition and fills in the default
+// type, operator and severity.
+func ValidateCondition(c *AlertCondition) error {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" || len(c.Name) > 255 {
+		return &AlertConfigError{Msg: "name is required (at most 255 characters)"}
+	}
+	if c.Type == "" {
+		c.Type = AlertConditionThreshold
+	}
+	switch c.Type {
+	case AlertConditionThreshold:
+	case AlertConditionAnomaly:
+		if err := validateAnomaly(c); err != nil {
+			return err
+		}
+	case AlertConditionForecast:
+		if err := validateForecast(c); err != nil {
+			return err
+		}
+	case AlertConditionHeartbeat:
+		if err := validateHeartbeat(c); err != nil {
+			return err
+		}
+	case AlertConditionComposite:
+		if err := validateComposite(c); err != nil {
+			return err
+		}
+	default:
+		return &AlertConfigError{Msg: "type must be threshold, anomaly, forecast, heartbeat or composite"}
+	}
+	if c.Operator == "" {
+		c.Operator = "above"
+	}
+	if alertOperators[c.Operator] == nil {
+		return &AlertConfigError{Msg: "operator must be above, above_or_equals, below, below_or_equals, equals or not_equals"}
+	}
+	c.Severity = strings.ToLower(c.Severity)
+	if c.Severity == "" {
+		c.Severity = "medium"
+	}
+	if !alertSeverities[c.Severity] {
+		return &AlertConfigError{Msg: "severity must be critical, high, medium or low"}
+	}
+	if c.Duration < 0 || c.RecoveryDuration < 0 || c.NoDataTimeout < 0 {
+		return &AlertConfigError{Msg: "duration, recovery_duration and no_data_timeout must not be negative"}
+	}
+	if c.Type == AlertConditionHeartbeat || c.Type == AlertConditionComposite {
+		return nil
+	}
+	if err := checkConditionQuery(c.Query); err != nil {
+		return &AlertConfigError{Msg: "invalid query: " + err.Error()}
+	}
+	return nil
+}
+
+// checkConditionQuery parses a condition query the way executeQuery runs it.
+func checkConditionQuery(q string) error {
+	q = strings.TrimSpace(q)
+	if q == "" {
+		return fmt.Errorf("query is required")
+	}
+	if strings.HasPrefix(strings.ToUpper(q), "SELECT") {
+		parsed, err := query.Parse(q)
+		if err != nil {
+			return err
+		}
+		if parsed.TimeSeries {
+			return fmt.Errorf("TIMESERIES queries do not yield a single value")
+		}
+		return nil
+	}
+	if rest, ok := strings.CutPrefix(q, "logs:"); ok {
+		_, err := logquery.CompileString(strings.TrimSpace(rest), time.Now())
+		return err
+	}
+	if rest, ok := strings.CutPrefix(q, "patterns:"); ok {
+		kind, lq, _ := strings.Cut(strings.TrimSpace(rest), " ")
+		if kind != "new" && kind != "spiking" {
+			return fmt.Errorf("unknown pattern signal %q (use patterns:new or patterns:spiking)", kind)
+		}
+		_, err := logquery.CompileString(strings.TrimSpace(lq), time.Now())
+		return err
+	}
+	// legacy free-text conditions
+	return nil
+}
+
+// ValidateChannel checks a channel's type and builds its sender to validate
+// the config.
+func ValidateChannel(ch *AlertChannel) error {
+	ch.Name = strings.TrimSpace(ch.Name)
+	if ch.Name == "" || len(ch.Name) > 255 {
+		return &AlertConfigError{Msg: "name is required (at most 255 characters)"}
+	}
+	var cfg map[string]interface{}
+	if err := json.Unmarshal([]byte(ch.Config), &cfg); err != nil || cfg == nil {
+		return &AlertConfigError{Msg: "config must be a JSON object"}
+	}
+	if _, err := notify.New(ch.Type, []byte(ch.Config)); err != nil {
+		return &AlertConfigError{Msg: err.Error()}
+	}
+	return nil
+}
+
+// ValidatePolicy checks a policy definition. Linked ids are checked against
+// the tenant when the policy is saved.
+func ValidatePolicy(p *AlertPolicy) error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" || len(p.Name) > 255 {
+		return &AlertConfigError{Msg: "name is required (at most 255 characters)"}
+	}
+	if p.EscalationPolicyID != nil {
+		return checkTenantIDs(postgres.DB, &AlertEscalationPolicy{}, p.TenantID, []int64{*p.EscalationPolicyID}, "escalation policy")
+	}
+	return nil
 }
 
 // Create Alert Condition
@@ -80,17 +281,40 @@ func (s *EnhancedAlertService) CreateCondition(condition *AlertCondition) error
 
 func (s *EnhancedAlertService) GetConditions(tenantID int64) ([]AlertCondition, error) {
 	var conditions []AlertCondition
-	err := postgres.DB.Where("tenant_id = ?", tenantID).Find(&conditions).Error
+	err := postgres.DB.Where("tenant_id = ?", tenantID).Order("id").Find(&conditions).Error
 	return conditions, err
 }
 
-func (s *EnhancedAlertService) UpdateCondition(id int64, tenantID int64, updates map[string]interface{}) error {
-	return postgres.DB.Model(&AlertCondition{}).
-		Where("id = ? AND tenant_id = ?", id, tenantID).
-		Updates(updates).Error
+func (s *EnhancedAlertService) GetCondition(id int64, tenantID int64) (*AlertCondition, error) {
+	var condition AlertCondition
+	if err := postgres.DB.Where("id = ? AND tenant_id = ?", id, tenantID).First(&condition).Error; err != nil {
+		return nil, err
+	}
+	return &condition, nil
 }
 
+// UpdateCondition saves a condition loaded with GetCondition. Disabling it
+// resolves its open incidents and resets its series states.
+func (s *EnhancedAlertService) UpdateCondition(condition *AlertCondition) error {
+	condition.UpdatedAt = time.Now()
+	if err := postgres.DB.Save(condition).Error; err != nil {
+		return err
+	}
+	if !condition.Enabled {
+		s.closeIncidents("condition_id = ?", condition.ID)
+		s.resetSeriesStates(condition.ID)
+	}
+	return nil
+}
+
+// DeleteCondition resolves the condition's open incidents and deletes it
+// along with its policy links. Conditions used by composite conditions are
+// not deleted.
 func (s *EnhancedAlertService) DeleteCondition(id int64, tenantID int64) error {
+	if names := compositesUsing(id, tenantID); len(names) > 0 {
+		return &AlertConfigError{Msg: "condition is used by composite condition " + strings.Join(names, ", ")}
+	}
+	s.closeIncidents("condition_id = ? AND tenant_id = ?", id, tenantID)
 	return postgres.DB.Where("id = ? AND tenant_id = ?", id, tenantID).
 		Delete(&AlertCondition{}).Error
 }
@@ -102,14 +326,21 @@ func (s *EnhancedAlertService) CreateChannel(channel *AlertChannel) error {
 
 func (s *EnhancedAlertService) GetChannels(tenantID int64) ([]AlertChannel, error) {
 	var channels []AlertChannel
-	err := postgres.DB.Where("tenant_id = ?", tenantID).Find(&channels).Error
+	err := postgres.DB.Where("tenant_id = ?", tenantID).Order("id").Find(&channels).Error
 	return channels, err
 }
 
-func (s *EnhancedAlertService) UpdateChannel(id int64, tenantID int64, updates map[string]interface{}) error {
-	return postgres.DB.Model(&AlertChannel{}).
-		Where("id = ? AND tenant_id = ?", id, tenantID).
-		Updates(updates).Error
+func (s *EnhancedAlertService) GetChannel(id int64, tenantID int64) (*AlertChannel, error) {
+	var channel AlertChannel
+	if err := postgres.DB.Where("id = ? AND tenant_id = ?", id, tenantID).First(&channel).Error; err != nil {
+		return nil, err
+	}
+	return &channel, nil
+}
+
+func (s *EnhancedAlertService) UpdateChannel(channel *AlertChannel) error {
+	channel.UpdatedAt = time.Now()
+	return postgres.DB.Save(channel).Error
 }
 
 func (s *EnhancedAlertService) DeleteChannel(id int64, tenantID int64) error {
@@ -117,139 +348,516 @@ func (s *EnhancedAlertService) DeleteChannel(id int64, tenantID int64) error {
 		Delete(&AlertChannel{}).Error
 }
 
-// Create Alert Policy
+// Create Alert Policy with its condition and channel links
 func (s *EnhancedAlertService) CreatePolicy(policy *AlertPolicy) error {
-	return postgres.DB.Create(policy).Error
+	return postgres.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(policy).Error; err != nil {
+			return err
+		}
+		_, err := setPolicyLinks(tx, policy)
+		return err
+	})
 }
 
 func (s *EnhancedAlertService) GetPolicies(tenantID int64) ([]AlertPolicy, error) {
 	var policies []AlertPolicy
-	err := postgres.DB.Where("tenant_id = ?", tenantID).Find(&policies).Error
-	return policies, err
+	if err := postgres.DB.Where("tenant_id = ?", tenantID).Order("id").Find(&policies).Error; err != nil {
+		return nil, err
+	}
+	return policies, loadPolicyLinks(policies)
 }
 
-func (s *EnhancedAlertService) UpdatePolicy(id int64, tenantID int64, updates map[string]interface{}) error {
-	return postgres.DB.Model(&AlertPolicy{}).
-		Where("id = ? AND tenant_id = ?", id, tenantID).
-		Updates(updates).Error
+func (s *EnhancedAlertService) GetPolicy(id int64, tenantID int64) (*AlertPolicy, error) {
+	var policy AlertPolicy
+	if err := postgres.DB.Where("id = ? AND tenant_id = ?", id, tenantID).First(&policy).Error; err != nil {
+		return nil, err
+	}
+	policies := []AlertPolicy{policy}
+	if err := loadPolicyLinks(policies); err != nil {
+		return nil, err
+	}
+	return &policies[0], nil
 }
 
+// UpdatePolicy saves a policy loaded with GetPolicy and replaces its links.
+// Incidents of conditions removed from the policy, or of every condition
+// when the policy is disabled, are resolved.
+func (s *EnhancedAlertService) UpdatePolicy(policy *AlertPolicy) error {
+	policy.UpdatedAt = time.Now()
+	var removed []int64
+	err := postgres.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(policy).Error; err != nil {
+			return err
+		}
+		var err error
+		removed, err = setPolicyLinks(tx, policy)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !policy.Enabled {
+		s.closeIncidents("policy_id = ?", policy.ID)
+	} else if len(removed) > 0 {
+		s.closeIncidents("policy_id = ? AND condition_id IN ?", policy.ID, removed)
+	}
+	return nil
+}
+
+// DeletePolicy resolves the policy's open incidents, while its channels are
+// still linked, and deletes it.
 func (s *EnhancedAlertService) DeletePolicy(id int64, tenantID int64) error {
+	s.closeIncidents("policy_id = ? AND tenant_id = ?", id, tenantID)
 	return postgres.DB.Where("id = ? AND tenant_id = ?", id, tenantID).
 		Delete(&AlertPolicy{}).Error
 }
 
+// setPolicyLinks replaces the condition and channel links of a policy after
+// checking that every id belongs to the policy's tenant. It returns the
+// conditions that were unlinked.
+func setPolicyLinks(tx *gorm.DB, policy *AlertPolicy) ([]int64, error) {
+	policy.ConditionIDs = uniqueIDs(policy.ConditionIDs)
+	policy.ChannelIDs = uniqueIDs(policy.ChannelIDs)
+	if err := checkTenantIDs(tx, &AlertCondition{}, policy.TenantID, policy.ConditionIDs, "condition"); err != nil {
+		return nil, err
+	}
+	if err := checkTenantIDs(tx, &AlertChannel{}, policy.TenantID, policy.ChannelIDs, "channel"); err != nil {
+		return nil, err
+	}
+
+	var previous []int64
+	if err := tx.Model(&AlertPolicyCondition{}).Where("policy_id = ?", policy.ID).
+		Pluck("condition_id", &previous).Error; err != nil {
+		return nil, err
+	}
+	keep := make(map[int64]bool, len(policy.ConditionIDs))
+	for _, id := range policy.ConditionIDs {
+		keep[id] = true
+	}
+	var removed []int64
+	for _, id := range previous {
+		if !keep[id] {
+			removed = append(removed, id)
+		}
+	}
+
+	if err := tx.Where("policy_id = ?", policy.ID).Delete(&AlertPolicyCondition{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("policy_id = ?", policy.ID).Delete(&AlertPolicyChannel{}).Error; err != nil {
+		return nil, err
+	}
+	if len(policy.ConditionIDs) > 0 {
+		links := make([]AlertPolicyCondition, len(policy.ConditionIDs))
+		for i, id := range policy.ConditionIDs {
+			links[i] = AlertPolicyCondition{PolicyID: policy.ID, ConditionID: id}
+		}
+		if err := tx.Create(&links).Error; err != nil {
+			return nil, err
+		}
+	}
+	if len(policy.ChannelIDs) > 0 {
+		links := make([]AlertPolicyChannel, len(policy.ChannelIDs))
+		for i, id := range policy.ChannelIDs {
+			links[i] = AlertPolicyChannel{PolicyID: policy.ID, ChannelID: id}
+		}
+		if err := tx.Create(&links).Error; err != nil {
+			return nil, err
+		}
+	}
+	return removed, nil
+}
+
+func checkTenantIDs(tx *gorm.DB, model interface{}, tenantID int64, ids []int64, kind string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var found []int64
+	if err := tx.Model(model).Where("tenant_id = ? AND id IN ?", tenantID, ids).Pluck("id", &found).Error; err != nil {
+		return err
+	}
+	if len(found) == len(ids) {
+		return nil
+	}
+	known := make(map[int64]bool, len(found))
+	for _, id := range found {
+		known[id] = true
+	}
+	for _, id := range ids {
+		if !known[id] {
+			return &AlertConfigError{Msg: fmt.Sprintf("unknown %s id %d", kind, id)}
+		}
+	}
+	return nil
+}
+
+// loadPolicyLinks fills in ConditionIDs and ChannelIDs.
+func loadPolicyLinks(policies []AlertPolicy) error {
+	if len(policies) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(policies))
+	index := make(map[int64]*AlertPolicy, len(policies))
+	for i := range policies {
+		ids[i] = policies[i].ID
+		index[policies[i].ID] = &policies[i]
+		policies[i].ConditionIDs = []int64{}
+		policies[i].ChannelIDs = []int64{}
+	}
+	var conditions []AlertPolicyCondition
+	if err := postgres.DB.Where("policy_id IN ?", ids).Order("condition_id").Find(&conditions).Error; err != nil {
+		return err
+	}
+	for _, l := range conditions {
+		p := index[l.PolicyID]
+		p.ConditionIDs = append(p.ConditionIDs, l.ConditionID)
+	}
+	var channels []AlertPolicyChannel
+	if err := postgres.DB.Where("policy_id IN ?", ids).Order("channel_id").Find(&channels).Error; err != nil {
+		return err
+	}
+	for _, l := range channels {
+		p := index[l.PolicyID]
+		p.ChannelIDs = append(p.ChannelIDs, l.ChannelID)
+	}
+	return nil
+}
+
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	out := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// ImportAlertRule converts an alert rule into a condition of the tenant's
+// "Legacy alert rules" policy, the same way migration 027 converts existing
+// rules, so rules created through /api/v1/alerts/rules are evaluated by the
+// engine. Rules were evaluated per host, so the condition facets by host. A
+// rule webhook becomes a webhook channel of that policy. tx should be the
+// transaction that stores the rule.
+func (s *EnhancedAlertService) ImportAlertRule(tx *gorm.DB, rule *models.AlertRule) error {
+	op := map[string]string{
+		">": "above", ">=": "above_or_equals", "<": "below", "<=": "below_or_equals", "==": "equals", "!=": "not_equals",
+	}[rule.Operator]
+	if op == "" || rule.MetricName == "" {
+		return &AlertConfigError{Msg: fmt.Sprintf("alert rule operator %q cannot be converted", rule.Operator)}
+	}
+	agg := "latest"
+	switch rule.Operator {
+	case ">", ">=":
+		agg = "max"
+	case "<", "<=":
+		agg = "min"
+	}
+	window := rule.Window
+	if window <= 0 {
+		window = 5
+	}
+	// A rule fires on its Frequency-th breach in a row; conditions are
+	// evaluated every minute, so that is Frequency-1 minutes pending
+	duration := max(rule.Frequency-1, 0)
+	ruleID := rule.ID
+	condition := &AlertCondition{
+		TenantID:     rule.TenantID,
+		Name:         fmt.Sprintf("%s %s %g", rule.MetricName, rule.Operator, rule.Threshold),
+		Query:        fmt.Sprintf("SELECT %s('%s') FROM metrics FACET host SINCE %d minutes ago", agg, strings.ReplaceAll(rule.MetricName, "'", "''"), window),
+		Threshold:    rule.Threshold,
+		Operator:     op,
+		Duration:     duration,
+		Severity:     "medium",
+		Enabled:      true,
+		LegacyRuleID: &ruleID,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	policy := AlertPolicy{
+		TenantID:    rule.TenantID,
+		Name:        legacyPolicyName,
+		Description: "Conditions converted from alert rules",
+		Enabled:     true,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if err := tx.Where("tenant_id = ? AND name = ?", rule.TenantID, legacyPolicyName).
+		FirstOrCreate(&policy).Error; err != nil {
+		return err
+	}
+	if err := tx.Create(condition).Error; err != nil {
+		return err
+	}
+	if err := tx.Create(&AlertPolicyCondition{PolicyID: policy.ID, ConditionID: condition.ID}).Error; err != nil {
+		return err
+	}
+	if rule.NotificationWebhook == "" {
+		return nil
+	}
+	config, _ := json.Marshal(map[string]string{"url": rule.NotificationWebhook})
+	channel := AlertChannel{
+		TenantID:  rule.TenantID,
+		Name:      "Webhook " + rule.NotificationWebhook,
+		Type:      "webhook",
+		Config:    string(config),
+		Enabled:   true,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := tx.Where("tenant_id = ? AND type = ? AND name = ?", channel.TenantID, channel.Type, channel.Name).
+		FirstOrCreate(&channel).Error; err != nil {
+		return err
+	}
+	return tx.Where(AlertPolicyChannel{PolicyID: policy.ID, ChannelID: channel.ID}).
+		FirstOrCreate(&AlertPolicyChannel{}).Error
+}
+
 // Incident Management
 func (s *EnhancedAlertService) CreateIncident(incident *AlertIncident) error {
 	return postgres.DB.Create(incident).Error
 }
 
-func (s *EnhancedAlertService) GetIncidents(tenantID int64, status string) ([]AlertIncident, error) {
+func (s *EnhancedAlertService) GetIncidents(tenantID int64, status string, suppressed *bool) ([]AlertIncident, error) {
 	var incidents []AlertIncident
 	query := postgres.DB.Where("tenant_id = ?", tenantID)
 
 	if status != "" {
 		query = query.Where("status = ?", status)
 	}
+	if suppressed != nil && *suppressed {
+		query = query.Where("suppressed_by <> ''")
+	} else if suppressed != nil {
+		query = query.Where("suppressed_by = ''")
+	}
 
-	err := query.Order("opened_at DESC").Find(&incidents).Error
+	err := query.Order("opened_at DESC").Limit(500).Find(&incidents).Error
 	return incidents, err
 }
 
+func (s *EnhancedAlertService) GetIncident(id int64, tenantID int64) (*AlertIncident, error) {
+	var incident AlertIncident
+	if err := postgres.DB.Where("id = ? AND tenant_id = ?", id, tenantID).First(&incident).Error; err != nil {
+		return nil, err
+	}
+	return &incident, nil
+}
+
 func (s *EnhancedAlertService) AcknowledgeIncident(id int64, tenantID int64, ackedBy string) error {
 	now := time.Now()
-	return postgres.DB.Model(&AlertIncident{}).
-		Where("id = ? AND tenant_id = ?", id, tenantID).
+	res := postgres.DB.Model(&AlertIncident{}).
+		Where("id = ? AND tenant_id = ? AND status = ?", id, tenantID, "open").
 		Updates(map[string]interface{}{
-			"status":   "acknowledged",
-			"acked_at": &now,
-			"acked_by": ackedBy,
-		}).Error
+			"status":             "acknowledged",
+			"acked_at":           &now,
+			"acked_by":           ackedBy,
+			"next_escalation_at": nil,
+		})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return res.Error
+	}
+	s.notifyIncidentByID(id, notify.Acknowledge)
+	return nil
 }
 
 func (s *EnhancedAlertService) CloseIncident(id int64, tenantID int64) error {
 	now := time.Now()
-	return postgres.DB.Model(&AlertIncident{}).
-		Where("id = ? AND tenant_id = ?", id, tenantID).
+	res := postgres.DB.Model(&AlertIncident{}).
+		Where("id = ? AND tenant_id = ? AND status <> ?", id, tenantID, "closed").
 		Updates(map[string]interface{}{
-			"status":    "closed",
-			"closed_at": &now,
-		}).Error
+			"status":             "closed",
+			"closed_at":          &now,
+			"next_escalation_at": nil,
+		})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return res.Error
+	}
+	s.notifyIncidentByID(id, notify.Resolve)
+	return nil
 }
 
-// Alert Evaluation Engine
-func (s *EnhancedAlertService) EvaluateConditions() {
-	// Get all enabled conditions
-	var conditions []AlertCondition
-	err := postgres.DB.Where("enabled = ?", true).Find(&conditions).Error
-	if err != nil {
+// closeIncidents closes the open and acknowledged incidents matching the
+// given conditions and notifies the resolution.
+func (s *EnhancedAlertService) closeIncidents(query string, args ...interface{}) {
+	var open []AlertIncident
+	if err := postgres.DB.Where("status IN ?", []string{"open", "acknowledged"}).
+		Where(query, args...).Find(&open).Error; err != nil {
+		logging.Errorf("failed to load open incidents: %v", err)
 		return
 	}
+	for _, incident := range open {
+		if err := s.CloseIncident(incident.ID, incident.TenantID); err != nil {
+			logging.Errorf("failed to close incident=%d: %v", incident.ID, err)
+		}
+	}
+}
 
-	for _, condition := range conditions {
-		go s.evaluateCondition(&condition)
+// notifyIncidentByID reloads an incident after a status change and
+// notifies its channels.
+func (s *EnhancedAlertService) notifyIncidentByID(id int64, action notify.Action) {
+	var incident AlertIncident
+	if err := postgres.DB.First(&incident, id).Error; err != nil {
+		logging.Warnf("failed to load incident=%d for %s notification: %v", id, action, err)
+		return
 	}
+	s.notifyIncident(&incident, action)
 }
 
-func (s *EnhancedAlertService) evaluateCondition(condition *AlertCondition) {
-	// Parse and execute the query
-	result, err := s.executeQuery(condition.Query, condition.TenantID)
+// Alert Evaluation Engine
+
+// EvaluateConditions evaluates, once each, the enabled conditions that
+// belong to at least one enabled policy.
+func (s *EnhancedAlertService) EvaluateConditions() {
+	var links []AlertPolicyCondition
+	err := postgres.DB.Table("alert_policy_conditions pc").
+		Select("pc.policy_id, pc.condition_id").
+		Joins("JOIN alert_policies p ON p.id = pc.policy_id").
+		Joins("JOIN alert_conditions c ON c.id = pc.condition_id").
+		Where("p.enabled AND c.enabled").
+		Scan(&links).Error
 	if err != nil {
+		logging.Errorf("failed to load alert policy conditions: %v", err)
 		return
 	}
-
-	// Check if threshold is breached
-	triggered := false
-	switch condition.Operator {
-	case "above":
-		triggered = result > condition.Threshold
-	case "below":
-		triggered = result < condition.Threshold
-	case "equals":
-		triggered = result == condition.Threshold
+	policies := make(map[int64][]int64)
+	for _, l := range links {
+		policies[l.ConditionID] = append(policies[l.ConditionID], l.PolicyID)
+	}
+	if len(policies) == 0 {
+		return
+	}
+	ids := make([]int64, 0, len(policies))
+	for id := range policies {
+		ids = append(ids, id)
 	}
 
-	if triggered {
-		// Check if incident already exists
-		var existingIncident AlertIncident
-		err := postgres.DB.Where("condition_id = ? AND status = ?",
-			condition.ID, "open").First(&existingIncident).Error
+	var conditions []AlertCondition
+	if err := postgres.DB.Where("id IN ?", ids).Find(&conditions).Error; err != nil {
+		logging.Errorf("failed to load alert conditions: %v", err)
+		return
+	}
 
-		if err != nil {
-			// Create new incident
-			incident := &AlertIncident{
-				TenantID:    condition.TenantID,
-				ConditionID: condition.ID,
-				Title:       fmt.Sprintf("Alert: %s", condition.Name),
-				Description: fmt.Sprintf("Condition '%s' triggered. Value: %.2f, Threshold: %.2f",
-					condition.Name, result, condition.Threshold),
-				Status:   "open",
-				Severity: condition.Severity,
-				OpenedAt: time.Now(),
-			}
-			if cerr := s.CreateIncident(incident); cerr != nil {
-				logging.Errorf("failed to create incident for condition=%d: %v", condition.ID, cerr)
+	// Children of composite conditions are evaluated even when they are in
+	// no policy; their series states feed the composites.
+	var children []int64
+	for _, c := range conditions {
+		if c.Type != AlertConditionComposite {
+			continue
+		}
+		if node, err := parseComposite(c.Expression); err == nil {
+			for _, id := range node.refs(nil) {
+				if policies[id] == nil {
+					children = append(children, id)
+				}
 			}
+		}
+	}
+	if len(children) > 0 {
+		var extra []AlertCondition
+		if err := postgres.DB.Where("id IN ? AND enabled AND type <> ?", uniqueIDs(children), AlertConditionComposite).
+			Find(&extra).Error; err != nil {
+			logging.Errorf("failed to load composite children: %v", err)
+		}
+		conditions = append(conditions, extra...)
+	}
 
-			// Send notifications
-			s.sendNotifications(incident)
+	var wg sync.WaitGroup
+	var composites []*AlertCondition
+	for i := range conditions {
+		condition := &conditions[i]
+		if condition.Type == AlertConditionComposite {
+			composites = append(composites, condition)
+			continue
 		}
-	} else {
-		// Close any open incidents for this condition
-		now := time.Now()
-		postgres.DB.Model(&AlertIncident{}).
-			Where("condition_id = ? AND status = ?", condition.ID, "open").
-			Updates(map[string]interface{}{
-				"status":    "closed",
-				"closed_at": &now,
-			})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.evaluateCondition(condition, policies[condition.ID])
+		}()
 	}
+	go func() {
+		wg.Wait()
+		for _, condition := range composites {
+			s.evaluateCondition(condition, policies[condition.ID])
+		}
+	}()
+}
+
+// openIncident opens an incident for a firing series of a condition in a
+// policy unless one is already open. An incident suppressed by a silence or
+// maintenance window (suppressedBy) is recorded and counted but neither
+// pushed to clients nor notified.
+func (s *EnhancedAlertService) openIncident(condition *AlertCondition, policyID int64, sv alertSeriesValue, suppressedBy string) {
+	seriesKey := sv.key
+	var existing int64
+	if err := postgres.DB.Model(&AlertIncident{}).
+		Where("condition_id = ? AND policy_id = ? AND series_key = ? AND status IN ?",
+			condition.ID, policyID, seriesKey, []string{"open", "acknowledged"}).
+		Count(&existing).Error; err != nil || existing > 0 {
+		return
+	}
+
+	incident := &AlertIncident{
+		TenantID:     condition.TenantID,
+		PolicyID:     policyID,
+		ConditionID:  condition.ID,
+		SeriesKey:    seriesKey,
+		Title:        incidentTitle(condition, seriesKey),
+		Description:  incidentDescription(condition, sv),
+		Status:       "open",
+		Severity:     condition.Severity,
+		OpenedAt:     time.Now(),
+		SuppressedBy: suppressedBy,
+	}
+	if err := s.CreateIncident(incident); err != nil {
+		logging.Errorf("failed to create incident for condition=%d policy=%d: %v", condition.ID, policyID, err)
+		return
+	}
+	linkIncidents(incident.ID, sv.related)
+	if incident.SuppressedBy != "" {
+		logging.Infof("incident=%d opened suppressed by %s", incident.ID, incident.SuppressedBy)
+		countSuppression(incident.SuppressedBy)
+		return
+	}
+	s.startEscalation(incident)
+
+	// Push to the tenant's websocket clients on the alerts topic
+	ws.PublishEvent(incident.TenantID, 0, map[string]interface{}{"type": "alert", "incident": incident})
+
+	// Send notifications
+	s.sendNotifications(incident)
 }
 
 func (s *EnhancedAlertService) executeQuery(query string, tenantID int64) (float64, error) {
-	// Simplified query execution - support a few basic metric names parsed
-	// out of the provided query string. This avoids an unused parameter
-	// while still keeping the implementation safe and constrained.
+	// KQL statements (SELECT ... FROM metrics ...) run on the query engine
+	if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(query)), "SELECT") {
+		return QuerySvc.Scalar(tenantID, query)
+	}
+
+	// "logs: <log query>" counts matching logs over the last 5 minutes
+	if rest, ok := strings.CutPrefix(strings.TrimSpace(query), "logs:"); ok {
+		n, err := CountLogsMatching(context.Background(), tenantID, strings.TrimSpace(rest), 5*time.Minute)
+		return float64(n), err
+	}
+
+	// "patterns:new <log query>" / "patterns:spiking <log query>" count log
+	// patterns first seen, or spiking against the previous hour, in the last
+	// 5 minutes
+	if rest, ok := strings.CutPrefix(strings.TrimSpace(query), "patterns:"); ok {
+		kind, q, _ := strings.Cut(strings.TrimSpace(rest), " ")
+		if kind != "new" && kind != "spiking" {
+			return 0, fmt.Errorf("unknown pattern signal %q (use patterns:new or patterns:spiking)", kind)
+		}
+		n, err := LogPatternSvc.CountPatternSignals(context.Background(), tenantID, strings.TrimSpace(q), kind == "spiking", 5*time.Minute, time.Hour)
+		return float64(n), err
+	}
+
+	// Legacy free-text conditions - support a few basic metric names parsed
+	// out of the provided query string.
 	metric := "cpu_usage"
 	q := strings.ToLower(query)
 	switch {
@@ -268,94 +876,150 @@ func (s *EnhancedAlertService) executeQuery(query string, tenantID int64) (float
 	return result, err
 }
 
+// AlertNotificationDelivery records one notification of an incident event
+// to a channel.
+type AlertNotificationDelivery struct {
+	ID              int64      `json:"id"`
+	TenantID        int64      `json:"tenant_id"`
+	IncidentID      int64      `json:"incident_id"`
+	ChannelID       int64      `json:"channel_id"`
+	ChannelType     string     `json:"channel_type"`
+	Event           string     `json:"event"`  // trigger, acknowledge, resolve
+	Status          string     `json:"status"` // sent, failed
+	Attempts        int        `json:"attempts"`
+	Error           string     `json:"error"`
+	EscalationLevel int        `json:"escalation_level"` // escalation tier, 0 for the policy's channels
+	GroupID         int64      `json:"group_id"`         // notification group of a grouped message
+	CreatedAt       time.Time  `json:"created_at"`
+	DeliveredAt     *time.Time `json:"delivered_at"`
+}
+
+// GetIncidentDeliveries returns the notification delivery log of an incident.
+func (s *EnhancedAlertService) GetIncidentDeliveries(incidentID int64, tenantID int64) ([]AlertNotificationDelivery, error) {
+	var deliveries []AlertNotificationDelivery
+	err := postgres.DB.Where("incident_id = ? AND tenant_id = ?", incidentID, tenantID).
+		Order("created_at").Find(&deliveries).Error
+	return deliveries, err
+}
+
 func (s *EnhancedAlertService) sendNotifications(incident *AlertIncident) {
-	// Get notification channels for this policy
+	s.notifyIncident(incident, notify.Trigger)
+}
+
+// notifyIncident delivers an incident lifecycle event to the enabled
+// channels of the incident's policy, or through the tenant's routing tree,
+// unless the incident is suppressed.
+func (s *EnhancedAlertService) notifyIncident(incident *AlertIncident, action notify.Action) {
+	if incident.SuppressedBy != "" || s.routeIncident(incident, action) {
+		return
+	}
 	var channels []AlertChannel
-	err := postgres.DB.Where("tenant_id = ? AND enabled = ?",
-		incident.TenantID, true).Find(&channels).Error
+	err := postgres.DB.
+		Joins("JOIN alert_policy_channels pc ON pc.channel_id = alert_channels.id").
+		Where("pc.policy_id = ? AND alert_channels.tenant_id = ? AND alert_channels.enabled = ?",
+			incident.PolicyID, incident.TenantID, true).
+		Find(&channels).Error
 	if err != nil {
+		logging.Errorf("failed to load alert channels for policy=%d: %v", incident.PolicyID, err)
 		return
 	}
 
-	for _, channel := range channels {
-		go s.sendNotification(&channel, incident)
+	event := incidentEvent(incident, action)
+	for i := range channels {
+		go s.sendNotification(&channels[i], event, 0)
 	}
 }
 
-func (s *EnhancedAlertService) sendNotification(channel *AlertChannel, incident *AlertIncident) {
-	switch channel.Type {
-	case "email":
-		s.sendEmailNotification(channel, incident)
-	case "slack":
-		s.sendSlackNotification(channel, incident)
-	case "webhook":
-		s.sendWebhookNotification(channel, incident)
-	case "pagerduty":
-		s.sendPagerDutyNotification(channel, incident)
+func incidentEvent(incident *AlertIncident, action notify.Action) notify.Event {
+	return notify.Event{
+		Action:      action,
+		IncidentID:  incident.ID,
+		TenantID:    incident.TenantID,
+		ConditionID: incident.ConditionID,
+		Title:       incident.Title,
+		Description: incident.Description,
+		Severity:    incident.Severity,
+		Status:      incident.Status,
+		OpenedAt:    incident.OpenedAt,
+		AckedBy:     incident.AckedBy,
+		Time:        time.Now(),
 	}
 }
 
-func (s *EnhancedAlertService) sendEmailNotification(channel *AlertChannel, incident *AlertIncident) {
-	// Parse email config
-	var config struct {
-		Recipients []string `json:"recipients"`
-		Subject    string   `json:"subject"`
-	}
-	if err := json.Unmarshal([]byte(channel.Config), &config); err != nil {
-		logging.Warnf("failed to parse email channel config for channel=%d: %v", channel.ID, err)
+// sendNotification delivers event to one channel with retries and records
+// the outcome in the delivery log, once per incident of a grouped message.
+func (s *EnhancedAlertService) sendNotification(channel *AlertChannel, event notify.Event, escalationLevel int) {
+	delivery := &AlertNotificationDelivery{
+		TenantID:        event.TenantID,
+		IncidentID:      event.IncidentID,
+		ChannelID:       channel.ID,
+		ChannelType:     channel.Type,
+		Event:           string(event.Action),
+		EscalationLevel: escalationLevel,
+		GroupID:         event.GroupID,
+		CreatedAt:       time.Now(),
 	}
-	// Send email (implement with your email service)
-	logging.Infof("EMAIL ALERT: %s - %s", incident.Title, incident.Description)
-}
 
-func (s *EnhancedAlertService) sendSlackNotification(channel *AlertChannel, incident *AlertIncident) {
-	// Parse Slack config
-	var config struct {
-		WebhookURL string `json:"webhook_url"`
-		Channel    string `json:"channel"`
-	}
-	if err := json.Unmarshal([]byte(channel.Config), &config); err != nil {
-		logging.Warnf("failed to parse slack channel config for channel=%d: %v", channel.ID, err)
+	sender, err := notify.New(channel.Type, []byte(channel.Config))
+	if err == nil {
+		delivery.Attempts, err = notify.Deliver(context.Background(), sender, event, notify.DefaultRetryPolicy)
 	}
-
-	// Send Slack message (implement with Slack API)
-	logging.Infof("SLACK ALERT: %s - %s", incident.Title, incident.Description)
-}
-
-func (s *EnhancedAlertService) sendWebhookNotification(channel *AlertChannel, incident *AlertIncident) {
-	// Parse webhook config
-	var config struct {
-		URL     string            `json:"url"`
-		Headers map[string]string `json:"headers"`
-	}
-	if err := json.Unmarshal([]byte(channel.Config), &config); err != nil {
-		logging.Warnf("failed to parse webhook channel config for channel=%d: %v", channel.ID, err)
+	if err != nil {
+		delivery.Status = "failed"
+		delivery.Error = err.Error()
+		logging.Warnf("alert %s notification for incident=%d via %s channel=%d failed after %d attempts: %v",
+			event.Action, event.IncidentID, channel.Type, channel.ID, delivery.Attempts, err)
+	} else {
+		now := time.Now()
+		delivery.Status = "sent"
+		delivery.DeliveredAt = &now
 	}
 
-	// Send webhook (implement HTTP POST)
-	logging.Infof("WEBHOOK ALERT: %s - %s", incident.Title, incident.Description)
-}
-
-func (s *EnhancedAlertService) sendPagerDutyNotification(channel *AlertChannel, incident *AlertIncident) {
-	// Parse PagerDuty config
-	var config struct {
-		IntegrationKey string `json:"integration_key"`
-		Severity       string `json:"severity"`
+	deliveries := []AlertNotificationDelivery{*delivery}
+	if len(event.Alerts) > 0 {
+		deliveries = make([]AlertNotificationDelivery, len(event.Alerts))
+		for i, a := range event.Alerts {
+			deliveries[i] = *delivery
+			deliveries[i].IncidentID = a.IncidentID
+			deliveries[i].Event = string(notify.Trigger)
+			if a.Status == "resolved" {
+				deliveries[i].Event = string(notify.Resolve)
+			}
+		}
 	}
-	if err := json.Unmarshal([]byte(channel.Config), &config); err != nil {
-		logging.Warnf("failed to parse pagerduty channel config for channel=%d: %v", channel.ID, err)
+	if err := postgres.DB.Create(&deliveries).Error; err != nil {
+		logging.Errorf("failed to record notification delivery for incident=%d: %v", event.IncidentID, err)
 	}
-
-	// Send PagerDuty alert (implement with PagerDuty API)
-	logging.Infof("PAGERDUTY ALERT: %s - %s", incident.Title, incident.Description)
 }
 
-// Start the alert evaluation scheduler
-func (s *EnhancedAlertService) StartScheduler() {
-	ticker := time.NewTicker(1 * time.Minute)
+// StartScheduler re-checks suppressions and evaluates conditions every
+// minute, drives escalations and notification groups and prunes old state
+// transitions hourly, until ctx is done.
+func (s *EnhancedAlertService) StartScheduler(ctx context.Context) {
+	ticker := time.NewTicker(alertEvalInterval)
+	timers := time.NewTicker(escalationTickPeriod)
+	prune := time.NewTicker(time.Hour)
 	go func() {
-		for range ticker.C {
-			s.EvaluateConditions()
+		defer ticker.Stop()
+		defer timers.Stop()
+		defer prune.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.refreshSuppressions()
+				s.EvaluateConditions()
+			case <-timers.C:
+				s.runEscalations()
+				s.flushGroups()
+			case <-prune.C:
+				if err := postgres.DB.Where("created_at < ?", time.Now().Add(-alertTransitionRetention)).
+					Delete(&AlertStateTransition{}).Error; err != nil {
+					logging.Warnf("failed to prune alert state transitions: %v", err)
+				}
+			}
 		}
 	}()
+	logging.Infof("Alert engine started (1m evaluation interval)")
 }
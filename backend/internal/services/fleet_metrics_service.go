@@ -0,0 +1,162 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/query"
+)
+
+// FleetFilter narrows fleet queries to part of a tenant's hosts. Empty fields
+// match everything.
+type FleetFilter struct {
+	Group  string
+	Tag    string
+	OS     string
+	Labels map[string]string
+}
+
+// FleetQuery describes an aggregate over many hosts, optionally split by a
+// dimension (group, tag, os, host or label.<name>).
+type FleetQuery struct {
+	Metrics []string
+	Func    string // avg, min, max, sum, count, latest, p50, p90, p95, p99
+	Range   string // 1h, 6h, 24h, 7d, 30d
+	GroupBy string
+	Filter  FleetFilter
+	Limit   int // groups kept when GroupBy is set
+}
+
+// FleetPoint is one bucket of a fleet series. Group is the GroupBy value.
+type FleetPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+	Group     string    `json:"group,omitempty"`
+}
+
+// TopHost is one entry of a top-N ranking.
+type TopHost struct {
+	HostID   int64   `json:"host_id"`
+	Hostname string  `json:"hostname"`
+	Group    string  `json:"group"`
+	Value    float64 `json:"value"`
+}
+
+// FleetSeries returns one time series per metric (per group when GroupBy is
+// set) aggregated across the tenant's hosts. It runs as a single KQL query.
+func (s *QueryService) FleetSeries(tenantID int64, fq FleetQuery) (map[string][]FleetPoint, error) {
+	q, err := s.fleetQuery(fq.Metrics, fq.Func, fq.Range, fq.Filter, fq.Limit)
+	if err != nil {
+		return nil, err
+	}
+	q.TimeSeries = true
+
+	var groupKey string
+	if fq.GroupBy != "" {
+		dim, err := query.ParseDimension(fq.GroupBy)
+		if err != nil {
+			return nil, err
+		}
+		q.Facets = []query.Dimension{dim}
+		groupKey = dim.String()
+	}
+
+	res, err := s.Execute(tenantID, q, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string][]FleetPoint, len(fq.Metrics))
+	for _, m := range fq.Metrics {
+		out[m] = []FleetPoint{}
+	}
+	for _, row := range res.Rows {
+		for name, v := range row.Values {
+			if v == nil {
+				continue
+			}
+			out[name] = append(out[name], FleetPoint{Timestamp: *row.Timestamp, Value: *v, Group: row.Facet[groupKey]})
+		}
+	}
+	return out, nil
+}
+
+// TopHosts ranks the tenant's hosts by fn(metric) over the range, highest
+// first.
+func (s *QueryService) TopHosts(tenantID int64, metric, fn, timeRange string, filter FleetFilter, limit int) ([]TopHost, error) {
+	q, err := s.fleetQuery([]string{metric}, fn, timeRange, filter, limit)
+	if err != nil {
+		return nil, err
+	}
+	q.Facets = []query.Dimension{{Name: "host_id"}, {Name: "host"}, {Name: "group"}}
+
+	res, err := s.Execute(tenantID, q, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]TopHost, 0, len(res.Rows))
+	for _, row := range res.Rows {
+		v := row.Values[metric]
+		if v == nil {
+			continue
+		}
+		hostID, _ := strconv.ParseInt(row.Facet["host_id"], 10, 64)
+		out = append(out, TopHost{HostID: hostID, Hostname: row.Facet["host"], Group: row.Facet["group"], Value: *v})
+	}
+	return out, nil
+}
+
+func (s *QueryService) fleetQuery(metrics []string, fn, timeRange string, filter FleetFilter, limit int) (*query.Query, error) {
+	if len(metrics) == 0 {
+		return nil, &QueryPlanError{Msg: "at least one metric is required"}
+	}
+	if fn == "" {
+		fn = "avg"
+	}
+	switch timeRange {
+	case "1h", "6h", "24h", "7d", "30d":
+	default:
+		return nil, &QueryPlanError{Msg: fmt.Sprintf("unknown range %q, use 1h, 6h, 24h, 7d or 30d", timeRange)}
+	}
+
+	now := time.Now()
+	q := &query.Query{
+		From:  "metrics",
+		Since: query.TimeRef{Absolute: s.aggregation.parseTimeRange(timeRange, now)},
+		Until: query.TimeRef{Absolute: now},
+		Limit: limit,
+	}
+	if q.Limit <= 0 {
+		q.Limit = query.DefaultLimit
+	} else if q.Limit > query.MaxLimit {
+		q.Limit = query.MaxLimit
+	}
+
+	seen := map[string]bool{}
+	for _, m := range metrics {
+		if seen[m] {
+			continue
+		}
+		seen[m] = true
+		agg, err := query.NewAggregate(fn, m)
+		if err != nil {
+			return nil, &QueryPlanError{Msg: err.Error()}
+		}
+		q.Select = append(q.Select, agg)
+	}
+
+	eq := func(dim query.Dimension, v string) {
+		if v != "" {
+			q.Where = append(q.Where, query.Condition{Dim: dim, Op: "=", Values: []string{v}})
+		}
+	}
+	eq(query.Dimension{Name: "group"}, filter.Group)
+	eq(query.Dimension{Name: "tag"}, filter.Tag)
+	eq(query.Dimension{Name: "os"}, filter.OS)
+	for k, v := range filter.Labels {
+		eq(query.Dimension{Name: "label", Label: k}, v)
+	}
+	return q, nil
+}
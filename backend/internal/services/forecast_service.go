@@ -0,0 +1,220 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/query"
+)
+
+// Forecasting. Series are downsampled by a TIMESERIES query and fitted
+// either by least-squares linear regression or by Holt's linear trend
+// (double exponential smoothing), which follows recent changes of the
+// trend more closely. The fit extrapolates the series to predict when it
+// reaches a limit; it backs forecast alert conditions and the capacity
+// forecast API.
+
+const (
+	ForecastLinear = "linear"
+	ForecastHolt   = "holt"
+
+	holtAlpha         = 0.5 // level smoothing
+	holtBeta          = 0.2 // trend smoothing
+	minForecastPoints = 5
+)
+
+var forecastMethods = map[string]bool{ForecastLinear: true, ForecastHolt: true}
+
+type forecastPoint struct {
+	t time.Time
+	v float64
+}
+
+// forecastFit is a fitted trend: the value at At and its change per second.
+type forecastFit struct {
+	At    time.Time
+	Level float64
+	Slope float64
+}
+
+// valueAt extrapolates the fit to t.
+func (f forecastFit) valueAt(t time.Time) float64 {
+	return f.Level + f.Slope*t.Sub(f.At).Seconds()
+}
+
+// reachAt returns when the fit reaches limit going up (rising) or down, or
+// false when it does not. A fit already past the limit reaches it at At.
+func (f forecastFit) reachAt(limit float64, rising bool) (time.Time, bool) {
+	if rising && f.Level >= limit || !rising && f.Level <= limit {
+		return f.At, true
+	}
+	if rising && f.Slope <= 0 || !rising && f.Slope >= 0 {
+		return time.Time{}, false
+	}
+	secs := (limit - f.Level) / f.Slope
+	if secs > float64(100*365*24*3600) {
+		return time.Time{}, false
+	}
+	return f.At.Add(time.Duration(secs * float64(time.Second))), true
+}
+
+// fitForecast fits points, ordered by time, with method.
+func fitForecast(points []forecastPoint, method string) (forecastFit, bool) {
+	if len(points) < minForecastPoints {
+		return forecastFit{}, false
+	}
+	if method == ForecastHolt {
+		return fitHolt(points), true
+	}
+	return fitLinear(points), true
+}
+
+func fitLinear(points []forecastPoint) forecastFit {
+	t0 := points[0].t
+	n := float64(len(points))
+	var sumX, sumY, sumXY, sumX2 float64
+	for _, p := range points {
+		x := p.t.Sub(t0).Seconds()
+		sumX += x
+		sumY += p.v
+		sumXY += x * p.v
+		sumX2 += x * x
+	}
+	slope := 0.0
+	if d := n*sumX2 - sumX*sumX; d != 0 {
+		slope = (n*sumXY - sumX*sumY) / d
+	}
+	intercept := (sumY - slope*sumX) / n
+	last := points[len(points)-1].t
+	return forecastFit{At: last, Level: intercept + slope*last.Sub(t0).Seconds(), Slope: slope}
+}
+
+// fitHolt runs Holt's linear trend method; gaps between points are
+// bridged by the trend.
+func fitHolt(points []forecastPoint) forecastFit {
+	level := points[0].v
+	slope := 0.0
+	if dt := points[1].t.Sub(points[0].t).Seconds(); dt > 0 {
+		slope = (points[1].v - points[0].v) / dt
+	}
+	for i := 1; i < len(points); i++ {
+		dt := points[i].t.Sub(points[i-1].t).Seconds()
+		prev := level
+		level = holtAlpha*points[i].v + (1-holtAlpha)*(level+slope*dt)
+		if dt > 0 {
+			slope = holtBeta*(level-prev)/dt + (1-holtBeta)*slope
+		}
+	}
+	return forecastFit{At: points[len(points)-1].t, Level: level, Slope: slope}
+}
+
+// forecastSeries runs q as a TIMESERIES (with its own interval, or AUTO)
+// and returns the points of each series, keyed as anomalySeriesKey does.
+func forecastSeries(tenantID int64, q *query.Query, now time.Time) (map[string][]forecastPoint, error) {
+	tq := *q
+	tq.TimeSeries = true
+	tq.Limit = query.MaxLimit
+	res, err := QuerySvc.Execute(tenantID, &tq, now)
+	if err != nil {
+		return nil, err
+	}
+	series := make(map[string][]forecastPoint)
+	for _, row := range res.Rows {
+		if row.Timestamp == nil {
+			continue
+		}
+		for _, col := range res.Columns {
+			if v := row.Values[col]; v != nil {
+				key := anomalySeriesKey(row.Facet, col, len(res.Columns))
+				series[key] = append(series[key], forecastPoint{t: *row.Timestamp, v: *v})
+			}
+		}
+	}
+	for _, points := range series {
+		sort.Slice(points, func(i, j int) bool { return points[i].t.Before(points[j].t) })
+	}
+	return series, nil
+}
+
+// CapacityForecast is the forecast of one metric of one host.
+type CapacityForecast struct {
+	Host           string     `json:"host"`
+	Metric         string     `json:"metric"`
+	Method         string     `json:"method"`
+	Points         int        `json:"points"`
+	Current        float64    `json:"current"`
+	SlopePerHour   float64    `json:"slope_per_hour"`
+	Forecast       float64    `json:"forecast"` // value at the end of the horizon
+	Limit          *float64   `json:"limit,omitempty"`
+	ReachesLimitAt *time.Time `json:"reaches_limit_at,omitempty"`
+	HoursToLimit   *float64   `json:"hours_to_limit,omitempty"`
+}
+
+// CapacityForecasts forecasts metrics per host over horizon from their
+// history. limit overrides the limit of every metric; otherwise percentage
+// metrics (*_usage, *_percent) are limited at 100 and others have none.
+func (s *QueryService) CapacityForecasts(tenantID int64, metrics []string, history, horizon time.Duration, method string, limit *float64) ([]CapacityForecast, error) {
+	if !forecastMethods[method] {
+		return nil, &QueryPlanError{Msg: "method must be linear or holt"}
+	}
+	now := time.Now()
+	forecasts := []CapacityForecast{}
+	for _, metric := range metrics {
+		q := &query.Query{
+			Select: []query.Aggregate{{Func: "avg", Metric: metric, Alias: metric}},
+			From:   "metrics",
+			Facets: []query.Dimension{{Name: "host"}},
+			Since:  query.TimeRef{Ago: history},
+		}
+		series, err := forecastSeries(tenantID, q, now)
+		if err != nil {
+			return nil, err
+		}
+		metricLimit := limit
+		if metricLimit == nil && (strings.HasSuffix(metric, "_usage") || strings.HasSuffix(metric, "_percent")) {
+			hundred := 100.0
+			metricLimit = &hundred
+		}
+		for key, points := range series {
+			fit, ok := fitForecast(points, method)
+			if !ok {
+				continue
+			}
+			f := CapacityForecast{
+				Host:         parseSeriesKey(key)["host"],
+				Metric:       metric,
+				Method:       method,
+				Points:       len(points),
+				Current:      points[len(points)-1].v,
+				SlopePerHour: fit.Slope * 3600,
+				Forecast:     fit.valueAt(now.Add(horizon)),
+				Limit:        metricLimit,
+			}
+			if metricLimit != nil {
+				if at, ok := fit.reachAt(*metricLimit, true); ok {
+					hours := at.Sub(now).Hours()
+					if hours < 0 {
+						hours = 0
+					}
+					f.ReachesLimitAt, f.HoursToLimit = &at, &hours
+				}
+			}
+			forecasts = append(forecasts, f)
+		}
+	}
+	sort.Slice(forecasts, func(i, j int) bool {
+		a, b := forecasts[i], forecasts[j]
+		if (a.HoursToLimit == nil) != (b.HoursToLimit == nil) {
+			return a.HoursToLimit != nil
+		}
+		if a.HoursToLimit != nil && *a.HoursToLimit != *b.HoursToLimit {
+			return *a.HoursToLimit < *b.HoursToLimit
+		}
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		return a.Metric < b.Metric
+	})
+	return forecasts, nil
+}
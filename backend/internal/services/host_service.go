@@ -1,8 +1,12 @@
 package services
 
 import (
+	"fmt"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
 	"github.com/sakkurohilla/kineticops/backend/internal/models"
 	"github.com/sakkurohilla/kineticops/backend/internal/repository/postgres"
 	"gorm.io/gorm"
@@ -90,12 +94,146 @@ func GetHostByID(hostID, tenantID int64) (*models.Host, error) {
 	return host, nil
 }
 
+// FindHostBySender maps a sender that cannot authenticate (e.g. a syslog
+// device) to a host. With a tenant it uses FindHostByIdentifiers; without one
+// it searches all tenants by IP, then hostname, and only returns a match that
+// is unambiguous so messages are never attributed to the wrong tenant.
+func FindHostBySender(hostname, ip string, tenantID int64) models.Host {
+	if hostname == "" && ip == "" {
+		return models.Host{}
+	}
+	if tenantID != 0 {
+		return FindHostByIdentifiers(hostname, ip, tenantID)
+	}
+
+	for _, q := range []struct{ col, val string }{{"ip", ip}, {"hostname", hostname}} {
+		if q.val == "" {
+			continue
+		}
+		var hosts []models.Host
+		if err := postgres.DB.Where(q.col+" = ?", q.val).Limit(2).Find(&hosts).Error; err == nil && len(hosts) == 1 {
+			return hosts[0]
+		}
+	}
+	return models.Host{}
+}
+
 // UpdateHostFields updates specific host fields
 func UpdateHostFields(hostID int64, fields map[string]interface{}) error {
 	return postgres.UpdateHost(postgres.DB, hostID, fields)
 }
 
+// hostSeenFlushInterval is how often hosts marked by MarkHostSeen are
+// written.
+const hostSeenFlushInterval = 15 * time.Second
+
+var hostsSeen = struct {
+	sync.Mutex
+	once sync.Once
+	ids  map[int64]bool
+}{ids: make(map[int64]bool)}
+
+// MarkHostSeen records that data arrived for a host. Ingest paths without
+// agent heartbeats (OTLP, remote_write, line protocol, syslog) call it so
+// the host's last_seen and agent_status follow their data; the marks are
+// written in one statement every hostSeenFlushInterval.
+func MarkHostSeen(hostID int64) {
+	if hostID == 0 {
+		return
+	}
+	hostsSeen.once.Do(func() { go flushHostsSeen() })
+	hostsSeen.Lock()
+	hostsSeen.ids[hostID] = true
+	hostsSeen.Unlock()
+}
+
+func flushHostsSeen() {
+	ticker := time.NewTicker(hostSeenFlushInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		hostsSeen.Lock()
+		ids := make([]int64, 0, len(hostsSeen.ids))
+		for id := range hostsSeen.ids {
+			ids = append(ids, id)
+		}
+		hostsSeen.ids = make(map[int64]bool)
+		hostsSeen.Unlock()
+		if len(ids) == 0 {
+			continue
+		}
+		if err := postgres.DB.Model(&models.Host{}).Where("id IN ?", ids).
+			Updates(map[string]interface{}{"last_seen": now, "agent_status": "online"}).Error; err != nil {
+			logging.Warnf("failed to update last_seen of %d hosts: %v", len(ids), err)
+		}
+	}
+}
+
 // DeleteHostByID deletes a host
 func DeleteHostByID(hostID int64) error {
 	return postgres.DeleteHost(postgres.DB, hostID)
 }
+
+// FindHostByIdentifiers implements multi-layer host identification shared by
+// the ingestion paths. A zero-value Host is returned when nothing matches.
+func FindHostByIdentifiers(hostname, ip string, tenantID int64) models.Host {
+	var host models.Host
+
+	// 1. PRIMARY: Try by reg_token (most reliable). Auto-registered hosts get
+	// "auto-<tenant>-<hostname>-<unix time>" (see findOrCreateHost).
+	if hostname != "" {
+		token := fmt.Sprintf("auto-%d-%s", tenantID, hostname)
+		var candidates []models.Host
+		postgres.DB.Where("reg_token LIKE ? AND tenant_id = ?", escapeLike(token+"-")+"%", tenantID).
+			Order("id").Find(&candidates)
+		for _, h := range candidates {
+			if isDigits(strings.TrimPrefix(h.RegToken, token+"-")) {
+				return h
+			}
+		}
+	}
+
+	// 2. SECONDARY: Try by IP + tenant (network stable)
+	if ip != "" {
+		err := postgres.DB.Where("ip = ? AND tenant_id = ?", ip, tenantID).First(&host).Error
+		if err == nil {
+			return host
+		}
+	}
+
+	// 3. FALLBACK: Try by hostname + tenant (legacy support)
+	if hostname != "" {
+		err := postgres.DB.Where("hostname = ? AND tenant_id = ?", hostname, tenantID).First(&host).Error
+		if err == nil {
+			return host
+		}
+	}
+
+	// 4. LAST RESORT: Try the host's FQDN, for hosts that report their short
+	// name ("web1" finds "web1.example.com" but not "web10")
+	if hostname != "" {
+		err := postgres.DB.Where("hostname LIKE ? AND tenant_id = ?", escapeLike(hostname+".")+"%", tenantID).
+			Order("id").First(&host).Error
+		if err == nil {
+			return host
+		}
+	}
+
+	return models.Host{} // Not found
+}
+
+// escapeLike escapes the LIKE wildcards in s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
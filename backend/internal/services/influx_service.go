@@ -0,0 +1,317 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/models"
+	"github.com/sakkurohilla/kineticops/backend/internal/repository/postgres"
+)
+
+// InfluxPoint is one parsed line of Influx line protocol.
+type InfluxPoint struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{}
+	Time        time.Time
+}
+
+// InfluxLineError reports a line that could not be parsed.
+type InfluxLineError struct {
+	Line int
+	Err  string
+}
+
+func (e InfluxLineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+// influxPrecision maps the precision values accepted by the v1 (n, u, ms, s,
+// m, h) and v2 (ns, us, ms, s) write APIs to a duration. Empty means ns.
+func influxPrecision(p string) (time.Duration, error) {
+	switch p {
+	case "", "n", "ns":
+		return time.Nanosecond, nil
+	case "u", "us", "µ", "µs":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	}
+	return 0, fmt.Errorf("invalid precision %q", p)
+}
+
+// ParseLineProtocol parses an Influx line protocol body. Points without a
+// timestamp get the current time. Valid points are returned even when some
+// lines fail, so callers can store a partial write as InfluxDB does.
+func ParseLineProtocol(body []byte, precision string) ([]InfluxPoint, []InfluxLineError, error) {
+	unit, err := influxPrecision(precision)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now().UTC()
+	var points []InfluxPoint
+	var lineErrs []InfluxLineError
+	for i, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p, err := parseInfluxLine(line, unit, now)
+		if err != nil {
+			lineErrs = append(lineErrs, InfluxLineError{Line: i + 1, Err: err.Error()})
+			continue
+		}
+		points = append(points, p)
+	}
+	return points, lineErrs, nil
+}
+
+func parseInfluxLine(line string, unit time.Duration, now time.Time) (InfluxPoint, error) {
+	sections := splitInfluxUnescaped(line, ' ')
+	if len(sections) < 2 || len(sections) > 3 {
+		return InfluxPoint{}, fmt.Errorf("expected measurement, fields and optional timestamp")
+	}
+
+	p := InfluxPoint{Tags: map[string]string{}, Fields: map[string]interface{}{}, Time: now}
+
+	key := splitInfluxUnescaped(sections[0], ',')
+	p.Measurement = unescapeInflux(key[0])
+	if p.Measurement == "" {
+		return p, fmt.Errorf("missing measurement")
+	}
+	for _, kv := range key[1:] {
+		parts := splitInfluxUnescaped(kv, '=')
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return p, fmt.Errorf("invalid tag %q", kv)
+		}
+		p.Tags[unescapeInflux(parts[0])] = unescapeInflux(parts[1])
+	}
+
+	for _, kv := range splitInfluxUnescaped(sections[1], ',') {
+		parts := splitInfluxUnescaped(kv, '=')
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return p, fmt.Errorf("invalid field %q", kv)
+		}
+		v, err := parseInfluxFieldValue(parts[1])
+		if err != nil {
+			return p, fmt.Errorf("field %s: %v", unescapeInflux(parts[0]), err)
+		}
+		p.Fields[unescapeInflux(parts[0])] = v
+	}
+
+	if len(sections) == 3 {
+		ts, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil || ts > math.MaxInt64/int64(unit) || ts < math.MinInt64/int64(unit) {
+			return p, fmt.Errorf("invalid timestamp %q", sections[2])
+		}
+		p.Time = time.Unix(0, ts*int64(unit)).UTC()
+	}
+	return p, nil
+}
+
+// splitInfluxUnescaped splits s on sep, ignoring backslash-escaped separators
+// and separators inside double-quoted field values.
+func splitInfluxUnescaped(s string, sep byte) []string {
+	var out []string
+	start, quoted := 0, false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				out = append(out, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(out, s[start:])
+}
+
+func unescapeInflux(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case ',', '=', ' ', '"', '\\':
+				i++
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// parseInfluxFieldValue parses a field value: float, integer (42i), unsigned
+// (42u), boolean or double-quoted string.
+func parseInfluxFieldValue(v string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(v, `"`):
+		if len(v) < 2 || !strings.HasSuffix(v, `"`) {
+			return nil, fmt.Errorf("unterminated string")
+		}
+		return unescapeInflux(v[1 : len(v)-1]), nil
+	case strings.HasSuffix(v, "i"):
+		return strconv.ParseInt(v[:len(v)-1], 10, 64)
+	case strings.HasSuffix(v, "u"):
+		return strconv.ParseUint(v[:len(v)-1], 10, 64)
+	}
+	switch v {
+	case "t", "T", "true", "True", "TRUE":
+		return true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", v)
+	}
+	return f, nil
+}
+
+// influxNumeric converts a field value to the float stored in metrics;
+// strings cannot be stored and report false.
+func influxNumeric(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, !math.IsNaN(t) && !math.IsInf(t, 0)
+	case int64:
+		return float64(t), true
+	case uint64:
+		return float64(t), true
+	case bool:
+		if t {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// IngestInfluxPoints stores line protocol points in the same metric storage
+// as the Telegraf JSON path. Each numeric field becomes a metric named
+// <measurement>_<field> (just <measurement> for a field called "value") with
+// the point's tags as labels. Points are mapped to a host by their host_id,
+// host/hostname or ip tags, falling back to the agent token's host; the rest
+// are kept as CustomMetric rows. Returns the number of values stored and
+// dropped.
+func IngestInfluxPoints(identity *IngestIdentity, points []InfluxPoint) (int, int, error) {
+	hostCache := make(map[string]int64)
+	var orphans []models.CustomMetric
+	stored, dropped := 0, 0
+
+	for _, p := range points {
+		hostID := resolveInfluxHost(identity, p.Tags, hostCache)
+		MarkHostSeen(hostID)
+		labels := make(map[string]string, len(p.Tags))
+		for k, v := range p.Tags {
+			if k != "host_id" {
+				labels[k] = v
+			}
+		}
+
+		for field, raw := range p.Fields {
+			value, ok := influxNumeric(raw)
+			if !ok {
+				dropped++
+				continue
+			}
+			name := p.Measurement + "_" + field
+			if field == "value" {
+				name = p.Measurement
+			}
+			name = truncate(name, 128)
+
+			if hostID == 0 {
+				lb, _ := json.Marshal(labels)
+				orphans = append(orphans, models.CustomMetric{
+					TenantID:  identity.TenantID,
+					Name:      name,
+					Type:      models.MetricTypeGauge,
+					Value:     value,
+					Labels:    string(lb),
+					Timestamp: p.Time,
+				})
+				stored++
+				continue
+			}
+
+			if err := CollectMetricAt(hostID, identity.TenantID, name, value, labels, p.Time); err != nil {
+				logging.Warnf("[INFLUX] failed to collect %s host=%d: %v", name, hostID, err)
+				dropped++
+				continue
+			}
+			stored++
+		}
+	}
+
+	if len(orphans) > 0 {
+		if err := postgres.DB.CreateInBatches(orphans, 500).Error; err != nil {
+			return stored - len(orphans), dropped + len(orphans), fmt.Errorf("store unmapped points: %w", err)
+		}
+	}
+	return stored, dropped, nil
+}
+
+// resolveInfluxHost maps point tags to a host of the tenant. An explicit
+// host_id tag wins; otherwise Telegraf's "host" tag (or hostname/ip) is
+// looked up like agent registrations are.
+func resolveInfluxHost(identity *IngestIdentity, tags map[string]string, cache map[string]int64) int64 {
+	if raw := tags["host_id"]; raw != "" {
+		key := "id:" + raw
+		if id, ok := cache[key]; ok {
+			return id
+		}
+		var id int64
+		if hid, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			if h, err := GetHostByID(hid, identity.TenantID); err == nil && h != nil && h.TenantID == identity.TenantID {
+				id = h.ID
+			}
+		}
+		cache[key] = id
+		if id != 0 {
+			return id
+		}
+	}
+
+	hostname := tags["host"]
+	if hostname == "" {
+		hostname = tags["hostname"]
+	}
+	ip := tags["ip"]
+	if hostname == "" && ip == "" {
+		return identity.HostID
+	}
+	if ip == "" && net.ParseIP(hostname) != nil {
+		hostname, ip = "", hostname
+	}
+
+	key := hostname + "|" + ip
+	if id, ok := cache[key]; ok {
+		return id
+	}
+	id := FindHostByIdentifiers(hostname, ip, identity.TenantID).ID
+	if id == 0 {
+		id = identity.HostID
+	}
+	cache[key] = id
+	return id
+}
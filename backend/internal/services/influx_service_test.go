@@ -0,0 +1,128 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseLineProtocol(t *testing.T) {
+	ts := time.Unix(0, 1700000000000000000).UTC()
+	tests := []struct {
+		line string
+		want InfluxPoint
+	}{
+		{
+			"cpu,host=web-1 usage=12.5 1700000000000000000",
+			InfluxPoint{"cpu", map[string]string{"host": "web-1"}, map[string]interface{}{"usage": 12.5}, ts},
+		},
+		{
+			`cpu\ load,host=my\ server,path=C:\\ value=1 1700000000000000000`,
+			InfluxPoint{"cpu load", map[string]string{"host": "my server", "path": `C:\`}, map[string]interface{}{"value": 1.0}, ts},
+		},
+		{
+			`disk\,io,dev\=name=sd\,a r\ w=3i 1700000000000000000`,
+			InfluxPoint{"disk,io", map[string]string{"dev=name": "sd,a"}, map[string]interface{}{"r w": int64(3)}, ts},
+		},
+		{
+			`app msg="hello, world = \"ok\"",n=-7i,u=42u 1700000000000000000`,
+			InfluxPoint{"app", map[string]string{}, map[string]interface{}{"msg": `hello, world = "ok"`, "n": int64(-7), "u": uint64(42)}, ts},
+		},
+		{
+			"flags a=t,b=TRUE,c=false,d=F,e=1e3 1700000000000000000",
+			InfluxPoint{"flags", map[string]string{}, map[string]interface{}{"a": true, "b": true, "c": false, "d": false, "e": 1000.0}, ts},
+		},
+	}
+	for _, tt := range tests {
+		points, lineErrs, err := ParseLineProtocol([]byte(tt.line), "")
+		if err != nil || len(lineErrs) > 0 {
+			t.Errorf("ParseLineProtocol(%q): %v %v", tt.line, err, lineErrs)
+			continue
+		}
+		if len(points) != 1 || !reflect.DeepEqual(points[0], tt.want) {
+			t.Errorf("ParseLineProtocol(%q) = %+v, want %+v", tt.line, points, tt.want)
+		}
+	}
+}
+
+func TestParseLineProtocolPrecision(t *testing.T) {
+	tests := []struct {
+		precision string
+		ts        string
+		want      time.Time
+	}{
+		{"", "1700000000", time.Unix(0, 1700000000)},
+		{"n", "1700000000", time.Unix(0, 1700000000)},
+		{"ns", "1700000000", time.Unix(0, 1700000000)},
+		{"u", "1700000000", time.UnixMicro(1700000000)},
+		{"us", "1700000000", time.UnixMicro(1700000000)},
+		{"µs", "1700000000", time.UnixMicro(1700000000)},
+		{"ms", "1700000000", time.UnixMilli(1700000000)},
+		{"s", "1700000000", time.Unix(1700000000, 0)},
+		{"m", "28333333", time.Unix(28333333*60, 0)},
+		{"h", "472222", time.Unix(472222*3600, 0)},
+	}
+	for _, tt := range tests {
+		points, _, err := ParseLineProtocol([]byte("cpu value=1 "+tt.ts), tt.precision)
+		if err != nil || len(points) != 1 {
+			t.Errorf("precision %q: %v", tt.precision, err)
+			continue
+		}
+		if !points[0].Time.Equal(tt.want) {
+			t.Errorf("precision %q: time = %v, want %v", tt.precision, points[0].Time, tt.want.UTC())
+		}
+	}
+
+	if _, _, err := ParseLineProtocol([]byte("cpu value=1"), "d"); err == nil {
+		t.Errorf("precision %q: expected an error", "d")
+	}
+}
+
+func TestParseLineProtocolMalformed(t *testing.T) {
+	for _, line := range []string{
+		"cpu",
+		",host=a value=1",
+		"cpu,host value=1",
+		"cpu,host= value=1",
+		"cpu value",
+		"cpu value=",
+		"cpu =1",
+		"cpu value=abc",
+		`cpu value="open`,
+		"cpu value=1.5i",
+		"cpu value=-1u",
+		"cpu value=1 notatime",
+		"cpu value=1 1700000000 extra",
+		"cpu value=1 99999999999999999999",
+	} {
+		points, lineErrs, err := ParseLineProtocol([]byte(line), "")
+		if err != nil {
+			t.Errorf("ParseLineProtocol(%q): %v", line, err)
+			continue
+		}
+		if len(points) != 0 || len(lineErrs) != 1 {
+			t.Errorf("ParseLineProtocol(%q) = %+v, %v, want one line error", line, points, lineErrs)
+		}
+	}
+}
+
+func TestParseLineProtocolPartial(t *testing.T) {
+	body := "# comment\ncpu value=1 1\n\ncpu value=oops 2\nmem used=3i 3\n"
+	points, lineErrs, err := ParseLineProtocol([]byte(body), "s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 || points[0].Measurement != "cpu" || points[1].Measurement != "mem" {
+		t.Errorf("points = %+v, want cpu and mem", points)
+	}
+	if len(lineErrs) != 1 || lineErrs[0].Line != 4 {
+		t.Errorf("line errors = %v, want one error on line 4", lineErrs)
+	}
+}
+
+func TestParseLineProtocolTimestampOverflow(t *testing.T) {
+	_, lineErrs, err := ParseLineProtocol([]byte("cpu value=1 1700000000000"), "h")
+	if err != nil || len(lineErrs) != 1 {
+		t.Errorf("overflowing timestamp: %v %v, want one line error", err, lineErrs)
+	}
+}
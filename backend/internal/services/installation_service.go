@@ -1,6 +1,9 @@
 package services
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/sakkurohilla/kineticops/backend/internal/models"
 	"github.com/sakkurohilla/kineticops/backend/internal/repository/postgres"
 )
@@ -18,3 +21,41 @@ func ResolveUserFromInstallationToken(token string) (*models.InstallationToken,
 
 	return &installToken, nil
 }
+
+// IngestIdentity is the tenant (and, for per-agent tokens, the agent's host)
+// an ingest token resolves to. Receivers that accept third-party telemetry
+// (OTLP, Prometheus, syslog) use it to scope everything they write.
+type IngestIdentity struct {
+	TenantID int64
+	HostID   int64
+	AgentID  int
+}
+
+// ResolveIngestToken maps an ingest token to its owning tenant. Per-agent
+// tokens are tried first and resolve through the agent's host; unexpired
+// installation tokens carry the tenant directly.
+func ResolveIngestToken(token string) (*IngestIdentity, error) {
+	if token == "" {
+		return nil, fmt.Errorf("missing ingest token")
+	}
+
+	if agent, err := postgres.GetAgentByToken(token); err == nil && agent != nil {
+		if agent.Revoked {
+			return nil, fmt.Errorf("agent token revoked")
+		}
+		host, herr := postgres.GetHost(postgres.DB, int64(agent.HostID))
+		if herr != nil || host == nil {
+			return nil, fmt.Errorf("agent host not found")
+		}
+		return &IngestIdentity{TenantID: host.TenantID, HostID: host.ID, AgentID: agent.ID}, nil
+	}
+
+	installToken, err := ResolveUserFromInstallationToken(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ingest token")
+	}
+	if time.Now().After(installToken.ExpiresAt) {
+		return nil, fmt.Errorf("ingest token expired")
+	}
+	return &IngestIdentity{TenantID: int64(installToken.TenantID)}, nil
+}
@@ -0,0 +1,627 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/logquery"
+	"github.com/sakkurohilla/kineticops/backend/internal/models"
+	"github.com/sakkurohilla/kineticops/backend/internal/repository/postgres"
+)
+
+// Log-derived metrics. Tenants define rules (models.LogMetricRule) that are
+// evaluated against every log as it is ingested. Matching lines are
+// aggregated per rule, host and group-by values over one-minute windows of
+// the log timestamp; when a window closes each series is written as a metric
+// sample stamped with the window start, so a counter sample is "matching
+// lines per minute". Distributions are written as <name>_count, _sum, _min,
+// _max, _avg, _p50, _p95 and _p99. Group-by values become labels
+// (label.<field> in KQL). Logs without a host are kept as CustomMetric rows
+// instead.
+//
+// Windows close logMetricGrace after they end; logs arriving later are
+// dropped. Series that matched within logMetricIdle are written as zero
+// (_count and _sum for distributions) for windows without matches, so a
+// quiet counter reads 0 rather than disappearing.
+
+const (
+	logMetricWindow      = time.Minute
+	logMetricGrace       = time.Minute      // lateness accepted before a window closes
+	logMetricIdle        = 15 * time.Minute // zero-fill series that matched within this
+	logMetricRuleTTL     = 30 * time.Second
+	maxLogMetricRules    = 50
+	maxLogMetricGroupBy  = 5
+	maxLogMetricSeries   = 500  // per rule and window; further groups fold into "other"
+	logMetricReservoir   = 1000 // distribution values kept per series for percentiles
+	maxLogMetricLabelLen = 128
+)
+
+var logMetricNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.:]*$`)
+
+// ErrLogMetricRuleExists is returned when a tenant already has a rule with
+// the same metric name.
+var ErrLogMetricRuleExists = errors.New("a log metric rule with this name already exists")
+
+// LogMetricRuleError reports an invalid rule definition.
+type LogMetricRuleError struct {
+	Msg string
+}
+
+func (e *LogMetricRuleError) Error() string { return e.Msg }
+
+type compiledLogMetric struct {
+	rule    models.LogMetricRule
+	matcher *logquery.Matcher
+	pattern *regexp.Regexp
+	groupBy []string
+}
+
+type tenantLogMetrics struct {
+	loadedAt time.Time
+	rules    []*compiledLogMetric
+}
+
+type logMetricKey struct {
+	ruleID int64
+	hostID int64
+	labels string
+}
+
+// logMetricWindowState holds the series of one open window.
+type logMetricWindowState struct {
+	series  map[logMetricKey]*logMetricSeries
+	perRule map[int64]int
+}
+
+// knownLogMetric is a series that matched recently, between the windows
+// first and last.
+type knownLogMetric struct {
+	series      *logMetricSeries
+	first, last time.Time
+}
+
+// logMetricBatch is the series of a closed window.
+type logMetricBatch struct {
+	window time.Time
+	series []*logMetricSeries
+}
+
+type logMetricSeries struct {
+	tenantID int64
+	hostID   int64
+	name     string
+	kind     string
+	labels   map[string]string
+	count    int64
+	sum      float64
+	min      float64
+	max      float64
+	samples  []float64
+}
+
+type LogMetricService struct {
+	rulesMu sync.RWMutex
+	rules   map[int64]*tenantLogMetrics
+
+	mu      sync.Mutex
+	running bool
+	next    time.Time // start of the oldest window not yet closed
+	windows map[time.Time]*logMetricWindowState
+	known   map[logMetricKey]*knownLogMetric
+	late    int64 // logs dropped since the last close
+}
+
+var LogMetricSvc = &LogMetricService{
+	rules:   map[int64]*tenantLogMetrics{},
+	windows: map[time.Time]*logMetricWindowState{},
+	known:   map[logMetricKey]*knownLogMetric{},
+}
+
+// Start enables rule evaluation and closes windows once they end, also when
+// no further logs arrive.
+func (s *LogMetricService) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.running = true
+	s.next = time.Now().Truncate(logMetricWindow)
+	s.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				s.mu.Lock()
+				batches := s.rotateLocked(time.Time{})
+				s.running = false
+				s.mu.Unlock()
+				s.emit(batches)
+				return
+			case now := <-ticker.C:
+				s.mu.Lock()
+				batches := s.rotateLocked(now)
+				s.mu.Unlock()
+				s.emit(batches)
+			}
+		}
+	}()
+}
+
+// Observe evaluates the tenant's rules against a stored log.
+func (s *LogMetricService) Observe(l *models.Log) {
+	s.mu.Lock()
+	running := s.running
+	s.mu.Unlock()
+	if !running || l.TenantID == 0 {
+		return
+	}
+
+	for _, r := range s.tenantRules(l.TenantID) {
+		if !r.matcher.Match(l) {
+			continue
+		}
+		value := 1.0
+		if r.rule.Type == models.LogMetricDistribution || r.rule.ValueField != "" || r.pattern != nil {
+			v, ok := r.extract(l)
+			if !ok {
+				continue
+			}
+			value = v
+		}
+		labels := make(map[string]string, len(r.groupBy))
+		for _, f := range r.groupBy {
+			if v, ok := logquery.FieldValue(f, l); ok && v != "" {
+				labels[strings.TrimPrefix(f, "meta.")] = truncate(v, maxLogMetricLabelLen)
+			}
+		}
+		s.add(r, l.HostID, labels, value, l.Timestamp)
+	}
+}
+
+// extract reads the rule's numeric value from the log: value_field (the
+// message by default), narrowed by the first group of value_pattern.
+func (r *compiledLogMetric) extract(l *models.Log) (float64, bool) {
+	field := r.rule.ValueField
+	if field == "" {
+		field = "message"
+	}
+	raw, ok := logquery.FieldValue(field, l)
+	if !ok {
+		return 0, false
+	}
+	if r.pattern != nil {
+		m := r.pattern.FindStringSubmatch(raw)
+		if m == nil {
+			return 0, false
+		}
+		raw = m[1]
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+// add counts a value in the window of the log timestamp ts. Logs from the
+// future count toward the current window.
+func (s *LogMetricService) add(r *compiledLogMetric, hostID int64, labels map[string]string, value float64, ts time.Time) {
+	s.mu.Lock()
+	now := time.Now()
+	batches := s.rotateLocked(now)
+
+	window := ts.Truncate(logMetricWindow)
+	if current := now.Truncate(logMetricWindow); ts.IsZero() || window.After(current) {
+		window = current
+	}
+	if window.Before(s.next) {
+		s.late++
+		s.mu.Unlock()
+		if len(batches) > 0 {
+			go s.emit(batches)
+		}
+		return
+	}
+	ws := s.windows[window]
+	if ws == nil {
+		ws = &logMetricWindowState{series: map[logMetricKey]*logMetricSeries{}, perRule: map[int64]int{}}
+		s.windows[window] = ws
+	}
+
+	lb, _ := json.Marshal(labels)
+	key := logMetricKey{ruleID: r.rule.ID, hostID: hostID, labels: string(lb)}
+	se := ws.series[key]
+	if se == nil {
+		if ws.perRule[r.rule.ID] >= maxLogMetricSeries && len(labels) > 0 {
+			// bound cardinality: fold the remaining groups into one series
+			for k := range labels {
+				labels[k] = "other"
+			}
+			lb, _ = json.Marshal(labels)
+			key.labels = string(lb)
+			se = ws.series[key]
+		}
+		if se == nil {
+			se = &logMetricSeries{
+				tenantID: r.rule.TenantID,
+				hostID:   hostID,
+				name:     r.rule.Name,
+				kind:     r.rule.Type,
+				labels:   labels,
+				min:      value,
+				max:      value,
+			}
+			ws.series[key] = se
+			ws.perRule[r.rule.ID]++
+		}
+	}
+	if k := s.known[key]; k == nil {
+		s.known[key] = &knownLogMetric{series: se, first: window, last: window}
+	} else if window.After(k.last) {
+		k.last = window
+	}
+	se.count++
+	se.sum += value
+	se.min = math.Min(se.min, value)
+	se.max = math.Max(se.max, value)
+	if se.kind == models.LogMetricDistribution {
+		if len(se.samples) < logMetricReservoir {
+			se.samples = append(se.samples, value)
+		} else if i := rand.Int63n(se.count); i < logMetricReservoir {
+			se.samples[i] = value
+		}
+	}
+	s.mu.Unlock()
+
+	if len(batches) > 0 {
+		go s.emit(batches)
+	}
+}
+
+// rotateLocked closes the windows that ended logMetricGrace before now, or
+// every open window when now is zero, and returns their series including
+// zeros for known series without matches. Callers hold s.mu.
+func (s *LogMetricService) rotateLocked(now time.Time) []logMetricBatch {
+	until := now.Add(-logMetricWindow - logMetricGrace)
+	if now.IsZero() {
+		until = s.next
+		for w := range s.windows {
+			if w.After(until) {
+				until = w
+			}
+		}
+	}
+	if s.late > 0 && !s.next.After(until) {
+		logging.Warnf("[LOG METRICS] dropped %d logs older than the open windows", s.late)
+		s.late = 0
+	}
+
+	var batches []logMetricBatch
+	for ; !s.next.After(until); s.next = s.next.Add(logMetricWindow) {
+		window := s.next
+		ws := s.windows[window]
+		delete(s.windows, window)
+
+		var batch []*logMetricSeries
+		if ws != nil {
+			for _, se := range ws.series {
+				batch = append(batch, se)
+			}
+		}
+		for key, k := range s.known {
+			if window.Sub(k.last) > logMetricIdle {
+				delete(s.known, key)
+				continue
+			}
+			if _, ok := ws.lookup(key); ok || window.Before(k.first) {
+				continue
+			}
+			batch = append(batch, k.series.zero())
+		}
+		if len(batch) > 0 {
+			batches = append(batches, logMetricBatch{window: window, series: batch})
+		}
+	}
+	return batches
+}
+
+func (ws *logMetricWindowState) lookup(key logMetricKey) (*logMetricSeries, bool) {
+	if ws == nil {
+		return nil, false
+	}
+	se, ok := ws.series[key]
+	return se, ok
+}
+
+// emit writes the series of closed windows.
+func (s *LogMetricService) emit(batches []logMetricBatch) {
+	for _, b := range batches {
+		s.emitWindow(b.window, b.series)
+	}
+}
+
+func (s *LogMetricService) emitWindow(window time.Time, batch []*logMetricSeries) {
+	var orphans []models.CustomMetric
+	for _, se := range batch {
+		if se.hostID == 0 {
+			orphans = append(orphans, se.customMetric(window))
+			continue
+		}
+		for name, v := range se.values() {
+			if err := CollectMetricAt(se.hostID, se.tenantID, name, v, se.labels, window); err != nil {
+				logging.Warnf("[LOG METRICS] failed to collect %s host=%d: %v", name, se.hostID, err)
+			}
+		}
+	}
+	if len(orphans) > 0 {
+		if err := postgres.DB.CreateInBatches(orphans, 500).Error; err != nil {
+			logging.Warnf("[LOG METRICS] failed to store %d host-less series: %v", len(orphans), err)
+		}
+	}
+}
+
+// zero returns an empty series with the identity of se.
+func (se *logMetricSeries) zero() *logMetricSeries {
+	return &logMetricSeries{tenantID: se.tenantID, hostID: se.hostID, name: se.name, kind: se.kind, labels: se.labels}
+}
+
+// values returns the samples to write for a series, keyed by metric name.
+func (se *logMetricSeries) values() map[string]float64 {
+	if se.kind != models.LogMetricDistribution {
+		return map[string]float64{se.name: se.sum}
+	}
+	if se.count == 0 {
+		return map[string]float64{se.name + "_count": 0, se.name + "_sum": 0}
+	}
+	p50, p95, p99 := se.percentiles()
+	return map[string]float64{
+		se.name + "_count": float64(se.count),
+		se.name + "_sum":   se.sum,
+		se.name + "_min":   se.min,
+		se.name + "_max":   se.max,
+		se.name + "_avg":   se.sum / float64(se.count),
+		se.name + "_p50":   p50,
+		se.name + "_p95":   p95,
+		se.name + "_p99":   p99,
+	}
+}
+
+func (se *logMetricSeries) percentiles() (float64, float64, float64) {
+	sort.Float64s(se.samples)
+	rank := func(p float64) float64 {
+		if len(se.samples) == 0 {
+			return 0
+		}
+		i := int(math.Ceil(p*float64(len(se.samples)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return se.samples[i]
+	}
+	return rank(0.50), rank(0.95), rank(0.99)
+}
+
+func (se *logMetricSeries) customMetric(window time.Time) models.CustomMetric {
+	lb, _ := json.Marshal(se.labels)
+	m := models.CustomMetric{
+		TenantID:  se.tenantID,
+		Name:      se.name,
+		Type:      models.MetricTypeCounter,
+		Value:     se.sum,
+		Labels:    string(lb),
+		Timestamp: window,
+	}
+	if se.kind == models.LogMetricDistribution {
+		m.Type = models.MetricTypeSummary
+		if se.count > 0 {
+			m.Value = se.sum / float64(se.count)
+		}
+		m.Count = se.count
+		m.Sum = se.sum
+		m.Min = se.min
+		m.Max = se.max
+		m.P50, m.P95, m.P99 = se.percentiles()
+	}
+	return m
+}
+
+// tenantRules returns the tenant's enabled rules, reloading them when the
+// cached set is older than logMetricRuleTTL.
+func (s *LogMetricService) tenantRules(tenantID int64) []*compiledLogMetric {
+	s.rulesMu.RLock()
+	cached := s.rules[tenantID]
+	s.rulesMu.RUnlock()
+	if cached != nil && time.Since(cached.loadedAt) < logMetricRuleTTL {
+		return cached.rules
+	}
+
+	var rules []models.LogMetricRule
+	if err := postgres.DB.Where("tenant_id = ? AND enabled = ?", tenantID, true).Find(&rules).Error; err != nil {
+		logging.Warnf("[LOG METRICS] failed to load rules for tenant=%d: %v", tenantID, err)
+		if cached != nil {
+			return cached.rules
+		}
+		rules = nil
+	}
+	compiled := make([]*compiledLogMetric, 0, len(rules))
+	for i := range rules {
+		r, err := compileLogMetricRule(&rules[i])
+		if err != nil {
+			logging.Warnf("[LOG METRICS] skipping rule %d of tenant=%d: %v", rules[i].ID, tenantID, err)
+			continue
+		}
+		compiled = append(compiled, r)
+	}
+
+	s.rulesMu.Lock()
+	s.rules[tenantID] = &tenantLogMetrics{loadedAt: time.Now(), rules: compiled}
+	s.rulesMu.Unlock()
+	return compiled
+}
+
+// invalidate drops the cached rules of a tenant after they changed, and
+// stops zero-filling its series until they match again.
+func (s *LogMetricService) invalidate(tenantID int64) {
+	s.rulesMu.Lock()
+	delete(s.rules, tenantID)
+	s.rulesMu.Unlock()
+
+	s.mu.Lock()
+	for key, k := range s.known {
+		if k.series.tenantID == tenantID {
+			delete(s.known, key)
+		}
+	}
+	s.mu.Unlock()
+}
+
+// ValidateLogMetricRule normalizes a rule definition and checks its query,
+// value extraction and group-by fields.
+func ValidateLogMetricRule(rule *models.LogMetricRule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	rule.Type = strings.ToLower(strings.TrimSpace(rule.Type))
+	rule.ValueField = strings.TrimSpace(rule.ValueField)
+	if rule.Type == "" {
+		rule.Type = models.LogMetricCounter
+	}
+
+	var fields []string
+	for _, f := range strings.Split(rule.GroupBy, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	rule.GroupBy = strings.Join(fields, ",")
+
+	_, err := compileLogMetricRule(rule)
+	return err
+}
+
+func compileLogMetricRule(rule *models.LogMetricRule) (*compiledLogMetric, error) {
+	if len(rule.Name) > 128 || !logMetricNamePattern.MatchString(rule.Name) {
+		return nil, &LogMetricRuleError{Msg: "name must be a metric name (letters, digits, _ . :)"}
+	}
+	if rule.Type != models.LogMetricCounter && rule.Type != models.LogMetricDistribution {
+		return nil, &LogMetricRuleError{Msg: "type must be counter or distribution"}
+	}
+
+	node, err := logquery.Parse(rule.Query)
+	if err != nil {
+		return nil, &LogMetricRuleError{Msg: "query: " + err.Error()}
+	}
+	matcher, err := logquery.NewMatcher(node)
+	if err != nil {
+		return nil, &LogMetricRuleError{Msg: "query: " + err.Error()}
+	}
+	r := &compiledLogMetric{rule: *rule, matcher: matcher}
+
+	if rule.ValueField != "" {
+		if path, err := logquery.ResolveField(rule.ValueField); err != nil || path == "timestamp" {
+			return nil, &LogMetricRuleError{Msg: fmt.Sprintf("invalid value_field %q", rule.ValueField)}
+		}
+	}
+	if rule.ValuePattern != "" {
+		re, err := regexp.Compile(rule.ValuePattern)
+		if err != nil {
+			return nil, &LogMetricRuleError{Msg: "value_pattern: " + err.Error()}
+		}
+		if re.NumSubexp() < 1 {
+			return nil, &LogMetricRuleError{Msg: "value_pattern needs a capture group for the value"}
+		}
+		r.pattern = re
+	}
+	if rule.Type == models.LogMetricDistribution && rule.ValueField == "" && r.pattern == nil {
+		return nil, &LogMetricRuleError{Msg: "distribution needs value_field or value_pattern"}
+	}
+
+	if rule.GroupBy != "" {
+		r.groupBy = strings.Split(rule.GroupBy, ",")
+	}
+	if len(r.groupBy) > maxLogMetricGroupBy {
+		return nil, &LogMetricRuleError{Msg: fmt.Sprintf("too many group_by fields (max %d)", maxLogMetricGroupBy)}
+	}
+	for _, f := range r.groupBy {
+		path, err := logquery.ResolveField(f)
+		if err != nil {
+			return nil, &LogMetricRuleError{Msg: err.Error()}
+		}
+		switch path {
+		case "timestamp", "message", "host_id", "correlation_id":
+			return nil, &LogMetricRuleError{Msg: fmt.Sprintf("cannot group by %q", f)}
+		}
+	}
+	return r, nil
+}
+
+func ListLogMetricRules(tenantID int64) ([]models.LogMetricRule, error) {
+	var rules []models.LogMetricRule
+	err := postgres.DB.Where("tenant_id = ?", tenantID).Order("name").Find(&rules).Error
+	return rules, err
+}
+
+func GetLogMetricRule(id, tenantID int64) (*models.LogMetricRule, error) {
+	var rule models.LogMetricRule
+	if err := postgres.DB.Where("id = ? AND tenant_id = ?", id, tenantID).First(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// CreateLogMetricRule stores a validated rule; names are unique per tenant.
+func CreateLogMetricRule(rule *models.LogMetricRule) error {
+	var existing []models.LogMetricRule
+	if err := postgres.DB.Select("id", "name").Where("tenant_id = ?", rule.TenantID).Find(&existing).Error; err != nil {
+		return err
+	}
+	if len(existing) >= maxLogMetricRules {
+		return &LogMetricRuleError{Msg: fmt.Sprintf("too many log metric rules (max %d)", maxLogMetricRules)}
+	}
+	for _, e := range existing {
+		if e.Name == rule.Name {
+			return ErrLogMetricRuleExists
+		}
+	}
+	if err := postgres.DB.Create(rule).Error; err != nil {
+		return err
+	}
+	LogMetricSvc.invalidate(rule.TenantID)
+	return nil
+}
+
+// UpdateLogMetricRule saves a validated rule that belongs to its tenant.
+func UpdateLogMetricRule(rule *models.LogMetricRule) error {
+	var clash int64
+	if err := postgres.DB.Model(&models.LogMetricRule{}).
+		Where("tenant_id = ? AND name = ? AND id <> ?", rule.TenantID, rule.Name, rule.ID).
+		Count(&clash).Error; err != nil {
+		return err
+	}
+	if clash > 0 {
+		return ErrLogMetricRuleExists
+	}
+	if err := postgres.DB.Save(rule).Error; err != nil {
+		return err
+	}
+	LogMetricSvc.invalidate(rule.TenantID)
+	return nil
+}
+
+func DeleteLogMetricRule(id, tenantID int64) error {
+	res := postgres.DB.Where("id = ? AND tenant_id = ?", id, tenantID).Delete(&models.LogMetricRule{})
+	if res.Error != nil {
+		return res.Error
+	}
+	LogMetricSvc.invalidate(tenantID)
+	return nil
+}
@@ -0,0 +1,344 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/logpattern"
+	"github.com/sakkurohilla/kineticops/backend/internal/logquery"
+	"github.com/sakkurohilla/kineticops/backend/internal/models"
+	"github.com/sakkurohilla/kineticops/backend/internal/repository/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Log patterns. Incoming messages are clustered into templates (see package
+// logpattern) per tenant and service, and each stored log carries the id of
+// its template as pattern_id, so pattern_id:<id> works in log queries.
+// Templates and their counts are persisted to the log_patterns collection in
+// the background and reloaded on start, keeping ids stable across restarts.
+// A pattern is new when it was first seen within the window and spiking when
+// its rate in the window is patternSpikeFactor times its baseline rate.
+
+const (
+	patternFlushInterval = 30 * time.Second
+	patternReloadWindow  = 30 * 24 * time.Hour
+	maxPatternStreams    = 10000
+	patternSpikeFactor   = 5.0
+	patternSpikeMinCount = 10
+	maxPatternCandidates = 1000
+)
+
+type patternKey struct {
+	tenantID int64
+	service  string
+}
+
+// patternStream is the Drain of one tenant and service plus the counts not
+// yet persisted.
+type patternStream struct {
+	mu      sync.Mutex
+	drain   *logpattern.Drain
+	pending map[string]*models.LogPattern
+}
+
+// LogPatternSignal describes one pattern over a window compared with its
+// baseline.
+type LogPatternSignal struct {
+	PatternID     string    `json:"pattern_id"`
+	Service       string    `json:"service"`
+	Template      string    `json:"template"`
+	Count         int64     `json:"count"`
+	BaselineCount int64     `json:"baseline_count"`
+	Rate          float64   `json:"rate"`          // per minute in the window
+	BaselineRate  float64   `json:"baseline_rate"` // per minute in the baseline
+	FirstSeen     time.Time `json:"first_seen"`
+	New           bool      `json:"new"`
+	Spiking       bool      `json:"spiking"`
+}
+
+type LogPatternService struct {
+	mu      sync.RWMutex
+	streams map[patternKey]*patternStream
+	running bool
+}
+
+var LogPatternSvc = &LogPatternService{streams: map[patternKey]*patternStream{}}
+
+// Start reloads known patterns, then enables clustering and persists
+// pattern counts periodically. It needs the log_patterns collection.
+func (s *LogPatternService) Start(ctx context.Context) {
+	if models.LogPatternCollection == nil {
+		return
+	}
+	go func() {
+		loadCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		known, err := mongodb.LoadLogPatterns(loadCtx, time.Now().Add(-patternReloadWindow))
+		cancel()
+		if err != nil {
+			logging.Warnf("[LOG PATTERNS] failed to reload patterns, starting empty: %v", err)
+		}
+		s.mu.Lock()
+		for _, p := range known {
+			s.streamLocked(patternKey{tenantID: p.TenantID, service: p.Service}).drain.Load(p.ID, p.Template)
+		}
+		s.running = true
+		s.mu.Unlock()
+		logging.Infof("[LOG PATTERNS] clustering enabled with %d known patterns", len(known))
+
+		ticker := time.NewTicker(patternFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				s.flush()
+				return
+			case <-ticker.C:
+				s.flush()
+			}
+		}
+	}()
+}
+
+// Assign clusters the message of a log about to be stored and sets its
+// PatternID.
+func (s *LogPatternService) Assign(l *models.Log) {
+	if l.TenantID == 0 || strings.TrimSpace(l.Message) == "" {
+		return
+	}
+	key := patternKey{tenantID: l.TenantID, service: l.Meta["service"]}
+
+	s.mu.RLock()
+	running, st := s.running, s.streams[key]
+	s.mu.RUnlock()
+	if !running {
+		return
+	}
+	if st == nil {
+		s.mu.Lock()
+		if len(s.streams) < maxPatternStreams {
+			st = s.streamLocked(key)
+		} else {
+			st = s.streams[key]
+		}
+		s.mu.Unlock()
+		if st == nil {
+			return
+		}
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	c, _, changed := st.drain.Add(l.Message)
+	if c == nil {
+		return
+	}
+	l.PatternID = c.ID
+
+	now := time.Now()
+	p := st.pending[c.ID]
+	if p == nil {
+		p = &models.LogPattern{ID: c.ID, TenantID: key.tenantID, Service: key.service, Template: c.String(), FirstSeen: now}
+		st.pending[c.ID] = p
+	} else if changed {
+		p.Template = c.String()
+	}
+	p.Count++
+	p.LastSeen = now
+}
+
+// streamLocked returns the stream for key, creating it. Callers hold s.mu.
+func (s *LogPatternService) streamLocked(key patternKey) *patternStream {
+	st := s.streams[key]
+	if st == nil {
+		st = &patternStream{
+			drain:   logpattern.New(logpattern.DefaultConfig, patternIDFunc(key)),
+			pending: map[string]*models.LogPattern{},
+		}
+		s.streams[key] = st
+	}
+	return st
+}
+
+// patternIDFunc derives pattern ids from the tenant, service and the
+// template a pattern was created with.
+func patternIDFunc(key patternKey) func([]string) string {
+	return func(template []string) string {
+		h := fnv.New64a()
+		h.Write([]byte(strconv.FormatInt(key.tenantID, 10) + "\x00" + key.service + "\x00" + strings.Join(template, " ")))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+}
+
+// flush persists pending pattern counts.
+func (s *LogPatternService) flush() {
+	s.mu.RLock()
+	streams := make([]*patternStream, 0, len(s.streams))
+	for _, st := range s.streams {
+		streams = append(streams, st)
+	}
+	s.mu.RUnlock()
+
+	var batch []models.LogPattern
+	for _, st := range streams {
+		st.mu.Lock()
+		for id, p := range st.pending {
+			batch = append(batch, *p)
+			delete(st.pending, id)
+		}
+		st.mu.Unlock()
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := mongodb.UpsertLogPatterns(ctx, batch); err != nil {
+		logging.Warnf("[LOG PATTERNS] failed to persist %d patterns: %v", len(batch), err)
+	}
+}
+
+// pendingPattern returns a pattern that is not persisted yet.
+func (s *LogPatternService) pendingPattern(tenantID int64, id string) (models.LogPattern, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for key, st := range s.streams {
+		if key.tenantID != tenantID {
+			continue
+		}
+		st.mu.Lock()
+		p, ok := st.pending[id]
+		var out models.LogPattern
+		if ok {
+			out = *p
+		}
+		st.mu.Unlock()
+		if ok {
+			return out, true
+		}
+	}
+	return models.LogPattern{}, false
+}
+
+// Signals returns the patterns of logs matching filter in the window ending
+// now, most frequent first, flagged as new or spiking against the baseline
+// period before the window.
+func (s *LogPatternService) Signals(ctx context.Context, tenantID int64, filter bson.M, window, baseline time.Duration, limit int) ([]LogPatternSignal, error) {
+	end := time.Now()
+	windowStart := end.Add(-window)
+	counts, err := mongodb.LogPatternCounts(ctx, tenantID, filter, windowStart.Add(-baseline), windowStart, end, limit)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(counts))
+	for i, c := range counts {
+		ids[i] = c.PatternID
+	}
+	known, err := mongodb.GetLogPatterns(ctx, tenantID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]LogPatternSignal, 0, len(counts))
+	for _, c := range counts {
+		p, ok := known[c.PatternID]
+		if !ok {
+			if p, ok = s.pendingPattern(tenantID, c.PatternID); !ok {
+				p = models.LogPattern{ID: c.PatternID}
+			}
+		}
+		sig := LogPatternSignal{
+			PatternID:     c.PatternID,
+			Service:       p.Service,
+			Template:      p.Template,
+			Count:         c.Recent,
+			BaselineCount: c.Baseline,
+			Rate:          float64(c.Recent) / window.Minutes(),
+			BaselineRate:  float64(c.Baseline) / baseline.Minutes(),
+			FirstSeen:     p.FirstSeen,
+		}
+		sig.New = !p.FirstSeen.IsZero() && !p.FirstSeen.Before(windowStart)
+		sig.Spiking = !sig.New && c.Recent >= patternSpikeMinCount && sig.Rate >= patternSpikeFactor*sig.BaselineRate
+		out = append(out, sig)
+	}
+	return out, nil
+}
+
+// CountPatternSignals counts the new (or spiking) patterns of logs matching
+// a log query over the last window against a baseline, for alert
+// conditions.
+func (s *LogPatternService) CountPatternSignals(ctx context.Context, tenantID int64, q string, spiking bool, window, baseline time.Duration) (int, error) {
+	filter, err := logquery.CompileString(q, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	signals, err := s.Signals(ctx, tenantID, filter, window, baseline, maxPatternCandidates)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, sig := range signals {
+		if (spiking && sig.Spiking) || (!spiking && sig.New) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// PatternHistogram returns the counts over time of the top patterns of logs
+// matching filter.
+func (s *LogPatternService) PatternHistogram(ctx context.Context, tenantID int64, filter bson.M, start, end time.Time, interval time.Duration, limit int) ([]LogPatternSeries, error) {
+	top, err := mongodb.TopLogValues(ctx, tenantID, bson.M{"$and": bson.A{filter, bson.M{"pattern_id": bson.M{"$gt": ""}}}}, "pattern_id", start, end, limit)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(top))
+	out := make([]LogPatternSeries, len(top))
+	series := make(map[string]*LogPatternSeries, len(top))
+	for i, t := range top {
+		ids[i] = t.Value
+		out[i] = LogPatternSeries{PatternID: t.Value, Count: t.Count, Buckets: []mongodb.LogPatternBucket{}}
+		series[t.Value] = &out[i]
+	}
+	if len(ids) == 0 {
+		return out, nil
+	}
+
+	known, err := mongodb.GetLogPatterns(ctx, tenantID, ids)
+	if err != nil {
+		return nil, err
+	}
+	buckets, err := mongodb.LogPatternHistogram(ctx, tenantID, filter, ids, start, end, interval)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range buckets {
+		if se := series[b.PatternID]; se != nil {
+			se.Buckets = append(se.Buckets, b)
+		}
+	}
+	for i := range out {
+		p, ok := known[out[i].PatternID]
+		if !ok {
+			p, _ = s.pendingPattern(tenantID, out[i].PatternID)
+		}
+		out[i].Service = p.Service
+		out[i].Template = p.Template
+	}
+	return out, nil
+}
+
+// LogPatternSeries is the count over time of one pattern.
+type LogPatternSeries struct {
+	PatternID string                     `json:"pattern_id"`
+	Service   string                     `json:"service"`
+	Template  string                     `json:"template"`
+	Count     int64                      `json:"count"`
+	Buckets   []mongodb.LogPatternBucket `json:"buckets"`
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/logpattern"
+	"github.com/sakkurohilla/kineticops/backend/internal/models"
+)
+
+func TestPatternIDFunc(t *testing.T) {
+	template := []string{"user", logpattern.Wildcard, "logged", "in"}
+	id := patternIDFunc(patternKey{tenantID: 1, service: "api"})(template)
+	if again := patternIDFunc(patternKey{tenantID: 1, service: "api"})(template); again != id {
+		t.Errorf("id changed between calls: %s, %s", id, again)
+	}
+	for _, key := range []patternKey{{tenantID: 2, service: "api"}, {tenantID: 1, service: "web"}, {tenantID: 1}} {
+		if other := patternIDFunc(key)(template); other == id {
+			t.Errorf("key %+v shares id %s with tenant 1/api", key, id)
+		}
+	}
+	if other := patternIDFunc(patternKey{tenantID: 1, service: "api"})(template[:3]); other == id {
+		t.Errorf("other template shares id %s", id)
+	}
+}
+
+// TestAssignReusesLoadedID checks that a template reloaded after a restart
+// keeps its stored id, even when it no longer hashes to that id because it
+// was generalized after creation.
+func TestAssignReusesLoadedID(t *testing.T) {
+	key := patternKey{tenantID: 1, service: "api"}
+
+	before := logpattern.New(logpattern.DefaultConfig, patternIDFunc(key))
+	c, _, _ := before.Add("user alice logged in")
+	id := c.ID
+	before.Add("user bob logged in")
+	if c.String() != "user <*> logged in" {
+		t.Fatalf("template = %q", c.String())
+	}
+
+	s := &LogPatternService{streams: map[patternKey]*patternStream{}, running: true}
+	s.streamLocked(key).drain.Load(id, c.String())
+
+	l := &models.Log{TenantID: 1, Message: "user carol logged in", Meta: map[string]string{"service": "api"}}
+	s.Assign(l)
+	if l.PatternID != id {
+		t.Errorf("PatternID = %q, want the stored %q", l.PatternID, id)
+	}
+	if p, ok := s.pendingPattern(1, id); !ok || p.Template != "user <*> logged in" || p.Count != 1 {
+		t.Errorf("pending pattern = %+v, %v", p, ok)
+	}
+}
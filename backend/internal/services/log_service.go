@@ -5,8 +5,12 @@ import (
 	"strings"
 	"time"
 
+	"github.com/sakkurohilla/kineticops/backend/internal/logquery"
 	"github.com/sakkurohilla/kineticops/backend/internal/models"
 	"github.com/sakkurohilla/kineticops/backend/internal/repository/mongodb"
+	"github.com/sakkurohilla/kineticops/backend/internal/telemetry"
+	ws "github.com/sakkurohilla/kineticops/backend/internal/websocket"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 func ParseAndEnrichLog(log *models.Log) {
@@ -31,8 +35,22 @@ func formatMeta(meta map[string]string) string {
 
 func CollectLog(ctx context.Context, log *models.Log) error {
 	ParseAndEnrichLog(log)
+	// Tag the log with its message pattern
+	LogPatternSvc.Assign(log)
 	// Store logs in MongoDB by default (ES integration removed)
-	return mongodb.InsertLog(ctx, log)
+	if err := mongodb.InsertLog(ctx, log); err != nil {
+		return err
+	}
+	// Feed the tenant's log-derived metrics
+	LogMetricSvc.Observe(log)
+	return nil
+}
+
+// BroadcastLog pushes a stored log to the live-tail subscriptions of its
+// tenant (see websocket.PublishLog).
+func BroadcastLog(l *models.Log) {
+	ws.PublishLog(l)
+	telemetry.IncWSBroadcast(context.Background(), 1)
 }
 
 func SearchLogs(ctx context.Context, tenantID int64, filters map[string]interface{}, text string, limit int, skip int) ([]models.Log, error) {
@@ -57,3 +75,59 @@ func EnforceLogRetention(days int) error {
 func GetLogSources(ctx context.Context, tenantID int64) ([]string, []string, error) {
 	return mongodb.GetLogSources(ctx, tenantID)
 }
+
+// logHistogramSteps are the bucket sizes picked by LogHistogramInterval.
+var logHistogramSteps = []time.Duration{
+	10 * time.Second, 30 * time.Second, time.Minute, 5 * time.Minute, 15 * time.Minute,
+	30 * time.Minute, time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+// MaxLogHistogramBuckets bounds the number of buckets of a log histogram.
+const MaxLogHistogramBuckets = 1000
+
+// LogHistogramInterval picks a bucket size giving roughly 60 buckets over
+// the window. Windows too long for MaxLogHistogramBuckets daily buckets get
+// buckets of several days.
+func LogHistogramInterval(start, end time.Time) time.Duration {
+	target := end.Sub(start) / 60
+	for _, step := range logHistogramSteps {
+		if step >= target {
+			return step
+		}
+	}
+	day := logHistogramSteps[len(logHistogramSteps)-1]
+	if days := (end.Sub(start) + MaxLogHistogramBuckets*day - 1) / (MaxLogHistogramBuckets * day); days > 1 {
+		return time.Duration(days) * day
+	}
+	return day
+}
+
+// LogHistogram counts logs matching filter over time.
+func LogHistogram(ctx context.Context, tenantID int64, filter bson.M, start, end time.Time, interval time.Duration) ([]mongodb.LogHistogramBucket, error) {
+	return mongodb.LogHistogram(ctx, tenantID, filter, start, end, interval)
+}
+
+// TopLogValues returns the most frequent values of a log field.
+func TopLogValues(ctx context.Context, tenantID int64, filter bson.M, field string, start, end time.Time, limit int) ([]mongodb.LogFieldCount, error) {
+	return mongodb.TopLogValues(ctx, tenantID, filter, field, start, end, limit)
+}
+
+// LogErrorRates returns the error-level share of logs per value of field.
+func LogErrorRates(ctx context.Context, tenantID int64, filter bson.M, field string, start, end time.Time, limit int) ([]mongodb.LogErrorRate, error) {
+	return mongodb.LogErrorRates(ctx, tenantID, filter, field, start, end, limit)
+}
+
+// CountLogsMatching counts logs matching a log query over the last window,
+// for alert conditions.
+func CountLogsMatching(ctx context.Context, tenantID int64, q string, window time.Duration) (int64, error) {
+	now := time.Now()
+	filter, err := logquery.CompileString(q, now)
+	if err != nil {
+		return 0, err
+	}
+	filters := map[string]interface{}{
+		"timestamp": bson.M{"$gte": now.Add(-window), "$lte": now},
+		"$and":      bson.A{filter},
+	}
+	return mongodb.CountLogs(ctx, tenantID, filters, "")
+}
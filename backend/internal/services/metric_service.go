@@ -23,13 +23,19 @@ func ValidateMetricSchema(name string, val float64, labels string) error {
 }
 
 func CollectMetric(hostID, tenantID int64, name string, value float64, labels map[string]string) error {
+	return CollectMetricAt(hostID, tenantID, name, value, labels, time.Now())
+}
+
+// CollectMetricAt is CollectMetric for samples that carry their own timestamp
+// (remote_write, line protocol).
+func CollectMetricAt(hostID, tenantID int64, name string, value float64, labels map[string]string, ts time.Time) error {
 	lb, _ := json.Marshal(labels)
 	metric := &models.Metric{
 		HostID:    hostID,
 		TenantID:  tenantID,
 		Name:      name,
 		Value:     value,
-		Timestamp: time.Now(),
+		Timestamp: ts,
 		Labels:    string(lb),
 	}
 	// Try to enqueue metric into the batcher for bulk insert. If the batcher
@@ -55,6 +61,61 @@ func CollectMetric(hostID, tenantID int64, name string, value float64, labels ma
 	return nil
 }
 
+// MetricBuffer collects samples through Collect, which has the signature of
+// CollectMetricAt, and stores them synchronously with Flush. It serves
+// callers that must know the samples were stored, such as the ingest writer
+// which commits its offsets only afterwards.
+type MetricBuffer struct {
+	metrics []*models.Metric
+}
+
+func (b *MetricBuffer) Collect(hostID, tenantID int64, name string, value float64, labels map[string]string, ts time.Time) error {
+	lb, _ := json.Marshal(labels)
+	b.metrics = append(b.metrics, &models.Metric{
+		HostID:    hostID,
+		TenantID:  tenantID,
+		Name:      name,
+		Value:     value,
+		Timestamp: ts,
+		Labels:    string(lb),
+	})
+	return nil
+}
+
+// metricBufferChunk bounds the rows of one insert, keeping the statement
+// well below Postgres' limit of 65535 bind parameters.
+const metricBufferChunk = 1000
+
+// Len returns the number of samples waiting to be flushed.
+func (b *MetricBuffer) Len() int {
+	return len(b.metrics)
+}
+
+// Truncate discards the samples collected after the first n, e.g. those of
+// an event that failed and will be replayed.
+func (b *MetricBuffer) Truncate(n int) {
+	if n < len(b.metrics) {
+		b.metrics = b.metrics[:n]
+	}
+}
+
+// Flush inserts the collected samples with multi-row statements. Samples
+// are removed from the buffer as their statement succeeds, so after an error
+// Flush can be called again without writing anything twice.
+func (b *MetricBuffer) Flush() error {
+	for len(b.metrics) > 0 {
+		n := min(len(b.metrics), metricBufferChunk)
+		if err := postgres.SaveMetricsBatch(postgres.DB, b.metrics[:n]); err != nil {
+			telemetry.IncCollectionError(context.Background(), int64(n))
+			return err
+		}
+		telemetry.IncCollectionSuccess(context.Background(), int64(n))
+		b.metrics = b.metrics[n:]
+	}
+	b.metrics = nil
+	return nil
+}
+
 // metricBatcherSingleton provides a background goroutine that batches metrics.
 var metricBatcher *metricBatcherSingleton
 
@@ -101,6 +162,17 @@ func GetMetricBatcherQueueLength() int {
 	return len(metricBatcher.metricsChan)
 }
 
+// MetricBatcherSaturated reports whether the batcher queue is at least 90%
+// full. Ingest endpoints then push back instead of letting the queue fill up
+// and degrade to direct per-sample inserts.
+func MetricBatcherSaturated() bool {
+	mb := metricBatcher
+	if mb == nil {
+		return false
+	}
+	return len(mb.metricsChan) >= cap(mb.metricsChan)*9/10
+}
+
 // GetMetricBatcherStatus returns queue length and last flush timestamp (UTC) for health checks.
 func GetMetricBatcherStatus() (int, string) {
 	if metricBatcher == nil {
@@ -145,13 +217,6 @@ func (m *metricBatcherSingleton) run() {
 			m.lastFlushMu.Lock()
 			m.lastFlushAt = time.Now().UTC()
 			m.lastFlushMu.Unlock()
-			// Trigger alert evaluation asynchronously per metric
-			go func(batch []*models.Metric) {
-				for _, m := range batch {
-					// best-effort alert checking; errors are ignored here
-					_ = CheckAndTriggerAlerts(m.TenantID, m.Name, m.HostID, m.Value)
-				}
-			}(append([]*models.Metric(nil), buffer...))
 		}
 		buffer = buffer[:0]
 	}
@@ -0,0 +1,667 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/models"
+	"github.com/sakkurohilla/kineticops/backend/internal/repository/postgres"
+	"github.com/sakkurohilla/kineticops/backend/internal/telemetry"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// apdexThresholdMs is the satisfied threshold (T) used when deriving an Apdex
+// score for transactions built from OTLP server spans.
+const apdexThresholdMs = 500.0
+
+// OTLPService maps OpenTelemetry (OTLP) exports onto the existing models:
+// spans become APM spans/traces/transactions, metrics become CustomMetric rows
+// and log records become models.Log documents. Every export is scoped to the
+// tenant of the ingest token that authenticated it.
+type OTLPService struct {
+	apm *APMService
+}
+
+func NewOTLPService() *OTLPService {
+	return &OTLPService{apm: NewAPMService()}
+}
+
+// Global OTLP ingest service shared by the HTTP and gRPC receivers
+var OTLPSvc = NewOTLPService()
+
+// otlpResource is an OTLP resource block resolved against the tenant's hosts
+// (and, for traces, applications).
+type otlpResource struct {
+	attrs       map[string]string
+	serviceName string
+	hostID      int64
+	app         *models.Application
+}
+
+// resolveResource maps resource attributes to a host using the same identity
+// rules as agent ingestion. When the resource names no known host, data sent
+// with a per-agent token falls back to that agent's host.
+func (s *OTLPService) resolveResource(identity *IngestIdentity, res *resourcepb.Resource) *otlpResource {
+	r := &otlpResource{attrs: otlpAttributes(res.GetAttributes())}
+	r.serviceName = r.attrs["service.name"]
+	if r.serviceName == "" {
+		r.serviceName = "unknown_service"
+	}
+
+	hostname := r.attrs["host.name"]
+	ip := r.attrs["host.ip"]
+	if strings.HasPrefix(ip, "[") {
+		// host.ip is a string array; use the first address
+		var ips []string
+		if err := json.Unmarshal([]byte(ip), &ips); err == nil && len(ips) > 0 {
+			ip = ips[0]
+		}
+	}
+	if hostname != "" || ip != "" {
+		if host := FindHostByIdentifiers(hostname, ip, identity.TenantID); host.ID != 0 {
+			r.hostID = host.ID
+		}
+	}
+	if r.hostID == 0 && identity.HostID != 0 {
+		r.hostID = identity.HostID
+	}
+	MarkHostSeen(r.hostID)
+	return r
+}
+
+// ensureApp attaches the APM application for the resource's service, creating
+// it on first sight. Applications must belong to a host.
+func (s *OTLPService) ensureApp(identity *IngestIdentity, r *otlpResource, cache map[string]*models.Application) error {
+	if r.hostID == 0 {
+		return fmt.Errorf("no host could be resolved for service %q", r.serviceName)
+	}
+	key := fmt.Sprintf("%d/%s", r.hostID, r.serviceName)
+	if app, ok := cache[key]; ok {
+		r.app = app
+		return nil
+	}
+	app := &models.Application{
+		TenantID:  identity.TenantID,
+		HostID:    r.hostID,
+		Name:      truncate(r.serviceName, 128),
+		Type:      "service",
+		Language:  truncate(r.attrs["telemetry.sdk.language"], 32),
+		Framework: truncate(r.attrs["telemetry.sdk.name"], 64),
+		Version:   truncate(r.attrs["service.version"], 32),
+		Status:    "active",
+	}
+	if err := s.apm.EnsureApplication(app); err != nil {
+		return err
+	}
+	cache[key] = app
+	r.app = app
+	return nil
+}
+
+// ExportTraces stores the spans of an OTLP trace export. Spans of resources
+// that cannot be tied to a host are rejected and reported through partial
+// success rather than failing the whole export.
+func (s *OTLPService) ExportTraces(ctx context.Context, identity *IngestIdentity, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	var (
+		spans        []models.Span
+		transactions []models.Transaction
+		errEvents    []models.ErrorEvent
+		rejected     int64
+		rejectMsg    string
+	)
+	apps := make(map[string]*models.Application)
+	traceIDs := make(map[string]struct{})
+
+	for _, rs := range req.GetResourceSpans() {
+		r := s.resolveResource(identity, rs.GetResource())
+		if err := s.ensureApp(identity, r, apps); err != nil {
+			for _, ss := range rs.GetScopeSpans() {
+				rejected += int64(len(ss.GetSpans()))
+			}
+			rejectMsg = err.Error()
+			continue
+		}
+
+		for _, ss := range rs.GetScopeSpans() {
+			for _, sp := range ss.GetSpans() {
+				span := s.mapSpan(identity.TenantID, r, ss.GetScope(), sp)
+				if span.TraceID == "" || span.SpanID == "" {
+					rejected++
+					rejectMsg = "span without trace_id or span_id"
+					continue
+				}
+				spans = append(spans, span)
+				traceIDs[span.TraceID] = struct{}{}
+
+				if sp.GetKind() == tracepb.Span_SPAN_KIND_SERVER {
+					transactions = append(transactions, mapTransaction(identity.TenantID, r.app.ID, &span, sp))
+				}
+				errEvents = append(errEvents, mapSpanErrors(identity.TenantID, r.app.ID, &span, sp)...)
+			}
+		}
+	}
+
+	if err := s.apm.AddSpans(spans); err != nil {
+		telemetry.IncCollectionError(ctx, int64(len(spans)))
+		return nil, fmt.Errorf("store spans: %w", err)
+	}
+	telemetry.IncCollectionSuccess(ctx, int64(len(spans)))
+
+	for traceID := range traceIDs {
+		if err := s.apm.RefreshTrace(identity.TenantID, traceID); err != nil {
+			logging.Warnf("[OTLP] failed to refresh trace %s tenant=%d: %v", traceID, identity.TenantID, err)
+		}
+	}
+	for i := range transactions {
+		if err := s.apm.RecordTransaction(&transactions[i]); err != nil {
+			logging.Warnf("[OTLP] failed to record transaction trace=%s: %v", transactions[i].TraceID, err)
+		}
+	}
+	for i := range errEvents {
+		if err := s.apm.RecordError(&errEvents[i]); err != nil {
+			logging.Warnf("[OTLP] failed to record error event trace=%s: %v", errEvents[i].TraceID, err)
+		}
+	}
+
+	resp := &coltracepb.ExportTraceServiceResponse{}
+	if rejected > 0 {
+		resp.PartialSuccess = &coltracepb.ExportTracePartialSuccess{RejectedSpans: rejected, ErrorMessage: rejectMsg}
+	}
+	return resp, nil
+}
+
+func (s *OTLPService) mapSpan(tenantID int64, r *otlpResource, scope *commonpb.InstrumentationScope, sp *tracepb.Span) models.Span {
+	start := otlpTime(sp.GetStartTimeUnixNano())
+	end := otlpTime(sp.GetEndTimeUnixNano())
+	if end.Before(start) {
+		end = start
+	}
+
+	tags := otlpAttributes(sp.GetAttributes())
+	tags["span.kind"] = strings.ToLower(strings.TrimPrefix(sp.GetKind().String(), "SPAN_KIND_"))
+	if scope.GetName() != "" {
+		tags["otel.scope.name"] = scope.GetName()
+	}
+	tagsJSON, _ := json.Marshal(tags)
+
+	var events []map[string]interface{}
+	for _, ev := range sp.GetEvents() {
+		events = append(events, map[string]interface{}{
+			"name":       ev.GetName(),
+			"timestamp":  otlpTime(ev.GetTimeUnixNano()).Format(time.RFC3339Nano),
+			"attributes": otlpAttributes(ev.GetAttributes()),
+		})
+	}
+	logsJSON := []byte("[]")
+	if len(events) > 0 {
+		logsJSON, _ = json.Marshal(events)
+	}
+
+	span := models.Span{
+		TenantID:      tenantID,
+		TraceID:       hex.EncodeToString(sp.GetTraceId()),
+		SpanID:        hex.EncodeToString(sp.GetSpanId()),
+		ParentSpanID:  hex.EncodeToString(sp.GetParentSpanId()),
+		ApplicationID: r.app.ID,
+		OperationName: truncate(sp.GetName(), 256),
+		ServiceName:   truncate(r.serviceName, 128),
+		StartTime:     start,
+		EndTime:       end,
+		Duration:      float64(end.Sub(start).Microseconds()) / 1000,
+		Tags:          string(tagsJSON),
+		Logs:          string(logsJSON),
+		Status:        "unset",
+	}
+	switch sp.GetStatus().GetCode() {
+	case tracepb.Status_STATUS_CODE_OK:
+		span.Status = "ok"
+	case tracepb.Status_STATUS_CODE_ERROR:
+		span.Status = "error"
+		span.Error = true
+		span.ErrorMessage = truncate(sp.GetStatus().GetMessage(), 1024)
+	}
+	return span
+}
+
+// mapTransaction derives a web/background transaction from a server span
+// using the OpenTelemetry HTTP semantic conventions (old and new names).
+func mapTransaction(tenantID, appID int64, span *models.Span, sp *tracepb.Span) models.Transaction {
+	attrs := otlpAttributes(sp.GetAttributes())
+	method := firstAttr(attrs, "http.request.method", "http.method")
+	txType := "background"
+	if method != "" {
+		txType = "web"
+	}
+	statusCode, _ := strconv.Atoi(firstAttr(attrs, "http.response.status_code", "http.status_code"))
+
+	apdex := 0.0
+	switch {
+	case span.Duration <= apdexThresholdMs:
+		apdex = 1
+	case span.Duration <= 4*apdexThresholdMs:
+		apdex = 0.5
+	}
+	if span.Error || statusCode >= 500 {
+		apdex = 0
+	}
+
+	return models.Transaction{
+		TenantID:      tenantID,
+		ApplicationID: appID,
+		TraceID:       span.TraceID,
+		Name:          span.OperationName,
+		Type:          txType,
+		Duration:      span.Duration,
+		ResponseTime:  span.Duration,
+		Apdex:         apdex,
+		StatusCode:    statusCode,
+		Method:        truncate(method, 16),
+		URI:           truncate(firstAttr(attrs, "url.path", "http.target", "http.route", "http.url"), 512),
+		UserAgent:     truncate(firstAttr(attrs, "user_agent.original", "http.user_agent"), 512),
+		RemoteIP:      truncate(firstAttr(attrs, "client.address", "http.client_ip", "net.peer.ip"), 45),
+		Timestamp:     span.StartTime,
+	}
+}
+
+// mapSpanErrors builds error events from "exception" span events, or from the
+// span status when it is an error without any recorded exception.
+func mapSpanErrors(tenantID, appID int64, span *models.Span, sp *tracepb.Span) []models.ErrorEvent {
+	var out []models.ErrorEvent
+	for _, ev := range sp.GetEvents() {
+		if ev.GetName() != "exception" {
+			continue
+		}
+		attrs := otlpAttributes(ev.GetAttributes())
+		class := attrs["exception.type"]
+		if class == "" {
+			class = "Exception"
+		}
+		msg := attrs["exception.message"]
+		out = append(out, models.ErrorEvent{
+			TenantID:      tenantID,
+			ApplicationID: appID,
+			TraceID:       span.TraceID,
+			SpanID:        span.SpanID,
+			ErrorClass:    truncate(class, 256),
+			ErrorMessage:  truncate(msg, 1024),
+			StackTrace:    attrs["exception.stacktrace"],
+			Fingerprint:   GenerateErrorFingerprint(class, msg),
+			Count:         1,
+			Timestamp:     otlpTime(ev.GetTimeUnixNano()),
+		})
+	}
+	if len(out) == 0 && span.Error {
+		out = append(out, models.ErrorEvent{
+			TenantID:      tenantID,
+			ApplicationID: appID,
+			TraceID:       span.TraceID,
+			SpanID:        span.SpanID,
+			ErrorClass:    truncate(span.OperationName, 256),
+			ErrorMessage:  span.ErrorMessage,
+			Fingerprint:   GenerateErrorFingerprint(span.OperationName, span.ErrorMessage),
+			Count:         1,
+			Timestamp:     span.EndTime,
+		})
+	}
+	return out
+}
+
+// ExportMetrics stores the data points of an OTLP metrics export as
+// CustomMetric rows. Resource and point attributes are merged into the JSONB
+// labels. Points of resources without a resolvable host are kept with
+// host_id 0 so they remain queryable by tenant and labels.
+func (s *OTLPService) ExportMetrics(ctx context.Context, identity *IngestIdentity, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	var rows []models.CustomMetric
+	var rejected int64
+	var rejectMsg string
+
+	for _, rm := range req.GetResourceMetrics() {
+		r := s.resolveResource(identity, rm.GetResource())
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				points, skipped := mapMetric(identity.TenantID, r, m)
+				rows = append(rows, points...)
+				if skipped > 0 {
+					rejected += skipped
+					rejectMsg = fmt.Sprintf("unsupported data points in metric %q", m.GetName())
+				}
+			}
+		}
+	}
+
+	if len(rows) > 0 {
+		if err := postgres.DB.CreateInBatches(rows, 500).Error; err != nil {
+			telemetry.IncCollectionError(ctx, int64(len(rows)))
+			return nil, fmt.Errorf("store metrics: %w", err)
+		}
+		telemetry.IncCollectionSuccess(ctx, int64(len(rows)))
+	}
+
+	resp := &colmetricspb.ExportMetricsServiceResponse{}
+	if rejected > 0 {
+		resp.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{RejectedDataPoints: rejected, ErrorMessage: rejectMsg}
+	}
+	return resp, nil
+}
+
+// mapMetric converts one OTLP metric into CustomMetric rows, returning the
+// number of data points that could not be represented.
+func mapMetric(tenantID int64, r *otlpResource, m *metricspb.Metric) ([]models.CustomMetric, int64) {
+	name := truncate(m.GetName(), 128)
+	newRow := func(typ models.MetricType, attrs []*commonpb.KeyValue, ts uint64) models.CustomMetric {
+		labels := make(map[string]string, len(r.attrs))
+		for k, v := range r.attrs {
+			labels[k] = v
+		}
+		for k, v := range otlpAttributes(attrs) {
+			labels[k] = v
+		}
+		if m.GetUnit() != "" {
+			labels["unit"] = m.GetUnit()
+		}
+		lb, _ := json.Marshal(labels)
+		return models.CustomMetric{
+			HostID:    r.hostID,
+			TenantID:  tenantID,
+			Name:      name,
+			Type:      typ,
+			Labels:    string(lb),
+			Timestamp: otlpTime(ts),
+		}
+	}
+
+	var out []models.CustomMetric
+	var skipped int64
+	switch data := m.GetData().(type) {
+	case *metricspb.Metric_Gauge:
+		for _, dp := range data.Gauge.GetDataPoints() {
+			row := newRow(models.MetricTypeGauge, dp.GetAttributes(), dp.GetTimeUnixNano())
+			row.Value = numberValue(dp)
+			out = append(out, row)
+		}
+	case *metricspb.Metric_Sum:
+		typ := models.MetricTypeGauge
+		if data.Sum.GetIsMonotonic() {
+			typ = models.MetricTypeCounter
+		}
+		for _, dp := range data.Sum.GetDataPoints() {
+			row := newRow(typ, dp.GetAttributes(), dp.GetTimeUnixNano())
+			row.Value = numberValue(dp)
+			out = append(out, row)
+		}
+	case *metricspb.Metric_Histogram:
+		for _, dp := range data.Histogram.GetDataPoints() {
+			row := newRow(models.MetricTypeHistogram, dp.GetAttributes(), dp.GetTimeUnixNano())
+			row.Count = int64(dp.GetCount())
+			row.Sum = dp.GetSum()
+			row.Min = dp.GetMin()
+			row.Max = dp.GetMax()
+			if dp.GetCount() > 0 {
+				row.Value = dp.GetSum() / float64(dp.GetCount())
+			}
+			row.P50 = histogramQuantile(0.50, dp.GetExplicitBounds(), dp.GetBucketCounts())
+			row.P95 = histogramQuantile(0.95, dp.GetExplicitBounds(), dp.GetBucketCounts())
+			row.P99 = histogramQuantile(0.99, dp.GetExplicitBounds(), dp.GetBucketCounts())
+			out = append(out, row)
+		}
+	case *metricspb.Metric_ExponentialHistogram:
+		for _, dp := range data.ExponentialHistogram.GetDataPoints() {
+			row := newRow(models.MetricTypeHistogram, dp.GetAttributes(), dp.GetTimeUnixNano())
+			row.Count = int64(dp.GetCount())
+			row.Sum = dp.GetSum()
+			row.Min = dp.GetMin()
+			row.Max = dp.GetMax()
+			if dp.GetCount() > 0 {
+				row.Value = dp.GetSum() / float64(dp.GetCount())
+			}
+			out = append(out, row)
+		}
+	case *metricspb.Metric_Summary:
+		for _, dp := range data.Summary.GetDataPoints() {
+			row := newRow(models.MetricTypeSummary, dp.GetAttributes(), dp.GetTimeUnixNano())
+			row.Count = int64(dp.GetCount())
+			row.Sum = dp.GetSum()
+			if dp.GetCount() > 0 {
+				row.Value = dp.GetSum() / float64(dp.GetCount())
+			}
+			for _, q := range dp.GetQuantileValues() {
+				switch q.GetQuantile() {
+				case 0:
+					row.Min = q.GetValue()
+				case 0.5:
+					row.P50 = q.GetValue()
+				case 0.95:
+					row.P95 = q.GetValue()
+				case 0.99:
+					row.P99 = q.GetValue()
+				case 1:
+					row.Max = q.GetValue()
+				}
+			}
+			out = append(out, row)
+		}
+	default:
+		skipped++
+	}
+	return out, skipped
+}
+
+func numberValue(dp *metricspb.NumberDataPoint) float64 {
+	if v, ok := dp.GetValue().(*metricspb.NumberDataPoint_AsInt); ok {
+		return float64(v.AsInt)
+	}
+	return dp.GetAsDouble()
+}
+
+// histogramQuantile estimates a quantile from explicit bucket bounds by linear
+// interpolation inside the bucket that contains the target rank.
+func histogramQuantile(q float64, bounds []float64, counts []uint64) float64 {
+	var total uint64
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 || len(counts) == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+	var cumulative uint64
+	for i, c := range counts {
+		if float64(cumulative+c) < rank {
+			cumulative += c
+			continue
+		}
+		lower := 0.0
+		if i > 0 && i-1 < len(bounds) {
+			lower = bounds[i-1]
+		}
+		if i >= len(bounds) {
+			// overflow bucket has no upper bound; report its lower bound
+			return lower
+		}
+		upper := bounds[i]
+		if c == 0 {
+			return upper
+		}
+		return lower + (upper-lower)*(rank-float64(cumulative))/float64(c)
+	}
+	if len(bounds) > 0 {
+		return bounds[len(bounds)-1]
+	}
+	return 0
+}
+
+// ExportLogs stores OTLP log records as models.Log documents. The body becomes
+// the message, attributes (plus service.name) become meta and the trace id is
+// kept as the correlation id so logs can be joined with traces.
+func (s *OTLPService) ExportLogs(ctx context.Context, identity *IngestIdentity, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	var rejected int64
+	var rejectMsg string
+	var stored int64
+
+	for _, rl := range req.GetResourceLogs() {
+		r := s.resolveResource(identity, rl.GetResource())
+		for _, sl := range rl.GetScopeLogs() {
+			for _, lr := range sl.GetLogRecords() {
+				ts := lr.GetTimeUnixNano()
+				if ts == 0 {
+					ts = lr.GetObservedTimeUnixNano()
+				}
+				meta := otlpAttributes(lr.GetAttributes())
+				meta["service.name"] = r.serviceName
+				if len(lr.GetSpanId()) > 0 {
+					meta["span_id"] = hex.EncodeToString(lr.GetSpanId())
+				}
+				l := &models.Log{
+					TenantID:  identity.TenantID,
+					HostID:    r.hostID,
+					Timestamp: otlpTime(ts),
+					Level:     otlpSeverity(lr.GetSeverityText(), int32(lr.GetSeverityNumber())),
+					Message:   anyValueString(lr.GetBody()),
+					Meta:      meta,
+					CorrelID:  hex.EncodeToString(lr.GetTraceId()),
+				}
+				if err := CollectLog(ctx, l); err != nil {
+					rejected++
+					rejectMsg = err.Error()
+					continue
+				}
+				BroadcastLog(l)
+				stored++
+			}
+		}
+	}
+
+	if stored > 0 {
+		telemetry.IncCollectionSuccess(ctx, stored)
+	}
+	if rejected > 0 {
+		telemetry.IncCollectionError(ctx, rejected)
+	}
+
+	resp := &collogspb.ExportLogsServiceResponse{}
+	if rejected > 0 {
+		resp.PartialSuccess = &collogspb.ExportLogsPartialSuccess{RejectedLogRecords: rejected, ErrorMessage: rejectMsg}
+	}
+	return resp, nil
+}
+
+// otlpSeverity prefers the exporter's severity text and otherwise maps the
+// OTLP severity number ranges onto the level names used elsewhere.
+func otlpSeverity(text string, number int32) string {
+	if text != "" {
+		return strings.ToLower(text)
+	}
+	switch {
+	case number >= 21:
+		return "fatal"
+	case number >= 17:
+		return "error"
+	case number >= 13:
+		return "warn"
+	case number >= 9:
+		return "info"
+	case number >= 5:
+		return "debug"
+	case number >= 1:
+		return "trace"
+	}
+	return "info"
+}
+
+// otlpAttributes flattens OTLP key/values into a string map. Non-scalar values
+// are JSON encoded.
+func otlpAttributes(kvs []*commonpb.KeyValue) map[string]string {
+	out := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		out[kv.GetKey()] = anyValueString(kv.GetValue())
+	}
+	return out
+}
+
+func anyValueString(v *commonpb.AnyValue) string {
+	switch val := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return val.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(val.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(val.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(val.DoubleValue, 'f', -1, 64)
+	case *commonpb.AnyValue_BytesValue:
+		return hex.EncodeToString(val.BytesValue)
+	case *commonpb.AnyValue_ArrayValue, *commonpb.AnyValue_KvlistValue:
+		b, _ := json.Marshal(anyValueInterface(v))
+		return string(b)
+	}
+	return ""
+}
+
+func anyValueInterface(v *commonpb.AnyValue) interface{} {
+	switch val := v.GetValue().(type) {
+	case *commonpb.AnyValue_ArrayValue:
+		items := make([]interface{}, 0, len(val.ArrayValue.GetValues()))
+		for _, item := range val.ArrayValue.GetValues() {
+			items = append(items, anyValueInterface(item))
+		}
+		return items
+	case *commonpb.AnyValue_KvlistValue:
+		m := make(map[string]interface{}, len(val.KvlistValue.GetValues()))
+		for _, kv := range val.KvlistValue.GetValues() {
+			m[kv.GetKey()] = anyValueInterface(kv.GetValue())
+		}
+		return m
+	case *commonpb.AnyValue_BoolValue:
+		return val.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return val.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		if math.IsNaN(val.DoubleValue) || math.IsInf(val.DoubleValue, 0) {
+			return nil
+		}
+		return val.DoubleValue
+	}
+	return anyValueString(v)
+}
+
+func firstAttr(attrs map[string]string, keys ...string) string {
+	for _, k := range keys {
+		if v := attrs[k]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// otlpTime converts a unix-nano timestamp, treating 0 as "now".
+func otlpTime(ns uint64) time.Time {
+	if ns == 0 {
+		return time.Now().UTC()
+	}
+	return time.Unix(0, int64(ns)).UTC()
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
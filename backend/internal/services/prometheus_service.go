@@ -0,0 +1,479 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/models"
+	"github.com/sakkurohilla/kineticops/backend/internal/repository/postgres"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// PromSample is a single remote_write sample (timestamp in milliseconds).
+type PromSample struct {
+	Value     float64
+	Timestamp int64
+}
+
+// PromSeries is one remote_write time series: its label set (including
+// __name__) and samples.
+type PromSeries struct {
+	Labels  map[string]string
+	Samples []PromSample
+}
+
+// DecodeRemoteWrite decodes an uncompressed Prometheus remote_write
+// WriteRequest protobuf. Only the fields we store are read (series labels and
+// float samples); exemplars, native histograms and metadata are skipped.
+func DecodeRemoteWrite(b []byte) ([]PromSeries, error) {
+	var series []PromSeries
+	err := walkProto(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		ts, err := decodePromTimeSeries(v)
+		if err != nil {
+			return err
+		}
+		series = append(series, ts)
+		return nil
+	})
+	return series, err
+}
+
+func decodePromTimeSeries(b []byte) (PromSeries, error) {
+	ts := PromSeries{Labels: map[string]string{}}
+	err := walkProto(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1: // Label
+			var name, value string
+			err := walkProto(v, func(n protowire.Number, t protowire.Type, lv []byte) error {
+				if t != protowire.BytesType {
+					return nil
+				}
+				switch n {
+				case 1:
+					name = string(lv)
+				case 2:
+					value = string(lv)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.Labels[name] = value
+		case 2: // Sample
+			var s PromSample
+			rest := v
+			for len(rest) > 0 {
+				n, t, tagLen := protowire.ConsumeTag(rest)
+				if tagLen < 0 {
+					return protowire.ParseError(tagLen)
+				}
+				rest = rest[tagLen:]
+				switch {
+				case n == 1 && t == protowire.Fixed64Type:
+					bits, l := protowire.ConsumeFixed64(rest)
+					if l < 0 {
+						return protowire.ParseError(l)
+					}
+					s.Value = math.Float64frombits(bits)
+					rest = rest[l:]
+				case n == 2 && t == protowire.VarintType:
+					x, l := protowire.ConsumeVarint(rest)
+					if l < 0 {
+						return protowire.ParseError(l)
+					}
+					s.Timestamp = int64(x)
+					rest = rest[l:]
+				default:
+					l := protowire.ConsumeFieldValue(n, t, rest)
+					if l < 0 {
+						return protowire.ParseError(l)
+					}
+					rest = rest[l:]
+				}
+			}
+			ts.Samples = append(ts.Samples, s)
+		}
+		return nil
+	})
+	return ts, err
+}
+
+// walkProto iterates the fields of a protobuf message, passing the raw payload
+// of length-delimited fields to fn. Other wire types are skipped.
+func walkProto(b []byte, fn func(protowire.Number, protowire.Type, []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ == protowire.BytesType {
+			v, l := protowire.ConsumeBytes(b)
+			if l < 0 {
+				return protowire.ParseError(l)
+			}
+			if err := fn(num, typ, v); err != nil {
+				return err
+			}
+			b = b[l:]
+			continue
+		}
+		l := protowire.ConsumeFieldValue(num, typ, b)
+		if l < 0 {
+			return protowire.ParseError(l)
+		}
+		if err := fn(num, typ, nil); err != nil {
+			return err
+		}
+		b = b[l:]
+	}
+	return nil
+}
+
+// IngestPromSeries stores remote_write series for a tenant. Series whose
+// host/instance label resolves to a known host (or that were sent with a
+// per-agent token) go through the metric batcher into the metrics table;
+// the rest are kept as CustomMetric rows with their labels as JSONB. NaN and
+// infinite samples (including Prometheus staleness markers) are dropped.
+// It returns the number of samples stored and dropped.
+func IngestPromSeries(identity *IngestIdentity, series []PromSeries) (int, int, error) {
+	hostCache := make(map[string]int64)
+	var orphans []models.CustomMetric
+	stored, dropped := 0, 0
+
+	for _, ts := range series {
+		name := ts.Labels["__name__"]
+		if name == "" {
+			dropped += len(ts.Samples)
+			continue
+		}
+		labels := make(map[string]string, len(ts.Labels))
+		for k, v := range ts.Labels {
+			if k != "__name__" {
+				labels[k] = v
+			}
+		}
+		hostID := resolvePromHost(identity, labels, hostCache)
+		MarkHostSeen(hostID)
+
+		for _, s := range ts.Samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				dropped++
+				continue
+			}
+			at := time.UnixMilli(s.Timestamp).UTC()
+			if s.Timestamp == 0 {
+				at = time.Now().UTC()
+			}
+
+			if hostID == 0 {
+				lb, _ := json.Marshal(labels)
+				orphans = append(orphans, models.CustomMetric{
+					TenantID:  identity.TenantID,
+					Name:      truncate(name, 128),
+					Type:      models.MetricTypeGauge,
+					Value:     s.Value,
+					Labels:    string(lb),
+					Timestamp: at,
+				})
+				stored++
+				continue
+			}
+
+			if err := CollectMetricAt(hostID, identity.TenantID, truncate(name, 128), s.Value, labels, at); err != nil {
+				logging.Warnf("[PROM] failed to collect %s host=%d: %v", name, hostID, err)
+				dropped++
+				continue
+			}
+			stored++
+		}
+	}
+
+	if len(orphans) > 0 {
+		if err := postgres.DB.CreateInBatches(orphans, 500).Error; err != nil {
+			return stored - len(orphans), dropped + len(orphans), fmt.Errorf("store unmapped series: %w", err)
+		}
+	}
+	return stored, dropped, nil
+}
+
+// resolvePromHost maps the host/instance labels of a series to a host id.
+// "instance" is usually host:port, so the port is stripped first.
+func resolvePromHost(identity *IngestIdentity, labels map[string]string, cache map[string]int64) int64 {
+	key := labels["host"]
+	if key == "" {
+		key = labels["instance"]
+	}
+	if key == "" {
+		return identity.HostID
+	}
+	if id, ok := cache[key]; ok {
+		return id
+	}
+
+	name := key
+	if h, _, err := net.SplitHostPort(key); err == nil {
+		name = h
+	}
+	var hostname, ip string
+	if net.ParseIP(name) != nil {
+		ip = name
+	} else {
+		hostname = name
+	}
+
+	id := FindHostByIdentifiers(hostname, ip, identity.TenantID).ID
+	if id == 0 {
+		id = identity.HostID
+	}
+	cache[key] = id
+	return id
+}
+
+// PromMatcher is one label matcher of a series selector (=, !=, =~, !~).
+type PromMatcher struct {
+	Name  string
+	Op    string
+	Value string
+	re    *regexp.Regexp
+}
+
+func (m PromMatcher) matches(v string) bool {
+	switch m.Op {
+	case "=":
+		return v == m.Value
+	case "!=":
+		return v != m.Value
+	case "=~":
+		return m.re.MatchString(v)
+	case "!~":
+		return !m.re.MatchString(v)
+	}
+	return false
+}
+
+// ParsePromSelector parses a series selector as used by Prometheus' match[]
+// parameter, e.g. `cpu_usage{host="web-1",group=~"prod.*"}` or
+// `{__name__=~"disk_.*"}`. Regexes are fully anchored like in PromQL.
+func ParsePromSelector(sel string) ([]PromMatcher, error) {
+	sel = strings.TrimSpace(sel)
+	var matchers []PromMatcher
+
+	name := sel
+	body := ""
+	if i := strings.Index(sel, "{"); i >= 0 {
+		if !strings.HasSuffix(sel, "}") {
+			return nil, fmt.Errorf("unterminated selector %q", sel)
+		}
+		name = strings.TrimSpace(sel[:i])
+		body = sel[i+1 : len(sel)-1]
+	}
+	if name != "" {
+		matchers = append(matchers, PromMatcher{Name: "__name__", Op: "=", Value: name})
+	}
+
+	for body = strings.TrimSpace(body); body != ""; body = strings.TrimSpace(body) {
+		m := promMatcherRe.FindStringSubmatch(body)
+		if m == nil {
+			return nil, fmt.Errorf("invalid matcher near %q", body)
+		}
+		value, err := strconv.Unquote(m[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid label value %s", m[3])
+		}
+		pm := PromMatcher{Name: m[1], Op: m[2], Value: value}
+		if pm.Op == "=~" || pm.Op == "!~" {
+			if pm.re, err = regexp.Compile("^(?:" + value + ")$"); err != nil {
+				return nil, fmt.Errorf("invalid regex %q: %w", value, err)
+			}
+		}
+		matchers = append(matchers, pm)
+		body = strings.TrimPrefix(strings.TrimSpace(body[len(m[0]):]), ",")
+	}
+	if len(matchers) == 0 {
+		return nil, fmt.Errorf("empty selector")
+	}
+	return matchers, nil
+}
+
+var (
+	promMatcherRe    = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*(=~|!~|!=|=)\s*("(?:[^"\\]|\\.)*")`)
+	promInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+)
+
+// promSeries is one rendered exposition sample.
+type promSeries struct {
+	name      string
+	labels    map[string]string
+	value     float64
+	timestamp time.Time
+}
+
+// RenderPrometheusExposition renders the tenant's latest value per host,
+// metric and label set in the Prometheus text exposition format (0.0.4).
+// Each sample carries host, host_id and group labels plus the host's tags
+// ("key=value" tags become key="value", bare tags become tag_<name>="true").
+// hostID 0 renders every host of the tenant. selectors are OR-ed; a series is
+// rendered when all matchers of at least one selector match. Only samples
+// newer than window are considered so stale series drop out like they would
+// in Prometheus.
+func RenderPrometheusExposition(tenantID, hostID int64, selectors [][]PromMatcher, window time.Duration) (string, error) {
+	hosts, err := ListHosts(tenantID, 10000, 0)
+	if err != nil {
+		return "", err
+	}
+	hostsByID := make(map[int64]models.Host, len(hosts))
+	for _, h := range hosts {
+		hostsByID[h.ID] = h
+	}
+
+	var rows []struct {
+		HostID    int64
+		Name      string
+		Value     float64
+		Labels    string
+		Timestamp time.Time
+	}
+	query := postgres.DB.Raw(`
+		SELECT DISTINCT ON (host_id, name, labels) host_id, name, value, labels, timestamp
+		FROM metrics
+		WHERE tenant_id = ? AND (? = 0 OR host_id = ?) AND timestamp > ?
+		ORDER BY host_id, name, labels, timestamp DESC
+	`, tenantID, hostID, hostID, time.Now().Add(-window))
+	if err := query.Scan(&rows).Error; err != nil {
+		return "", err
+	}
+
+	var series []promSeries
+	for _, r := range rows {
+		host, ok := hostsByID[r.HostID]
+		if !ok {
+			continue
+		}
+		labels := map[string]string{}
+		if r.Labels != "" && r.Labels != "null" {
+			var extra map[string]string
+			if err := json.Unmarshal([]byte(r.Labels), &extra); err == nil {
+				for k, v := range extra {
+					labels[promLabelName(k)] = v
+				}
+			}
+		}
+		for k, v := range promHostTagLabels(host.Tags) {
+			labels[k] = v
+		}
+		labels["host"] = host.Hostname
+		labels["host_id"] = strconv.FormatInt(host.ID, 10)
+		labels["group"] = host.Group
+
+		s := promSeries{name: promMetricName(r.Name), labels: labels, value: r.Value, timestamp: r.Timestamp}
+		if promSelected(s, selectors) {
+			series = append(series, s)
+		}
+	}
+
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].name != series[j].name {
+			return series[i].name < series[j].name
+		}
+		return promLabelString(series[i].labels) < promLabelString(series[j].labels)
+	})
+
+	var b strings.Builder
+	last := ""
+	for _, s := range series {
+		if s.name != last {
+			fmt.Fprintf(&b, "# TYPE %s untyped\n", s.name)
+			last = s.name
+		}
+		fmt.Fprintf(&b, "%s%s %s %d\n", s.name, promLabelString(s.labels),
+			strconv.FormatFloat(s.value, 'g', -1, 64), s.timestamp.UnixMilli())
+	}
+	return b.String(), nil
+}
+
+func promSelected(s promSeries, selectors [][]PromMatcher) bool {
+	if len(selectors) == 0 {
+		return true
+	}
+	for _, sel := range selectors {
+		all := true
+		for _, m := range sel {
+			v := s.labels[m.Name]
+			if m.Name == "__name__" {
+				v = s.name
+			}
+			if !m.matches(v) {
+				all = false
+				break
+			}
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+// promHostTagLabels converts the comma-separated host tags into labels.
+func promHostTagLabels(tags string) map[string]string {
+	out := map[string]string{}
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if k, v, ok := strings.Cut(tag, "="); ok {
+			out[promLabelName(strings.TrimSpace(k))] = strings.TrimSpace(v)
+		} else if k, v, ok := strings.Cut(tag, ":"); ok {
+			out[promLabelName(strings.TrimSpace(k))] = strings.TrimSpace(v)
+		} else {
+			out["tag_"+promLabelName(tag)] = "true"
+		}
+	}
+	return out
+}
+
+func promMetricName(name string) string {
+	name = promInvalidChars.ReplaceAllString(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+func promLabelName(name string) string {
+	return strings.ReplaceAll(promMetricName(name), ":", "_")
+}
+
+func promLabelString(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[k])
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, k, v))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
@@ -0,0 +1,417 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/query"
+	"github.com/sakkurohilla/kineticops/backend/internal/repository/postgres"
+)
+
+const (
+	// maxQueryRange bounds SINCE/UNTIL windows.
+	maxQueryRange = 400 * 24 * time.Hour
+	// maxQueryBuckets bounds TIMESERIES buckets per series.
+	maxQueryBuckets = 1500
+)
+
+// QueryPlanError reports a query that parsed but cannot be executed as
+// written (too many buckets, inverted window, ...).
+type QueryPlanError struct {
+	Msg string
+}
+
+func (e *QueryPlanError) Error() string { return e.Msg }
+
+// QueryRow is one result row: a facet group, a bucket of a facet group, or
+// the single row of an unfaceted query. Values are nil when no samples
+// matched.
+type QueryRow struct {
+	Facet     map[string]string   `json:"facet,omitempty"`
+	Timestamp *time.Time          `json:"timestamp,omitempty"`
+	Values    map[string]*float64 `json:"values"`
+}
+
+// QueryResult is the response of a KQL query.
+type QueryResult struct {
+	Columns         []string   `json:"columns"`
+	Facets          []string   `json:"facets,omitempty"`
+	Since           time.Time  `json:"since"`
+	Until           time.Time  `json:"until"`
+	IntervalSeconds int64      `json:"interval_seconds,omitempty"`
+	Source          string     `json:"source"`
+	Rows            []QueryRow `json:"rows"`
+}
+
+// QueryService plans and executes KQL queries (see package query) against
+// the metrics table, or a rollup chosen by AggregationService.selectOptimalTable
+// for long time series.
+type QueryService struct {
+	aggregation *AggregationService
+}
+
+// QuerySvc is the global query service.
+var QuerySvc = &QueryService{aggregation: NewAggregationService()}
+
+// Run parses and executes a query for a tenant.
+func (s *QueryService) Run(tenantID int64, text string) (*QueryResult, error) {
+	q, err := query.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return s.Execute(tenantID, q, time.Now())
+}
+
+// Scalar runs a query that yields a single number, as alert conditions do.
+// For FACET queries the highest facet value is returned so a threshold on
+// "the worst host" can be expressed directly.
+func (s *QueryService) Scalar(tenantID int64, text string) (float64, error) {
+	q, err := query.Parse(text)
+	if err != nil {
+		return 0, err
+	}
+	if q.TimeSeries {
+		return 0, &QueryPlanError{Msg: "TIMESERIES queries do not yield a single value"}
+	}
+	res, err := s.Execute(tenantID, q, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	if len(res.Rows) == 0 || res.Rows[0].Values[res.Columns[0]] == nil {
+		return 0, fmt.Errorf("no data")
+	}
+	return *res.Rows[0].Values[res.Columns[0]], nil
+}
+
+// Execute plans and runs a parsed query.
+func (s *QueryService) Execute(tenantID int64, q *query.Query, now time.Time) (*QueryResult, error) {
+	since, until := q.Since.Resolve(now), q.Until.Resolve(now)
+	if !since.Before(until) {
+		return nil, &QueryPlanError{Msg: "SINCE must be before UNTIL"}
+	}
+	if until.Sub(since) > maxQueryRange {
+		return nil, &QueryPlanError{Msg: "time window is longer than 400 days"}
+	}
+
+	res := &QueryResult{Since: since, Until: until, Source: "metrics"}
+	for _, a := range q.Select {
+		res.Columns = append(res.Columns, a.Alias)
+	}
+	for _, f := range q.Facets {
+		res.Facets = append(res.Facets, f.String())
+	}
+
+	var interval time.Duration
+	if q.TimeSeries {
+		interval = q.Interval
+		if interval == 0 {
+			interval = s.aggregation.intervalDuration(s.aggregation.selectOptimalInterval(since, until))
+		}
+		if interval < 10*time.Second {
+			return nil, &QueryPlanError{Msg: "TIMESERIES interval must be at least 10 seconds"}
+		}
+		if until.Sub(since)/interval > maxQueryBuckets {
+			return nil, &QueryPlanError{Msg: fmt.Sprintf("too many buckets (max %d); use a larger TIMESERIES interval", maxQueryBuckets)}
+		}
+		res.IntervalSeconds = int64(interval / time.Second)
+		res.Source = s.selectSource(q, since, until, interval)
+	}
+
+	// With FACET, rank groups over the whole window first so a TIMESERIES
+	// returns the same top-N groups a plain FACET query would.
+	var keep map[string]bool
+	if len(q.Facets) > 0 {
+		plan := s.plan(tenantID, q, since, until, 0, "metrics")
+		plan.sql += fmt.Sprintf(" ORDER BY %d DESC NULLS LAST LIMIT %d", len(q.Facets)+1, q.Limit)
+		rows, err := s.run(plan, q, false)
+		if err != nil {
+			return nil, err
+		}
+		if !q.TimeSeries {
+			res.Rows = rows
+			return res, nil
+		}
+		keep = make(map[string]bool, len(rows))
+		for _, r := range rows {
+			keep[facetKey(r.Facet, res.Facets)] = true
+		}
+	}
+
+	plan := s.plan(tenantID, q, since, until, interval, res.Source)
+	if q.TimeSeries {
+		plan.sql += " ORDER BY 1"
+	}
+	rows, err := s.run(plan, q, q.TimeSeries)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		if keep == nil || keep[facetKey(r.Facet, res.Facets)] {
+			res.Rows = append(res.Rows, r)
+		}
+	}
+	if res.Rows == nil {
+		res.Rows = []QueryRow{}
+	}
+	return res, nil
+}
+
+// selectSource picks a rollup for TIMESERIES queries that only use
+// functions rollups can answer and do not touch metric labels (rollups
+// aggregate labels away).
+func (s *QueryService) selectSource(q *query.Query, since, until time.Time, interval time.Duration) string {
+	intervals := map[time.Duration]string{5 * time.Minute: "5m", 15 * time.Minute: "15m", time.Hour: "1h", 24 * time.Hour: "1d"}
+	key, ok := intervals[interval]
+	if !ok {
+		return "metrics"
+	}
+	for _, c := range q.Where {
+		if c.Dim.Name == "label" {
+			return "metrics"
+		}
+	}
+	for _, f := range q.Facets {
+		if f.Name == "label" {
+			return "metrics"
+		}
+	}
+
+	table := ""
+	for _, a := range q.Select {
+		switch a.Func {
+		case "avg", "min", "max", "sum", "count":
+		default:
+			return "metrics"
+		}
+		t := s.aggregation.selectOptimalTable(since, until, key, a.Func)
+		if t == "metrics" || (table != "" && t != table) {
+			return "metrics"
+		}
+		table = t
+	}
+	return table
+}
+
+type queryPlan struct {
+	sql  string
+	args []interface{}
+}
+
+// plan builds the SQL for q. interval > 0 adds a leading time bucket column;
+// facet columns follow, then one column per SELECT item.
+func (s *QueryService) plan(tenantID int64, q *query.Query, since, until time.Time, interval time.Duration, source string) queryPlan {
+	rollup := source != "metrics"
+	timeCol := "m.timestamp"
+	if rollup {
+		timeCol = "m.bucket"
+	}
+
+	var cols, groupBy []string
+	var args []interface{}
+	from := source + " m LEFT JOIN hosts h ON h.id = m.host_id"
+	if interval > 0 {
+		cols = append(cols, RollupSvc.bucketExpr(fmt.Sprintf("%d seconds", int64(interval/time.Second)), timeCol))
+		groupBy = append(groupBy, "1")
+	}
+	for _, f := range q.Facets {
+		if f.Name == "tag" {
+			// a host with several tags counts towards each of them
+			from += " LEFT JOIN LATERAL unnest(" + hostTagsSQL + ") AS ht(tag) ON true"
+		}
+		expr, a := dimensionSQL(f)
+		cols = append(cols, expr)
+		args = append(args, a...)
+		groupBy = append(groupBy, fmt.Sprint(len(cols)))
+	}
+
+	metrics := make([]interface{}, 0, len(q.Select))
+	seen := map[string]bool{}
+	for _, a := range q.Select {
+		expr, n := aggregateSQL(a, rollup)
+		cols = append(cols, "("+expr+")::double precision")
+		for i := 0; i < n; i++ {
+			args = append(args, a.Metric)
+		}
+		if !seen[a.Metric] {
+			seen[a.Metric] = true
+			metrics = append(metrics, a.Metric)
+		}
+	}
+
+	where := []string{"m.tenant_id = ?", "m.name IN (" + placeholders(len(metrics)) + ")", timeCol + " >= ?", timeCol + " < ?"}
+	args = append(args, tenantID)
+	args = append(args, metrics...)
+	args = append(args, since, until)
+	for _, c := range q.Where {
+		expr, a := conditionSQL(c)
+		where = append(where, expr)
+		args = append(args, a...)
+	}
+
+	stmt := fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(cols, ", "), from, strings.Join(where, " AND "))
+	if len(groupBy) > 0 {
+		stmt += " GROUP BY " + strings.Join(groupBy, ", ")
+	}
+	return queryPlan{sql: stmt, args: args}
+}
+
+func (s *QueryService) run(plan queryPlan, q *query.Query, timeseries bool) ([]QueryRow, error) {
+	rows, err := postgres.DB.Raw(plan.sql, plan.args...).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []QueryRow
+	for rows.Next() {
+		var ts time.Time
+		facets := make([]sql.NullString, len(q.Facets))
+		values := make([]sql.NullFloat64, len(q.Select))
+
+		dest := make([]interface{}, 0, 1+len(facets)+len(values))
+		if timeseries {
+			dest = append(dest, &ts)
+		}
+		for i := range facets {
+			dest = append(dest, &facets[i])
+		}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		row := QueryRow{Values: make(map[string]*float64, len(values))}
+		if timeseries {
+			t := ts.UTC()
+			row.Timestamp = &t
+		}
+		if len(facets) > 0 {
+			row.Facet = make(map[string]string, len(facets))
+			for i, f := range q.Facets {
+				row.Facet[f.String()] = facets[i].String
+			}
+		}
+		for i, a := range q.Select {
+			if values[i].Valid {
+				v := values[i].Float64
+				row.Values[a.Alias] = &v
+			} else {
+				row.Values[a.Alias] = nil
+			}
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// aggregateSQL returns the SQL for one SELECT item and how many metric-name
+// placeholders it contains.
+func aggregateSQL(a query.Aggregate, rollup bool) (string, int) {
+	const filter = " FILTER (WHERE m.name = ?)"
+	if rollup {
+		switch a.Func {
+		case "min":
+			return "MIN(m.min_value)" + filter, 1
+		case "max":
+			return "MAX(m.max_value)" + filter, 1
+		case "sum":
+			return "SUM(m.avg_value * m.sample_count)" + filter, 1
+		case "count":
+			return "SUM(m.sample_count)" + filter, 1
+		default:
+			return "SUM(m.avg_value * m.sample_count)" + filter + " / NULLIF(SUM(m.sample_count)" + filter + ", 0)", 2
+		}
+	}
+	switch a.Func {
+	case "min":
+		return "MIN(m.value)" + filter, 1
+	case "max":
+		return "MAX(m.value)" + filter, 1
+	case "sum":
+		return "SUM(m.value)" + filter, 1
+	case "count":
+		return "COUNT(m.value)" + filter, 1
+	case "latest":
+		return "(ARRAY_AGG(m.value ORDER BY m.timestamp DESC)" + filter + ")[1]", 1
+	case "percentile":
+		return fmt.Sprintf("percentile_cont(%g) WITHIN GROUP (ORDER BY m.value)", a.Quantile) + filter, 1
+	default:
+		return "AVG(m.value)" + filter, 1
+	}
+}
+
+// dimensionSQL maps a dimension to a text expression over metrics m and
+// hosts h.
+func dimensionSQL(d query.Dimension) (string, []interface{}) {
+	switch d.Name {
+	case "host":
+		return "h.hostname", nil
+	case "host_id":
+		return "m.host_id::text", nil
+	case "group":
+		return `h."group"`, nil
+	case "os":
+		return "h.os", nil
+	case "ip":
+		return "h.ip", nil
+	case "tag":
+		// only valid as a FACET, over the lateral join added by plan
+		return "NULLIF(ht.tag, '')", nil
+	case "label":
+		// labels is JSON text; guard the cast against legacy non-JSON rows
+		return "CASE WHEN m.labels LIKE '{%' THEN m.labels::jsonb ->> ? END", []interface{}{d.Label}
+	}
+	return "NULL", nil
+}
+
+const hostTagsSQL = "string_to_array(replace(COALESCE(h.tags, ''), ' ', ''), ',')"
+
+func conditionSQL(c query.Condition) (string, []interface{}) {
+	vals := make([]interface{}, len(c.Values))
+	for i, v := range c.Values {
+		vals[i] = v
+	}
+
+	if c.Dim.Name == "tag" {
+		expr := hostTagsSQL + " && ARRAY[" + placeholders(len(vals)) + "]::text[]"
+		if c.Op == "!=" || c.Op == "NOT IN" {
+			expr = "NOT (" + expr + ")"
+		}
+		return expr, vals
+	}
+
+	dim, args := dimensionSQL(c.Dim)
+	repeat := func() []interface{} { return append([]interface{}{}, args...) }
+	switch c.Op {
+	case "!=":
+		return dim + " IS DISTINCT FROM ?", append(repeat(), vals...)
+	case "IN":
+		return dim + " IN (" + placeholders(len(vals)) + ")", append(repeat(), vals...)
+	case "NOT IN":
+		a := append(repeat(), args...)
+		return "(" + dim + " IS NULL OR " + dim + " NOT IN (" + placeholders(len(vals)) + "))", append(a, vals...)
+	case "LIKE":
+		return dim + " LIKE ?", append(repeat(), vals...)
+	case "NOT LIKE":
+		a := append(repeat(), args...)
+		return "(" + dim + " IS NULL OR " + dim + " NOT LIKE ?)", append(a, vals...)
+	default:
+		return dim + " = ?", append(repeat(), vals...)
+	}
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func facetKey(facet map[string]string, names []string) string {
+	parts := make([]string, len(names))
+	for i, n := range names {
+		parts[i] = facet[n]
+	}
+	return strings.Join(parts, "\x00")
+}
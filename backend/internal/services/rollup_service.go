@@ -0,0 +1,376 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/repository/postgres"
+)
+
+// rollupLevel describes one rollup resolution of the metrics table. Every
+// level has the same columns whichever backend maintains it: bucket, host_id,
+// tenant_id, name, avg_value, min_value, max_value, sample_count. Rollup
+// tables also store p50/p95/p99_value; continuous aggregates store pct (a
+// timescaledb_toolkit percentile_agg) when toolkit is installed and no
+// percentiles otherwise.
+type rollupLevel struct {
+	Table     string
+	Bucket    string        // SQL interval of one bucket
+	Step      time.Duration // same as Bucket, for range/interval selection
+	Source    string        // rollup tables: level the buckets are built from, empty for raw metrics
+	Refresh   string        // continuous aggregate refresh window; rollup tables backfill this far when empty
+	Schedule  string        // continuous aggregate policy schedule
+	Retention string        // how long rollup rows are kept
+}
+
+// rollupLevels are ordered from finest to coarsest. Refresh windows stay
+// inside the raw metrics retention (30 days): refreshing a region whose raw
+// chunks were dropped would erase the rollup rows.
+var rollupLevels = []rollupLevel{
+	{Table: "metrics_rollup_5m", Bucket: "5 minutes", Step: 5 * time.Minute, Refresh: "1 day", Schedule: "5 minutes", Retention: "30 days"},
+	{Table: "metrics_rollup_1h", Bucket: "1 hour", Step: time.Hour, Source: "metrics_rollup_5m", Refresh: "7 days", Schedule: "30 minutes", Retention: "180 days"},
+	{Table: "metrics_rollup_1d", Bucket: "1 day", Step: 24 * time.Hour, Source: "metrics_rollup_1h", Refresh: "28 days", Schedule: "6 hours", Retention: "730 days"},
+}
+
+// rollupLateness is how long the rollup tables wait for late samples before
+// a raw bucket is considered closed and materialized for good.
+const rollupLateness = 10 * time.Minute
+
+// RollupService owns metric rollups. On TimescaleDB it creates continuous
+// aggregates on the metrics hypertable with refresh, compression and
+// retention policies; on vanilla Postgres it maintains equivalent tables from
+// a periodic worker. AggregationService.selectOptimalTable is the only
+// reader of the rollups.
+type RollupService struct {
+	mu        sync.RWMutex
+	ready     bool
+	timescale bool
+	toolkit   map[string]bool // per level: pct column present
+
+	// watermarks holds, per rollup table, the end of the last materialized
+	// bucket. Only the refresh worker touches it.
+	watermarks map[string]time.Time
+}
+
+// RollupSvc is the global rollup service.
+var RollupSvc = &RollupService{toolkit: map[string]bool{}, watermarks: map[string]time.Time{}}
+
+// Start prepares the rollups and, on vanilla Postgres, starts the refresh
+// worker. Setup failures leave the rollups unused so queries fall back to the
+// raw metrics table.
+func (s *RollupService) Start(ctx context.Context) {
+	go func() {
+		if err := s.setup(); err != nil {
+			logging.Errorf("[ROLLUP] setup failed, queries will use raw metrics: %v", err)
+			return
+		}
+		if s.Timescale() {
+			return
+		}
+		s.refreshTables()
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.refreshTables()
+			}
+		}
+	}()
+}
+
+// Timescale reports whether rollups are TimescaleDB continuous aggregates.
+func (s *RollupService) Timescale() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.timescale
+}
+
+// level returns the rollup for table if rollups are ready.
+func (s *RollupService) level(table string) (rollupLevel, bool, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.ready {
+		return rollupLevel{}, false, false
+	}
+	for _, l := range rollupLevels {
+		if l.Table == table {
+			return l, s.toolkit[table], true
+		}
+	}
+	return rollupLevel{}, false, false
+}
+
+func (s *RollupService) setup() error {
+	var hypertable bool
+	// the information view only exists with the extension installed
+	_ = postgres.DB.Raw(`SELECT EXISTS (
+		SELECT 1 FROM pg_extension WHERE extname = 'timescaledb'
+	) AND EXISTS (
+		SELECT 1 FROM pg_class WHERE relname = 'metrics'
+	)`).Scan(&hypertable).Error
+	if hypertable {
+		_ = postgres.DB.Raw(`SELECT EXISTS (
+			SELECT 1 FROM timescaledb_information.hypertables WHERE hypertable_name = 'metrics'
+		)`).Scan(&hypertable).Error
+	}
+
+	toolkit := map[string]bool{}
+	var err error
+	if hypertable {
+		toolkit, err = setupContinuousAggregates()
+	} else {
+		err = setupRollupTables()
+		for _, l := range rollupLevels {
+			toolkit[l.Table] = false
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.ready, s.timescale, s.toolkit = true, hypertable, toolkit
+	s.mu.Unlock()
+	logging.Infof("[ROLLUP] rollups ready (timescale=%v)", hypertable)
+	return nil
+}
+
+// setupContinuousAggregates creates one continuous aggregate per level with
+// refresh and retention policies, and enables compression on the raw
+// hypertable. Percentile sketches are stored when timescaledb_toolkit is
+// available. It returns which levels carry the pct column.
+func setupContinuousAggregates() (map[string]bool, error) {
+	// toolkit is optional (bundled with timescaledb-ha images only)
+	_ = postgres.DB.Exec(`CREATE EXTENSION IF NOT EXISTS timescaledb_toolkit`).Error
+	var hasToolkit bool
+	_ = postgres.DB.Raw(`SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb_toolkit')`).Scan(&hasToolkit).Error
+
+	toolkit := map[string]bool{}
+	for _, l := range rollupLevels {
+		var exists bool
+		if err := postgres.DB.Raw(`SELECT EXISTS (
+			SELECT 1 FROM timescaledb_information.continuous_aggregates WHERE view_name = ?
+		)`, l.Table).Scan(&exists).Error; err != nil {
+			return nil, err
+		}
+
+		if !exists {
+			pct := ""
+			if hasToolkit {
+				pct = ", percentile_agg(value::double precision) AS pct"
+			}
+			create := fmt.Sprintf(`
+				CREATE MATERIALIZED VIEW IF NOT EXISTS %s
+				WITH (timescaledb.continuous) AS
+				SELECT
+					time_bucket(INTERVAL '%s', timestamp) AS bucket,
+					host_id,
+					tenant_id,
+					name,
+					AVG(value)::double precision AS avg_value,
+					MIN(value)::double precision AS min_value,
+					MAX(value)::double precision AS max_value,
+					COUNT(*) AS sample_count%s
+				FROM metrics
+				GROUP BY bucket, host_id, tenant_id, name
+				WITH NO DATA`, l.Table, l.Bucket, pct)
+			if err := postgres.DB.Exec(create).Error; err != nil {
+				return nil, fmt.Errorf("create %s: %w", l.Table, err)
+			}
+			// initial backfill runs outside a transaction and may be slow
+			go func(l rollupLevel) {
+				if err := postgres.DB.Exec(fmt.Sprintf(
+					`CALL refresh_continuous_aggregate('%s', NOW() - INTERVAL '%s', NOW())`, l.Table, l.Refresh)).Error; err != nil {
+					logging.Warnf("[ROLLUP] initial refresh of %s failed: %v", l.Table, err)
+				}
+			}(l)
+		}
+
+		policies := []string{
+			fmt.Sprintf(`SELECT add_continuous_aggregate_policy('%s',
+				start_offset => INTERVAL '%s', end_offset => INTERVAL '%s',
+				schedule_interval => INTERVAL '%s', if_not_exists => TRUE)`, l.Table, l.Refresh, l.Bucket, l.Schedule),
+			fmt.Sprintf(`SELECT add_retention_policy('%s', INTERVAL '%s', if_not_exists => TRUE)`, l.Table, l.Retention),
+		}
+		for _, p := range policies {
+			if err := postgres.DB.Exec(p).Error; err != nil {
+				logging.Warnf("[ROLLUP] policy on %s failed: %v", l.Table, err)
+			}
+		}
+
+		var pctCol bool
+		_ = postgres.DB.Raw(`SELECT EXISTS (
+			SELECT 1 FROM information_schema.columns WHERE table_name = ? AND column_name = 'pct'
+		)`, l.Table).Scan(&pctCol).Error
+		toolkit[l.Table] = pctCol
+	}
+
+	// Compress raw chunks once they are past the 5m refresh window. The
+	// primary key (id, timestamp) must be covered by segmentby/orderby.
+	// Raw retention stays with RetentionService (drop_chunks).
+	var compressed bool
+	_ = postgres.DB.Raw(`SELECT compression_enabled FROM timescaledb_information.hypertables WHERE hypertable_name = 'metrics'`).Scan(&compressed).Error
+	if !compressed {
+		if err := postgres.DB.Exec(`ALTER TABLE metrics SET (
+			timescaledb.compress,
+			timescaledb.compress_segmentby = 'host_id, name',
+			timescaledb.compress_orderby = 'timestamp DESC, id'
+		)`).Error; err != nil {
+			logging.Warnf("[ROLLUP] enabling compression on metrics failed: %v", err)
+			return toolkit, nil
+		}
+	}
+	if err := postgres.DB.Exec(`SELECT add_compression_policy('metrics', INTERVAL '7 days', if_not_exists => TRUE)`).Error; err != nil {
+		logging.Warnf("[ROLLUP] compression policy on metrics failed: %v", err)
+	}
+	return toolkit, nil
+}
+
+// setupRollupTables creates the plain-table rollups used without TimescaleDB.
+func setupRollupTables() error {
+	for _, l := range rollupLevels {
+		if err := postgres.DB.Exec(fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %s (
+				bucket TIMESTAMPTZ NOT NULL,
+				host_id BIGINT NOT NULL,
+				tenant_id BIGINT NOT NULL,
+				name VARCHAR(128) NOT NULL,
+				avg_value DOUBLE PRECISION,
+				min_value DOUBLE PRECISION,
+				max_value DOUBLE PRECISION,
+				sample_count BIGINT,
+				p50_value DOUBLE PRECISION,
+				p95_value DOUBLE PRECISION,
+				p99_value DOUBLE PRECISION,
+				PRIMARY KEY (tenant_id, host_id, name, bucket)
+			)`, l.Table)).Error; err != nil {
+			return fmt.Errorf("create %s: %w", l.Table, err)
+		}
+	}
+	return nil
+}
+
+// refreshTables materializes the buckets of each level that closed since
+// the last run and prunes rows past the level's retention. The 5m level is
+// built from raw metrics once a bucket is older than rollupLateness; coarser
+// levels are built from the level below once all its buckets are in, so each
+// raw row is read once. Percentiles cannot be merged, so only levels built
+// from raw metrics carry them.
+func (s *RollupService) refreshTables() {
+	for _, l := range rollupLevels {
+		from, err := s.watermark(l)
+		if err != nil {
+			logging.Errorf("[ROLLUP] watermark of %s failed: %v", l.Table, err)
+			continue
+		}
+		var until time.Time
+		if l.Source == "" {
+			err = postgres.DB.Raw(fmt.Sprintf(`SELECT date_bin(INTERVAL '%s', NOW() - INTERVAL '%d seconds', '2000-01-01')`,
+				l.Bucket, int(rollupLateness.Seconds()))).Scan(&until).Error
+		} else {
+			err = postgres.DB.Raw(fmt.Sprintf(`SELECT date_bin(INTERVAL '%s', ?::timestamptz, '2000-01-01')`, l.Bucket),
+				s.watermarks[l.Source]).Scan(&until).Error
+		}
+		if err != nil {
+			logging.Errorf("[ROLLUP] refresh window of %s failed: %v", l.Table, err)
+			continue
+		}
+
+		if until.After(from) {
+			if err := postgres.DB.Exec(rollupRefreshSQL(l), from, until).Error; err != nil {
+				logging.Errorf("[ROLLUP] refresh of %s failed: %v", l.Table, err)
+				continue
+			}
+			s.watermarks[l.Table] = until
+		}
+
+		if err := postgres.DB.Exec(fmt.Sprintf(`DELETE FROM %s WHERE bucket < NOW() - INTERVAL '%s'`, l.Table, l.Retention)).Error; err != nil {
+			logging.Warnf("[ROLLUP] retention on %s failed: %v", l.Table, err)
+		}
+	}
+}
+
+// watermark returns where the next refresh of l starts. After a restart it
+// resumes at the newest stored bucket, which is recomputed in case it was
+// written partially; an empty table is backfilled over l.Refresh.
+func (s *RollupService) watermark(l rollupLevel) (time.Time, error) {
+	if wm, ok := s.watermarks[l.Table]; ok {
+		return wm, nil
+	}
+	var wm time.Time
+	err := postgres.DB.Raw(fmt.Sprintf(`SELECT COALESCE(
+		(SELECT MAX(bucket) FROM %s),
+		date_bin(INTERVAL '%s', NOW() - INTERVAL '%s', '2000-01-01')
+	)`, l.Table, l.Bucket, l.Refresh)).Scan(&wm).Error
+	if err != nil {
+		return time.Time{}, err
+	}
+	s.watermarks[l.Table] = wm
+	return wm, nil
+}
+
+// rollupRefreshSQL upserts the buckets of l in [$1, $2) from its source.
+func rollupRefreshSQL(l rollupLevel) string {
+	var sel string
+	if l.Source == "" {
+		sel = fmt.Sprintf(`
+			SELECT
+				date_bin(INTERVAL '%s', timestamp, '2000-01-01') AS b,
+				host_id,
+				tenant_id,
+				name,
+				AVG(value),
+				MIN(value),
+				MAX(value),
+				COUNT(*),
+				percentile_cont(0.50) WITHIN GROUP (ORDER BY value),
+				percentile_cont(0.95) WITHIN GROUP (ORDER BY value),
+				percentile_cont(0.99) WITHIN GROUP (ORDER BY value)
+			FROM metrics
+			WHERE timestamp >= ? AND timestamp < ?
+			GROUP BY b, host_id, tenant_id, name`, l.Bucket)
+	} else {
+		sel = fmt.Sprintf(`
+			SELECT
+				date_bin(INTERVAL '%s', bucket, '2000-01-01') AS b,
+				host_id,
+				tenant_id,
+				name,
+				SUM(avg_value * sample_count) / NULLIF(SUM(sample_count), 0),
+				MIN(min_value),
+				MAX(max_value),
+				SUM(sample_count),
+				NULL::double precision,
+				NULL::double precision,
+				NULL::double precision
+			FROM %s
+			WHERE bucket >= ? AND bucket < ?
+			GROUP BY b, host_id, tenant_id, name`, l.Bucket, l.Source)
+	}
+	return fmt.Sprintf(`
+		INSERT INTO %s (bucket, host_id, tenant_id, name, avg_value, min_value, max_value, sample_count, p50_value, p95_value, p99_value)
+		%s
+		ON CONFLICT (tenant_id, host_id, name, bucket) DO UPDATE SET
+			avg_value = EXCLUDED.avg_value,
+			min_value = EXCLUDED.min_value,
+			max_value = EXCLUDED.max_value,
+			sample_count = EXCLUDED.sample_count,
+			p50_value = EXCLUDED.p50_value,
+			p95_value = EXCLUDED.p95_value,
+			p99_value = EXCLUDED.p99_value`, l.Table, sel)
+}
+
+// bucketExpr returns the SQL bucketing expression for col in the active
+// backend: time_bucket on TimescaleDB, date_bin (PostgreSQL 14+) otherwise.
+func (s *RollupService) bucketExpr(interval, col string) string {
+	if s.Timescale() {
+		return fmt.Sprintf("time_bucket(INTERVAL '%s', %s)", interval, col)
+	}
+	return fmt.Sprintf("date_bin(INTERVAL '%s', %s, '2000-01-01')", interval, col)
+}
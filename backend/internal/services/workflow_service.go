@@ -141,13 +141,13 @@ func (s *WorkflowService) DiscoverServices(hostID int, sessionToken string) ([]m
 // DiscoverServicesRealtime gets real-time services from websocket cache (same as Services page)
 func (s *WorkflowService) DiscoverServicesRealtime(hostID int, sessionToken string) (interface{}, error) {
 	// Validate session
-	_, err := s.ValidateSession(sessionToken)
+	session, err := s.ValidateSession(sessionToken)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get last cached services from websocket hub
-	servicesData, err := ws.GetLastServicesForHost(int64(hostID))
+	// Get last cached services from websocket hub (tenant maps to the session user)
+	servicesData, err := ws.GetLastServicesForHost(int64(session.UserID), int64(hostID))
 	if err != nil {
 		// Fallback to database if no websocket data available yet
 		logging.Warnf("No real-time services for host %d, using database fallback: %v", hostID, err)
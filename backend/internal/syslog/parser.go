@@ -0,0 +1,244 @@
+package syslog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is a parsed RFC 3164 (BSD) or RFC 5424 syslog message.
+type Message struct {
+	Facility       int
+	Severity       int
+	Timestamp      time.Time
+	Hostname       string
+	AppName        string
+	ProcID         string
+	MsgID          string
+	StructuredData map[string]map[string]string
+	Message        string
+}
+
+var severityNames = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+var facilityNames = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// SeverityName returns the syslog keyword for the message severity.
+func (m *Message) SeverityName() string {
+	return severityNames[m.Severity]
+}
+
+// FacilityName returns the syslog keyword for the message facility.
+func (m *Message) FacilityName() string {
+	if m.Facility < len(facilityNames) {
+		return facilityNames[m.Facility]
+	}
+	return strconv.Itoa(m.Facility)
+}
+
+// Level maps the syslog severity onto the level names used for agent and
+// OTLP logs.
+func (m *Message) Level() string {
+	switch {
+	case m.Severity <= 2:
+		return "fatal"
+	case m.Severity == 3:
+		return "error"
+	case m.Severity == 4:
+		return "warn"
+	case m.Severity <= 6:
+		return "info"
+	}
+	return "debug"
+}
+
+// Parse parses a single syslog frame. RFC 5424 is detected by the version
+// field after PRI; anything else is treated as RFC 3164, which is lenient by
+// design: a missing PRI defaults to user.notice and a missing timestamp to
+// now.
+func Parse(raw []byte, now time.Time) (*Message, error) {
+	s := strings.TrimRight(string(raw), "\r\n\x00")
+	if s == "" {
+		return nil, fmt.Errorf("empty message")
+	}
+
+	m := &Message{Facility: 1, Severity: 5}
+	if strings.HasPrefix(s, "<") {
+		end := strings.IndexByte(s, '>')
+		if end < 2 || end > 4 {
+			return nil, fmt.Errorf("invalid PRI")
+		}
+		pri, err := strconv.Atoi(s[1:end])
+		if err != nil || pri < 0 || pri > 191 {
+			return nil, fmt.Errorf("invalid PRI %q", s[1:end])
+		}
+		m.Facility, m.Severity = pri/8, pri%8
+		s = s[end+1:]
+	}
+
+	if strings.HasPrefix(s, "1 ") {
+		if err := parse5424(m, s[2:]); err != nil {
+			return nil, err
+		}
+	} else {
+		parse3164(m, s, now)
+	}
+	if m.Timestamp.IsZero() {
+		m.Timestamp = now
+	}
+	return m, nil
+}
+
+// parse5424 parses the part of an RFC 5424 message after "VERSION SP":
+// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG].
+func parse5424(m *Message, s string) error {
+	fields := make([]string, 5)
+	for i := range fields {
+		sp := strings.IndexByte(s, ' ')
+		if sp < 0 {
+			return fmt.Errorf("truncated RFC 5424 header")
+		}
+		fields[i], s = s[:sp], s[sp+1:]
+	}
+	if fields[0] != "-" {
+		ts, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %q", fields[0])
+		}
+		m.Timestamp = ts
+	}
+	m.Hostname = nilValue(fields[1])
+	m.AppName = nilValue(fields[2])
+	m.ProcID = nilValue(fields[3])
+	m.MsgID = nilValue(fields[4])
+
+	if strings.HasPrefix(s, "-") {
+		s = s[1:]
+	} else {
+		sd, rest, err := parseStructuredData(s)
+		if err != nil {
+			return err
+		}
+		m.StructuredData, s = sd, rest
+	}
+	s = strings.TrimPrefix(s, " ")
+	m.Message = strings.TrimPrefix(s, "\ufeff")
+	return nil
+}
+
+// parseStructuredData parses one or more [SD-ID PARAM="VALUE" ...] elements
+// and returns the remainder of the message.
+func parseStructuredData(s string) (map[string]map[string]string, string, error) {
+	sd := map[string]map[string]string{}
+	for strings.HasPrefix(s, "[") {
+		s = s[1:]
+		end := strings.IndexAny(s, " ]")
+		if end <= 0 {
+			return nil, "", fmt.Errorf("invalid structured data")
+		}
+		id := s[:end]
+		params := map[string]string{}
+		s = s[end:]
+		for strings.HasPrefix(s, " ") {
+			s = s[1:]
+			eq := strings.Index(s, `="`)
+			if eq <= 0 {
+				return nil, "", fmt.Errorf("invalid structured data param in %s", id)
+			}
+			name := s[:eq]
+			s = s[eq+2:]
+			var b strings.Builder
+			closed := false
+			for i := 0; i < len(s); i++ {
+				c := s[i]
+				if c == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\' || s[i+1] == ']') {
+					b.WriteByte(s[i+1])
+					i++
+					continue
+				}
+				if c == '"' {
+					s, closed = s[i+1:], true
+					break
+				}
+				b.WriteByte(c)
+			}
+			if !closed {
+				return nil, "", fmt.Errorf("unterminated structured data value in %s", id)
+			}
+			params[name] = b.String()
+		}
+		if !strings.HasPrefix(s, "]") {
+			return nil, "", fmt.Errorf("unterminated structured data element %s", id)
+		}
+		s = s[1:]
+		sd[id] = params
+	}
+	return sd, s, nil
+}
+
+// parse3164 parses "TIMESTAMP HOSTNAME TAG[PID]: MSG". Senders commonly omit
+// the hostname or use an RFC 3339 timestamp, so each part is optional.
+func parse3164(m *Message, s string, now time.Time) {
+	if len(s) >= 16 && s[15] == ' ' {
+		if ts, err := time.ParseInLocation(time.Stamp, s[:15], time.Local); err == nil {
+			ts = time.Date(now.Year(), ts.Month(), ts.Day(), ts.Hour(), ts.Minute(), ts.Second(), 0, time.Local)
+			// BSD timestamps have no year; December messages received in January
+			// belong to the previous year
+			if ts.After(now.Add(24 * time.Hour)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+			m.Timestamp = ts
+			s = s[16:]
+		}
+	}
+	if m.Timestamp.IsZero() {
+		if sp := strings.IndexByte(s, ' '); sp > 0 {
+			if ts, err := time.Parse(time.RFC3339Nano, s[:sp]); err == nil {
+				m.Timestamp = ts
+				s = s[sp+1:]
+			}
+		}
+	}
+
+	// HOSTNAME is present when the first word is not itself the tag but the
+	// second one is
+	if sp := strings.IndexByte(s, ' '); sp > 0 && !strings.ContainsAny(s[:sp], ":[") {
+		next := s[sp+1:]
+		if end := strings.IndexByte(next, ' '); end > 0 {
+			next = next[:end]
+		}
+		if strings.HasSuffix(next, ":") || strings.Contains(next, "[") {
+			m.Hostname = s[:sp]
+			s = s[sp+1:]
+		}
+	}
+
+	// TAG ends in [pid] and/or ':'; RFC 3164 caps it at 32 chars but senders exceed that
+	if end := strings.IndexAny(s, ":[ "); end > 0 && end <= 48 {
+		tag := s[:end]
+		rest := s[end:]
+		if strings.HasPrefix(rest, "[") {
+			if rb := strings.Index(rest, "]"); rb > 0 {
+				m.ProcID = rest[1:rb]
+				rest = rest[rb+1:]
+			}
+		}
+		if strings.HasPrefix(rest, ":") {
+			m.AppName = tag
+			s = strings.TrimPrefix(rest[1:], " ")
+		}
+	}
+	m.Message = s
+}
+
+func nilValue(v string) string {
+	if v == "-" {
+		return ""
+	}
+	return v
+}
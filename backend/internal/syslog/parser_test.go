@@ -0,0 +1,166 @@
+package syslog
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePRI(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		in                 string
+		facility, severity string
+		level              string
+	}{
+		{"<0>kernel: panic", "kern", "emerg", "fatal"},
+		{"<10>su: denied", "user", "crit", "fatal"},
+		{"<11>app: failed", "user", "err", "error"},
+		{"<28>ntpd: drift", "daemon", "warning", "warn"},
+		{"<38>sshd: accepted", "auth", "info", "info"},
+		{"<85>sudo: session", "authpriv", "notice", "info"},
+		{"<134>nginx: request", "local0", "info", "info"},
+		{"<191>app: trace", "local7", "debug", "debug"},
+		{"no pri at all", "user", "notice", "info"},
+	}
+	for _, tt := range tests {
+		m, err := Parse([]byte(tt.in), now)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if m.FacilityName() != tt.facility || m.SeverityName() != tt.severity || m.Level() != tt.level {
+			t.Errorf("Parse(%q) = %s.%s (%s), want %s.%s (%s)", tt.in,
+				m.FacilityName(), m.SeverityName(), m.Level(), tt.facility, tt.severity, tt.level)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"\r\n",
+		"<>msg",
+		"<1234>msg",
+		"<192>msg",
+		"<-1>msg",
+		"<abc>msg",
+		"<13>1 2024-05-01T12:00:00Z host",
+		"<13>1 yesterday host app - - - msg",
+		"<13>1 - host app - - [id a=\"b] msg",
+		"<13>1 - host app - - [id a=\"b\" msg",
+	} {
+		if _, err := Parse([]byte(in), time.Now()); err == nil {
+			t.Errorf("Parse(%q): expected an error", in)
+		}
+	}
+}
+
+func TestParse3164(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		in   string
+		want Message
+	}{
+		{
+			"<34>Apr 30 22:14:15 mymachine su[123]: 'su root' failed",
+			Message{Facility: 4, Severity: 2, Timestamp: time.Date(2024, 4, 30, 22, 14, 15, 0, time.Local),
+				Hostname: "mymachine", AppName: "su", ProcID: "123", Message: "'su root' failed"},
+		},
+		{
+			// no hostname
+			"<13>May  1 11:59:00 cron: job done",
+			Message{Facility: 1, Severity: 5, Timestamp: time.Date(2024, 5, 1, 11, 59, 0, 0, time.Local),
+				AppName: "cron", Message: "job done"},
+		},
+		{
+			// no year: a December message received in May is from this year's
+			// past, one dated tomorrow+ belongs to the previous year
+			"<13>Dec 31 23:59:59 web-1 app: late",
+			Message{Facility: 1, Severity: 5, Timestamp: time.Date(2023, 12, 31, 23, 59, 59, 0, time.Local),
+				Hostname: "web-1", AppName: "app", Message: "late"},
+		},
+		{
+			"<13>2024-05-01T10:00:00Z web-1 app[7]: rfc3339 stamp",
+			Message{Facility: 1, Severity: 5, Timestamp: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+				Hostname: "web-1", AppName: "app", ProcID: "7", Message: "rfc3339 stamp"},
+		},
+		{
+			// no timestamp, hostname or tag
+			"<13>just some text",
+			Message{Facility: 1, Severity: 5, Timestamp: now, Message: "just some text"},
+		},
+	}
+	for _, tt := range tests {
+		m, err := Parse([]byte(tt.in), now)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if !m.Timestamp.Equal(tt.want.Timestamp) {
+			t.Errorf("Parse(%q) timestamp = %v, want %v", tt.in, m.Timestamp, tt.want.Timestamp)
+		}
+		m.Timestamp = tt.want.Timestamp
+		if !reflect.DeepEqual(*m, tt.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.in, *m, tt.want)
+		}
+	}
+}
+
+func TestParse3164YearRollover(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 5, 0, 0, time.Local)
+	m, err := Parse([]byte("<13>Dec 31 23:59:00 web-1 app: sent before midnight"), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Timestamp.Year() != 2024 {
+		t.Errorf("timestamp = %v, want December 2024", m.Timestamp)
+	}
+}
+
+func TestParse5424(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want Message
+	}{
+		{
+			`<165>1 2024-05-01T10:00:00.003Z web-1 evntslog 42 ID47 [exampleSDID@32473 iut="3" eventSource="Application"][meta seq="1"] An application event`,
+			Message{Facility: 20, Severity: 5, Timestamp: time.Date(2024, 5, 1, 10, 0, 0, 3e6, time.UTC),
+				Hostname: "web-1", AppName: "evntslog", ProcID: "42", MsgID: "ID47",
+				StructuredData: map[string]map[string]string{
+					"exampleSDID@32473": {"iut": "3", "eventSource": "Application"},
+					"meta":              {"seq": "1"},
+				},
+				Message: "An application event"},
+		},
+		{
+			`<13>1 - - - - - [q a="x \"y\" \] \\z"]`,
+			Message{Facility: 1, Severity: 5, Timestamp: now,
+				StructuredData: map[string]map[string]string{"q": {"a": `x "y" ] \z`}}},
+		},
+		{
+			"<13>1 2024-05-01T10:00:00+02:00 host app - - [empty]",
+			Message{Facility: 1, Severity: 5, Timestamp: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC),
+				Hostname: "host", AppName: "app", StructuredData: map[string]map[string]string{"empty": {}}},
+		},
+		{
+			"<13>1 - host app - - - \ufeffbom message",
+			Message{Facility: 1, Severity: 5, Timestamp: now, Hostname: "host", AppName: "app", Message: "bom message"},
+		},
+	}
+	for _, tt := range tests {
+		m, err := Parse([]byte(tt.in), now)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if !m.Timestamp.Equal(tt.want.Timestamp) {
+			t.Errorf("Parse(%q) timestamp = %v, want %v", tt.in, m.Timestamp, tt.want.Timestamp)
+		}
+		m.Timestamp = tt.want.Timestamp
+		if !reflect.DeepEqual(*m, tt.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.in, *m, tt.want)
+		}
+	}
+}
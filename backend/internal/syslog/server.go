@@ -0,0 +1,301 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sakkurohilla/kineticops/backend/config"
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/models"
+	"github.com/sakkurohilla/kineticops/backend/internal/services"
+)
+
+const (
+	// maxMessageSize bounds a single frame; RFC 5425 receivers must accept
+	// at least 2048 octets and commonly allow much more.
+	maxMessageSize = 64 * 1024
+	// connIdleTimeout closes stream connections that stop sending.
+	connIdleTimeout = 10 * time.Minute
+	// hostCacheTTL bounds how long a sender-to-host mapping is reused, so
+	// hosts added later are picked up without a restart.
+	hostCacheTTL = time.Minute
+)
+
+// Server receives syslog over UDP, TCP and TLS and stores messages as logs.
+type Server struct {
+	tenantID  int64
+	packet    net.PacketConn
+	listeners []net.Listener
+	wg        sync.WaitGroup
+
+	mu        sync.Mutex
+	hostCache map[string]hostCacheEntry
+}
+
+type hostCacheEntry struct {
+	host    models.Host
+	expires time.Time
+}
+
+// Start opens the listeners configured in cfg (SYSLOG_UDP_ADDR,
+// SYSLOG_TCP_ADDR and SYSLOG_TLS_ADDR with SYSLOG_TLS_CERT/KEY). It returns
+// nil when none is configured. Senders are mapped to hosts of
+// SYSLOG_TENANT_ID, or of any tenant when unset; messages from unknown
+// senders are kept (with no host) only when a tenant is configured.
+func Start(cfg *config.Config) *Server {
+	if cfg.SyslogUDPAddr == "" && cfg.SyslogTCPAddr == "" && cfg.SyslogTLSAddr == "" {
+		return nil
+	}
+
+	s := &Server{tenantID: cfg.SyslogTenantID, hostCache: make(map[string]hostCacheEntry)}
+
+	if cfg.SyslogUDPAddr != "" {
+		pc, err := net.ListenPacket("udp", cfg.SyslogUDPAddr)
+		if err != nil {
+			logging.Errorf("[SYSLOG] UDP listen on %s failed: %v", cfg.SyslogUDPAddr, err)
+		} else {
+			s.packet = pc
+			s.wg.Add(1)
+			go s.serveUDP(pc)
+			logging.Infof("[SYSLOG] UDP receiver listening on %s", cfg.SyslogUDPAddr)
+		}
+	}
+
+	if cfg.SyslogTCPAddr != "" {
+		lis, err := net.Listen("tcp", cfg.SyslogTCPAddr)
+		if err != nil {
+			logging.Errorf("[SYSLOG] TCP listen on %s failed: %v", cfg.SyslogTCPAddr, err)
+		} else {
+			s.serveStream(lis)
+			logging.Infof("[SYSLOG] TCP receiver listening on %s", cfg.SyslogTCPAddr)
+		}
+	}
+
+	if cfg.SyslogTLSAddr != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.SyslogTLSCert, cfg.SyslogTLSKey)
+		if err != nil {
+			logging.Errorf("[SYSLOG] TLS certificate load failed: %v", err)
+		} else if lis, err := tls.Listen("tcp", cfg.SyslogTLSAddr, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}); err != nil {
+			logging.Errorf("[SYSLOG] TLS listen on %s failed: %v", cfg.SyslogTLSAddr, err)
+		} else {
+			s.serveStream(lis)
+			logging.Infof("[SYSLOG] TLS receiver listening on %s", cfg.SyslogTLSAddr)
+		}
+	}
+
+	return s
+}
+
+// Stop closes all listeners and waits for the accept loops to exit.
+func (s *Server) Stop() {
+	if s.packet != nil {
+		_ = s.packet.Close()
+	}
+	for _, lis := range s.listeners {
+		_ = lis.Close()
+	}
+	s.wg.Wait()
+}
+
+func (s *Server) serveUDP(pc net.PacketConn) {
+	defer s.wg.Done()
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			logging.Warnf("[SYSLOG] UDP read failed: %v", err)
+			continue
+		}
+		s.handle(buf[:n], addrIP(addr))
+	}
+}
+
+func (s *Server) serveStream(lis net.Listener) {
+	s.listeners = append(s.listeners, lis)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				logging.Warnf("[SYSLOG] accept failed: %v", err)
+				continue
+			}
+			go s.serveConn(conn)
+		}
+	}()
+}
+
+// serveConn reads frames from a stream connection. Both RFC 6587 framings
+// are accepted per frame: octet counting ("LEN SP MSG", mandatory for RFC
+// 5425 TLS) and newline-terminated messages.
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	ip := addrIP(conn.RemoteAddr())
+	r := bufio.NewReaderSize(conn, maxMessageSize)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(connIdleTimeout))
+		frame, err := readFrame(r)
+		if len(frame) > 0 {
+			s.handle(frame, ip)
+		}
+		if err != nil {
+			var ne net.Error
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) && !(errors.As(err, &ne) && ne.Timeout()) {
+				logging.Warnf("[SYSLOG] connection from %s closed: %v", ip, err)
+			}
+			return
+		}
+	}
+}
+
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] >= '1' && first[0] <= '9' {
+		// octet counting: MSG-LEN SP MSG. The length is read digit by digit so
+		// a sender that never sends the space cannot make us buffer forever.
+		n := 0
+		for {
+			c, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if c == ' ' {
+				break
+			}
+			if c < '0' || c > '9' || n > maxMessageSize {
+				return nil, fmt.Errorf("invalid frame length")
+			}
+			n = n*10 + int(c-'0')
+		}
+		if n <= 0 || n > maxMessageSize {
+			return nil, fmt.Errorf("invalid frame length %d", n)
+		}
+		frame := make([]byte, n)
+		if _, err := io.ReadFull(r, frame); err != nil {
+			return nil, err
+		}
+		return frame, nil
+	}
+
+	line, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		// oversized message: keep the first maxMessageSize bytes, drop the rest
+		frame := append([]byte(nil), line...)
+		for errors.Is(err, bufio.ErrBufferFull) {
+			_, err = r.ReadSlice('\n')
+		}
+		return frame, err
+	}
+	return append([]byte(nil), line...), err
+}
+
+func (s *Server) handle(raw []byte, senderIP string) {
+	msg, err := Parse(raw, time.Now())
+	if err != nil {
+		return
+	}
+
+	host, cached := s.lookupHost(msg.Hostname, senderIP)
+	tenantID := s.tenantID
+	if tenantID == 0 {
+		if host.ID == 0 {
+			// warn once per cache period rather than per message
+			if !cached {
+				logging.Warnf("[SYSLOG] dropping messages from unknown sender %s (%s)", senderIP, msg.Hostname)
+			}
+			return
+		}
+		tenantID = host.TenantID
+	}
+
+	meta := map[string]string{
+		"source":    "syslog",
+		"facility":  msg.FacilityName(),
+		"severity":  msg.SeverityName(),
+		"source_ip": senderIP,
+	}
+	for k, v := range map[string]string{"hostname": msg.Hostname, "app_name": msg.AppName, "proc_id": msg.ProcID, "msg_id": msg.MsgID} {
+		if v != "" {
+			meta[k] = v
+		}
+	}
+	for id, params := range msg.StructuredData {
+		for k, v := range params {
+			meta[id+"."+k] = v
+		}
+	}
+
+	l := &models.Log{
+		TenantID:  tenantID,
+		HostID:    host.ID,
+		Timestamp: msg.Timestamp,
+		Level:     msg.Level(),
+		Message:   msg.Message,
+		Meta:      meta,
+	}
+	if err := services.CollectLog(context.Background(), l); err != nil {
+		logging.Warnf("[SYSLOG] failed to persist log from %s: %v", senderIP, err)
+		return
+	}
+	services.MarkHostSeen(host.ID)
+	services.BroadcastLog(l)
+}
+
+// lookupHost maps the sender to a host by IP, then by the hostname in the
+// message, caching results (including misses) for hostCacheTTL. The bool
+// reports whether the result came from the cache.
+func (s *Server) lookupHost(hostname, ip string) (models.Host, bool) {
+	key := ip + "|" + hostname
+	now := time.Now()
+
+	s.mu.Lock()
+	if e, ok := s.hostCache[key]; ok && now.Before(e.expires) {
+		s.mu.Unlock()
+		return e.host, true
+	}
+	s.mu.Unlock()
+
+	host := services.FindHostBySender(hostname, ip, s.tenantID)
+
+	s.mu.Lock()
+	if len(s.hostCache) > 10000 {
+		s.hostCache = make(map[string]hostCacheEntry)
+	}
+	s.hostCache[key] = hostCacheEntry{host: host, expires: now.Add(hostCacheTTL)}
+	s.mu.Unlock()
+	return host, false
+}
+
+func addrIP(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP.String()
+	case *net.TCPAddr:
+		return a.IP.String()
+	}
+	if h, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return h
+	}
+	return addr.String()
+}
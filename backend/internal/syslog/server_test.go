@@ -0,0 +1,85 @@
+package syslog
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func readFrames(t *testing.T, in string) ([]string, error) {
+	t.Helper()
+	r := bufio.NewReaderSize(strings.NewReader(in), maxMessageSize)
+	var frames []string
+	for {
+		frame, err := readFrame(r)
+		if len(frame) > 0 {
+			frames = append(frames, string(frame))
+		}
+		if err != nil {
+			return frames, err
+		}
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"11 <13>hello a5 <13>b", []string{"<13>hello a", "<13>b"}},
+		{"<13>one\n<13>two\n", []string{"<13>one\n", "<13>two\n"}},
+		{"<13>no trailing newline", []string{"<13>no trailing newline"}},
+		{"9 <13>a\nb c\n<13>d\n", []string{"<13>a\nb c", "\n", "<13>d\n"}},
+		{"5 <13>x<13>y\n", []string{"<13>x", "<13>y\n"}},
+	}
+	for _, tt := range tests {
+		got, err := readFrames(t, tt.in)
+		if err != io.EOF {
+			t.Errorf("readFrame(%q): %v", tt.in, err)
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("readFrame(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestReadFrameLength(t *testing.T) {
+	max := strings.Repeat("x", maxMessageSize)
+	tests := []struct {
+		name    string
+		in      string
+		wantLen int
+		wantErr bool
+	}{
+		{"exactly max", strconv.Itoa(maxMessageSize) + " " + max, maxMessageSize, false},
+		{"over max", strconv.Itoa(maxMessageSize+1) + " " + max + "x", 0, true},
+		{"huge length", "99999999999999999999 x", 0, true},
+		{"non-digit in length", "12a <13>x", 0, true},
+		{"length without space", strings.Repeat("9", 100), 0, true},
+		{"truncated frame", "10 <13>x", 0, true},
+	}
+	for _, tt := range tests {
+		r := bufio.NewReaderSize(strings.NewReader(tt.in), maxMessageSize)
+		frame, err := readFrame(r)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if len(frame) != tt.wantLen {
+			t.Errorf("%s: frame length = %d, want %d", tt.name, len(frame), tt.wantLen)
+		}
+	}
+}
+
+func TestReadFrameOversizedLine(t *testing.T) {
+	in := "<13>" + strings.Repeat("x", 2*maxMessageSize) + "\n<13>next\n"
+	got, err := readFrames(t, in)
+	if err != io.EOF {
+		t.Fatalf("readFrame: %v", err)
+	}
+	if len(got) != 2 || len(got[0]) != maxMessageSize || got[1] != "<13>next\n" {
+		t.Errorf("oversized line: got %d frames (first %d bytes), want the first %d bytes then the next message",
+			len(got), len(got[0]), maxMessageSize)
+	}
+}
@@ -15,35 +15,59 @@ type Client struct {
 	conn   *websocket.Conn
 	send   chan []byte
 	userID int64
-	// simple token-bucket limiter fields (tokens refill over time)
-	limiterMu     sync.Mutex
-	limiterTokens float64
-	limiterLast   time.Time
-	limiterRate   float64 // tokens per second
-	limiterBurst  float64 // max tokens
+	// tenantID scopes tenant data such as live log tails
+	tenantID int64
+	// limiter caps the rate of broadcast messages sent to this client
+	limiter *tokenBucket
+
+	// subsMu guards topics and logSubs, which are touched by ReadPump and
+	// hub publishers
+	subsMu sync.Mutex
+	// topics narrows host events; empty means every event of the tenant
+	topics  map[string]bool
+	logSubs map[string]*logSubscription
+	subSeq  int
 }
 
 // AllowSend attempts to consume `n` tokens from the client's bucket and
 // returns true when there are enough tokens. It is safe for concurrent use.
 func (c *Client) AllowSend(n int) bool {
-	c.limiterMu.Lock()
-	defer c.limiterMu.Unlock()
+	return c.limiter.Allow(n)
+}
+
+// tokenBucket is a simple token-bucket limiter (tokens refill over time).
+type tokenBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	rate   float64 // tokens per second
+	burst  float64 // max tokens
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst}
+}
+
+// Allow consumes n tokens when available. It is safe for concurrent use.
+func (b *tokenBucket) Allow(n int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	now := time.Now()
-	if c.limiterLast.IsZero() {
-		c.limiterLast = now
+	if b.last.IsZero() {
+		b.last = now
 		// initialize tokens to full burst on first use
-		c.limiterTokens = c.limiterBurst
+		b.tokens = b.burst
 	}
-	elapsed := now.Sub(c.limiterLast).Seconds()
+	elapsed := now.Sub(b.last).Seconds()
 	if elapsed > 0 {
-		c.limiterTokens += elapsed * c.limiterRate
-		if c.limiterTokens > c.limiterBurst {
-			c.limiterTokens = c.limiterBurst
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
 		}
-		c.limiterLast = now
+		b.last = now
 	}
-	if float64(n) <= c.limiterTokens {
-		c.limiterTokens -= float64(n)
+	if float64(n) <= b.tokens {
+		b.tokens -= float64(n)
 		return true
 	}
 	return false
@@ -80,13 +104,14 @@ func (c *Client) ReadPump() {
 	})
 
 	for {
-		_, _, err := c.conn.ReadMessage()
+		_, msg, err := c.conn.ReadMessage()
 		if err != nil {
 			// log read error for diagnostics
 			logging.Warnf("[WS CLIENT] read error user=%d remote=%v: %v", c.userID, c.conn.RemoteAddr(), err)
 			break
 		}
-		// No need to process incoming for now.
+		// control messages: subscribe/unsubscribe (see subscription.go)
+		c.handleControl(msg)
 	}
 }
 
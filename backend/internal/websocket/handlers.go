@@ -84,9 +84,10 @@ func WsHandler(hub *Hub, jwtSecret string) func(*websocket.Conn) {
 		_ = c.WriteMessage(websocket.TextMessage, []byte("{\"type\":\"auth_ok\"}"))
 
 		client := &Client{hub: hub, conn: c, send: make(chan []byte, 256), userID: userID,
+			// tenant currently maps to the owning user id (see middleware.AuthRequired)
+			tenantID: userID,
 			// sensible defaults: 50 messages/sec with a small burst
-			limiterRate:  50.0,
-			limiterBurst: 100.0,
+			limiter: newTokenBucket(50.0, 100.0),
 		}
 		hub.register <- client
 		go client.WritePump()
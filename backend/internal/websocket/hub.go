@@ -3,8 +3,9 @@ package websocket
 import (
 	"encoding/json"
 	"fmt"
-	"runtime"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/sakkurohilla/kineticops/backend/internal/logging"
 	"github.com/sakkurohilla/kineticops/backend/internal/telemetry"
@@ -12,93 +13,51 @@ import (
 
 // No need to import github.com/gofiber/contrib/websocket here!
 
+// Hub routes host events to the websocket clients of the owning tenant.
+// Every message is published with its tenant, host and type; clients only
+// ever receive their own tenant's messages, narrowed further by topic
+// subscriptions (see subscription.go).
 type Hub struct {
 	clients    map[*Client]bool
-	broadcast  chan []byte
 	register   chan *Client
 	unregister chan *Client
 	mu         sync.Mutex
 	maxClients int // Enterprise connection limit
-	// lastMessages keeps the most recent message per host_id and message type
-	// so new clients can receive a warm-up snapshot when they connect.
+	// lastMessages keeps the most recent message per tenant, host_id and
+	// message type so new clients can receive a warm-up snapshot of their
+	// tenant's hosts when they connect.
 	// Key format: "hostID:type" (e.g., "6:services", "6:metric")
-	lastMessages map[string]struct {
-		Seq uint64
-		Msg []byte
-	}
-	// broadcastQueue decouples producers from the actual per-client sends so a
-	// single slow client won't block the publisher. Workers read from this
-	// queue and fan-out messages to active clients.
-	broadcastQueue chan []byte
-	workerCount    int
-	// maximum number of host warm-up messages to retain to avoid unbounded
-	// memory growth in high-scale scenarios.
+	lastMessages map[int64]map[string]cachedMessage
+	// maximum number of host warm-up messages to retain per tenant to avoid
+	// unbounded memory growth in high-scale scenarios.
 	maxLastMessages int
 }
 
+type cachedMessage struct {
+	Seq uint64
+	Msg []byte
+}
+
 func NewHub() *Hub {
-	workerCount := runtime.NumCPU()
-	queueSize := 10000
 	return &Hub{
-		clients:    make(map[*Client]bool),
-		broadcast:  make(chan []byte),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		maxClients: 10000, // Enterprise limit
-		lastMessages: make(map[string]struct {
-			Seq uint64
-			Msg []byte
-		}),
-		broadcastQueue:  make(chan []byte, queueSize),
-		workerCount:     workerCount,
+		clients:         make(map[*Client]bool),
+		register:        make(chan *Client),
+		unregister:      make(chan *Client),
+		maxClients:      10000, // Enterprise limit
+		lastMessages:    make(map[int64]map[string]cachedMessage),
 		maxLastMessages: 2000,
 	}
 }
 
 func (h *Hub) Run() {
-	// start broadcast worker pool
-	for i := 0; i < h.workerCount; i++ {
-		go func(id int) {
-			for msg := range h.broadcastQueue {
-				h.mu.Lock()
-				var msgData map[string]interface{}
-				targetUserID := int64(-1)
-				if json.Unmarshal(msg, &msgData) == nil {
-					if userID, ok := msgData["target_user_id"]; ok {
-						if uid, ok := userID.(float64); ok {
-							targetUserID = int64(uid)
-						}
-					}
-				}
-
-				for client := range h.clients {
-					if targetUserID != -1 && client.userID != targetUserID {
-						continue
-					}
-					// Respect per-client token-bucket limiter. If the client is over its
-					// send rate, count a drop and skip sending to that client.
-					if !client.AllowSend(1) {
-						telemetry.IncClientSendDrop()
-						continue
-					}
-					select {
-					case client.send <- msg:
-					default:
-						// If client's buffer is full, drop the client to reclaim resources
-						telemetry.IncClientDisconnect()
-						close(client.send)
-						delete(h.clients, client)
-					}
-				}
-				h.mu.Unlock()
-				// update hub queue length metric
-				telemetry.SetHubQueueLength(len(h.broadcastQueue))
-			}
-		}(i)
-	}
+	// report lines dropped from live tails once per second
+	dropTicker := time.NewTicker(time.Second)
+	defer dropTicker.Stop()
 
 	for {
 		select {
+		case <-dropTicker.C:
+			h.flushDroppedNotices()
 		case client := <-h.register:
 			h.mu.Lock()
 			// Check connection limit
@@ -109,17 +68,14 @@ func (h *Hub) Run() {
 				continue
 			}
 			h.clients[client] = true
-			fmt.Printf("[WS HUB] registered client user=%d, total_clients=%d\n", client.userID, len(h.clients))
+			fmt.Printf("[WS HUB] registered client user=%d tenant=%d, total_clients=%d\n", client.userID, client.tenantID, len(h.clients))
 			telemetry.SetTotalClients(len(h.clients))
-			// send warm-up messages (last known metrics) to the newly registered client
-			// best-effort: skip warming when lastMessages map is too large
-			if len(h.lastMessages) <= h.maxLastMessages {
-				for _, entry := range h.lastMessages {
-					select {
-					case client.send <- entry.Msg:
-					default:
-						// skip if buffer full
-					}
+			// send warm-up messages (last known host state) of the client's tenant
+			for _, entry := range h.lastMessages[client.tenantID] {
+				select {
+				case client.send <- entry.Msg:
+				default:
+					// skip if buffer full
 				}
 			}
 			h.mu.Unlock()
@@ -132,26 +88,39 @@ func (h *Hub) Run() {
 				telemetry.SetTotalClients(len(h.clients))
 			}
 			h.mu.Unlock()
-		case message := <-h.broadcast:
-			// enqueue into broadcastQueue; drop if queue is full to avoid blocking
-			select {
-			case h.broadcastQueue <- message:
-				telemetry.SetHubQueueLength(len(h.broadcastQueue))
-			default:
-				// queue full — drop message and log
-				logging.Warnf("[WS HUB] broadcast queue full, dropping message")
-				telemetry.IncBroadcastQueueDrop()
-			}
 		}
 	}
 }
 
-func (h *Hub) Broadcast(msg []byte) {
-	// Lock while iterating/modifying the clients map to avoid concurrent map access
+// topicFor maps a message type to its subscription topic.
+func topicFor(msgType string) string {
+	switch msgType {
+	case "", "metric":
+		return "metrics"
+	case "alert":
+		return "alerts"
+	}
+	return msgType
+}
+
+// Publish remembers msg for warm-up (when it belongs to a host) and sends it
+// to the tenant's clients whose subscriptions cover the host or the topic of
+// msgType.
+func (h *Hub) Publish(tenantID, hostID int64, msgType string, seq uint64, msg []byte) {
+	if tenantID == 0 {
+		return
+	}
+	if hostID != 0 {
+		h.remember(tenantID, hostID, msgType, seq, msg)
+	}
+	topic := topicFor(msgType)
+
 	h.mu.Lock()
 	defer h.mu.Unlock()
-
 	for c := range h.clients {
+		if c.tenantID != tenantID || !c.wants(hostID, topic) {
+			continue
+		}
 		if !c.AllowSend(1) {
 			telemetry.IncClientSendDrop()
 			continue
@@ -168,45 +137,47 @@ func (h *Hub) Broadcast(msg []byte) {
 	}
 }
 
-// RememberMessage stores a message (if it contains host_id) for warm-up on new
-// client registration.
-func (h *Hub) RememberMessage(msg []byte) {
-	// best-effort parse host_id from JSON
-	var tmp map[string]interface{}
-	if err := json.Unmarshal(msg, &tmp); err != nil {
-		return
+// PublishRaw routes a marshalled event carrying its own tenant_id, host_id,
+// type and optional seq fields, as produced by PublishEvent and relayed
+// through Redpanda.
+func (h *Hub) PublishRaw(msg []byte) error {
+	var head struct {
+		TenantID int64  `json:"tenant_id"`
+		HostID   int64  `json:"host_id"`
+		Type     string `json:"type"`
+		Seq      uint64 `json:"seq"`
 	}
-	if hidRaw, ok := tmp["host_id"]; ok {
-		// JSON numbers decode as float64
-		if fid, ok2 := hidRaw.(float64); ok2 {
-			hid := int64(fid)
-			// extract seq (if present) and only replace stored message when seq is newer
-			var seq uint64 = 0
-			if sRaw, ok := tmp["seq"]; ok {
-				switch s := sRaw.(type) {
-				case float64:
-					seq = uint64(s)
-				case int64:
-					seq = uint64(s)
-				}
-			}
-			// Get message type for composite key
-			msgType := "unknown"
-			if mType, ok := tmp["type"].(string); ok {
-				msgType = mType
-			}
-			key := fmt.Sprintf("%d:%s", hid, msgType)
+	if err := json.Unmarshal(msg, &head); err != nil {
+		return err
+	}
+	if head.TenantID == 0 {
+		return fmt.Errorf("event has no tenant_id")
+	}
+	h.Publish(head.TenantID, head.HostID, head.Type, head.Seq, msg)
+	return nil
+}
 
-			h.mu.Lock()
-			existing, ok := h.lastMessages[key]
-			if !ok || seq > existing.Seq {
-				h.lastMessages[key] = struct {
-					Seq uint64
-					Msg []byte
-				}{Seq: seq, Msg: msg}
-			}
-			h.mu.Unlock()
-		}
+// remember stores a host message for warm-up on new client registration,
+// replacing the cached one unless it carries an older seq.
+func (h *Hub) remember(tenantID, hostID int64, msgType string, seq uint64, msg []byte) {
+	if msgType == "" {
+		msgType = "metric"
+	}
+	key := strconv.FormatInt(hostID, 10) + ":" + msgType
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cache := h.lastMessages[tenantID]
+	if cache == nil {
+		cache = make(map[string]cachedMessage)
+		h.lastMessages[tenantID] = cache
+	}
+	existing, ok := cache[key]
+	if !ok && len(cache) >= h.maxLastMessages {
+		return
+	}
+	if !ok || seq == 0 || seq > existing.Seq {
+		cache[key] = cachedMessage{Seq: seq, Msg: msg}
 	}
 }
 
@@ -223,17 +194,38 @@ func GetGlobalHub() *Hub {
 	return globalHub
 }
 
-// BroadcastToClients sends msg to all connected websocket clients if hub is available.
-// This is a best-effort non-blocking call.
-func BroadcastToClients(msg []byte) {
+// PublishEvent stamps payload with tenant_id and host_id, marshals it and
+// publishes it via the global hub. payload["type"] selects the topic
+// (metric, services, processes, alert, ...); payload["seq"] orders warm-up
+// replacement.
+func PublishEvent(tenantID, hostID int64, payload map[string]interface{}) {
 	if globalHub == nil {
-		// helpful debug when broadcasting during startup or when hub isn't set
-		fmt.Printf("[WS BROADCAST] no global hub available, dropping message: %s\n", string(msg))
 		return
 	}
-	// report number of connected clients for diagnostics, then hand off to hub
-	fmt.Printf("[WS BROADCAST] broadcasting message to %d clients\n", GetGlobalClientCount())
-	globalHub.Broadcast(msg)
+	if tenantID == 0 {
+		logging.Warnf("[WS HUB] dropping event for host=%d without tenant", hostID)
+		return
+	}
+	payload["tenant_id"] = tenantID
+	if hostID != 0 {
+		payload["host_id"] = hostID
+	}
+	msgType, _ := payload["type"].(string)
+	var seq uint64
+	switch s := payload["seq"].(type) {
+	case uint64:
+		seq = s
+	case int64:
+		seq = uint64(s)
+	case int:
+		seq = uint64(s)
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		logging.Warnf("[WS HUB] failed to marshal %s event: %v", msgType, err)
+		return
+	}
+	globalHub.Publish(tenantID, hostID, msgType, seq, b)
 }
 
 // ClientCount returns the current number of connected clients
@@ -251,8 +243,9 @@ func GetGlobalClientCount() int {
 	return globalHub.ClientCount()
 }
 
-// GetLastServicesForHost retrieves the last cached services message for a specific host
-func GetLastServicesForHost(hostID int64) (map[string]interface{}, error) {
+// GetLastServicesForHost retrieves the last cached services message for a
+// host of the given tenant.
+func GetLastServicesForHost(tenantID, hostID int64) (map[string]interface{}, error) {
 	if globalHub == nil {
 		return nil, fmt.Errorf("global hub not initialized")
 	}
@@ -262,7 +255,7 @@ func GetLastServicesForHost(hostID int64) (map[string]interface{}, error) {
 
 	// Use composite key with "services" type
 	key := fmt.Sprintf("%d:services", hostID)
-	cached, exists := globalHub.lastMessages[key]
+	cached, exists := globalHub.lastMessages[tenantID][key]
 	if !exists {
 		return nil, fmt.Errorf("no cached services for host %d", hostID)
 	}
@@ -279,7 +272,3 @@ func GetLastServicesForHost(hostID int64) (map[string]interface{}, error) {
 
 	return msgData, nil
 }
-
-//func (h *Hub) Broadcast(data []byte) {
-//	h.broadcast <- data
-//}
@@ -0,0 +1,369 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/logquery"
+	"github.com/sakkurohilla/kineticops/backend/internal/models"
+	"github.com/sakkurohilla/kineticops/backend/internal/telemetry"
+)
+
+const (
+	// maxLogSubscriptions bounds live tails per connection.
+	maxLogSubscriptions = 10
+	// maxTopics bounds topic subscriptions per connection.
+	maxTopics = 100
+	// defaultLogRate and maxLogRate are lines per second per subscription.
+	defaultLogRate = 50
+	maxLogRate     = 500
+)
+
+// Host events. Without topic subscriptions a client receives every host
+// event of its tenant. After
+//
+//	{"type":"subscribe","topics":["host:3","alerts"]}
+//
+// it only receives events of the subscribed hosts (any type) and of the
+// subscribed topics: metrics, services, processes and alerts. The server
+// answers {"type":"subscribed","topics":[...]} with the full topic set;
+// {"type":"unsubscribe","topics":[...]} removes topics again, and removing
+// the last one restores the tenant-wide default.
+//
+// Live log tails. After auth a client subscribes with
+//
+//	{"type":"subscribe","stream":"logs","id":"tail-1",
+//	 "query":{"host_id":3,"level":"error,warn","service":"api","text":"timeout"},
+//	 "rate":100}
+//
+// where query may instead be a log query string (see package logquery) and
+// its object form may also carry one as "q". The server answers
+// {"type":"subscribed",...} and then sends {"type":"log","subscription":id,
+// "log":{...}} for each matching log of the client's tenant. Lines over the
+// subscription rate, or that do not fit the client's send buffer, are
+// counted and reported as {"type":"dropped","subscription":id,"count":N}.
+// {"type":"unsubscribe","id":"tail-1"} ends a tail.
+
+type logSubscription struct {
+	id      string
+	matcher *logquery.Matcher
+	limiter *tokenBucket
+	dropped int
+}
+
+type controlMessage struct {
+	Type   string          `json:"type"`
+	Stream string          `json:"stream"`
+	ID     string          `json:"id"`
+	Query  json.RawMessage `json:"query"`
+	Rate   int             `json:"rate"`
+	Topics []string        `json:"topics"`
+}
+
+type logSubscriptionQuery struct {
+	HostID  int64  `json:"host_id"`
+	Level   string `json:"level"`
+	Service string `json:"service"`
+	Source  string `json:"source"`
+	Text    string `json:"text"`
+	Q       string `json:"q"`
+}
+
+// handleControl processes a message sent by the client after auth.
+func (c *Client) handleControl(msg []byte) {
+	var m controlMessage
+	if err := json.Unmarshal(msg, &m); err != nil {
+		return
+	}
+	switch m.Type {
+	case "subscribe":
+		if len(m.Topics) > 0 && m.Stream == "" {
+			topics, err := c.subscribeTopics(m.Topics)
+			if err != nil {
+				c.reply(map[string]interface{}{"type": "error", "id": m.ID, "error": err.Error()})
+				return
+			}
+			c.reply(map[string]interface{}{"type": "subscribed", "topics": topics})
+			return
+		}
+		if m.Stream != "logs" {
+			c.reply(map[string]interface{}{"type": "error", "id": m.ID, "error": fmt.Sprintf("unknown stream %q", m.Stream)})
+			return
+		}
+		id, err := c.subscribeLogs(m)
+		if err != nil {
+			c.reply(map[string]interface{}{"type": "error", "id": m.ID, "error": err.Error()})
+			return
+		}
+		c.reply(map[string]interface{}{"type": "subscribed", "stream": "logs", "subscription": id})
+	case "unsubscribe":
+		if len(m.Topics) > 0 {
+			c.reply(map[string]interface{}{"type": "unsubscribed", "topics": c.unsubscribeTopics(m.Topics)})
+			return
+		}
+		c.subsMu.Lock()
+		_, ok := c.logSubs[m.ID]
+		delete(c.logSubs, m.ID)
+		c.subsMu.Unlock()
+		if ok {
+			c.reply(map[string]interface{}{"type": "unsubscribed", "subscription": m.ID})
+		}
+	}
+}
+
+// validTopic accepts the event topics and host:<id>.
+func validTopic(t string) bool {
+	switch t {
+	case "metrics", "services", "processes", "alerts":
+		return true
+	}
+	if id, ok := strings.CutPrefix(t, "host:"); ok {
+		n, err := strconv.ParseInt(id, 10, 64)
+		return err == nil && n > 0
+	}
+	return false
+}
+
+func (c *Client) subscribeTopics(topics []string) ([]string, error) {
+	for _, t := range topics {
+		if !validTopic(t) {
+			return nil, fmt.Errorf("unknown topic %q (use metrics, services, processes, alerts or host:<id>)", t)
+		}
+	}
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	if c.topics == nil {
+		c.topics = make(map[string]bool)
+	}
+	for _, t := range topics {
+		if !c.topics[t] && len(c.topics) >= maxTopics {
+			return nil, fmt.Errorf("too many topics (max %d)", maxTopics)
+		}
+		c.topics[t] = true
+	}
+	return c.topicList(), nil
+}
+
+func (c *Client) unsubscribeTopics(topics []string) []string {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	for _, t := range topics {
+		delete(c.topics, t)
+	}
+	return c.topicList()
+}
+
+// topicList returns the subscribed topics. Callers hold c.subsMu.
+func (c *Client) topicList() []string {
+	out := make([]string, 0, len(c.topics))
+	for t := range c.topics {
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// wants reports whether a host event passes the client's topic
+// subscriptions.
+func (c *Client) wants(hostID int64, topic string) bool {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	if len(c.topics) == 0 {
+		return true
+	}
+	return c.topics[topic] || (hostID != 0 && c.topics["host:"+strconv.FormatInt(hostID, 10)])
+}
+
+func (c *Client) subscribeLogs(m controlMessage) (string, error) {
+	node, err := logSubscriptionFilter(m.Query)
+	if err != nil {
+		return "", err
+	}
+	matcher, err := logquery.NewMatcher(node)
+	if err != nil {
+		return "", err
+	}
+
+	rate := m.Rate
+	if rate <= 0 {
+		rate = defaultLogRate
+	} else if rate > maxLogRate {
+		rate = maxLogRate
+	}
+
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	if c.logSubs == nil {
+		c.logSubs = make(map[string]*logSubscription)
+	}
+	id := m.ID
+	if id == "" {
+		c.subSeq++
+		id = "logs-" + strconv.Itoa(c.subSeq)
+	}
+	if _, exists := c.logSubs[id]; !exists && len(c.logSubs) >= maxLogSubscriptions {
+		return "", fmt.Errorf("too many subscriptions (max %d)", maxLogSubscriptions)
+	}
+	// re-subscribing with the same id replaces the filter
+	c.logSubs[id] = &logSubscription{
+		id:      id,
+		matcher: matcher,
+		limiter: newTokenBucket(float64(rate), float64(2*rate)),
+	}
+	return id, nil
+}
+
+// logSubscriptionFilter builds a log query from the subscribe "query" field,
+// which is either a query string or an object of common filters.
+func logSubscriptionFilter(raw json.RawMessage) (logquery.Node, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return logquery.Parse(text)
+	}
+
+	var q logSubscriptionQuery
+	if err := json.Unmarshal(raw, &q); err != nil {
+		return nil, fmt.Errorf("invalid query")
+	}
+	var nodes []logquery.Node
+	if q.HostID != 0 {
+		nodes = append(nodes, logquery.Term{Field: "host_id", Value: strconv.FormatInt(q.HostID, 10)})
+	}
+	if q.Level != "" {
+		var levels logquery.Or
+		for _, l := range strings.Split(q.Level, ",") {
+			if l = strings.TrimSpace(l); l != "" {
+				levels.Nodes = append(levels.Nodes, logquery.Term{Field: "level", Value: l})
+			}
+		}
+		nodes = append(nodes, levels)
+	}
+	if q.Service != "" {
+		nodes = append(nodes, logquery.Term{Field: "service", Value: q.Service})
+	}
+	if q.Source != "" {
+		nodes = append(nodes, logquery.Term{Field: "source", Value: q.Source})
+	}
+	if q.Text != "" {
+		nodes = append(nodes, logquery.Term{Value: q.Text, Phrase: true})
+	}
+	if q.Q != "" {
+		n, err := logquery.Parse(q.Q)
+		if err != nil {
+			return nil, err
+		}
+		if n != nil {
+			nodes = append(nodes, n)
+		}
+	}
+	switch len(nodes) {
+	case 0:
+		return nil, nil
+	case 1:
+		return nodes[0], nil
+	}
+	return logquery.And{Nodes: nodes}, nil
+}
+
+// reply sends a control response without blocking the reader.
+func (c *Client) reply(v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	// the hub closes send on unregister; only write while still registered
+	if _, ok := c.hub.clients[c]; !ok {
+		return
+	}
+	select {
+	case c.send <- b:
+	default:
+	}
+}
+
+// PublishLog delivers a stored log to the matching live-tail subscriptions
+// of its tenant. Slow clients lose lines rather than their connection.
+func (h *Hub) PublishLog(l *models.Log) {
+	body, err := json.Marshal(l)
+	if err != nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		if c.tenantID != l.TenantID {
+			continue
+		}
+		c.subsMu.Lock()
+		for _, sub := range c.logSubs {
+			if !sub.matcher.Match(l) {
+				continue
+			}
+			if !sub.limiter.Allow(1) || !c.flushDropped(sub) {
+				sub.dropped++
+				telemetry.IncClientSendDrop()
+				continue
+			}
+			msg := fmt.Appendf(nil, `{"type":"log","subscription":%s,"log":%s}`, jsonString(sub.id), body)
+			select {
+			case c.send <- msg:
+			default:
+				sub.dropped++
+				telemetry.IncClientSendDrop()
+			}
+		}
+		c.subsMu.Unlock()
+	}
+}
+
+// flushDropped sends the pending drop notice of sub, if any. It reports
+// false when the client's buffer is still full. Callers hold c.subsMu.
+func (c *Client) flushDropped(sub *logSubscription) bool {
+	if sub.dropped == 0 {
+		return true
+	}
+	msg := fmt.Appendf(nil, `{"type":"dropped","stream":"logs","subscription":%s,"count":%d}`, jsonString(sub.id), sub.dropped)
+	select {
+	case c.send <- msg:
+		sub.dropped = 0
+		return true
+	default:
+		return false
+	}
+}
+
+// flushDroppedNotices reports pending drops on idle subscriptions, so a
+// client learns about lost lines even when no further lines match.
+func (h *Hub) flushDroppedNotices() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		c.subsMu.Lock()
+		for _, sub := range c.logSubs {
+			c.flushDropped(sub)
+		}
+		c.subsMu.Unlock()
+	}
+}
+
+func jsonString(s string) []byte {
+	b, _ := json.Marshal(s)
+	return b
+}
+
+// PublishLog delivers a log to live-tail subscribers via the global hub.
+func PublishLog(l *models.Log) {
+	if globalHub == nil {
+		return
+	}
+	globalHub.PublishLog(l)
+}
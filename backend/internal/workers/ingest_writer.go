@@ -0,0 +1,192 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/sakkurohilla/kineticops/backend/internal/logging"
+	"github.com/sakkurohilla/kineticops/backend/internal/models"
+	"github.com/sakkurohilla/kineticops/backend/internal/repository/postgres"
+	"github.com/segmentio/kafka-go"
+)
+
+// ErrIngestRetry marks handler errors caused by storage rather than by the
+// event: the event is held and replayed instead of being dropped.
+var ErrIngestRetry = errors.New("ingest write failed")
+
+// IngestSink writes consumed ingest events. Handle stores one event and may
+// buffer rows until Flush; when it returns ErrIngestRetry it must discard
+// whatever it buffered for that event. Flush writes the buffered rows and
+// keeps those it could not write, so it can simply be called again.
+type IngestSink interface {
+	Handle(value []byte) error
+	Flush() error
+}
+
+// StartIngestWriter consumes the ingest topic as part of groupID and writes
+// events to sink. Messages are fetched in batches of up to batchSize (or
+// whatever arrived within flushInterval); after the handled events are
+// flushed their offsets are committed. When an event fails with
+// ErrIngestRetry, the events before it are flushed and committed and the
+// batch is replayed from the failed event once the databases answer again,
+// so events are written at least once without rewriting the whole batch.
+// Running the server on more nodes scales writers up to the topic's
+// partition count.
+func StartIngestWriter(brokers []string, topic, groupID string, batchSize int, flushInterval time.Duration, sink IngestSink) {
+	go func() {
+		reachable := false
+		for !reachable {
+			for _, b := range brokers {
+				conn, err := net.DialTimeout("tcp", b, 2*time.Second)
+				if err == nil {
+					conn.Close()
+					reachable = true
+					break
+				}
+			}
+			if !reachable {
+				logging.Warnf("[INGEST] no reachable Redpanda brokers yet, retrying in 5s...")
+				time.Sleep(5 * time.Second)
+			}
+		}
+
+		r := kafka.NewReader(kafka.ReaderConfig{
+			Brokers:        brokers,
+			Topic:          topic,
+			GroupID:        groupID,
+			MinBytes:       1,
+			MaxBytes:       10e6,
+			CommitInterval: 0, // commit explicitly after each flush
+		})
+		defer r.Close()
+		logging.Infof("[INGEST] writer started for topic=%s group=%s", topic, groupID)
+
+		for {
+			batch := fetchIngestBatch(r, batchSize, flushInterval)
+			backoff := time.Second
+			for len(batch) > 0 {
+				waitForDatabase()
+				handled, dropped := writeIngestEvents(sink, batch)
+				flushIngestSink(sink)
+				commitIngest(r, batch[:handled])
+				if dropped > 0 {
+					logging.Infof("[INGEST] wrote %d events (%d dropped)", handled-dropped, dropped)
+				}
+
+				batch = batch[handled:]
+				if len(batch) > 0 {
+					logging.Warnf("[INGEST] %d events not written, replaying in %s", len(batch), backoff)
+					time.Sleep(backoff)
+					if backoff < 30*time.Second {
+						backoff *= 2
+					}
+				}
+			}
+		}
+	}()
+}
+
+// writeIngestEvents hands the batch to sink in order and stops at the first
+// event that failed with ErrIngestRetry. It returns how many events were
+// handled (written or dropped) and how many of those were dropped.
+func writeIngestEvents(sink IngestSink, batch []kafka.Message) (handled, dropped int) {
+	for _, m := range batch {
+		err := sink.Handle(m.Value)
+		if errors.Is(err, ErrIngestRetry) {
+			logging.Errorf("[INGEST] write failed partition=%d offset=%d: %v", m.Partition, m.Offset, err)
+			return handled, dropped
+		}
+		if err != nil {
+			// malformed events cannot succeed on retry; skip them
+			dropped++
+			logging.Warnf("[INGEST] dropping event partition=%d offset=%d: %v", m.Partition, m.Offset, err)
+		}
+		handled++
+	}
+	return handled, dropped
+}
+
+// flushIngestSink retries Flush until the buffered rows are written; the
+// offsets of the events they belong to are committed only afterwards.
+func flushIngestSink(sink IngestSink) {
+	backoff := time.Second
+	for {
+		err := sink.Flush()
+		if err == nil {
+			return
+		}
+		logging.Errorf("[INGEST] flush failed, retrying in %s: %v", backoff, err)
+		time.Sleep(backoff)
+		waitForDatabase()
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+func commitIngest(r *kafka.Reader, msgs []kafka.Message) {
+	if len(msgs) == 0 {
+		return
+	}
+	for {
+		if err := r.CommitMessages(context.Background(), msgs...); err != nil {
+			logging.Warnf("[INGEST] commit failed, retrying: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		return
+	}
+}
+
+// fetchIngestBatch blocks for the first message, then collects more until
+// the batch is full or flushInterval has passed.
+func fetchIngestBatch(r *kafka.Reader, batchSize int, flushInterval time.Duration) []kafka.Message {
+	first, err := r.FetchMessage(context.Background())
+	if err != nil {
+		logging.Warnf("[INGEST] fetch error: %v", err)
+		time.Sleep(time.Second)
+		return nil
+	}
+	batch := []kafka.Message{first}
+
+	ctx, cancel := context.WithTimeout(context.Background(), flushInterval)
+	defer cancel()
+	for len(batch) < batchSize {
+		m, err := r.FetchMessage(ctx)
+		if err != nil {
+			break
+		}
+		batch = append(batch, m)
+	}
+	return batch
+}
+
+// waitForDatabase blocks until Postgres and, when logs are stored, MongoDB
+// answer a ping, backing off up to 30s.
+func waitForDatabase() {
+	backoff := time.Second
+	for !databaseReachable() {
+		logging.Warnf("[INGEST] database unavailable, holding batch (retry in %s)", backoff)
+		time.Sleep(backoff)
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+func databaseReachable() bool {
+	if postgres.SqlxDB == nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if postgres.SqlxDB.PingContext(ctx) != nil {
+		return false
+	}
+	if logs := models.LogCollection; logs != nil {
+		return logs.Database().Client().Ping(ctx, nil) == nil
+	}
+	return true
+}
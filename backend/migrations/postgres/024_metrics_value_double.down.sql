@@ -0,0 +1,3 @@
+-- Restore the original metrics.value precision (values above 999999.9999 will fail)
+ALTER TABLE metrics
+ALTER COLUMN value TYPE DECIMAL(10,4);
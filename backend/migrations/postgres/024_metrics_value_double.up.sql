@@ -0,0 +1,5 @@
+-- Widen metrics.value so externally ingested series (Prometheus remote_write,
+-- Influx line protocol) with large counters or high precision fit.
+-- DECIMAL(10,4) overflows above 999999.9999.
+ALTER TABLE metrics
+ALTER COLUMN value TYPE DOUBLE PRECISION;
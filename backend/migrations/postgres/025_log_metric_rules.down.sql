@@ -0,0 +1 @@
+DROP TABLE IF EXISTS log_metric_rules;
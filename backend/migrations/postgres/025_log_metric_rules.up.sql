@@ -0,0 +1,19 @@
+-- Tenant-defined rules that derive metrics from ingested logs (counts of
+-- matching lines or distributions of a numeric field), grouped by log fields.
+CREATE TABLE IF NOT EXISTS log_metric_rules (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL,
+    name VARCHAR(128) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    query TEXT NOT NULL DEFAULT '',
+    type VARCHAR(16) NOT NULL DEFAULT 'counter',
+    value_field VARCHAR(128) NOT NULL DEFAULT '',
+    value_pattern TEXT NOT NULL DEFAULT '',
+    group_by TEXT NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_log_metric_rules_tenant ON log_metric_rules (tenant_id);
@@ -0,0 +1,17 @@
+-- Delivery log of alert notifications: one row per incident, channel and
+-- lifecycle event (trigger, acknowledge, resolve) with the outcome.
+CREATE TABLE IF NOT EXISTS alert_notification_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL,
+    incident_id BIGINT NOT NULL,
+    channel_id BIGINT NOT NULL,
+    channel_type VARCHAR(32) NOT NULL,
+    event VARCHAR(16) NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_notification_deliveries_incident ON alert_notification_deliveries (tenant_id, incident_id);
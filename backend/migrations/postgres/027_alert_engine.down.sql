@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS alert_incidents;
+DROP TABLE IF EXISTS alert_policy_channels;
+DROP TABLE IF EXISTS alert_policy_conditions;
+DROP TABLE IF EXISTS alert_policies;
+DROP TABLE IF EXISTS alert_channels;
+DROP TABLE IF EXISTS alert_conditions;
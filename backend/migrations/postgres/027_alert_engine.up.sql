@@ -0,0 +1,164 @@
+-- Alert engine: conditions are evaluated on a schedule, policies own
+-- conditions and notification channels (many-to-many) and incidents are
+-- opened per policy and condition.
+CREATE TABLE IF NOT EXISTS alert_conditions (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    query TEXT NOT NULL,
+    threshold DOUBLE PRECISION NOT NULL DEFAULT 0,
+    operator VARCHAR(32) NOT NULL DEFAULT 'above',
+    duration INTEGER NOT NULL DEFAULT 0,
+    severity VARCHAR(16) NOT NULL DEFAULT 'medium',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    legacy_rule_id BIGINT UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS alert_channels (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    type VARCHAR(32) NOT NULL,
+    config TEXT NOT NULL DEFAULT '{}',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS alert_policies (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS alert_policy_conditions (
+    policy_id BIGINT NOT NULL REFERENCES alert_policies(id) ON DELETE CASCADE,
+    condition_id BIGINT NOT NULL REFERENCES alert_conditions(id) ON DELETE CASCADE,
+    PRIMARY KEY (policy_id, condition_id)
+);
+
+CREATE TABLE IF NOT EXISTS alert_policy_channels (
+    policy_id BIGINT NOT NULL REFERENCES alert_policies(id) ON DELETE CASCADE,
+    channel_id BIGINT NOT NULL REFERENCES alert_channels(id) ON DELETE CASCADE,
+    PRIMARY KEY (policy_id, channel_id)
+);
+
+CREATE TABLE IF NOT EXISTS alert_incidents (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL,
+    policy_id BIGINT NOT NULL,
+    condition_id BIGINT NOT NULL,
+    title VARCHAR(512) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    status VARCHAR(16) NOT NULL DEFAULT 'open',
+    severity VARCHAR(16) NOT NULL DEFAULT 'medium',
+    opened_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    closed_at TIMESTAMPTZ,
+    acked_at TIMESTAMPTZ,
+    acked_by VARCHAR(255) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_conditions_tenant ON alert_conditions (tenant_id);
+CREATE INDEX IF NOT EXISTS idx_alert_channels_tenant ON alert_channels (tenant_id);
+CREATE INDEX IF NOT EXISTS idx_alert_policies_tenant ON alert_policies (tenant_id);
+CREATE INDEX IF NOT EXISTS idx_alert_policy_conditions_condition ON alert_policy_conditions (condition_id);
+CREATE INDEX IF NOT EXISTS idx_alert_policy_channels_channel ON alert_policy_channels (channel_id);
+CREATE INDEX IF NOT EXISTS idx_alert_incidents_tenant_status ON alert_incidents (tenant_id, status, opened_at DESC);
+CREATE INDEX IF NOT EXISTS idx_alert_incidents_condition ON alert_incidents (condition_id, policy_id) WHERE status <> 'closed';
+
+-- Convert alert_rules into conditions of a per-tenant "Legacy alert rules"
+-- policy. Rules are read through to_jsonb so both the 002 columns
+-- (evaluation_window, severity, status) and the older model columns
+-- (window, notification_webhook) are picked up when present. A rule on
+-- metric m with operator > becomes "SELECT max('m') FROM metrics FACET
+-- host SINCE <window> minutes ago" compared above the threshold, so each
+-- host breaches on its own as the per-host rule evaluation did; a rule
+-- bound to hosts (host_filters holding a JSON array of ids) also gets
+-- "WHERE host_id IN (...)". A rule firing on its n-th breach in a row
+-- (consecutive_breaches, or frequency) is pending for n-1 minutes, one
+-- evaluation per minute. Converted rules are tracked by legacy_rule_id, so
+-- re-running converts only new rules.
+DO $$
+BEGIN
+    IF to_regclass('alert_rules') IS NULL THEN
+        RETURN;
+    END IF;
+
+    CREATE TEMP TABLE legacy_rules ON COMMIT DROP AS
+    SELECT
+        (j->>'id')::BIGINT AS id,
+        (j->>'tenant_id')::BIGINT AS tenant_id,
+        j->>'metric_name' AS metric,
+        COALESCE(j->>'operator', '>') AS op,
+        COALESCE((j->>'threshold')::DOUBLE PRECISION, 0) AS threshold,
+        GREATEST(1, COALESCE(NULLIF((j->>'evaluation_window')::INTEGER, 0) / 60, NULLIF((j->>'window')::INTEGER, 0), 5)) AS window_minutes,
+        GREATEST(0, COALESCE(NULLIF((j->>'consecutive_breaches')::INTEGER, 0), NULLIF((j->>'frequency')::INTEGER, 0), 1) - 1) AS pending_minutes,
+        NULLIF(j->>'name', '') AS name,
+        COALESCE(j->>'description', '') AS description,
+        CASE WHEN lower(j->>'severity') IN ('critical', 'high', 'medium', 'low') THEN lower(j->>'severity') ELSE 'medium' END AS severity,
+        COALESCE(j->>'status', 'ACTIVE') = 'ACTIVE' AS enabled,
+        NULLIF(j->>'notification_webhook', '') AS webhook,
+        CASE WHEN j->>'host_filters' ~ '^\s*\[\s*\d+(\s*,\s*\d+)*\s*\]\s*$'
+            THEN replace(regexp_replace(j->>'host_filters', '[\[\]\s]', '', 'g'), ',', ', ')
+        END AS host_ids
+    FROM (SELECT to_jsonb(r) AS j FROM alert_rules r) rules
+    WHERE COALESCE(j->>'operator', '>') IN ('>', '>=', '<', '<=', '==', '!=')
+      AND COALESCE(j->>'metric_name', '') <> ''
+      AND NOT EXISTS (SELECT 1 FROM alert_conditions c WHERE c.legacy_rule_id = (j->>'id')::BIGINT);
+
+    INSERT INTO alert_policies (tenant_id, name, description)
+    SELECT DISTINCT l.tenant_id, 'Legacy alert rules', 'Conditions converted from alert rules'
+    FROM legacy_rules l
+    WHERE NOT EXISTS (SELECT 1 FROM alert_policies p WHERE p.tenant_id = l.tenant_id AND p.name = 'Legacy alert rules');
+
+    INSERT INTO alert_conditions (tenant_id, name, description, query, threshold, operator, duration, severity, enabled, legacy_rule_id)
+    SELECT
+        l.tenant_id,
+        COALESCE(l.name, l.metric || ' ' || l.op || ' ' || l.threshold),
+        l.description,
+        format('SELECT %s(''%s'') FROM metrics%s FACET host SINCE %s minutes ago',
+            CASE WHEN l.op IN ('>', '>=') THEN 'max' WHEN l.op IN ('<', '<=') THEN 'min' ELSE 'latest' END,
+            replace(l.metric, '''', ''''''),
+            COALESCE(' WHERE host_id IN (' || l.host_ids || ')', ''),
+            l.window_minutes),
+        l.threshold,
+        CASE l.op
+            WHEN '>' THEN 'above' WHEN '>=' THEN 'above_or_equals'
+            WHEN '<' THEN 'below' WHEN '<=' THEN 'below_or_equals'
+            WHEN '==' THEN 'equals' ELSE 'not_equals'
+        END,
+        l.pending_minutes,
+        l.severity,
+        l.enabled,
+        l.id
+    FROM legacy_rules l;
+
+    INSERT INTO alert_policy_conditions (policy_id, condition_id)
+    SELECT p.id, c.id
+    FROM legacy_rules l
+    JOIN alert_conditions c ON c.legacy_rule_id = l.id
+    JOIN alert_policies p ON p.tenant_id = l.tenant_id AND p.name = 'Legacy alert rules'
+    ON CONFLICT DO NOTHING;
+
+    -- Rule webhooks become webhook channels of the policy
+    INSERT INTO alert_channels (tenant_id, name, type, config)
+    SELECT DISTINCT l.tenant_id, 'Webhook ' || l.webhook, 'webhook', json_build_object('url', l.webhook)::TEXT
+    FROM legacy_rules l
+    WHERE l.webhook IS NOT NULL
+      AND NOT EXISTS (SELECT 1 FROM alert_channels ch WHERE ch.tenant_id = l.tenant_id AND ch.type = 'webhook' AND ch.name = 'Webhook ' || l.webhook);
+
+    INSERT INTO alert_policy_channels (policy_id, channel_id)
+    SELECT DISTINCT p.id, ch.id
+    FROM legacy_rules l
+    JOIN alert_policies p ON p.tenant_id = l.tenant_id AND p.name = 'Legacy alert rules'
+    JOIN alert_channels ch ON ch.tenant_id = l.tenant_id AND ch.type = 'webhook' AND ch.name = 'Webhook ' || l.webhook
+    WHERE l.webhook IS NOT NULL
+    ON CONFLICT DO NOTHING;
+END $$;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS alert_state_transitions;
+DROP TABLE IF EXISTS alert_series_states;
+DROP INDEX IF EXISTS idx_alert_incidents_condition;
+CREATE INDEX IF NOT EXISTS idx_alert_incidents_condition ON alert_incidents (condition_id, policy_id) WHERE status <> 'closed';
+ALTER TABLE alert_incidents DROP COLUMN IF EXISTS series_key;
+ALTER TABLE alert_conditions DROP COLUMN IF EXISTS recovery_duration;
@@ -0,0 +1,35 @@
+-- Alert state machine: per-series state of each condition (ok, pending,
+-- firing, recovering, resolved) with flap history, and the log of state
+-- transitions. Incidents are opened per series.
+ALTER TABLE alert_conditions ADD COLUMN IF NOT EXISTS recovery_duration INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE alert_incidents ADD COLUMN IF NOT EXISTS series_key TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS alert_series_states (
+    condition_id BIGINT NOT NULL REFERENCES alert_conditions(id) ON DELETE CASCADE,
+    series_key TEXT NOT NULL,
+    tenant_id BIGINT NOT NULL,
+    state VARCHAR(16) NOT NULL,
+    value DOUBLE PRECISION NOT NULL DEFAULT 0,
+    state_since TIMESTAMPTZ NOT NULL,
+    history BIGINT NOT NULL DEFAULT 0,
+    flapping BOOLEAN NOT NULL DEFAULT FALSE,
+    evaluated_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (condition_id, series_key)
+);
+
+CREATE TABLE IF NOT EXISTS alert_state_transitions (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL,
+    condition_id BIGINT NOT NULL,
+    series_key TEXT NOT NULL,
+    from_state VARCHAR(16) NOT NULL,
+    to_state VARCHAR(16) NOT NULL,
+    value DOUBLE PRECISION NOT NULL DEFAULT 0,
+    flapping BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_state_transitions_condition ON alert_state_transitions (condition_id, created_at DESC);
+
+DROP INDEX IF EXISTS idx_alert_incidents_condition;
+CREATE INDEX IF NOT EXISTS idx_alert_incidents_condition ON alert_incidents (condition_id, policy_id, series_key) WHERE status <> 'closed';
@@ -0,0 +1,7 @@
+ALTER TABLE alert_notification_deliveries DROP COLUMN IF EXISTS escalation_level;
+DROP INDEX IF EXISTS idx_alert_incidents_escalation;
+ALTER TABLE alert_incidents DROP COLUMN IF EXISTS next_escalation_at;
+ALTER TABLE alert_incidents DROP COLUMN IF EXISTS escalation_repeat;
+ALTER TABLE alert_incidents DROP COLUMN IF EXISTS escalation_level;
+ALTER TABLE alert_policies DROP COLUMN IF EXISTS escalation_policy_id;
+DROP TABLE IF EXISTS alert_escalation_policies;
@@ -0,0 +1,28 @@
+-- Escalation policies: timed tiers of channels and users notified while an
+-- incident stays unacknowledged. Progress is kept on the incident so
+-- escalations survive restarts.
+CREATE TABLE IF NOT EXISTS alert_escalation_policies (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    tiers TEXT NOT NULL DEFAULT '[]',
+    repeat_interval INTEGER NOT NULL DEFAULT 0,
+    max_repeats INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_escalation_policies_tenant ON alert_escalation_policies (tenant_id);
+
+ALTER TABLE alert_policies ADD COLUMN IF NOT EXISTS escalation_policy_id BIGINT
+    REFERENCES alert_escalation_policies(id) ON DELETE SET NULL;
+
+ALTER TABLE alert_incidents ADD COLUMN IF NOT EXISTS escalation_level INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE alert_incidents ADD COLUMN IF NOT EXISTS escalation_repeat INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE alert_incidents ADD COLUMN IF NOT EXISTS next_escalation_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_alert_incidents_escalation ON alert_incidents (next_escalation_at)
+    WHERE status = 'open' AND next_escalation_at IS NOT NULL;
+
+ALTER TABLE alert_notification_deliveries ADD COLUMN IF NOT EXISTS escalation_level INTEGER NOT NULL DEFAULT 0;
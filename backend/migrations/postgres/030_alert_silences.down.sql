@@ -0,0 +1,3 @@
+ALTER TABLE alert_incidents DROP COLUMN IF EXISTS suppressed_by;
+DROP TABLE IF EXISTS alert_maintenance_windows;
+DROP TABLE IF EXISTS alert_silences;
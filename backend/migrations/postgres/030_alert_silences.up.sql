@@ -0,0 +1,34 @@
+-- Silences and recurring maintenance windows. Incidents they match are
+-- opened with suppressed_by set and are not notified.
+CREATE TABLE IF NOT EXISTS alert_silences (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL,
+    matchers TEXT NOT NULL DEFAULT '[]',
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    created_by VARCHAR(255) NOT NULL DEFAULT '',
+    comment TEXT NOT NULL DEFAULT '',
+    suppressed_count BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_silences_tenant_ends ON alert_silences (tenant_id, ends_at);
+
+CREATE TABLE IF NOT EXISTS alert_maintenance_windows (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    host_group VARCHAR(255) NOT NULL,
+    schedule VARCHAR(255) NOT NULL,
+    duration INTEGER NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    suppressed_count BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_maintenance_windows_tenant ON alert_maintenance_windows (tenant_id);
+
+ALTER TABLE alert_incidents ADD COLUMN IF NOT EXISTS suppressed_by VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+ALTER TABLE alert_notification_deliveries DROP COLUMN IF EXISTS group_id;
+DROP TABLE IF EXISTS alert_notification_group_incidents;
+DROP TABLE IF EXISTS alert_notification_groups;
+DROP TABLE IF EXISTS alert_routing_trees;
@@ -0,0 +1,33 @@
+-- Routing trees and notification groups: incidents of tenants with a
+-- routing tree are batched per route and group_by labels and sent as one
+-- message per group.
+CREATE TABLE IF NOT EXISTS alert_routing_trees (
+    tenant_id BIGINT PRIMARY KEY,
+    root TEXT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS alert_notification_groups (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL,
+    route_path VARCHAR(64) NOT NULL DEFAULT '',
+    group_key TEXT NOT NULL DEFAULT '',
+    channel_ids TEXT NOT NULL DEFAULT '[]',
+    group_interval INTEGER NOT NULL,
+    repeat_interval INTEGER NOT NULL,
+    next_flush_at TIMESTAMPTZ NOT NULL,
+    last_flush_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, route_path, group_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_notification_groups_flush ON alert_notification_groups (next_flush_at);
+
+CREATE TABLE IF NOT EXISTS alert_notification_group_incidents (
+    group_id BIGINT NOT NULL REFERENCES alert_notification_groups(id) ON DELETE CASCADE,
+    incident_id BIGINT NOT NULL REFERENCES alert_incidents(id) ON DELETE CASCADE,
+    notified VARCHAR(16) NOT NULL DEFAULT '',
+    PRIMARY KEY (group_id, incident_id)
+);
+
+ALTER TABLE alert_notification_deliveries ADD COLUMN IF NOT EXISTS group_id BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+ALTER TABLE alert_conditions DROP COLUMN IF EXISTS seasonality;
+ALTER TABLE alert_conditions DROP COLUMN IF EXISTS direction;
+ALTER TABLE alert_conditions DROP COLUMN IF EXISTS sensitivity;
+ALTER TABLE alert_conditions DROP COLUMN IF EXISTS type;
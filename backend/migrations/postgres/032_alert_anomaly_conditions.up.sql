@@ -0,0 +1,6 @@
+-- Condition types: threshold (the default) and anomaly, which compares each
+-- series with a seasonal baseline of its own history.
+ALTER TABLE alert_conditions ADD COLUMN IF NOT EXISTS type VARCHAR(32) NOT NULL DEFAULT 'threshold';
+ALTER TABLE alert_conditions ADD COLUMN IF NOT EXISTS sensitivity DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE alert_conditions ADD COLUMN IF NOT EXISTS direction VARCHAR(8) NOT NULL DEFAULT '';
+ALTER TABLE alert_conditions ADD COLUMN IF NOT EXISTS seasonality VARCHAR(16) NOT NULL DEFAULT '';
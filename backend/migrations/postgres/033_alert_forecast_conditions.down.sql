@@ -0,0 +1,2 @@
+ALTER TABLE alert_conditions DROP COLUMN IF EXISTS forecast_method;
+ALTER TABLE alert_conditions DROP COLUMN IF EXISTS horizon;
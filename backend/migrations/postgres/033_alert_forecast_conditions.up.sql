@@ -0,0 +1,4 @@
+-- Forecast conditions fire when a series is predicted to cross the
+-- threshold within horizon minutes.
+ALTER TABLE alert_conditions ADD COLUMN IF NOT EXISTS horizon INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE alert_conditions ADD COLUMN IF NOT EXISTS forecast_method VARCHAR(16) NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+ALTER TABLE alert_conditions DROP COLUMN IF EXISTS timeout;
+ALTER TABLE alert_conditions DROP COLUMN IF EXISTS host_group;
+ALTER TABLE alert_conditions DROP COLUMN IF EXISTS host_id;
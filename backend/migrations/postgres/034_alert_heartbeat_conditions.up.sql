@@ -0,0 +1,5 @@
+-- Heartbeat conditions fire for hosts (one host, a host group or all hosts)
+-- that sent no data for timeout minutes.
+ALTER TABLE alert_conditions ADD COLUMN IF NOT EXISTS host_id BIGINT;
+ALTER TABLE alert_conditions ADD COLUMN IF NOT EXISTS host_group VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE alert_conditions ADD COLUMN IF NOT EXISTS timeout INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS alert_incident_links;
+ALTER TABLE alert_conditions DROP COLUMN IF EXISTS correlation;
+ALTER TABLE alert_conditions DROP COLUMN IF EXISTS expression;
@@ -0,0 +1,13 @@
+-- Composite conditions combine other conditions with a boolean expression
+-- over their ids, optionally per host or host group. Their incidents link
+-- to the child incidents that made them fire.
+ALTER TABLE alert_conditions ADD COLUMN IF NOT EXISTS expression TEXT NOT NULL DEFAULT '';
+ALTER TABLE alert_conditions ADD COLUMN IF NOT EXISTS correlation VARCHAR(8) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS alert_incident_links (
+    incident_id BIGINT NOT NULL REFERENCES alert_incidents(id) ON DELETE CASCADE,
+    related_incident_id BIGINT NOT NULL REFERENCES alert_incidents(id) ON DELETE CASCADE,
+    PRIMARY KEY (incident_id, related_incident_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_incident_links_related ON alert_incident_links(related_incident_id);
@@ -0,0 +1,32 @@
+-- Recreate the legacy rollups as the plain tables of the old downsampling
+-- worker. They come back empty and nothing maintains them; the continuous
+-- aggregate variant is not restored.
+CREATE TABLE IF NOT EXISTS metrics_5m (
+    id SERIAL PRIMARY KEY,
+    host_id INTEGER NOT NULL,
+    tenant_id INTEGER NOT NULL,
+    name VARCHAR(128) NOT NULL,
+    value DECIMAL(10,4) NOT NULL,
+    timestamp TIMESTAMP NOT NULL,
+    UNIQUE(host_id, name, timestamp)
+);
+
+CREATE TABLE IF NOT EXISTS metrics_1h (
+    id SERIAL PRIMARY KEY,
+    host_id INTEGER NOT NULL,
+    tenant_id INTEGER NOT NULL,
+    name VARCHAR(128) NOT NULL,
+    value DECIMAL(10,4) NOT NULL,
+    timestamp TIMESTAMP NOT NULL,
+    UNIQUE(host_id, name, timestamp)
+);
+
+CREATE TABLE IF NOT EXISTS metrics_1d (
+    id SERIAL PRIMARY KEY,
+    host_id INTEGER NOT NULL,
+    tenant_id INTEGER NOT NULL,
+    name VARCHAR(128) NOT NULL,
+    value DECIMAL(10,4) NOT NULL,
+    timestamp TIMESTAMP NOT NULL,
+    UNIQUE(host_id, name, timestamp)
+);
@@ -0,0 +1,20 @@
+-- Drop the metrics_5m/1h/1d rollups of the old downsampling worker (plain
+-- tables) and of the early TimescaleDB setup (continuous aggregates). Both
+-- are superseded by the metrics_rollup_* levels maintained by the backend.
+DO $$
+DECLARE
+    r RECORD;
+BEGIN
+    FOR r IN
+        SELECT relname, relkind::text AS kind FROM pg_class
+        WHERE relnamespace = 'public'::regnamespace
+          AND relname IN ('metrics_5m', 'metrics_1h', 'metrics_1d')
+    LOOP
+        IF r.kind = 'r' THEN
+            EXECUTE format('DROP TABLE IF EXISTS %I', r.relname);
+        ELSIF r.kind = 'v' AND EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb') THEN
+            EXECUTE format('DROP MATERIALIZED VIEW IF EXISTS %I', r.relname);
+        END IF;
+    END LOOP;
+END
+$$;
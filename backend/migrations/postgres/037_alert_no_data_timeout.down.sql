@@ -0,0 +1 @@
+ALTER TABLE alert_conditions DROP COLUMN IF EXISTS no_data_timeout;
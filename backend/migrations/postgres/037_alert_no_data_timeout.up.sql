@@ -0,0 +1,3 @@
+-- Firing series that stop reporting are resolved after no_data_timeout
+-- minutes without data (0 uses the engine default).
+ALTER TABLE alert_conditions ADD COLUMN IF NOT EXISTS no_data_timeout INTEGER NOT NULL DEFAULT 0;
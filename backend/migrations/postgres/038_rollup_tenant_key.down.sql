@@ -0,0 +1,19 @@
+-- Restore the (host_id, name, bucket) key of the plain-table rollups. Rows
+-- that only differ by tenant would violate it, so the tables are emptied and
+-- RollupService backfills recent buckets on its next run.
+DO $$
+DECLARE
+    r RECORD;
+BEGIN
+    FOR r IN
+        SELECT relname FROM pg_class
+        WHERE relnamespace = 'public'::regnamespace
+          AND relkind = 'r'
+          AND relname IN ('metrics_rollup_5m', 'metrics_rollup_1h', 'metrics_rollup_1d')
+    LOOP
+        EXECUTE format('TRUNCATE %I', r.relname);
+        EXECUTE format('ALTER TABLE %I DROP CONSTRAINT IF EXISTS %I', r.relname, r.relname || '_pkey');
+        EXECUTE format('ALTER TABLE %I ADD PRIMARY KEY (host_id, name, bucket)', r.relname);
+    END LOOP;
+END
+$$;
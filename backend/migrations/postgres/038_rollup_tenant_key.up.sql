@@ -0,0 +1,19 @@
+-- Key the plain-table rollups by tenant as well, so the rows of two tenants
+-- can never be merged into one bucket. Continuous aggregates (TimescaleDB)
+-- have no primary key and are left alone; fresh installs get the new key
+-- from RollupService.
+DO $$
+DECLARE
+    r RECORD;
+BEGIN
+    FOR r IN
+        SELECT relname FROM pg_class
+        WHERE relnamespace = 'public'::regnamespace
+          AND relkind = 'r'
+          AND relname IN ('metrics_rollup_5m', 'metrics_rollup_1h', 'metrics_rollup_1d')
+    LOOP
+        EXECUTE format('ALTER TABLE %I DROP CONSTRAINT IF EXISTS %I', r.relname, r.relname || '_pkey');
+        EXECUTE format('ALTER TABLE %I ADD PRIMARY KEY (tenant_id, host_id, name, bucket)', r.relname);
+    END LOOP;
+END
+$$;
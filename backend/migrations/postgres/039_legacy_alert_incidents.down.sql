@@ -0,0 +1,2 @@
+DELETE FROM alert_incidents WHERE legacy_alert_id IS NOT NULL;
+ALTER TABLE alert_incidents DROP COLUMN IF EXISTS legacy_alert_id;
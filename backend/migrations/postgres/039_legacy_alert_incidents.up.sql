@@ -0,0 +1,44 @@
+-- Copy the rows of the pre-engine alerts table into alert_incidents: the
+-- alert scheduler that wrote them is gone and GET /api/v1/alerts now lists
+-- incidents only. An alert of a converted rule is attached to the rule's
+-- condition in the "Legacy alert rules" policy (see 027); other alerts get
+-- policy and condition 0. Rows are read through to_jsonb so both the 001 and
+-- the 002 alerts columns are picked up. Copies carry no escalation, so
+-- nothing is notified again; legacy_alert_id marks them, so re-running
+-- copies only new rows.
+ALTER TABLE alert_incidents ADD COLUMN IF NOT EXISTS legacy_alert_id BIGINT UNIQUE;
+
+DO $$
+BEGIN
+    IF to_regclass('alerts') IS NULL THEN
+        RETURN;
+    END IF;
+
+    INSERT INTO alert_incidents (tenant_id, policy_id, condition_id, series_key, title, description,
+        status, severity, opened_at, closed_at, acked_at, acked_by, legacy_alert_id)
+    SELECT
+        (j->>'tenant_id')::BIGINT,
+        CASE WHEN c.id IS NULL THEN 0 ELSE COALESCE(p.id, 0) END,
+        COALESCE(c.id, 0),
+        COALESCE('host=' || h.hostname, 'host_id=' || (j->>'host_id'), ''),
+        left(COALESCE(NULLIF(j->>'title', ''), NULLIF(j->>'message', ''), NULLIF(j->>'metric_name', '') || ' alert', 'Alert'), 512),
+        COALESCE(j->>'description', ''),
+        CASE upper(COALESCE(j->>'status', 'OPEN'))
+            WHEN 'ACKNOWLEDGED' THEN 'acknowledged'
+            WHEN 'RESOLVED' THEN 'closed'
+            WHEN 'CLOSED' THEN 'closed'
+            ELSE 'open'
+        END,
+        CASE WHEN lower(j->>'severity') IN ('critical', 'high', 'medium', 'low') THEN lower(j->>'severity') ELSE 'medium' END,
+        COALESCE((j->>'triggered_at')::TIMESTAMPTZ, (j->>'created_at')::TIMESTAMPTZ, NOW()),
+        COALESCE((j->>'resolved_at')::TIMESTAMPTZ, (j->>'closed_at')::TIMESTAMPTZ,
+            CASE WHEN upper(COALESCE(j->>'status', '')) IN ('RESOLVED', 'CLOSED') THEN NOW() END),
+        (j->>'acknowledged_at')::TIMESTAMPTZ,
+        COALESCE(j->>'acknowledged_by', ''),
+        (j->>'id')::BIGINT
+    FROM (SELECT to_jsonb(a) AS j FROM alerts a) legacy
+    LEFT JOIN hosts h ON h.id = (j->>'host_id')::BIGINT
+    LEFT JOIN alert_conditions c ON c.legacy_rule_id = (j->>'rule_id')::BIGINT
+    LEFT JOIN alert_policies p ON p.tenant_id = (j->>'tenant_id')::BIGINT AND p.name = 'Legacy alert rules'
+    WHERE NOT EXISTS (SELECT 1 FROM alert_incidents i WHERE i.legacy_alert_id = (j->>'id')::BIGINT);
+END $$;
@@ -0,0 +1,2 @@
+ALTER TABLE alert_conditions DROP COLUMN IF EXISTS last_error_at;
+ALTER TABLE alert_conditions DROP COLUMN IF EXISTS last_error;
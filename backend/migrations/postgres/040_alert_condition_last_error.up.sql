@@ -0,0 +1,4 @@
+-- Why the latest evaluation of a condition failed (empty once it succeeds)
+-- and when, so conditions that stopped evaluating are visible.
+ALTER TABLE alert_conditions ADD COLUMN IF NOT EXISTS last_error TEXT NOT NULL DEFAULT '';
+ALTER TABLE alert_conditions ADD COLUMN IF NOT EXISTS last_error_at TIMESTAMPTZ;
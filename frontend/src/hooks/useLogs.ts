@@ -59,21 +59,39 @@ export const useLogs = (): UseLogsReturn => {
   useEffect(() => {
     if (!isTailing) return;
 
-    const { subscribe } = require('../services/ws/manager');
+    const { subscribe, publish, isAuthenticated } = require('../services/ws/manager');
+    // The server only streams logs matching a subscription, scoped to our tenant
+    const subscription = 'logs-tail';
+    const sendSubscribe = () =>
+      publish({
+        type: 'subscribe',
+        stream: 'logs',
+        id: subscription,
+        query: { level: filters.level, text: filters.search },
+      });
+
     const unsubscribe = subscribe((data: any) => {
-      if (data.type === 'log' && data.log) {
+      if (data.type === 'auth_ok') {
+        sendSubscribe(); // (re)subscribe after every (re)connect
+      } else if (data.type === 'log' && data.log && data.subscription === subscription) {
         setLogs(prev => [data.log, ...prev.slice(0, 999)]); // Keep last 1000 logs
+      } else if (data.type === 'dropped' && data.subscription === subscription) {
+        console.warn(`[useLogs] live tail dropped ${data.count} lines`);
       }
     });
+    if (isAuthenticated()) {
+      sendSubscribe();
+    }
 
     // Also refresh periodically as fallback
     const interval = setInterval(fetchLogs, 30000);
 
     return () => {
+      publish({ type: 'unsubscribe', id: subscription });
       unsubscribe();
       clearInterval(interval);
     };
-  }, [isTailing, fetchLogs]);
+  }, [isTailing, fetchLogs, filters.level, filters.search]);
 
   const toggleTailing = useCallback(() => {
     setIsTailing(prev => !prev);
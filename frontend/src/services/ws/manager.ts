@@ -12,6 +12,9 @@ let reconnectTimer: number | null = null;
 let visibilityHandler: (() => void) | null = null;
 let currentToken: string | null = null;
 let tokenCheckInterval: number | null = null;
+// set once the server acknowledged auth; control messages sent earlier
+// would be read as the auth message
+let authenticated = false;
 
 // Handle page visibility changes to reconnect when tab becomes visible
 function setupVisibilityHandler() {
@@ -133,7 +136,9 @@ function connect() {
       const parsed = JSON.parse(ev.data);
       // handle server auth_ok/auth_failed messages specially
       if (parsed && parsed.type === 'auth_ok') {
-        // authenticated; ignore message
+        // authenticated; let subscribers (re)send stream subscriptions
+        authenticated = true;
+        notifyAll(parsed);
         return;
       }
       if (parsed && parsed.type === 'auth_failed') {
@@ -149,6 +154,7 @@ function connect() {
 
   ws.onclose = (ev) => {
     ws = null;
+    authenticated = false;
     console.log('[wsManager] connection closed', ev.code, ev.reason);
     
     // Handle different close codes
@@ -206,8 +212,12 @@ export function getSubscriberCount() {
   return subscribers.size;
 }
 
+export function isAuthenticated() {
+  return authenticated;
+}
+
 export function publish(data: any) {
-  if (!ws) return false;
+  if (!ws || !authenticated) return false;
   try {
     ws.send(JSON.stringify(data));
     return true;
@@ -270,4 +280,4 @@ export function disconnect() {
   wsStatus.setWsStatus('disconnected');
 }
 
-export default { subscribe, publish, disconnect, getSubscriberCount };
+export default { subscribe, publish, disconnect, getSubscriberCount, isAuthenticated };